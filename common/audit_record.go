@@ -0,0 +1,46 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package common
+
+// AuditRecord is an append-only record of a northbound api call that changes the configs. The
+// versions are of the subdoc, the reference subdoc or the root document, by the call.
+type AuditRecord struct {
+	CpeMac       string   `json:"cpe_mac,omitempty"`
+	EventTime    int64    `json:"event_time"`
+	AuditId      string   `json:"audit_id"`
+	Action       string   `json:"action"`
+	SubdocId     string   `json:"subdoc_id,omitempty"`
+	RefId        string   `json:"ref_id,omitempty"`
+	Status       int      `json:"status"`
+	Subject      string   `json:"subject,omitempty"`
+	Kid          string   `json:"kid,omitempty"`
+	Capabilities []string `json:"capabilities,omitempty"`
+	SourceApp    string   `json:"source_app,omitempty"`
+	OldVersion   string   `json:"old_version,omitempty"`
+	NewVersion   string   `json:"new_version,omitempty"`
+	PayloadHash  string   `json:"payload_hash,omitempty"`
+}
+
+// AuditQuery filters the audit records by mac or subject, in [StartTime, EndTime) in ms
+type AuditQuery struct {
+	CpeMac    string
+	Subject   string
+	StartTime int64
+	EndTime   int64
+	Limit     int
+}
@@ -0,0 +1,174 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package common
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-akka/configuration"
+	"github.com/go-akka/configuration/hocon"
+)
+
+const redactedConfigMask = "****"
+
+// beyond the sensitive log keys, the config keys of files, hosts and users are masked too
+var sensitiveConfigKeyPatterns = []string{
+	"private_key",
+	"key_file",
+	"cert_file",
+	"ca_file",
+	"db_file",
+	"encryption_key",
+	"host",
+	"broker",
+	"url",
+	"endpoint",
+	"user",
+	"sasl",
+}
+
+// ConfigDiff is a config value that differs from the sample config
+type ConfigDiff struct {
+	Path   string      `json:"path"`
+	Value  interface{} `json:"value"`
+	Sample interface{} `json:"sample,omitempty"`
+}
+
+func IsSensitiveConfigKey(k string) bool {
+	if isSensitiveLogKey(k) {
+		return true
+	}
+	key := strings.ToLower(k)
+	for _, p := range sensitiveConfigKeyPatterns {
+		if strings.Contains(key, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactedConfig returns the config as nested maps. The strings and the lists under sensitive keys
+// are masked, the booleans and the numbers are kept.
+func RedactedConfig(conf *configuration.Config) map[string]interface{} {
+	root := conf.Root()
+	if root == nil || !root.IsObject() {
+		return map[string]interface{}{}
+	}
+	view, _ := redactedConfigValue(root, "").(map[string]interface{})
+	return view
+}
+
+func redactedConfigValue(v *hocon.HoconValue, key string) interface{} {
+	switch {
+	case v.IsObject():
+		view := map[string]interface{}{}
+		obj := v.GetObject()
+		for _, k := range obj.GetKeys() {
+			view[k] = redactedConfigValue(obj.GetKey(k), k)
+		}
+		return view
+	case v.IsArray():
+		if IsSensitiveConfigKey(key) {
+			return redactedConfigMask
+		}
+		values := []interface{}{}
+		for _, x := range v.GetArray() {
+			values = append(values, redactedConfigValue(x, key))
+		}
+		return values
+	}
+
+	value := configLiteral(v.GetString())
+	if _, ok := value.(string); ok && IsSensitiveConfigKey(key) {
+		return redactedConfigMask
+	}
+	return value
+}
+
+// configLiteral types the booleans and the numbers of a hocon literal
+func configLiteral(s string) interface{} {
+	if s == "true" || s == "false" {
+		return s == "true"
+	}
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return i
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f
+	}
+	return s
+}
+
+// DiffConfig lists the redacted values of conf that are not in the sample config or differ from
+// it, sorted by path
+func DiffConfig(conf *configuration.Config, sample *configuration.Config) []ConfigDiff {
+	values := map[string]interface{}{}
+	flattenConfigView(RedactedConfig(conf), "", values)
+	sampleValues := map[string]interface{}{}
+	flattenConfigView(RedactedConfig(sample), "", sampleValues)
+
+	diffs := []ConfigDiff{}
+	for path, value := range values {
+		sv, ok := sampleValues[path]
+		if ok && configValueEqual(value, sv) {
+			continue
+		}
+		diffs = append(diffs, ConfigDiff{
+			Path:   path,
+			Value:  value,
+			Sample: sv,
+		})
+	}
+	sort.Slice(diffs, func(i, j int) bool {
+		return diffs[i].Path < diffs[j].Path
+	})
+	return diffs
+}
+
+func flattenConfigView(view map[string]interface{}, prefix string, values map[string]interface{}) {
+	for k, v := range view {
+		path := k
+		if len(prefix) > 0 {
+			path = prefix + "." + k
+		}
+		if m, ok := v.(map[string]interface{}); ok {
+			flattenConfigView(m, path, values)
+			continue
+		}
+		values[path] = v
+	}
+}
+
+func configValueEqual(a, b interface{}) bool {
+	as, ok1 := a.([]interface{})
+	bs, ok2 := b.([]interface{})
+	if ok1 || ok2 {
+		if !ok1 || !ok2 || len(as) != len(bs) {
+			return false
+		}
+		for i := range as {
+			if !configValueEqual(as[i], bs[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
@@ -0,0 +1,93 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package common
+
+import (
+	"testing"
+
+	"github.com/go-akka/configuration"
+	"gotest.tools/assert"
+)
+
+func TestRedactedConfig(t *testing.T) {
+	conf := configuration.ParseString(`
+webconfig {
+    panic_exit_enabled = false
+    server {
+        port = 9000
+        read_timeout_in_secs = 2.5
+        key_file = "/tmp/server_key.pem"
+    }
+    database {
+        cassandra {
+            user = "cassandra"
+            encrypted_password = "xyz"
+            hosts = [
+                "127.0.0.1"
+            ]
+            keyspace = "xpc"
+        }
+    }
+}
+`)
+	view := RedactedConfig(conf)
+	webconfig := view["webconfig"].(map[string]interface{})
+	assert.Equal(t, webconfig["panic_exit_enabled"], false)
+
+	server := webconfig["server"].(map[string]interface{})
+	assert.Equal(t, server["port"], int64(9000))
+	assert.Equal(t, server["read_timeout_in_secs"], 2.5)
+	assert.Equal(t, server["key_file"], redactedConfigMask)
+
+	cassandra := webconfig["database"].(map[string]interface{})["cassandra"].(map[string]interface{})
+	assert.Equal(t, cassandra["user"], redactedConfigMask)
+	assert.Equal(t, cassandra["encrypted_password"], redactedConfigMask)
+	assert.Equal(t, cassandra["hosts"], redactedConfigMask)
+	assert.Equal(t, cassandra["keyspace"], "xpc")
+}
+
+func TestDiffConfig(t *testing.T) {
+	sample := configuration.ParseString(`
+webconfig {
+    server {
+        port = 9000
+        key_file = "/tmp/server_key.pem"
+    }
+    log.level = "debug"
+}
+`)
+	conf := configuration.ParseString(`
+webconfig {
+    server {
+        port = 8080
+        key_file = "/etc/webconfig/server_key.pem"
+    }
+    log.level = "debug"
+    audit.enabled = true
+}
+`)
+	diffs := DiffConfig(conf, sample)
+	expected := []ConfigDiff{
+		{Path: "webconfig.audit.enabled", Value: true},
+		{Path: "webconfig.server.port", Value: int64(8080), Sample: int64(9000)},
+	}
+	// the masked key_file looks the same on both sides
+	assert.DeepEqual(t, diffs, expected)
+
+	assert.Equal(t, len(DiffConfig(sample, sample)), 0)
+}
@@ -88,8 +88,12 @@ const (
 	HeaderSubdocumentErrorCode       = "X-Subdocument-Error-Code"
 	HeaderSubdocumentErrorDetails    = "X-Subdocument-Error-Details"
 	HeaderSubdocumentExpiry          = "X-Subdocument-Expiry"
+	HeaderSubdocumentEffectiveTime   = "X-Subdocument-Effective-Time"
+	HeaderOverrideDuration           = "X-Subdocument-Override-Duration"
+	HeaderSubdocumentRetryAttempts   = "X-Subdocument-Retry-Attempts"
 	HeaderSubdocumentOldState        = "X-Subdocument-Old-State"
 	HeaderSubdocumentMetricsAgent    = "X-Subdocument-Metrics-Agent"
+	HeaderSubdocumentSignature       = "X-Subdocument-Signature"
 	HeaderDeviceId                   = "Device-Id"
 	HeaderDocName                    = "Doc-Name"
 	HeaderUpstreamNewBitmap          = "X-Upstream-New-Bitmap"
@@ -123,6 +127,12 @@ const (
 	SkipDbUpdate = "skip-db-update"
 )
 
+const (
+	// error_code and error_details set on subdocs whose mqtt response was never acknowledged
+	MqttResponseTimeoutErrorCode = 901
+	MqttResponseTimeout          = "mqtt_response_timeout"
+)
+
 var (
 	SupportedPokeDocs   = []string{"primary", "telemetry", "root"}
 	SupportedPokeRoutes = []string{"mqtt"}
@@ -0,0 +1,94 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package common
+
+import "sort"
+
+const (
+	DeploymentGroupStaged = iota + 1
+	DeploymentGroupCommitted
+)
+
+// a group staged longer than this is left over by a writer that stopped before the
+// commit or the abort, its subdocs are not held back anymore
+const DeploymentGroupStagedTimeoutMillis = 5 * 60 * 1000
+
+// DeploymentGroup is a set of subdocs of a device committed together. The subdocs of a
+// staged group are held back from the device until the group is committed. SubdocIds
+// are in the delivery order, dependencies first.
+type DeploymentGroup struct {
+	CpeMac        string   `json:"cpe_mac"`
+	DeploymentId  string   `json:"deployment_id"`
+	SubdocIds     []string `json:"subdoc_ids"`
+	State         int      `json:"state"`
+	CreatedTime   int64    `json:"created_time"`
+	CommittedTime int64    `json:"committed_time,omitempty"`
+}
+
+func (g *DeploymentGroup) IsStaged() bool {
+	return g.State == DeploymentGroupStaged
+}
+
+// IsAbandoned tells if the group is still staged past the timeout at nowMs
+func (g *DeploymentGroup) IsAbandoned(nowMs int64) bool {
+	return g.IsStaged() && nowMs-g.CreatedTime > DeploymentGroupStagedTimeoutMillis
+}
+
+// FoldDeploymentGroups returns the subdocIds followed by the subdocs of the committed
+// groups not listed yet, the latest committed group first
+func FoldDeploymentGroups(subdocIds []string, groups []DeploymentGroup) []string {
+	committed := []DeploymentGroup{}
+	for _, g := range groups {
+		if !g.IsStaged() {
+			committed = append(committed, g)
+		}
+	}
+	sort.SliceStable(committed, func(i, j int) bool {
+		return committed[i].CommittedTime > committed[j].CommittedTime
+	})
+
+	folded := []string{}
+	seen := map[string]bool{}
+	add := func(ids []string) {
+		for _, subdocId := range ids {
+			if !seen[subdocId] {
+				seen[subdocId] = true
+				folded = append(folded, subdocId)
+			}
+		}
+	}
+	add(subdocIds)
+	for _, g := range committed {
+		add(g.SubdocIds)
+	}
+	return folded
+}
+
+// DeploymentGroupRequest is the json body to post a deployment group. The subdocs listed
+// in "order" go first in the multipart response.
+type DeploymentGroupRequest struct {
+	SubDocuments []DeploymentGroupSubDocument `json:"subdocs"`
+	Order        []string                     `json:"order,omitempty"`
+}
+
+type DeploymentGroupSubDocument struct {
+	SubdocId string  `json:"subdoc_id"`
+	Version  *string `json:"version,omitempty"`
+	Payload  []byte  `json:"payload"`
+	Expiry   *int    `json:"expiry,omitempty"`
+}
@@ -0,0 +1,31 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package common
+
+const (
+	DeviceEventRollback = "rollback"
+)
+
+// DeviceEvent is an entry of the history of a device
+type DeviceEvent struct {
+	CpeMac    string `json:"cpe_mac"`
+	EventTime int64  `json:"event_time"`
+	Event     string `json:"event"`
+	SubdocId  string `json:"subdoc_id,omitempty"`
+	Details   string `json:"details,omitempty"`
+}
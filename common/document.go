@@ -20,6 +20,7 @@ package common
 import (
 	"fmt"
 	"net/http"
+	"sort"
 	"strconv"
 	"time"
 
@@ -33,6 +34,7 @@ import (
 type Document struct {
 	docmap       map[string]SubDocument
 	rootDocument *RootDocument
+	order        []string
 }
 
 // TODO add support to support NewDocument([]common.Multipart)
@@ -78,6 +80,18 @@ func (d *Document) VersionMap() map[string]string {
 	return versionMap
 }
 
+// EffectiveVersionMap excludes the subdocs not effective yet at nowMs, so that the
+// root version changes again when they become effective
+func (d *Document) EffectiveVersionMap(nowMs int) map[string]string {
+	versionMap := map[string]string{}
+	for k, doc := range d.docmap {
+		if doc.Version() != nil && doc.IsEffective(nowMs) {
+			versionMap[k] = *doc.Version()
+		}
+	}
+	return versionMap
+}
+
 func (d *Document) StateMap() map[string]int {
 	stateMap := map[string]int{}
 	for k, doc := range d.docmap {
@@ -104,6 +118,69 @@ func (d *Document) GetRootDocument() *RootDocument {
 	return d.rootDocument
 }
 
+// SetOrder sets the subdocs listed first in the multipart, the rest follow
+func (d *Document) SetOrder(subdocIds []string) {
+	d.order = subdocIds
+}
+
+func (d *Document) Order() []string {
+	return d.order
+}
+
+// ApplyDeploymentGroups holds back the subdocs of the staged groups and orders the subdocs
+// of the committed groups, the latest committed group goes first. The groups abandoned
+// in the staged state at nowMs are ignored.
+func (d *Document) ApplyDeploymentGroups(groups []DeploymentGroup, nowMs int64) {
+	committed := []DeploymentGroup{}
+	for _, g := range groups {
+		if g.IsAbandoned(nowMs) {
+			continue
+		}
+		if g.IsStaged() {
+			for _, subdocId := range g.SubdocIds {
+				delete(d.docmap, subdocId)
+			}
+			continue
+		}
+		committed = append(committed, g)
+	}
+	sort.SliceStable(committed, func(i, j int) bool {
+		return committed[i].CommittedTime > committed[j].CommittedTime
+	})
+
+	order := []string{}
+	seen := map[string]bool{}
+	for _, g := range committed {
+		for _, subdocId := range g.SubdocIds {
+			if !seen[subdocId] {
+				seen[subdocId] = true
+				order = append(order, subdocId)
+			}
+		}
+	}
+	if len(order) > 0 {
+		d.order = order
+	}
+}
+
+// orderedSubdocIds lists the subdocs in the order first, then the others
+func (d *Document) orderedSubdocIds() []string {
+	subdocIds := []string{}
+	seen := map[string]bool{}
+	for _, subdocId := range d.order {
+		if _, ok := d.docmap[subdocId]; ok && !seen[subdocId] {
+			seen[subdocId] = true
+			subdocIds = append(subdocIds, subdocId)
+		}
+	}
+	for subdocId := range d.docmap {
+		if !seen[subdocId] {
+			subdocIds = append(subdocIds, subdocId)
+		}
+	}
+	return subdocIds
+}
+
 func (d *Document) RootVersion() string {
 	if d.rootDocument == nil {
 		return ""
@@ -112,12 +189,17 @@ func (d *Document) RootVersion() string {
 }
 
 // TODO
-// (1) for now we only filter by state
+// (1) for now we only filter by state and effective_time
 // (2) expiry check can be included to support blaster/command subdocs
 // (3) we can implement blockedSubdocIds if we want
 func (d *Document) FilterForMqttSend() *Document {
 	newdoc := NewDocument(d.GetRootDocument())
+	newdoc.SetOrder(d.order)
+	nowMs := int(time.Now().UnixMilli())
 	for subdocId, subDocument := range d.docmap {
+		if !subDocument.IsEffective(nowMs) {
+			continue
+		}
 		if subDocument.State() != nil {
 			state := *subDocument.State()
 			if state > Deployed {
@@ -130,6 +212,7 @@ func (d *Document) FilterForMqttSend() *Document {
 
 func (d *Document) FilterForGet(versionMap map[string]string) *Document {
 	newdoc := NewDocument(d.GetRootDocument())
+	newdoc.SetOrder(d.order)
 
 	deviceRootVersion := versionMap["root"]
 	if len(deviceRootVersion) > 0 {
@@ -138,7 +221,12 @@ func (d *Document) FilterForGet(versionMap map[string]string) *Document {
 		}
 	}
 
+	nowMs := int(time.Now().UnixMilli())
 	for subdocId, subDocument := range d.docmap {
+		// scheduled subdocs are held back until their effective_time
+		if !subDocument.IsEffective(nowMs) {
+			continue
+		}
 		if subDocument.Version() != nil {
 			deviceSubdocVersion := versionMap[subdocId]
 			version := *subDocument.Version()
@@ -150,14 +238,15 @@ func (d *Document) FilterForGet(versionMap map[string]string) *Document {
 	return newdoc
 }
 
-func (d *Document) Bytes() ([]byte, error) {
+func (d *Document) Bytes(signers ...PartSigner) ([]byte, error) {
 	if len(d.docmap) == 0 {
 		return nil, nil
 	}
 
 	// build the http stream
 	mparts := []Multipart{}
-	for subdocId, subdoc := range d.docmap {
+	for _, subdocId := range d.orderedSubdocIds() {
+		subdoc := d.docmap[subdocId]
 		mpart := Multipart{
 			Bytes:   subdoc.Payload(),
 			Version: *subdoc.Version(),
@@ -166,7 +255,7 @@ func (d *Document) Bytes() ([]byte, error) {
 		mparts = append(mparts, mpart)
 	}
 
-	bbytes, err := WriteMultipartBytes(mparts)
+	bbytes, err := WriteMultipartBytes(mparts, signers...)
 	if err != nil {
 		return nil, NewError(err)
 	}
@@ -174,10 +263,11 @@ func (d *Document) Bytes() ([]byte, error) {
 	return bbytes, nil
 }
 
-func (d *Document) HttpBytes(fields log.Fields) ([]byte, error) {
+func (d *Document) HttpBytes(fields log.Fields, signers ...PartSigner) ([]byte, error) {
 	// build the http stream
 	mparts := []Multipart{}
-	for subdocId, subdoc := range d.docmap {
+	for _, subdocId := range d.orderedSubdocIds() {
+		subdoc := d.docmap[subdocId]
 		mpart := Multipart{
 			Bytes:   subdoc.Payload(),
 			Version: *subdoc.Version(),
@@ -212,7 +302,7 @@ func (d *Document) HttpBytes(fields log.Fields) ([]byte, error) {
 	header.Set("X-Webpa-Transaction-Id", transactionId)
 	header.Set("X-Moneytrace", xmoney)
 
-	bbytes, err := WriteMultipartBytes(mparts)
+	bbytes, err := WriteMultipartBytes(mparts, signers...)
 	if err != nil {
 		return nil, NewError(err)
 	}
@@ -227,6 +317,7 @@ func (d *Document) FilterByBitmap(alwaysTrueSubdocIds ...string) *Document {
 	}
 
 	newdoc := NewDocument(rootdoc)
+	newdoc.SetOrder(d.order)
 	supportedMap := GetSupportedMap(rootdoc.Bitmap)
 	for _, sid := range alwaysTrueSubdocIds {
 		supportedMap[sid] = true
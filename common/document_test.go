@@ -118,3 +118,56 @@ func TestFilterByBitmap(t *testing.T) {
 	assert.Assert(t, filteredDocument != nil)
 	assert.Equal(t, len(filteredDocument.Items()), 5)
 }
+
+func TestFilterForGetEffectiveTime(t *testing.T) {
+	document := NewDocument(nil)
+	nowMs := int(time.Now().UnixMilli())
+	state := PendingDownload
+
+	lanVersion := "lan1"
+	lan := NewSubDocument(RandomBytes(10, 20), &lanVersion, &state, nil, nil, nil)
+	document.SetSubDocument("lan", lan)
+
+	wanVersion := "wan1"
+	wan := NewSubDocument(RandomBytes(10, 20), &wanVersion, &state, nil, nil, nil)
+	future := nowMs + 3600000
+	wan.SetEffectiveTime(&future)
+	document.SetSubDocument("wan", wan)
+
+	filteredDocument := document.FilterForGet(nil)
+	assert.Equal(t, len(filteredDocument.Items()), 1)
+	assert.Assert(t, filteredDocument.SubDocument("wan") == nil)
+	assert.Equal(t, len(document.FilterForMqttSend().Items()), 1)
+
+	assert.DeepEqual(t, document.EffectiveVersionMap(nowMs), map[string]string{"lan": "lan1"})
+	assert.Equal(t, len(document.EffectiveVersionMap(future)), 2)
+}
+
+func TestApplyDeploymentGroups(t *testing.T) {
+	document := NewDocument(nil)
+	state := PendingDownload
+	for _, subdocId := range []string{"lan", "wan", "mesh", "portforwarding", "macbinding"} {
+		version := subdocId + "1"
+		subdoc := NewSubDocument(RandomBytes(10, 20), &version, &state, nil, nil, nil)
+		document.SetSubDocument(subdocId, subdoc)
+	}
+
+	groups := []DeploymentGroup{
+		{DeploymentId: "g1", SubdocIds: []string{"wan", "lan"}, State: DeploymentGroupCommitted, CommittedTime: 1000},
+		{DeploymentId: "g2", SubdocIds: []string{"portforwarding", "lan"}, State: DeploymentGroupCommitted, CommittedTime: 2000},
+		{DeploymentId: "g3", SubdocIds: []string{"mesh"}, State: DeploymentGroupStaged, CreatedTime: 3000},
+		{DeploymentId: "g4", SubdocIds: []string{"macbinding"}, State: DeploymentGroupStaged, CreatedTime: 1000},
+	}
+	// g4 is abandoned
+	document.ApplyDeploymentGroups(groups, 3000+DeploymentGroupStagedTimeoutMillis)
+	assert.Equal(t, document.Length(), 4)
+	assert.Assert(t, document.SubDocument("mesh") == nil)
+	assert.DeepEqual(t, document.Order(), []string{"portforwarding", "lan", "wan"})
+
+	// the order is kept by the filters and the unordered subdocs follow
+	filteredDocument := document.FilterForGet(nil)
+	assert.DeepEqual(t, filteredDocument.orderedSubdocIds(), []string{"portforwarding", "lan", "wan", "macbinding"})
+
+	// a new commit takes over the order of the committed groups
+	assert.DeepEqual(t, FoldDeploymentGroups([]string{"mesh", "wan"}, groups), []string{"mesh", "wan", "portforwarding", "lan"})
+}
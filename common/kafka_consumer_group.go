@@ -0,0 +1,58 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package common
+
+// KafkaPartitionStatus reports the consumption progress of one topic partition
+type KafkaPartitionStatus struct {
+	Topic           string `json:"topic"`
+	Partition       int32  `json:"partition"`
+	CommittedOffset int64  `json:"committed_offset"`
+	HighWaterMark   int64  `json:"high_water_mark"`
+	Lag             int64  `json:"lag"`
+}
+
+type KafkaConsumerGroupStatus struct {
+	ClusterName  string                     `json:"cluster_name"`
+	GroupId      string                     `json:"group_id"`
+	Topics       []string                   `json:"topics"`
+	Paused       bool                       `json:"paused"`
+	Partitions   []KafkaPartitionStatus     `json:"partitions"`
+	PendingSeeks map[string]map[int32]int64 `json:"pending_seeks,omitempty"`
+	Error        string                     `json:"error,omitempty"`
+}
+
+// KafkaSeekRequest rewinds or fast-forwards a consumer group.
+// Exactly one of Offset or Timestamp (in epoch millis) should be set.
+// A nil Partition means all partitions of the topic.
+type KafkaSeekRequest struct {
+	Topic     string `json:"topic"`
+	Partition *int32 `json:"partition,omitempty"`
+	Offset    *int64 `json:"offset,omitempty"`
+	Timestamp *int64 `json:"timestamp,omitempty"`
+}
+
+// KafkaConsumerControl is the pause and the last seek of the consumer group of a cluster. It is
+// kept in the db so that every replica polls and applies it, whichever replica served the admin
+// call. A seek is applied once per replica by its SeekId.
+type KafkaConsumerControl struct {
+	ClusterName string                     `json:"cluster_name"`
+	Paused      bool                       `json:"paused"`
+	SeekId      string                     `json:"seek_id,omitempty"`
+	SeekOffsets map[string]map[int32]int64 `json:"seek_offsets,omitempty"`
+	SeekTime    int64                      `json:"seek_time,omitempty"`
+}
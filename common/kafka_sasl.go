@@ -0,0 +1,231 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package common
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/IBM/sarama"
+	"github.com/go-akka/configuration"
+	log "github.com/sirupsen/logrus"
+	"github.com/xdg-go/scram"
+)
+
+// Decrypter decrypts the encrypted settings, it is the security.AesCodec, which common cannot import
+type Decrypter interface {
+	Decrypt(encryptedB64 string) (string, error)
+}
+
+// KafkaSASLConfig holds the SASL settings of one kafka block
+type KafkaSASLConfig struct {
+	Mechanism      string
+	User           string
+	Password       string
+	OAuthTokenEnv  string
+	OAuthTokenFile string
+	prefix         string
+}
+
+// LoadKafkaSASLConfig loads SASL configuration from HOCON config at the specified prefix.
+// Prefix should be like "webconfig.kafka" or "webconfig.kafka.clusters.mesh" or "webconfig.kafka_producer".
+// Returns nil if SASL is not enabled.
+// Returns error if SASL is enabled but configuration is invalid.
+//
+// Secrets are never expected in the config file itself. The password is resolved in this order:
+// the secret named by sasl_password_secret, the env var named by sasl_password_env, the file
+// sasl_password_file, sasl_encrypted_password decrypted by the codec, then sasl_password.
+func LoadKafkaSASLConfig(conf *configuration.Config, prefix string, codec Decrypter) (*KafkaSASLConfig, error) {
+	if !conf.GetBoolean(prefix + ".sasl_enabled") {
+		return nil, nil
+	}
+
+	mechanism := strings.ToUpper(conf.GetString(prefix+".sasl_mechanism", sarama.SASLTypePlaintext))
+	c := &KafkaSASLConfig{
+		Mechanism: mechanism,
+		prefix:    prefix,
+	}
+
+	switch mechanism {
+	case sarama.SASLTypePlaintext, sarama.SASLTypeSCRAMSHA256, sarama.SASLTypeSCRAMSHA512:
+		c.User = conf.GetString(prefix + ".sasl_user")
+		if len(c.User) == 0 {
+			return nil, NewError(fmt.Errorf("SASL %s enabled but %s.sasl_user is empty", mechanism, prefix))
+		}
+		password, err := readKafkaPassword(conf, prefix, codec)
+		if err != nil {
+			return nil, NewError(err)
+		}
+		if len(password) == 0 {
+			return nil, NewError(fmt.Errorf("SASL %s enabled but no password configured for %s", mechanism, prefix))
+		}
+		c.Password = password
+	case sarama.SASLTypeOAuth:
+		c.OAuthTokenEnv = conf.GetString(prefix + ".sasl_oauth_token_env")
+		c.OAuthTokenFile = conf.GetString(prefix + ".sasl_oauth_token_file")
+		if len(c.OAuthTokenEnv) == 0 && len(c.OAuthTokenFile) == 0 {
+			return nil, NewError(fmt.Errorf("SASL %s enabled but neither sasl_oauth_token_env nor sasl_oauth_token_file is configured for %s", mechanism, prefix))
+		}
+		// fail early if the token is not readable at startup
+		if _, err := c.Token(); err != nil {
+			return nil, NewError(err)
+		}
+	default:
+		return nil, NewError(fmt.Errorf("unsupported SASL mechanism %q for %s", mechanism, prefix))
+	}
+
+	log.WithFields(log.Fields{
+		"prefix":    prefix,
+		"mechanism": mechanism,
+		"user":      c.User,
+	}).Info("SASL configuration loaded for Kafka connection")
+
+	return c, nil
+}
+
+// readKafkaPassword resolves the sasl password from sasl_password_secret, sasl_password_env,
+// sasl_password_file, sasl_encrypted_password or sasl_password, in that order
+func readKafkaPassword(conf *configuration.Config, prefix string, codec Decrypter) (string, error) {
+	key := prefix + ".sasl_password"
+	if secret, ok, err := ReadConfigSecret(conf, key); ok {
+		if err != nil {
+			return "", NewError(err)
+		}
+		return string(secret), nil
+	}
+	if envName := conf.GetString(key + "_env"); len(envName) > 0 {
+		if x := os.Getenv(envName); len(x) > 0 {
+			return x, nil
+		}
+	}
+	if fname := conf.GetString(key + "_file"); len(fname) > 0 {
+		bbytes, err := os.ReadFile(fname)
+		if err != nil {
+			return "", NewError(fmt.Errorf("failed to read %s from %s: %v", key, fname, err))
+		}
+		return strings.TrimSpace(string(bbytes)), nil
+	}
+	if encryptedPassword := conf.GetString(prefix + ".sasl_encrypted_password"); len(encryptedPassword) > 0 {
+		if codec == nil {
+			return "", NewError(fmt.Errorf("no codec to decrypt %s.sasl_encrypted_password", prefix))
+		}
+		password, err := codec.Decrypt(encryptedPassword)
+		if err != nil {
+			return "", NewError(fmt.Errorf("failed to decrypt %s.sasl_encrypted_password: %v", prefix, err))
+		}
+		return password, nil
+	}
+	return conf.GetString(key), nil
+}
+
+// Token implements sarama.AccessTokenProvider. The token is read on every call
+// so that an externally rotated token file is picked up on reconnect.
+func (c *KafkaSASLConfig) Token() (*sarama.AccessToken, error) {
+	var token string
+	if len(c.OAuthTokenEnv) > 0 {
+		token = os.Getenv(c.OAuthTokenEnv)
+	}
+	if len(token) == 0 && len(c.OAuthTokenFile) > 0 {
+		bbytes, err := os.ReadFile(c.OAuthTokenFile)
+		if err != nil {
+			return nil, NewError(fmt.Errorf("failed to read SASL oauth token from %s: %v", c.OAuthTokenFile, err))
+		}
+		token = strings.TrimSpace(string(bbytes))
+	}
+	if len(token) == 0 {
+		return nil, NewError(fmt.Errorf("empty SASL oauth token for %s", c.prefix))
+	}
+	return &sarama.AccessToken{Token: token}, nil
+}
+
+// Apply sets the SASL options on a sarama config
+func (c *KafkaSASLConfig) Apply(sconfig *sarama.Config) {
+	sconfig.Net.SASL.Enable = true
+	sconfig.Net.SASL.Handshake = true
+	sconfig.Net.SASL.Mechanism = sarama.SASLMechanism(c.Mechanism)
+
+	switch c.Mechanism {
+	case sarama.SASLTypeOAuth:
+		sconfig.Net.SASL.TokenProvider = c
+	case sarama.SASLTypeSCRAMSHA256:
+		sconfig.Net.SASL.User = c.User
+		sconfig.Net.SASL.Password = c.Password
+		sconfig.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient {
+			return &ScramClient{HashGeneratorFcn: scram.HashGeneratorFcn(sha256.New)}
+		}
+	case sarama.SASLTypeSCRAMSHA512:
+		sconfig.Net.SASL.User = c.User
+		sconfig.Net.SASL.Password = c.Password
+		sconfig.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient {
+			return &ScramClient{HashGeneratorFcn: scram.HashGeneratorFcn(sha512.New)}
+		}
+	default:
+		sconfig.Net.SASL.User = c.User
+		sconfig.Net.SASL.Password = c.Password
+	}
+}
+
+// ScramClient implements sarama.SCRAMClient
+type ScramClient struct {
+	*scram.Client
+	*scram.ClientConversation
+	scram.HashGeneratorFcn
+}
+
+func (x *ScramClient) Begin(userName, password, authzID string) error {
+	client, err := x.HashGeneratorFcn.NewClient(userName, password, authzID)
+	if err != nil {
+		return NewError(err)
+	}
+	x.Client = client
+	x.ClientConversation = client.NewConversation()
+	return nil
+}
+
+func (x *ScramClient) Step(challenge string) (string, error) {
+	return x.ClientConversation.Step(challenge)
+}
+
+func (x *ScramClient) Done() bool {
+	return x.ClientConversation.Done()
+}
+
+// ConfigureKafkaSecurity loads both TLS and SASL settings at the prefix and applies them to the sarama
+// config. The codec decrypts an encrypted sasl password, it can be nil if none is configured.
+func ConfigureKafkaSecurity(conf *configuration.Config, prefix string, sconfig *sarama.Config, codec Decrypter) error {
+	tlsConfig, err := LoadKafkaTLSConfig(conf, prefix)
+	if err != nil {
+		return NewError(fmt.Errorf("failed to load TLS configuration for %s: %v", prefix, err))
+	}
+	if tlsConfig != nil {
+		sconfig.Net.TLS.Enable = true
+		sconfig.Net.TLS.Config = tlsConfig
+	}
+
+	saslConfig, err := LoadKafkaSASLConfig(conf, prefix, codec)
+	if err != nil {
+		return NewError(fmt.Errorf("failed to load SASL configuration for %s: %v", prefix, err))
+	}
+	if saslConfig != nil {
+		saslConfig.Apply(sconfig)
+	}
+	return nil
+}
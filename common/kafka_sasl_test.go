@@ -0,0 +1,295 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package common
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/go-akka/configuration"
+	"gotest.tools/assert"
+)
+
+func TestLoadKafkaSASLConfig_Disabled(t *testing.T) {
+	confStr := `
+webconfig {
+	kafka {
+		sasl_enabled = false
+	}
+}
+`
+	conf := configuration.ParseString(confStr)
+	saslConfig, err := LoadKafkaSASLConfig(conf, "webconfig.kafka", nil)
+
+	assert.NilError(t, err)
+	assert.Assert(t, saslConfig == nil, "SASL config should be nil when SASL is disabled")
+}
+
+func TestLoadKafkaSASLConfig_PasswordSources(t *testing.T) {
+	// plain text in the config
+	confStr := `
+webconfig {
+	kafka {
+		sasl_enabled = true
+		sasl_mechanism = "PLAIN"
+		sasl_user = "webconfig"
+		sasl_password = "from-conf"
+	}
+}
+`
+	conf := configuration.ParseString(confStr)
+	saslConfig, err := LoadKafkaSASLConfig(conf, "webconfig.kafka", nil)
+	assert.NilError(t, err)
+	assert.Equal(t, saslConfig.Mechanism, sarama.SASLTypePlaintext)
+	assert.Equal(t, saslConfig.User, "webconfig")
+	assert.Equal(t, saslConfig.Password, "from-conf")
+
+	// file takes precedence over the plain config
+	tempDir := t.TempDir()
+	passwordFile := filepath.Join(tempDir, "kafka_password")
+	err = os.WriteFile(passwordFile, []byte("from-file\n"), 0600)
+	assert.NilError(t, err)
+
+	confStr = `
+webconfig {
+	kafka_producer {
+		sasl_enabled = true
+		sasl_mechanism = "scram-sha-512"
+		sasl_user = "webconfig"
+		sasl_password = "from-conf"
+		sasl_password_file = "` + passwordFile + `"
+		sasl_password_env = "TEST_WEBCONFIG_KAFKA_SASL_PASSWORD"
+	}
+}
+`
+	conf = configuration.ParseString(confStr)
+	saslConfig, err = LoadKafkaSASLConfig(conf, "webconfig.kafka_producer", nil)
+	assert.NilError(t, err)
+	assert.Equal(t, saslConfig.Mechanism, sarama.SASLTypeSCRAMSHA512)
+	assert.Equal(t, saslConfig.Password, "from-file")
+
+	// env takes precedence over the file
+	t.Setenv("TEST_WEBCONFIG_KAFKA_SASL_PASSWORD", "from-env")
+	saslConfig, err = LoadKafkaSASLConfig(conf, "webconfig.kafka_producer", nil)
+	assert.NilError(t, err)
+	assert.Equal(t, saslConfig.Password, "from-env")
+}
+
+// testDecrypter stands in for the aes codec, the encrypted value is just base64
+type testDecrypter struct{}
+
+func (d testDecrypter) Decrypt(encryptedB64 string) (string, error) {
+	bbytes, err := base64.StdEncoding.DecodeString(encryptedB64)
+	return string(bbytes), err
+}
+
+func TestLoadKafkaSASLConfig_EncryptedPassword(t *testing.T) {
+	confStr := `
+webconfig {
+	kafka {
+		sasl_enabled = true
+		sasl_mechanism = "SCRAM-SHA-256"
+		sasl_user = "webconfig"
+		sasl_password = "from-conf"
+		sasl_encrypted_password = "` + base64.StdEncoding.EncodeToString([]byte("from-encrypted")) + `"
+	}
+}
+`
+	// the encrypted password takes precedence over the plain config
+	conf := configuration.ParseString(confStr)
+	saslConfig, err := LoadKafkaSASLConfig(conf, "webconfig.kafka", testDecrypter{})
+	assert.NilError(t, err)
+	assert.Equal(t, saslConfig.Password, "from-encrypted")
+
+	// it cannot be read without a codec
+	_, err = LoadKafkaSASLConfig(conf, "webconfig.kafka", nil)
+	assert.Assert(t, err != nil)
+
+	conf = configuration.ParseString(strings.Replace(confStr, "sasl_encrypted_password = \"", "sasl_encrypted_password = \"!", 1))
+	_, err = LoadKafkaSASLConfig(conf, "webconfig.kafka", testDecrypter{})
+	assert.Assert(t, err != nil)
+}
+
+func TestLoadKafkaSASLConfig_Errors(t *testing.T) {
+	confStr := `
+webconfig {
+	kafka {
+		clusters {
+			mesh {
+				sasl_enabled = true
+				sasl_mechanism = "SCRAM-SHA-256"
+				sasl_password = "secret"
+			}
+			east {
+				sasl_enabled = true
+				sasl_mechanism = "SCRAM-SHA-256"
+				sasl_user = "webconfig"
+				sasl_password_file = "/nonexistent/kafka_password"
+			}
+			west {
+				sasl_enabled = true
+				sasl_mechanism = "GSSAPI"
+			}
+			north {
+				sasl_enabled = true
+				sasl_mechanism = "OAUTHBEARER"
+			}
+		}
+	}
+}
+`
+	conf := configuration.ParseString(confStr)
+
+	_, err := LoadKafkaSASLConfig(conf, "webconfig.kafka.clusters.mesh", nil)
+	assert.ErrorContains(t, err, "sasl_user is empty")
+
+	_, err = LoadKafkaSASLConfig(conf, "webconfig.kafka.clusters.east", nil)
+	assert.ErrorContains(t, err, "failed to read")
+
+	_, err = LoadKafkaSASLConfig(conf, "webconfig.kafka.clusters.west", nil)
+	assert.ErrorContains(t, err, "unsupported SASL mechanism")
+
+	_, err = LoadKafkaSASLConfig(conf, "webconfig.kafka.clusters.north", nil)
+	assert.ErrorContains(t, err, "sasl_oauth_token")
+}
+
+func TestLoadKafkaSASLConfig_OAuthTokenRotation(t *testing.T) {
+	tempDir := t.TempDir()
+	tokenFile := filepath.Join(tempDir, "kafka_token")
+	err := os.WriteFile(tokenFile, []byte("token1"), 0600)
+	assert.NilError(t, err)
+
+	confStr := `
+webconfig {
+	kafka {
+		sasl_enabled = true
+		sasl_mechanism = "OAUTHBEARER"
+		sasl_oauth_token_file = "` + tokenFile + `"
+	}
+}
+`
+	conf := configuration.ParseString(confStr)
+	saslConfig, err := LoadKafkaSASLConfig(conf, "webconfig.kafka", nil)
+	assert.NilError(t, err)
+
+	sconfig := sarama.NewConfig()
+	saslConfig.Apply(sconfig)
+	assert.Equal(t, sconfig.Net.SASL.Mechanism, sarama.SASLMechanism(sarama.SASLTypeOAuth))
+	assert.NilError(t, sconfig.Validate())
+
+	token, err := sconfig.Net.SASL.TokenProvider.Token()
+	assert.NilError(t, err)
+	assert.Equal(t, token.Token, "token1")
+
+	// a rotated token should be picked up without a reload
+	err = os.WriteFile(tokenFile, []byte("token2"), 0600)
+	assert.NilError(t, err)
+	token, err = sconfig.Net.SASL.TokenProvider.Token()
+	assert.NilError(t, err)
+	assert.Equal(t, token.Token, "token2")
+}
+
+func TestKafkaSASLConfig_ApplyScram(t *testing.T) {
+	for _, mechanism := range []string{sarama.SASLTypeSCRAMSHA256, sarama.SASLTypeSCRAMSHA512} {
+		saslConfig := &KafkaSASLConfig{
+			Mechanism: mechanism,
+			User:      "webconfig",
+			Password:  "secret",
+		}
+		sconfig := sarama.NewConfig()
+		saslConfig.Apply(sconfig)
+		assert.NilError(t, sconfig.Validate())
+		assert.Equal(t, sconfig.Net.SASL.User, "webconfig")
+		assert.Equal(t, sconfig.Net.SASL.Password, "secret")
+
+		// the client-first message should carry the user name
+		client := sconfig.Net.SASL.SCRAMClientGeneratorFunc()
+		err := client.Begin("webconfig", "secret", "")
+		assert.NilError(t, err)
+		msg, err := client.Step("")
+		assert.NilError(t, err)
+		assert.Assert(t, strings.HasPrefix(msg, "n,,n=webconfig,r="))
+		assert.Assert(t, !client.Done())
+	}
+}
+
+// the mock broker stands in for a SASL enabled kafka
+func TestConfigureKafkaSecurity_MockBroker(t *testing.T) {
+	confStr := `
+webconfig {
+	kafka {
+		sasl_enabled = true
+		sasl_mechanism = "PLAIN"
+		sasl_user = "webconfig"
+		sasl_password_env = "TEST_WEBCONFIG_KAFKA_SASL_PASSWORD"
+	}
+}
+`
+	t.Setenv("TEST_WEBCONFIG_KAFKA_SASL_PASSWORD", "secret")
+	conf := configuration.ParseString(confStr)
+
+	for _, authErr := range []sarama.KError{sarama.ErrNoError, sarama.ErrSASLAuthenticationFailed} {
+		mockBroker := sarama.NewMockBroker(t, 1)
+		authResponse := sarama.NewMockSaslAuthenticateResponse(t)
+		if authErr != sarama.ErrNoError {
+			authResponse = authResponse.SetError(authErr)
+		}
+		mockBroker.SetHandlerByMap(map[string]sarama.MockResponse{
+			"SaslHandshakeRequest": sarama.NewMockSaslHandshakeResponse(t).
+				SetEnabledMechanisms([]string{sarama.SASLTypePlaintext}),
+			"SaslAuthenticateRequest": authResponse,
+			"MetadataRequest": sarama.NewMockMetadataResponse(t).
+				SetBroker(mockBroker.Addr(), mockBroker.BrokerID()),
+		})
+
+		sconfig := sarama.NewConfig()
+		sconfig.Version = sarama.V1_0_0_0
+		sconfig.Metadata.Retry.Max = 0
+		sconfig.Net.ReadTimeout = time.Second
+		err := ConfigureKafkaSecurity(conf, "webconfig.kafka", sconfig, nil)
+		assert.NilError(t, err)
+		assert.Assert(t, sconfig.Net.SASL.Enable)
+		assert.Assert(t, !sconfig.Net.TLS.Enable)
+
+		client, err := sarama.NewClient([]string{mockBroker.Addr()}, sconfig)
+		if authErr == sarama.ErrNoError {
+			assert.NilError(t, err)
+			_ = client.Close()
+		} else {
+			assert.Assert(t, err != nil)
+		}
+
+		var handshakes, authenticates int
+		for _, rr := range mockBroker.History() {
+			switch rr.Request.(type) {
+			case *sarama.SaslHandshakeRequest:
+				handshakes++
+			case *sarama.SaslAuthenticateRequest:
+				authenticates++
+			}
+		}
+		assert.Assert(t, handshakes > 0)
+		assert.Assert(t, authenticates > 0)
+		mockBroker.Close()
+	}
+}
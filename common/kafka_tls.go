@@ -22,6 +22,7 @@ import (
 	"crypto/x509"
 	"fmt"
 	"os"
+	"sync"
 
 	"github.com/go-akka/configuration"
 	log "github.com/sirupsen/logrus"
@@ -46,9 +47,42 @@ func LoadKafkaTLSConfig(conf *configuration.Config, prefix string) (*tls.Config,
 	certFile := conf.GetString(prefix + ".tls_cert_file")
 	keyFile := conf.GetString(prefix + ".tls_key_file")
 
+	// The PEMs named by tls_cert_secret and tls_key_secret take precedence over the files
+	certPem, hasCertSecret, err := ReadConfigSecret(conf, prefix+".tls_cert")
+	if err != nil {
+		return nil, NewError(err)
+	}
+	keyPem, hasKeySecret, err := ReadConfigSecret(conf, prefix+".tls_key")
+	if err != nil {
+		return nil, NewError(err)
+	}
+
 	// When insecure_skip_verify is true and no cert files configured, skip loading certificates
 	// This allows TLS without client authentication (server-only TLS)
-	if insecureSkipVerify && (len(certFile) == 0 || len(keyFile) == 0) {
+	if hasCertSecret || hasKeySecret {
+		if !hasCertSecret || !hasKeySecret {
+			return nil, NewError(fmt.Errorf("TLS enabled but only one of %s.tls_cert_secret and %s.tls_key_secret is configured", prefix, prefix))
+		}
+		cert, err := tls.X509KeyPair(certPem, keyPem)
+		if err != nil {
+			return nil, NewError(fmt.Errorf("failed to load TLS certificate and key from secrets: %v", err))
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+		tlsConfig.GetClientCertificate = reloadingClientCertificate(prefix, cert, func() (tls.Certificate, error) {
+			certPem, _, err := ReadConfigSecret(conf, prefix+".tls_cert")
+			if err != nil {
+				return tls.Certificate{}, err
+			}
+			keyPem, _, err := ReadConfigSecret(conf, prefix+".tls_key")
+			if err != nil {
+				return tls.Certificate{}, err
+			}
+			return tls.X509KeyPair(certPem, keyPem)
+		})
+		log.WithFields(log.Fields{
+			"prefix": prefix,
+		}).Info("Loaded TLS client certificate for mTLS from secrets")
+	} else if insecureSkipVerify && (len(certFile) == 0 || len(keyFile) == 0) {
 		// Insecure mode without client certificates - skip cert loading
 	} else if len(certFile) > 0 && len(keyFile) > 0 {
 		// Only validate cert files exist when verification is enabled
@@ -71,6 +105,9 @@ func LoadKafkaTLSConfig(conf *configuration.Config, prefix string) (*tls.Config,
 		}
 
 		tlsConfig.Certificates = []tls.Certificate{cert}
+		tlsConfig.GetClientCertificate = reloadingClientCertificate(prefix, cert, func() (tls.Certificate, error) {
+			return tls.LoadX509KeyPair(certFile, keyFile)
+		})
 		log.WithFields(log.Fields{
 			"prefix":    prefix,
 			"cert_file": certFile,
@@ -85,9 +122,22 @@ func LoadKafkaTLSConfig(conf *configuration.Config, prefix string) (*tls.Config,
 
 	// Load CA certificate if provided (optional when insecure_skip_verify is true)
 	caCertFile := conf.GetString(prefix + ".tls_ca_cert_file")
+	caCertPem, hasCaCertSecret, err := ReadConfigSecret(conf, prefix+".tls_ca_cert")
+	if err != nil {
+		return nil, NewError(err)
+	}
 	// When insecure_skip_verify is true and no CA file configured, skip loading CA cert
 	// This allows TLS without broker verification (insecure mode)
-	if insecureSkipVerify && len(caCertFile) == 0 {
+	if hasCaCertSecret {
+		caCertPool := x509.NewCertPool()
+		if !caCertPool.AppendCertsFromPEM(caCertPem) {
+			return nil, NewError(fmt.Errorf("failed to parse TLS CA certificate from %s.tls_ca_cert_secret", prefix))
+		}
+		tlsConfig.RootCAs = caCertPool
+		log.WithFields(log.Fields{
+			"prefix": prefix,
+		}).Info("Loaded TLS CA certificate for broker verification from secrets")
+	} else if insecureSkipVerify && len(caCertFile) == 0 {
 		// Insecure mode without CA cert - skip CA loading
 	} else if len(caCertFile) > 0 {
 		// Only validate CA cert file exists when verification is enabled
@@ -133,3 +183,23 @@ func LoadKafkaTLSConfig(conf *configuration.Config, prefix string) (*tls.Config,
 
 	return tlsConfig, nil
 }
+
+// reloadingClientCertificate loads the client certificate again on every handshake, so the new
+// connections pick up a rotated secret or file. The CA is read only once. If the certificate fails
+// to load, the last good one is used.
+func reloadingClientCertificate(prefix string, cert tls.Certificate, load func() (tls.Certificate, error)) func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	var lock sync.Mutex
+	return func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		if c, err := load(); err == nil {
+			cert = c
+		} else {
+			log.WithFields(log.Fields{
+				"prefix": prefix,
+				"error":  err,
+			}).Warn("Failed to reload TLS client certificate, using the last loaded one")
+		}
+		return &cert, nil
+	}
+}
@@ -0,0 +1,41 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package common
+
+// LastKnownGood keeps the last version of a subdoc deployed by the device, and
+// counts the failures of the newer version since
+type LastKnownGood struct {
+	CpeMac        string `json:"cpe_mac"`
+	SubdocId      string `json:"subdoc_id"`
+	Payload       []byte `json:"-"`
+	Version       string `json:"version"`
+	DeployedTime  int64  `json:"deployed_time"`
+	FailedVersion string `json:"failed_version,omitempty"`
+	FailureCount  int    `json:"failure_count,omitempty"`
+}
+
+// RollbackEvent is sent on the kafka producer when a subdoc is rolled back
+type RollbackEvent struct {
+	EventName    string `json:"event_name"`
+	DeviceId     string `json:"device_id"`
+	Namespace    string `json:"namespace"`
+	FromVersion  string `json:"from_version"`
+	ToVersion    string `json:"to_version"`
+	FailureCount int    `json:"failure_count"`
+	Timestamp    int64  `json:"timestamp"`
+}
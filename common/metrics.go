@@ -75,6 +75,12 @@ type AppMetrics struct {
 	failureIncCount             *prometheus.CounterVec
 	failureDecCount             *prometheus.CounterVec
 	kafkaProducerErrCount       *prometheus.CounterVec
+	mqttRoundTrip               *prometheus.HistogramVec
+	mqttTimeoutCount            *prometheus.CounterVec
+	circuitBreakerState         *prometheus.GaugeVec
+	circuitBreakerRejectCount   *prometheus.CounterVec
+	pokeQueueDepth              *prometheus.GaugeVec
+	subdocRetryCount            *prometheus.CounterVec
 	watchedCpes                 []string
 	logrusLevel                 log.Level
 }
@@ -306,6 +312,49 @@ func NewMetrics(conf *configuration.Config, args ...func(string) string) *AppMet
 			},
 			[]string{"topic", "partition"},
 		),
+		mqttRoundTrip: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    appName + "_mqtt_round_trip_seconds",
+				Help:    "A histogram of the time from an mqtt response to the device state report or re-request per feature.",
+				Buckets: []float64{.5, 1, 2.5, 5, 10, 30, 60, 120, 300},
+			},
+			[]string{"feature", "outcome"},
+		),
+		mqttTimeoutCount: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: appName + "_mqtt_timeout_count",
+				Help: "A counter for the number of mqtt responses never acknowledged by the device per feature.",
+			},
+			[]string{"feature"},
+		),
+		circuitBreakerState: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: appName + "_circuit_breaker_state",
+				Help: "A gauge for the circuit breaker state per service, 0=closed, 1=half-open, 2=open.",
+			},
+			[]string{"service"},
+		),
+		circuitBreakerRejectCount: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: appName + "_circuit_breaker_reject_count",
+				Help: "A counter for the number of calls short-circuited by the circuit breaker per service.",
+			},
+			[]string{"service"},
+		),
+		pokeQueueDepth: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: appName + "_poke_queue_depth",
+				Help: "A gauge for the number of async webpa pokes in the queue per status.",
+			},
+			[]string{"status"},
+		),
+		subdocRetryCount: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: appName + "_subdoc_retry_count",
+				Help: "A counter for the automatic retries of failed subdocs per feature and outcome.",
+			},
+			[]string{"feature", "outcome"},
+		),
 		watchedCpes: watchedCpes,
 		logrusLevel: logrusLevel,
 	}
@@ -335,6 +384,12 @@ func NewMetrics(conf *configuration.Config, args ...func(string) string) *AppMet
 		appMetrics.failureIncCount,
 		appMetrics.failureDecCount,
 		appMetrics.kafkaProducerErrCount,
+		appMetrics.mqttRoundTrip,
+		appMetrics.mqttTimeoutCount,
+		appMetrics.circuitBreakerState,
+		appMetrics.circuitBreakerRejectCount,
+		appMetrics.pokeQueueDepth,
+		appMetrics.subdocRetryCount,
 	)
 	return appMetrics
 }
@@ -551,6 +606,31 @@ func (m *AppMetrics) ObserveKafkaProducerErr(topic string, partition int32) {
 	m.kafkaProducerErrCount.With(labels).Inc()
 }
 
+func (m *AppMetrics) ObserveMqttRoundTrip(subdocId string, outcome string, seconds float64) {
+	labels := prometheus.Labels{"feature": subdocId, "outcome": outcome}
+	m.mqttRoundTrip.With(labels).Observe(seconds)
+}
+
+func (m *AppMetrics) CountMqttTimeout(subdocId string) {
+	m.mqttTimeoutCount.With(prometheus.Labels{"feature": subdocId}).Inc()
+}
+
+func (m *AppMetrics) SetCircuitBreakerState(service string, state int) {
+	m.circuitBreakerState.With(prometheus.Labels{"service": service}).Set(float64(state))
+}
+
+func (m *AppMetrics) CountCircuitBreakerReject(service string) {
+	m.circuitBreakerRejectCount.With(prometheus.Labels{"service": service}).Inc()
+}
+
+func (m *AppMetrics) SetPokeQueueDepth(status string, depth int) {
+	m.pokeQueueDepth.With(prometheus.Labels{"status": status}).Set(float64(depth))
+}
+
+func (m *AppMetrics) CountSubdocRetry(subdocId string, outcome string) {
+	m.subdocRetryCount.With(prometheus.Labels{"feature": subdocId, "outcome": outcome}).Inc()
+}
+
 func (m *AppMetrics) GetStateCounter(labels prometheus.Labels) (*StateCounter, error) {
 	// REMINDER if a label is defined with 2 dimensions, then it must be referred
 	//          with 2 dimensions. Aggregation happens at prometheus level
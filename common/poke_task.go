@@ -0,0 +1,63 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package common
+
+import (
+	"hash/fnv"
+	"strings"
+)
+
+const (
+	DefaultPokeQueueBuckets = 16
+)
+
+const (
+	PokeTaskQueued     = "queued"
+	PokeTaskInProgress = "in_progress"
+	PokeTaskDone       = "done"
+	PokeTaskFailed     = "failed"
+	PokeTaskSuperseded = "superseded"
+)
+
+// PokeTask is an async webpa poke persisted in the poke queue. The queue keeps
+// only the latest task per cpe_mac, while the status of every task can be
+// looked up by its transaction id. The queue is partitioned by Bucket so that
+// each replica polls only the buckets it owns.
+type PokeTask struct {
+	Bucket        int    `json:"bucket"`
+	CpeMac        string `json:"cpe_mac"`
+	TransactionId string `json:"transaction_id"`
+	Url           string `json:"url,omitempty"`
+	Header        []byte `json:"-"`
+	Payload       []byte `json:"-"`
+	Status        string `json:"status"`
+	Attempts      int    `json:"attempts"`
+	ErrorDetails  string `json:"error_details,omitempty"`
+	CreatedTime   int64  `json:"created_time"`
+	UpdatedTime   int64  `json:"updated_time"`
+}
+
+// PokeQueueBucket returns the partition of the poke queue of a cpe
+func PokeQueueBucket(cpeMac string, buckets int) int {
+	if buckets <= 0 {
+		buckets = DefaultPokeQueueBuckets
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(strings.ToUpper(cpeMac)))
+	return int(h.Sum32() % uint32(buckets))
+}
@@ -40,6 +40,8 @@ type RootDocument struct {
 	LockedTill      int    `json:"locked_till"`
 	ProductClass    string `json:"product_class"`
 	AccountType     string `json:"account_type"`
+	Route           string `json:"route,omitempty"`
+	TimeZone        string `json:"time_zone,omitempty"`
 }
 
 // (bitmap, firmware_version, model_name, partner_id, schema_version, version, query_params, product_class, account_type), nil
@@ -90,6 +92,8 @@ func (d *RootDocument) NonEmptyColumnMap() map[string]interface{} {
 		"query_params":     d.QueryParams,
 		"product_class":    d.ProductClass,
 		"account_type":     d.AccountType,
+		"route":            d.Route,
+		"time_zone":        d.TimeZone,
 	}
 
 	for k, v := range tempDict {
@@ -186,6 +190,12 @@ func (d *RootDocument) Update(r *RootDocument) {
 	if len(r.AccountType) > 0 {
 		d.AccountType = r.AccountType
 	}
+	if len(r.Route) > 0 {
+		d.Route = r.Route
+	}
+	if len(r.TimeZone) > 0 {
+		d.TimeZone = r.TimeZone
+	}
 }
 
 func (d *RootDocument) UpdateMetadata(r *RootDocument) {
@@ -0,0 +1,303 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-akka/configuration"
+)
+
+const (
+	SecretProviderEnv  = "env"
+	SecretProviderFile = "file"
+	SecretProviderDir  = "dir"
+	SecretProviderHttp = "http"
+)
+
+const (
+	secretProviderConfigPath    = "webconfig.secret_provider"
+	defaultSecretTimeoutInSecs  = 5
+	defaultSecretCacheTtlInSecs = 300
+	maxSecretResponseBodySize   = 1 << 20
+)
+
+// ErrSecretNotFound is returned when the source reports that a secret does not exist, unlike the
+// errors of a source that cannot be read
+var ErrSecretNotFound = errors.New("secret not found")
+
+// IsSecretNotFound tells if the secret, or the file of a key, is gone from its source
+func IsSecretNotFound(err error) bool {
+	return errors.Is(err, ErrSecretNotFound) || errors.Is(err, fs.ErrNotExist)
+}
+
+// SecretProvider resolves a secret by its name. What the name means depends on the provider: an
+// env var, a file path, a file in a directory of mounted secrets or a key in a secret store.
+type SecretProvider interface {
+	GetSecret(name string) ([]byte, error)
+}
+
+// NewSecretProvider builds the provider configured in webconfig.secret_provider, env by default
+func NewSecretProvider(conf *configuration.Config) (SecretProvider, error) {
+	prefix := secretProviderConfigPath
+	providerType := conf.GetString(prefix+".type", SecretProviderEnv)
+	switch providerType {
+	case SecretProviderEnv:
+		return NewEnvSecretProvider(), nil
+	case SecretProviderFile:
+		return NewFileSecretProvider(conf.GetString(prefix + ".file.base_dir")), nil
+	case SecretProviderDir:
+		dir := conf.GetString(prefix + ".dir.path")
+		if len(dir) == 0 {
+			return nil, NewError(fmt.Errorf("empty %v.dir.path", prefix))
+		}
+		return NewDirSecretProvider(dir), nil
+	case SecretProviderHttp:
+		storeUrl := conf.GetString(prefix + ".http.url")
+		if len(storeUrl) == 0 {
+			return nil, NewError(fmt.Errorf("empty %v.http.url", prefix))
+		}
+		var token string
+		if envName := conf.GetString(prefix + ".http.token_env"); len(envName) > 0 {
+			token = os.Getenv(envName)
+		}
+		timeout := time.Duration(conf.GetInt32(prefix+".http.timeout_in_secs", defaultSecretTimeoutInSecs)) * time.Second
+		cacheTtl := time.Duration(conf.GetInt32(prefix+".http.cache_ttl_in_secs", defaultSecretCacheTtlInSecs)) * time.Second
+		return NewHttpSecretProvider(storeUrl, token, timeout, cacheTtl), nil
+	}
+	return nil, NewError(fmt.Errorf("unsupported secret provider %q", providerType))
+}
+
+var (
+	secretProviders     = map[*configuration.Config]SecretProvider{}
+	secretProvidersLock sync.Mutex
+)
+
+// GetSecretProvider returns the provider of the config, built once so that the caches of the dir
+// and the http providers are shared by all the readers of the same config
+func GetSecretProvider(conf *configuration.Config) (SecretProvider, error) {
+	secretProvidersLock.Lock()
+	defer secretProvidersLock.Unlock()
+	if p, ok := secretProviders[conf]; ok {
+		return p, nil
+	}
+	p, err := NewSecretProvider(conf)
+	if err != nil {
+		return nil, NewError(err)
+	}
+	secretProviders[conf] = p
+	return p, nil
+}
+
+// ReadConfigSecret reads the secret named by <key>_secret through the provider of the config.
+// ok is false when no secret is configured for the key, so the callers can fall back to their
+// older settings.
+func ReadConfigSecret(conf *configuration.Config, key string) ([]byte, bool, error) {
+	name := conf.GetString(key + "_secret")
+	if len(name) == 0 {
+		return nil, false, nil
+	}
+	p, err := GetSecretProvider(conf)
+	if err != nil {
+		return nil, true, NewError(err)
+	}
+	value, err := p.GetSecret(name)
+	if err != nil {
+		return nil, true, NewError(fmt.Errorf("failed to read %v_secret: %w", key, err))
+	}
+	return value, true, nil
+}
+
+// EnvSecretProvider reads the secrets from env vars
+type EnvSecretProvider struct{}
+
+func NewEnvSecretProvider() *EnvSecretProvider {
+	return &EnvSecretProvider{}
+}
+
+func (p *EnvSecretProvider) GetSecret(name string) ([]byte, error) {
+	x := os.Getenv(name)
+	if len(x) == 0 {
+		return nil, fmt.Errorf("%w: no env %v", ErrSecretNotFound, name)
+	}
+	return []byte(x), nil
+}
+
+// FileSecretProvider reads the secrets from files, the relative paths are under the base dir
+type FileSecretProvider struct {
+	baseDir string
+}
+
+func NewFileSecretProvider(baseDir string) *FileSecretProvider {
+	return &FileSecretProvider{
+		baseDir: baseDir,
+	}
+}
+
+func (p *FileSecretProvider) GetSecret(name string) ([]byte, error) {
+	fname := name
+	if !filepath.IsAbs(fname) && len(p.baseDir) > 0 {
+		fname = filepath.Join(p.baseDir, fname)
+	}
+	bbytes, err := os.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimSpace(bbytes), nil
+}
+
+// DirSecretProvider reads the secrets mounted as files in one directory, like the kubernetes
+// secret volumes. A secret is cached and read again only when its file changes.
+type DirSecretProvider struct {
+	dir     string
+	secrets map[string]*dirSecret
+	sync.Mutex
+}
+
+type dirSecret struct {
+	value   []byte
+	modTime time.Time
+	size    int64
+}
+
+func NewDirSecretProvider(dir string) *DirSecretProvider {
+	return &DirSecretProvider{
+		dir:     dir,
+		secrets: map[string]*dirSecret{},
+	}
+}
+
+func (p *DirSecretProvider) GetSecret(name string) ([]byte, error) {
+	if len(name) == 0 || strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		return nil, fmt.Errorf("invalid secret name %q", name)
+	}
+	fname := filepath.Join(p.dir, name)
+	// the mounted secrets are symlinks swapped on update, stat follows them
+	info, err := os.Stat(fname)
+	if err != nil {
+		return nil, err
+	}
+
+	p.Lock()
+	defer p.Unlock()
+	if s, ok := p.secrets[name]; ok && s.modTime.Equal(info.ModTime()) && s.size == info.Size() {
+		return s.value, nil
+	}
+	bbytes, err := os.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	value := bytes.TrimSpace(bbytes)
+	p.secrets[name] = &dirSecret{
+		value:   value,
+		modTime: info.ModTime(),
+		size:    info.Size(),
+	}
+	return value, nil
+}
+
+// HttpSecretProvider reads the secrets from a secret store by GET <url>/<name>, which responds
+// {"value": "..."}. The values are cached for the ttl.
+type HttpSecretProvider struct {
+	url      string
+	token    string
+	client   *http.Client
+	cacheTtl time.Duration
+	secrets  map[string]*httpSecret
+	sync.Mutex
+}
+
+type httpSecret struct {
+	value     []byte
+	expiresAt time.Time
+}
+
+type SecretStoreResponse struct {
+	Value string `json:"value"`
+}
+
+func NewHttpSecretProvider(storeUrl string, token string, timeout time.Duration, cacheTtl time.Duration) *HttpSecretProvider {
+	return &HttpSecretProvider{
+		url:   strings.TrimRight(storeUrl, "/"),
+		token: token,
+		client: &http.Client{
+			Timeout: timeout,
+		},
+		cacheTtl: cacheTtl,
+		secrets:  map[string]*httpSecret{},
+	}
+}
+
+func (p *HttpSecretProvider) GetSecret(name string) ([]byte, error) {
+	p.Lock()
+	defer p.Unlock()
+	if s, ok := p.secrets[name]; ok && time.Now().Before(s.expiresAt) {
+		return s.value, nil
+	}
+
+	req, err := http.NewRequest("GET", p.url+"/"+url.PathEscape(name), nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(p.token) > 0 {
+		req.Header.Set("Authorization", "Bearer "+p.token)
+	}
+	res, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	rbytes, err := io.ReadAll(io.LimitReader(res.Body, maxSecretResponseBodySize))
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: secret store responded %v for %v", ErrSecretNotFound, res.StatusCode, name)
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("secret store responded %v for %v", res.StatusCode, name)
+	}
+
+	var resp SecretStoreResponse
+	if err := json.Unmarshal(rbytes, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Value) == 0 {
+		return nil, fmt.Errorf("empty secret %v", name)
+	}
+	value := []byte(resp.Value)
+	if p.cacheTtl > 0 {
+		p.secrets[name] = &httpSecret{
+			value:     value,
+			expiresAt: time.Now().Add(p.cacheTtl),
+		}
+	}
+	return value, nil
+}
@@ -0,0 +1,208 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-akka/configuration"
+	"gotest.tools/assert"
+)
+
+func TestEnvAndFileSecretProviders(t *testing.T) {
+	envName := "WEBCONFIG_TEST_SECRET"
+	t.Setenv(envName, "sesame")
+	value, err := NewEnvSecretProvider().GetSecret(envName)
+	assert.NilError(t, err)
+	assert.Equal(t, string(value), "sesame")
+	_, err = NewEnvSecretProvider().GetSecret(envName + "_MISSING")
+	assert.Assert(t, IsSecretNotFound(err))
+
+	dir := t.TempDir()
+	err = os.WriteFile(filepath.Join(dir, "db_password"), []byte("hunter2\n"), 0600)
+	assert.NilError(t, err)
+	p := NewFileSecretProvider(dir)
+	value, err = p.GetSecret("db_password")
+	assert.NilError(t, err)
+	assert.Equal(t, string(value), "hunter2")
+	value, err = NewFileSecretProvider("").GetSecret(filepath.Join(dir, "db_password"))
+	assert.NilError(t, err)
+	assert.Equal(t, string(value), "hunter2")
+}
+
+func TestDirSecretProviderReload(t *testing.T) {
+	dir := t.TempDir()
+	fname := filepath.Join(dir, "encryption_key")
+	err := os.WriteFile(fname, []byte("first"), 0600)
+	assert.NilError(t, err)
+
+	p := NewDirSecretProvider(dir)
+	value, err := p.GetSecret("encryption_key")
+	assert.NilError(t, err)
+	assert.Equal(t, string(value), "first")
+
+	// a rotated secret is read again
+	err = os.WriteFile(fname, []byte("second"), 0600)
+	assert.NilError(t, err)
+	later := time.Now().Add(time.Minute)
+	err = os.Chtimes(fname, later, later)
+	assert.NilError(t, err)
+	value, err = p.GetSecret("encryption_key")
+	assert.NilError(t, err)
+	assert.Equal(t, string(value), "second")
+
+	_, err = p.GetSecret("../encryption_key")
+	assert.Assert(t, err != nil)
+	_, err = p.GetSecret("missing")
+	assert.Assert(t, IsSecretNotFound(err))
+}
+
+func TestHttpSecretProvider(t *testing.T) {
+	var calls int32
+	store := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if r.Header.Get("Authorization") != "Bearer store-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/v1/secrets/db_password" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(SecretStoreResponse{Value: "hunter2"})
+	}))
+	defer store.Close()
+
+	p := NewHttpSecretProvider(store.URL+"/v1/secrets/", "store-token", time.Second, time.Minute)
+	value, err := p.GetSecret("db_password")
+	assert.NilError(t, err)
+	assert.Equal(t, string(value), "hunter2")
+
+	// served from the cache
+	value, err = p.GetSecret("db_password")
+	assert.NilError(t, err)
+	assert.Equal(t, string(value), "hunter2")
+	assert.Equal(t, atomic.LoadInt32(&calls), int32(1))
+
+	_, err = p.GetSecret("missing")
+	assert.Assert(t, IsSecretNotFound(err))
+
+	// a store refusing the call does not report the secret missing
+	p = NewHttpSecretProvider(store.URL+"/v1/secrets", "", time.Second, 0)
+	_, err = p.GetSecret("db_password")
+	assert.Assert(t, err != nil)
+	assert.Assert(t, !IsSecretNotFound(err))
+}
+
+func TestReadConfigSecret(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "sasl_password"), []byte("hunter2"), 0600)
+	assert.NilError(t, err)
+
+	conf := configuration.ParseString(fmt.Sprintf(`
+webconfig {
+    secret_provider {
+        type = "dir"
+        dir.path = "%v"
+    }
+    kafka {
+        sasl_password_secret = "sasl_password"
+        sasl_user_secret = "missing"
+    }
+}`, dir))
+	value, ok, err := ReadConfigSecret(conf, "webconfig.kafka.sasl_password")
+	assert.NilError(t, err)
+	assert.Assert(t, ok)
+	assert.Equal(t, string(value), "hunter2")
+
+	_, ok, err = ReadConfigSecret(conf, "webconfig.kafka.sasl_user")
+	assert.Assert(t, ok)
+	assert.Assert(t, IsSecretNotFound(err))
+
+	_, ok, err = ReadConfigSecret(conf, "webconfig.kafka.tls_cert")
+	assert.NilError(t, err)
+	assert.Assert(t, !ok)
+
+	_, err = NewSecretProvider(configuration.ParseString(`webconfig.secret_provider.type = "vault"`))
+	assert.Assert(t, err != nil)
+}
+
+func TestLoadKafkaTLSConfig_FromSecrets(t *testing.T) {
+	dir := t.TempDir()
+	generateTestCertificate(t, filepath.Join(dir, "kafka_cert"), filepath.Join(dir, "kafka_key"))
+
+	conf := configuration.ParseString(fmt.Sprintf(`
+webconfig {
+    secret_provider {
+        type = "dir"
+        dir.path = "%v"
+    }
+    kafka {
+        tls_enabled = true
+        tls_cert_secret = "kafka_cert"
+        tls_key_secret = "kafka_key"
+        tls_ca_cert_secret = "kafka_cert"
+    }
+}`, dir))
+	tlsConfig, err := LoadKafkaTLSConfig(conf, "webconfig.kafka")
+	assert.NilError(t, err)
+	assert.Equal(t, len(tlsConfig.Certificates), 1)
+	assert.Assert(t, tlsConfig.RootCAs != nil)
+
+	// the new connections pick up a rotated certificate
+	generateTestCertificate(t, filepath.Join(dir, "kafka_cert"), filepath.Join(dir, "kafka_key"))
+	later := time.Now().Add(time.Minute)
+	for _, name := range []string{"kafka_cert", "kafka_key"} {
+		err = os.Chtimes(filepath.Join(dir, name), later, later)
+		assert.NilError(t, err)
+	}
+	cert, err := tlsConfig.GetClientCertificate(nil)
+	assert.NilError(t, err)
+	assert.Assert(t, !bytes.Equal(cert.Certificate[0], tlsConfig.Certificates[0].Certificate[0]))
+
+	// the last good certificate is kept if the secret is gone
+	err = os.Remove(filepath.Join(dir, "kafka_key"))
+	assert.NilError(t, err)
+	lastCert, err := tlsConfig.GetClientCertificate(nil)
+	assert.NilError(t, err)
+	assert.Assert(t, bytes.Equal(lastCert.Certificate[0], cert.Certificate[0]))
+	generateTestCertificate(t, filepath.Join(dir, "kafka_cert"), filepath.Join(dir, "kafka_key"))
+
+	conf = configuration.ParseString(fmt.Sprintf(`
+webconfig {
+    secret_provider {
+        type = "dir"
+        dir.path = "%v"
+    }
+    kafka {
+        tls_enabled = true
+        tls_cert_secret = "kafka_cert"
+    }
+}`, dir))
+	_, err = LoadKafkaTLSConfig(conf, "webconfig.kafka")
+	assert.Assert(t, err != nil)
+}
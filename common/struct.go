@@ -37,10 +37,11 @@ type HttpErrorResponse struct {
 }
 
 type Multipart struct {
-	Bytes   []byte
-	Version string
-	Name    string
-	State   int
+	Bytes     []byte
+	Version   string
+	Name      string
+	State     int
+	Signature string
 }
 
 type Version struct {
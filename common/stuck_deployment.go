@@ -0,0 +1,83 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package common
+
+// the error set on the subdocs marked as failure by the stuck deployment sweeper
+const (
+	StuckDeploymentErrorCode    = 900
+	StuckDeploymentErrorDetails = "stuck deployment"
+)
+
+const (
+	RemediationPoke = "poke"
+	RemediationFail = "fail"
+	RemediationWait = "wait"
+)
+
+// the subdocs written in these states are indexed by the time they become stale,
+// in hour buckets kept for a week. The sweeper scans the buckets of that window only.
+const (
+	StaleIndexBucketMillis = 3600 * 1000
+	StaleIndexTTLSecs      = 7 * 86400
+)
+
+var StaleIndexStates = []int{PendingDownload, InDeployment}
+
+// StaleIndexBucket returns the bucket of the time in milliseconds
+func StaleIndexBucket(ms int64) int64 {
+	return ms / StaleIndexBucketMillis
+}
+
+// StaleIndexTime returns the time from which the written subdoc counts as stale,
+// the later of its updated_time, effective_time and retry_time. It returns false
+// if the write does not go into the index.
+func StaleIndexTime(subdoc *SubDocument) (int64, bool) {
+	if subdoc.State() == nil || subdoc.UpdatedTime() == nil {
+		return 0, false
+	}
+	indexed := false
+	for _, state := range StaleIndexStates {
+		if *subdoc.State() == state {
+			indexed = true
+		}
+	}
+	if !indexed {
+		return 0, false
+	}
+	return max(int64(*subdoc.UpdatedTime()), int64(subdoc.HeldUntil())), true
+}
+
+// StuckSubDocument is an entry of the stale subdoc index. It may be outdated, the
+// subdoc is read again before any remediation.
+type StuckSubDocument struct {
+	CpeMac      string `json:"cpe_mac"`
+	SubdocId    string `json:"subdoc_id"`
+	State       int    `json:"state"`
+	UpdatedTime int64  `json:"updated_time"`
+}
+
+// Remediation tracks the pokes sent for a stuck subdoc. UpdatedTime is the
+// updated_time of the subdoc when the remediation started, so that the attempts
+// are reset when the subdoc is written again.
+type Remediation struct {
+	CpeMac       string `json:"cpe_mac"`
+	SubdocId     string `json:"subdoc_id"`
+	Attempts     int    `json:"attempts"`
+	LastPokeTime int64  `json:"last_poke_time"`
+	UpdatedTime  int64  `json:"updated_time"`
+}
@@ -23,13 +23,16 @@ import (
 )
 
 type SubDocument struct {
-	payload      []byte
-	version      *string
-	state        *int
-	updatedTime  *int
-	errorCode    *int
-	errorDetails *string
-	expiry       *int
+	payload       []byte
+	version       *string
+	state         *int
+	updatedTime   *int
+	errorCode     *int
+	errorDetails  *string
+	expiry        *int
+	effectiveTime *int
+	retryAttempts *int
+	retryTime     *int
 }
 
 func NewSubDocument(payload []byte, version *string, state *int, updatedTime *int, errorCode *int, errorDetails *string) *SubDocument {
@@ -158,6 +161,51 @@ func (d *SubDocument) SetExpiry(expiry *int) {
 	d.expiry = expiry
 }
 
+func (d *SubDocument) EffectiveTime() *int {
+	return d.effectiveTime
+}
+
+func (d *SubDocument) SetEffectiveTime(effectiveTime *int) {
+	d.effectiveTime = effectiveTime
+}
+
+// RetryAttempts counts the automatic retries of the current version after failures
+func (d *SubDocument) RetryAttempts() *int {
+	return d.retryAttempts
+}
+
+func (d *SubDocument) SetRetryAttempts(retryAttempts *int) {
+	d.retryAttempts = retryAttempts
+}
+
+// RetryTime is when the pending retry of a failure is due. It is kept apart from
+// the effective_time set by the writer.
+func (d *SubDocument) RetryTime() *int {
+	return d.retryTime
+}
+
+func (d *SubDocument) SetRetryTime(retryTime *int) {
+	d.retryTime = retryTime
+}
+
+// HeldUntil returns the later of effective_time and retry_time, 0 if neither is set
+func (d *SubDocument) HeldUntil() int {
+	heldUntil := 0
+	if d.effectiveTime != nil {
+		heldUntil = *d.effectiveTime
+	}
+	if d.retryTime != nil && *d.retryTime > heldUntil {
+		heldUntil = *d.retryTime
+	}
+	return heldUntil
+}
+
+// IsEffective tells if the subdoc can be delivered at nowMs. A subdoc without an
+// effective_time and a retry_time, or with 0, is always effective.
+func (d *SubDocument) IsEffective(nowMs int) bool {
+	return d.HeldUntil() <= nowMs
+}
+
 func (d *SubDocument) Equals(tdoc *SubDocument) (bool, error) {
 	if d.HasPayload() && tdoc.HasPayload() {
 		if !bytes.Equal(d.Payload(), tdoc.Payload()) {
@@ -257,6 +305,30 @@ func (d *SubDocument) Equals(tdoc *SubDocument) (bool, error) {
 		}
 	}
 
+	if d.EffectiveTime() != nil && tdoc.EffectiveTime() != nil {
+		if *d.EffectiveTime() != *tdoc.EffectiveTime() {
+			err := fmt.Errorf("*d.EffectiveTime()[%v] != *tdoc.EffectiveTime()[%v]", *d.EffectiveTime(), *tdoc.EffectiveTime())
+			return false, NewError(err)
+		}
+	} else {
+		if d.EffectiveTime() != tdoc.EffectiveTime() {
+			err := fmt.Errorf("d.EffectiveTime()[%v] != tdoc.EffectiveTime()[%v]", d.EffectiveTime(), tdoc.EffectiveTime())
+			return false, NewError(err)
+		}
+	}
+
+	var dRetryAttempts, tdocRetryAttempts int
+	if d.RetryAttempts() != nil {
+		dRetryAttempts = *d.RetryAttempts()
+	}
+	if tdoc.RetryAttempts() != nil {
+		tdocRetryAttempts = *tdoc.RetryAttempts()
+	}
+	if dRetryAttempts != tdocRetryAttempts {
+		err := fmt.Errorf("d.RetryAttempts()[%v] != tdoc.RetryAttempts()[%v]", d.RetryAttempts(), tdoc.RetryAttempts())
+		return false, NewError(err)
+	}
+
 	return true, nil
 }
 
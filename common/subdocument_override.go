@@ -0,0 +1,55 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package common
+
+// SubDocumentOverride keeps the subdoc replaced by a temporary write, so that it
+// can be restored when the temporary subdoc expires
+type SubDocumentOverride struct {
+	CpeMac       string `json:"cpe_mac"`
+	SubdocId     string `json:"subdoc_id"`
+	Expiry       int64  `json:"expiry"`
+	PriorPayload []byte `json:"-"`
+	PriorVersion string `json:"prior_version,omitempty"`
+	CreatedTime  int64  `json:"created_time"`
+}
+
+// HasPrior tells if a subdoc existed before the override. If not, the temporary
+// subdoc is removed on expiry.
+func (o *SubDocumentOverride) HasPrior() bool {
+	return len(o.PriorPayload) > 0 || len(o.PriorVersion) > 0
+}
+
+// the overrides are indexed by their expiry in hour buckets, kept for a week after
+// the expiry at most. The reverter reads the expired buckets only.
+const (
+	SubDocumentOverrideBucketMillis = 3600 * 1000
+	SubDocumentOverrideTTLSecs      = 7 * 86400
+)
+
+// SubDocumentOverrideBucket returns the bucket of the time in milliseconds
+func SubDocumentOverrideBucket(ms int64) int64 {
+	return ms / SubDocumentOverrideBucketMillis
+}
+
+// SubDocumentOverrideExpiry is an entry of the override expiry index. It may be
+// outdated, the override is read again before it is reverted.
+type SubDocumentOverrideExpiry struct {
+	CpeMac   string `json:"cpe_mac"`
+	SubdocId string `json:"subdoc_id"`
+	Expiry   int64  `json:"expiry"`
+}
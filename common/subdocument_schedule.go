@@ -0,0 +1,38 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package common
+
+// the schedules are partitioned by their effective_time in hour buckets, and are
+// kept for a week after that time at most. The scheduler reads the due buckets only.
+const (
+	SubDocumentScheduleBucketMillis = 3600 * 1000
+	SubDocumentScheduleTTLSecs      = 7 * 86400
+)
+
+// SubDocumentScheduleBucket returns the bucket of the time in milliseconds
+func SubDocumentScheduleBucket(ms int64) int64 {
+	return ms / SubDocumentScheduleBucketMillis
+}
+
+// SubDocumentSchedule records a subdoc written with an effective_time in the
+// future, so that the device can be poked once the subdoc becomes effective
+type SubDocumentSchedule struct {
+	CpeMac        string `json:"cpe_mac"`
+	SubdocId      string `json:"subdoc_id"`
+	EffectiveTime int64  `json:"effective_time"`
+}
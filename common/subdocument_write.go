@@ -0,0 +1,45 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package common
+
+// SubDocumentWriteMessage is the body of a "subdoc-upsert" or "subdoc-delete" kafka event.
+// It carries the same data as a POST/DELETE to /api/v1/device/{mac}/document/{subdoc_id}.
+type SubDocumentWriteMessage struct {
+	CorrelationId string  `json:"correlation_id,omitempty"`
+	Mac           string  `json:"mac"`
+	SubdocId      string  `json:"subdoc_id"`
+	Version       *string `json:"version,omitempty"`
+	State         *int    `json:"state,omitempty"`
+	Payload       []byte  `json:"payload,omitempty"`
+	Expiry        *int    `json:"expiry,omitempty"`
+	EffectiveTime *int    `json:"effective_time,omitempty"`
+	MetricsAgent  *string `json:"metrics_agent,omitempty"`
+	AutoPoke      bool    `json:"auto_poke,omitempty"`
+}
+
+// SubDocumentWriteResult is published to the reply topic, keyed by the correlation id
+type SubDocumentWriteResult struct {
+	CorrelationId string `json:"correlation_id"`
+	EventName     string `json:"event_name"`
+	Mac           string `json:"mac,omitempty"`
+	SubdocId      string `json:"subdoc_id,omitempty"`
+	Status        int    `json:"status"`
+	Message       string `json:"message,omitempty"`
+	RootVersion   string `json:"root_version,omitempty"`
+	AutoPoke      bool   `json:"auto_poke,omitempty"`
+}
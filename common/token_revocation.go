@@ -0,0 +1,43 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package common
+
+// TokenRevocation revokes a token by its jti, or all the tokens of a mac issued before a time.
+// IssuedBefore and Expiry are in unix seconds like the jwt claims, CreatedTime is in ms.
+type TokenRevocation struct {
+	Jti          string `json:"jti,omitempty"`
+	CpeMac       string `json:"cpe_mac,omitempty"`
+	IssuedBefore int64  `json:"issued_before,omitempty"`
+	Expiry       int64  `json:"expiry,omitempty"`
+	Reason       string `json:"reason,omitempty"`
+	CreatedTime  int64  `json:"created_time"`
+}
+
+// Revokes returns if a token of the jti, or of the mac issued at iat, is revoked. An iat of 0
+// means the token has neither iat nor nbf. Such a token cannot be told apart from the ones issued
+// before the revocation, so it is rejected by any revocation of its mac and has to be reissued with
+// an iat.
+func (r *TokenRevocation) Revokes(jti string, iat int64) bool {
+	if len(r.Jti) > 0 {
+		return r.Jti == jti
+	}
+	if iat <= 0 {
+		return true
+	}
+	return iat < r.IssuedBefore
+}
@@ -32,7 +32,20 @@ var (
 	MultipartContentType = fmt.Sprintf("multipart/mixed; boundary=%s", Boundary)
 )
 
-func WriteMultipartBytes(mparts []Multipart) ([]byte, error) {
+// PartSigner signs the payload of a part together with its name and version, so the devices can
+// verify the parts relayed by the transports we do not control
+type PartSigner interface {
+	SignPart(name string, version string, payload []byte) (string, error)
+}
+
+// WriteMultipartBytes builds the multipart body. With a signer, each part carries its detached
+// signature in the X-Subdocument-Signature header.
+func WriteMultipartBytes(mparts []Multipart, signers ...PartSigner) ([]byte, error) {
+	var signer PartSigner
+	if len(signers) > 0 {
+		signer = signers[0]
+	}
+
 	var buffer bytes.Buffer
 	writer := multipart.NewWriter(&buffer)
 	writer.SetBoundary(Boundary)
@@ -42,6 +55,13 @@ func WriteMultipartBytes(mparts []Multipart) ([]byte, error) {
 			"Namespace":       {m.Name},
 			"Etag":            {m.Version},
 		}
+		if signer != nil {
+			signature, err := signer.SignPart(m.Name, m.Version, m.Bytes)
+			if err != nil {
+				return nil, NewError(err)
+			}
+			header.Set(HeaderSubdocumentSignature, signature)
+		}
 		p, err := writer.CreatePart(header)
 		if err != nil {
 			return nil, NewError(err)
@@ -0,0 +1,158 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package cassandra
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/rdkcentral/webconfig/common"
+)
+
+const (
+	// partition of the audit records of the calls not targeting a device, it is
+	// bucketed by day while the device partitions all use day 0
+	auditLogNoMac = "none"
+	// the largest cassandra timestamp, used when the query has no end time
+	auditLogMaxTime   = int64(1<<63 - 1)
+	auditLogDayMillis = 86400 * 1000
+	// the days read by a subject query without a start time
+	auditLogDefaultSubjectQueryDays = 31
+)
+
+func auditLogDay(ms int64) int64 {
+	return ms / auditLogDayMillis
+}
+
+func (c *CassandraClient) AppendAuditRecord(r *common.AuditRecord) error {
+	c.concurrentQueries <- true
+	defer func() { <-c.concurrentQueries }()
+
+	cpeMac := r.CpeMac
+	day := int64(0)
+	if len(cpeMac) == 0 {
+		cpeMac = auditLogNoMac
+		day = auditLogDay(r.EventTime)
+	}
+	capabilities := strings.Join(r.Capabilities, ",")
+
+	batch := c.NewBatch(gocql.LoggedBatch)
+	stmt := "INSERT INTO audit_log(cpe_mac,day,event_time,audit_id,action,group_id,ref_id,status,subject,kid,capabilities,source_app,old_version,new_version,payload_hash) VALUES(?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)"
+	batch.Query(stmt, cpeMac, day, r.EventTime, r.AuditId, r.Action, r.SubdocId, r.RefId, r.Status, r.Subject, r.Kid,
+		capabilities, r.SourceApp, r.OldVersion, r.NewVersion, r.PayloadHash)
+	if len(r.Subject) > 0 {
+		stmt = "INSERT INTO audit_log_by_subject(subject,day,event_time,audit_id,cpe_mac,action,group_id,ref_id,status,kid,capabilities,source_app,old_version,new_version,payload_hash) VALUES(?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)"
+		batch.Query(stmt, r.Subject, auditLogDay(r.EventTime), r.EventTime, r.AuditId, r.CpeMac, r.Action, r.SubdocId, r.RefId, r.Status, r.Kid,
+			capabilities, r.SourceApp, r.OldVersion, r.NewVersion, r.PayloadHash)
+	}
+	if err := c.ExecuteBatch(batch); err != nil {
+		return common.NewError(err)
+	}
+	return nil
+}
+
+// GetAuditRecords reads the mac partition, or the day partitions of the subject from
+// the end time back to the start time. Without a start time, the subject query reads
+// the last auditLogDefaultSubjectQueryDays days.
+func (c *CassandraClient) GetAuditRecords(q *common.AuditQuery) ([]*common.AuditRecord, error) {
+	c.concurrentQueries <- true
+	defer func() { <-c.concurrentQueries }()
+
+	endTime := q.EndTime
+	if endTime <= 0 {
+		endTime = auditLogMaxTime
+	}
+
+	// the mac partition is preferred, the subject is then filtered here
+	records := []*common.AuditRecord{}
+	if len(q.CpeMac) > 0 {
+		stmt := "SELECT cpe_mac,event_time,audit_id,action,group_id,ref_id,status,subject,kid,capabilities,source_app,old_version,new_version,payload_hash FROM audit_log WHERE cpe_mac=? AND day=0 AND event_time>=? AND event_time<?"
+		if err := c.scanAuditRecords(q, stmt, []interface{}{q.CpeMac, q.StartTime, endTime}, &records); err != nil {
+			return nil, common.NewError(err)
+		}
+		return records, nil
+	}
+
+	lastDay := auditLogDay(time.Now().UnixMilli())
+	if q.EndTime > 0 {
+		lastDay = auditLogDay(q.EndTime - 1)
+	}
+	firstDay := lastDay - auditLogDefaultSubjectQueryDays + 1
+	if q.StartTime > 0 {
+		firstDay = auditLogDay(q.StartTime)
+	}
+	stmt := "SELECT cpe_mac,event_time,audit_id,action,group_id,ref_id,status,subject,kid,capabilities,source_app,old_version,new_version,payload_hash FROM audit_log_by_subject WHERE subject=? AND day=? AND event_time>=? AND event_time<?"
+	for day := lastDay; day >= firstDay; day-- {
+		if q.Limit > 0 && len(records) >= q.Limit {
+			break
+		}
+		if err := c.scanAuditRecords(q, stmt, []interface{}{q.Subject, day, q.StartTime, endTime}, &records); err != nil {
+			return nil, common.NewError(err)
+		}
+	}
+	return records, nil
+}
+
+// scanAuditRecords appends the records of one partition up to the limit of the query
+func (c *CassandraClient) scanAuditRecords(q *common.AuditQuery, stmt string, args []interface{}, records *[]*common.AuditRecord) error {
+	// a mac query filtered by subject is not limited by the db
+	if q.Limit > 0 && (len(q.CpeMac) == 0 || len(q.Subject) == 0) {
+		stmt += " LIMIT ?"
+		args = append(args, q.Limit-len(*records))
+	}
+
+	var cpeMac, auditId, action, subdocId, refId, subject, kid, capabilities, sourceApp, oldVersion, newVersion, payloadHash string
+	var status int
+	var eventTime time.Time
+	iter := c.Query(stmt, args...).Iter()
+	for iter.Scan(&cpeMac, &eventTime, &auditId, &action, &subdocId, &refId, &status, &subject, &kid, &capabilities, &sourceApp, &oldVersion, &newVersion, &payloadHash) {
+		if len(q.Subject) > 0 && subject != q.Subject {
+			continue
+		}
+		if cpeMac == auditLogNoMac {
+			cpeMac = ""
+		}
+		r := &common.AuditRecord{
+			CpeMac:      cpeMac,
+			EventTime:   toMilli(eventTime),
+			AuditId:     auditId,
+			Action:      action,
+			SubdocId:    subdocId,
+			RefId:       refId,
+			Status:      status,
+			Subject:     subject,
+			Kid:         kid,
+			SourceApp:   sourceApp,
+			OldVersion:  oldVersion,
+			NewVersion:  newVersion,
+			PayloadHash: payloadHash,
+		}
+		if len(capabilities) > 0 {
+			r.Capabilities = strings.Split(capabilities, ",")
+		}
+		*records = append(*records, r)
+		if q.Limit > 0 && len(*records) >= q.Limit {
+			break
+		}
+	}
+	if err := iter.Close(); err != nil {
+		return common.NewError(err)
+	}
+	return nil
+}
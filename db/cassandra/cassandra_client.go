@@ -60,6 +60,7 @@ type CassandraClient struct {
 	lockRootDocumentEnabled          bool
 	supplementaryPrecookEnabled      bool
 	supplementaryPrecookStateTTLDays int
+	pokeStatusTTLDays                int
 }
 
 /*
@@ -129,8 +130,15 @@ func NewCassandraClient(conf *configuration.Config, testOnly bool) (*CassandraCl
 	user := dbconf.GetString("user")
 	isSslEnabled := dbconf.GetBoolean("is_ssl_enabled")
 
-	// if the password is encrypted, we need to decrypt it
-	if encryptedPassword != "" {
+	// a plain password named by password_secret takes precedence, otherwise if the password
+	// is encrypted, we need to decrypt it
+	secret, hasSecret, err := common.ReadConfigSecret(conf, "webconfig.database."+dbdriver+".password")
+	if hasSecret {
+		if err != nil {
+			return nil, common.NewError(err)
+		}
+		password = string(secret)
+	} else if encryptedPassword != "" {
 		password, err = codec.Decrypt(encryptedPassword)
 		if err != nil {
 			return nil, common.NewError(err)
@@ -178,6 +186,7 @@ func NewCassandraClient(conf *configuration.Config, testOnly bool) (*CassandraCl
 	lockRootDocumentEnabled := conf.GetBoolean("webconfig.lock_root_document_enabled")
 	supplementaryPrecookEnabled := conf.GetBoolean("webconfig.supplementary_precook_enabled")
 	supplementaryPrecookStateTTLDays := int(conf.GetInt32("webconfig.supplementary_precook_state_ttl_days", 7))
+	pokeStatusTTLDays := int(conf.GetInt32("webconfig.poke_status_ttl_days", 7))
 
 	return &CassandraClient{
 		Session:                          session,
@@ -191,6 +200,7 @@ func NewCassandraClient(conf *configuration.Config, testOnly bool) (*CassandraCl
 		lockRootDocumentEnabled:          lockRootDocumentEnabled,
 		supplementaryPrecookEnabled:      supplementaryPrecookEnabled,
 		supplementaryPrecookStateTTLDays: supplementaryPrecookStateTTLDays,
+		pokeStatusTTLDays:                pokeStatusTTLDays,
 	}, nil
 }
 
@@ -0,0 +1,87 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package cassandra
+
+import (
+	"strings"
+	"time"
+
+	"github.com/rdkcentral/webconfig/common"
+)
+
+// a group left staged by an aborted write is dropped eventually
+const deploymentGroupTTLSecs = 30 * 86400
+
+func (c *CassandraClient) GetDeploymentGroups(cpeMac string) ([]common.DeploymentGroup, error) {
+	c.concurrentQueries <- true
+	defer func() { <-c.concurrentQueries }()
+
+	return c.getDeploymentGroups(cpeMac)
+}
+
+// getDeploymentGroups does not take a query slot, so it can be called within GetDocument
+func (c *CassandraClient) getDeploymentGroups(cpeMac string) ([]common.DeploymentGroup, error) {
+	groups := []common.DeploymentGroup{}
+	var deploymentId, subdocIds string
+	var state int
+	var createdTime, committedTime time.Time
+	iter := c.Query("SELECT deployment_id,subdoc_ids,state,created_time,committed_time FROM deployment_group WHERE cpe_mac=?", cpeMac).Iter()
+	for iter.Scan(&deploymentId, &subdocIds, &state, &createdTime, &committedTime) {
+		groups = append(groups, common.DeploymentGroup{
+			CpeMac:        cpeMac,
+			DeploymentId:  deploymentId,
+			SubdocIds:     strings.Split(subdocIds, ","),
+			State:         state,
+			CreatedTime:   toMilli(createdTime),
+			CommittedTime: toMilli(committedTime),
+		})
+	}
+	if err := iter.Close(); err != nil {
+		return nil, common.NewError(err)
+	}
+	return groups, nil
+}
+
+func (c *CassandraClient) SetDeploymentGroup(g *common.DeploymentGroup) error {
+	c.concurrentQueries <- true
+	defer func() { <-c.concurrentQueries }()
+
+	// the flag makes GetDocument read the groups of the device, it expires with the last group
+	stmt := "UPDATE xpc_group_config USING TTL ? SET deployment_groups=true WHERE cpe_mac=?"
+	if err := c.Query(stmt, deploymentGroupTTLSecs, g.CpeMac).Exec(); err != nil {
+		return common.NewError(err)
+	}
+
+	stmt = "INSERT INTO deployment_group(cpe_mac,deployment_id,subdoc_ids,state,created_time,committed_time) VALUES(?,?,?,?,?,?) USING TTL ?"
+	err := c.Query(stmt, g.CpeMac, g.DeploymentId, strings.Join(g.SubdocIds, ","), g.State, g.CreatedTime, g.CommittedTime, deploymentGroupTTLSecs).Exec()
+	if err != nil {
+		return common.NewError(err)
+	}
+	return nil
+}
+
+func (c *CassandraClient) DeleteDeploymentGroup(cpeMac string, deploymentId string) error {
+	c.concurrentQueries <- true
+	defer func() { <-c.concurrentQueries }()
+
+	err := c.Query("DELETE FROM deployment_group WHERE cpe_mac=? AND deployment_id=?", cpeMac, deploymentId).Exec()
+	if err != nil {
+		return common.NewError(err)
+	}
+	return nil
+}
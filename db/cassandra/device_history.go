@@ -0,0 +1,62 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package cassandra
+
+import (
+	"time"
+
+	"github.com/rdkcentral/webconfig/common"
+)
+
+// the history is kept for a limited time only
+const deviceHistoryTTLSecs = 30 * 86400
+
+func (c *CassandraClient) GetDeviceHistory(cpeMac string, limit int) ([]*common.DeviceEvent, error) {
+	c.concurrentQueries <- true
+	defer func() { <-c.concurrentQueries }()
+
+	events := []*common.DeviceEvent{}
+	var event, groupId, details string
+	var eventTime time.Time
+	iter := c.Query("SELECT event_time,event,group_id,details FROM device_history WHERE cpe_mac=? LIMIT ?", cpeMac, limit).Iter()
+	for iter.Scan(&eventTime, &event, &groupId, &details) {
+		events = append(events, &common.DeviceEvent{
+			CpeMac:    cpeMac,
+			EventTime: toMilli(eventTime),
+			Event:     event,
+			SubdocId:  groupId,
+			Details:   details,
+		})
+	}
+	if err := iter.Close(); err != nil {
+		return nil, common.NewError(err)
+	}
+	return events, nil
+}
+
+func (c *CassandraClient) AppendDeviceHistory(event *common.DeviceEvent) error {
+	c.concurrentQueries <- true
+	defer func() { <-c.concurrentQueries }()
+
+	stmt := "INSERT INTO device_history(cpe_mac,event_time,event,group_id,details) VALUES(?,?,?,?,?) USING TTL ?"
+	err := c.Query(stmt, event.CpeMac, event.EventTime, event.Event, event.SubdocId, event.Details, deviceHistoryTTLSecs).Exec()
+	if err != nil {
+		return common.NewError(err)
+	}
+	return nil
+}
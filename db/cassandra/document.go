@@ -31,18 +31,28 @@ import (
 )
 
 func (c *CassandraClient) GetSubDocument(cpeMac string, groupId string) (*common.SubDocument, error) {
+	return c.getSubDocument(cpeMac, groupId, true)
+}
+
+// GetRawSubDocument returns the subdoc as stored, a reference to a refsubdocument
+// is not resolved
+func (c *CassandraClient) GetRawSubDocument(cpeMac string, groupId string) (*common.SubDocument, error) {
+	return c.getSubDocument(cpeMac, groupId, false)
+}
+
+func (c *CassandraClient) getSubDocument(cpeMac string, groupId string, resolveRef bool) (*common.SubDocument, error) {
 	var err error
 	var payload []byte
 	var version, errorDetails string
-	var state, errorCode int
-	var updatedTime, expiry time.Time
+	var state, errorCode, retryAttempts int
+	var updatedTime, expiry, effectiveTime, retryTime time.Time
 	var updatedTimeTsPtr, expiryTsPtr *int
 
 	c.concurrentQueries <- true
 	defer func() { <-c.concurrentQueries }()
 
-	stmt := "SELECT payload,version,state,updated_time,error_code,error_details,expiry FROM xpc_group_config WHERE cpe_mac=? AND group_id=?"
-	if err := c.Query(stmt, cpeMac, groupId).Scan(&payload, &version, &state, &updatedTime, &errorCode, &errorDetails, &expiry); err != nil {
+	stmt := "SELECT payload,version,state,updated_time,error_code,error_details,expiry,effective_time,retry_attempts,retry_time FROM xpc_group_config WHERE cpe_mac=? AND group_id=?"
+	if err := c.Query(stmt, cpeMac, groupId).Scan(&payload, &version, &state, &updatedTime, &errorCode, &errorDetails, &expiry, &effectiveTime, &retryAttempts, &retryTime); err != nil {
 		return nil, common.NewError(err)
 	}
 
@@ -58,7 +68,7 @@ func (c *CassandraClient) GetSubDocument(cpeMac string, groupId string) (*common
 	}
 
 	// Check if payload contains a reference to a refsubdocument
-	if refId, ok := db.GetRefId(payload); ok {
+	if refId, ok := db.GetRefId(payload); ok && resolveRef {
 		refsubdocument, err := c.GetRefSubDocument(refId)
 		if err != nil {
 			if !c.IsDbNotFound(err) {
@@ -82,6 +92,15 @@ func (c *CassandraClient) GetSubDocument(cpeMac string, groupId string) (*common
 	if expiryTsPtr != nil {
 		subdoc.SetExpiry(expiryTsPtr)
 	}
+	if x := int(effectiveTime.UnixMilli()); x > 0 {
+		subdoc.SetEffectiveTime(&x)
+	}
+	if retryAttempts > 0 {
+		subdoc.SetRetryAttempts(&retryAttempts)
+	}
+	if x := int(retryTime.UnixMilli()); x > 0 {
+		subdoc.SetRetryTime(&x)
+	}
 
 	return subdoc, nil
 }
@@ -180,6 +199,31 @@ func (c *CassandraClient) SetSubDocument(cpeMac string, groupId string, subdoc *
 		values = append(values, &utime)
 		columnMap["expiry"] = utime
 	}
+	if subdoc.EffectiveTime() != nil {
+		columns = append(columns, "effective_time")
+		utime := int64(*subdoc.EffectiveTime())
+		if utime < 0 {
+			err := fmt.Errorf("invalid effective_time: utime=%v, *subdoc.EffectiveTime()=%v", utime, *subdoc.EffectiveTime())
+			return common.NewError(err)
+		}
+		values = append(values, &utime)
+		columnMap["effective_time"] = utime
+	}
+	if subdoc.RetryAttempts() != nil {
+		columns = append(columns, "retry_attempts")
+		values = append(values, subdoc.RetryAttempts())
+		columnMap["retry_attempts"] = subdoc.RetryAttempts()
+	}
+	if subdoc.RetryTime() != nil {
+		columns = append(columns, "retry_time")
+		utime := int64(*subdoc.RetryTime())
+		if utime < 0 {
+			err := fmt.Errorf("invalid retry_time: utime=%v, *subdoc.RetryTime()=%v", utime, *subdoc.RetryTime())
+			return common.NewError(err)
+		}
+		values = append(values, &utime)
+		columnMap["retry_time"] = utime
+	}
 	stmt = fmt.Sprintf("INSERT INTO xpc_group_config(%v) VALUES(%v)", db.GetColumnsStr(columns), db.GetValuesStr(len(columns)))
 
 	c.concurrentQueries <- true
@@ -188,6 +232,9 @@ func (c *CassandraClient) SetSubDocument(cpeMac string, groupId string, subdoc *
 	if err := c.Query(stmt, values...).Exec(); err != nil {
 		return common.NewError(err)
 	}
+	if err := c.indexStaleSubDocument(cpeMac, groupId, subdoc); err != nil {
+		return common.NewError(err)
+	}
 
 	// update state metrics
 	if c.IsMetricsEnabled() {
@@ -258,7 +305,7 @@ func (c *CassandraClient) GetDocument(cpeMac string, xargs ...interface{}) (fndo
 	c.concurrentQueries <- true
 	defer func() { <-c.concurrentQueries }()
 
-	stmt := "SELECT group_id,payload,version,state,updated_time,error_code,error_details,expiry FROM xpc_group_config WHERE cpe_mac=?"
+	stmt := "SELECT group_id,payload,version,state,updated_time,error_code,error_details,expiry,effective_time,retry_time,deployment_groups FROM xpc_group_config WHERE cpe_mac=?"
 	iter := c.Query(stmt, cpeMac).Iter()
 	rmap := make(util.Dict)
 	defer func() {
@@ -280,17 +327,22 @@ func (c *CassandraClient) GetDocument(cpeMac string, xargs ...interface{}) (fndo
 	}()
 
 	now := time.Now()
+	var hasGroups bool
 	for {
 		var err error
 		var payload []byte
 		var groupId, version, errorDetails string
 		var state, errorCode int
-		var updatedTime, expiry time.Time
+		var updatedTime, expiry, effectiveTime, retryTime time.Time
 		var updatedTimeTsPtr *int
 
-		if !iter.Scan(&groupId, &payload, &version, &state, &updatedTime, &errorCode, &errorDetails, &expiry) {
+		if !iter.Scan(&groupId, &payload, &version, &state, &updatedTime, &errorCode, &errorDetails, &expiry, &effectiveTime, &retryTime, &hasGroups) {
 			break
 		}
+		// the static deployment_groups is returned alone when no subdoc is left
+		if len(groupId) == 0 {
+			continue
+		}
 
 		// build the logging obj
 		row := util.Dict{
@@ -304,6 +356,12 @@ func (c *CassandraClient) GetDocument(cpeMac string, xargs ...interface{}) (fndo
 		if !expiry.IsZero() {
 			row["expiry"] = expiry.Format(common.LoggingTimeFormat)
 		}
+		if !effectiveTime.IsZero() {
+			row["effective_time"] = effectiveTime.Format(common.LoggingTimeFormat)
+		}
+		if !retryTime.IsZero() {
+			row["retry_time"] = retryTime.Format(common.LoggingTimeFormat)
+		}
 		row["payload_len"] = len(payload)
 		rmap[groupId] = row
 
@@ -339,10 +397,26 @@ func (c *CassandraClient) GetDocument(cpeMac string, xargs ...interface{}) (fndo
 				subdoc.SetExpiry(&x)
 			}
 		}
+		if x := int(effectiveTime.UnixMilli()); x > 0 {
+			subdoc.SetEffectiveTime(&x)
+		}
+		if x := int(retryTime.UnixMilli()); x > 0 {
+			subdoc.SetRetryTime(&x)
+		}
 
 		doc.SetSubDocument(groupId, subdoc)
 	}
 
+	// the subdocs of staged deployment groups are held back until committed. The
+	// groups are read only for the devices flagged by SetDeploymentGroup.
+	if hasGroups {
+		groups, err := c.getDeploymentGroups(cpeMac)
+		if err != nil {
+			return nil, common.NewError(err)
+		}
+		doc.ApplyDeploymentGroups(groups, now.UnixMilli())
+	}
+
 	if fields != nil {
 		fields["document"] = rmap
 	}
@@ -0,0 +1,75 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package cassandra
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/rdkcentral/webconfig/common"
+)
+
+func (c *CassandraClient) GetKafkaConsumerControl(clusterName string) (*common.KafkaConsumerControl, error) {
+	c.concurrentQueries <- true
+	defer func() { <-c.concurrentQueries }()
+
+	control := common.KafkaConsumerControl{
+		ClusterName: clusterName,
+	}
+	var seekOffsets string
+	var seekTime time.Time
+	stmt := "SELECT paused,seek_id,seek_offsets,seek_time FROM kafka_consumer_control WHERE cluster_name=?"
+	err := c.Query(stmt, clusterName).Scan(&control.Paused, &control.SeekId, &seekOffsets, &seekTime)
+	if err != nil {
+		return nil, common.NewError(err)
+	}
+	if len(seekOffsets) > 0 {
+		if err := json.Unmarshal([]byte(seekOffsets), &control.SeekOffsets); err != nil {
+			return nil, common.NewError(err)
+		}
+	}
+	control.SeekTime = toMilli(seekTime)
+	return &control, nil
+}
+
+func (c *CassandraClient) SetKafkaConsumerPaused(clusterName string, paused bool) error {
+	c.concurrentQueries <- true
+	defer func() { <-c.concurrentQueries }()
+
+	stmt := "UPDATE kafka_consumer_control SET paused=?,updated_time=? WHERE cluster_name=?"
+	if err := c.Query(stmt, paused, time.Now(), clusterName).Exec(); err != nil {
+		return common.NewError(err)
+	}
+	return nil
+}
+
+// SetKafkaConsumerSeek replaces the last seek of the cluster, the pause is not changed
+func (c *CassandraClient) SetKafkaConsumerSeek(control *common.KafkaConsumerControl) error {
+	c.concurrentQueries <- true
+	defer func() { <-c.concurrentQueries }()
+
+	bbytes, err := json.Marshal(control.SeekOffsets)
+	if err != nil {
+		return common.NewError(err)
+	}
+	stmt := "UPDATE kafka_consumer_control SET seek_id=?,seek_offsets=?,seek_time=?,updated_time=? WHERE cluster_name=?"
+	if err := c.Query(stmt, control.SeekId, string(bbytes), control.SeekTime, time.Now(), control.ClusterName).Exec(); err != nil {
+		return common.NewError(err)
+	}
+	return nil
+}
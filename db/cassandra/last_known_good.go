@@ -0,0 +1,68 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package cassandra
+
+import (
+	"time"
+
+	"github.com/rdkcentral/webconfig/common"
+)
+
+const lastKnownGoodColumns = "cpe_mac,group_id,payload,version,deployed_time,failed_version,failure_count"
+
+func (c *CassandraClient) GetLastKnownGood(cpeMac string, groupId string) (*common.LastKnownGood, error) {
+	c.concurrentQueries <- true
+	defer func() { <-c.concurrentQueries }()
+
+	var lkg common.LastKnownGood
+	var dtime time.Time
+	stmt := "SELECT " + lastKnownGoodColumns + " FROM last_known_good WHERE cpe_mac=? AND group_id=?"
+	err := c.Query(stmt, cpeMac, groupId).Scan(&lkg.CpeMac, &lkg.SubdocId, &lkg.Payload, &lkg.Version, &dtime, &lkg.FailedVersion, &lkg.FailureCount)
+	if err != nil {
+		return nil, common.NewError(err)
+	}
+	lkg.DeployedTime = toMilli(dtime)
+	if len(lkg.Payload) > 0 && c.IsEncryptedGroup(groupId) {
+		lkg.Payload, err = c.DecryptBytes(lkg.Payload)
+		if err != nil {
+			return nil, common.NewError(err)
+		}
+	}
+	return &lkg, nil
+}
+
+func (c *CassandraClient) SetLastKnownGood(lkg *common.LastKnownGood) error {
+	c.concurrentQueries <- true
+	defer func() { <-c.concurrentQueries }()
+
+	payload := lkg.Payload
+	if len(payload) > 0 && c.IsEncryptedGroup(lkg.SubdocId) {
+		encbytes, err := c.EncryptBytes(payload)
+		if err != nil {
+			return common.NewError(err)
+		}
+		payload = encbytes
+	}
+
+	stmt := "INSERT INTO last_known_good(" + lastKnownGoodColumns + ") VALUES(?,?,?,?,?,?,?)"
+	err := c.Query(stmt, lkg.CpeMac, lkg.SubdocId, payload, lkg.Version, lkg.DeployedTime, lkg.FailedVersion, lkg.FailureCount).Exec()
+	if err != nil {
+		return common.NewError(err)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package cassandra
+
+import (
+	"github.com/rdkcentral/webconfig/common"
+)
+
+// AcquireLease takes or renews the lease of name for ttlSecs. The row expires by
+// its ttl, and lightweight transactions make sure only one owner holds it.
+func (c *CassandraClient) AcquireLease(name string, owner string, ttlSecs int) (bool, error) {
+	c.concurrentQueries <- true
+	defer func() { <-c.concurrentQueries }()
+
+	stmt := "INSERT INTO leader_lease(name,owner) VALUES(?,?) IF NOT EXISTS USING TTL ?"
+	existing := map[string]interface{}{}
+	applied, err := c.Query(stmt, name, owner, ttlSecs).MapScanCAS(existing)
+	if err != nil {
+		return false, common.NewError(err)
+	}
+	if applied {
+		return true, nil
+	}
+	if x, ok := existing["owner"].(string); !ok || x != owner {
+		return false, nil
+	}
+
+	// renew
+	stmt = "UPDATE leader_lease USING TTL ? SET owner=? WHERE name=? IF owner=?"
+	applied, err = c.Query(stmt, ttlSecs, owner, name, owner).MapScanCAS(map[string]interface{}{})
+	if err != nil {
+		return false, common.NewError(err)
+	}
+	return applied, nil
+}
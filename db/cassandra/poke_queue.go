@@ -0,0 +1,152 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package cassandra
+
+import (
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/rdkcentral/webconfig/common"
+)
+
+const (
+	pokeQueueColumns  = "bucket,cpe_mac,transaction_id,url,header,payload,status,attempts,error_details,created_time,updated_time"
+	pokeStatusColumns = "transaction_id,cpe_mac,status,attempts,error_details,created_time,updated_time"
+)
+
+func toMilli(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixMilli()
+}
+
+// GetPokeTasks reads one partition of the queue
+func (c *CassandraClient) GetPokeTasks(bucket int) ([]*common.PokeTask, error) {
+	c.concurrentQueries <- true
+	defer func() { <-c.concurrentQueries }()
+
+	tasks := []*common.PokeTask{}
+	var task common.PokeTask
+	var ctime, utime time.Time
+	iter := c.Query("SELECT "+pokeQueueColumns+" FROM poke_queue WHERE bucket=?", bucket).Iter()
+	for iter.Scan(&task.Bucket, &task.CpeMac, &task.TransactionId, &task.Url, &task.Header, &task.Payload, &task.Status, &task.Attempts, &task.ErrorDetails, &ctime, &utime) {
+		t := task
+		t.CreatedTime = toMilli(ctime)
+		t.UpdatedTime = toMilli(utime)
+		tasks = append(tasks, &t)
+		task = common.PokeTask{}
+	}
+	if err := iter.Close(); err != nil {
+		return nil, common.NewError(err)
+	}
+	return tasks, nil
+}
+
+func (c *CassandraClient) GetPokeTask(bucket int, cpeMac string) (*common.PokeTask, error) {
+	c.concurrentQueries <- true
+	defer func() { <-c.concurrentQueries }()
+
+	var task common.PokeTask
+	var ctime, utime time.Time
+	stmt := "SELECT " + pokeQueueColumns + " FROM poke_queue WHERE bucket=? AND cpe_mac=?"
+	err := c.Query(stmt, bucket, cpeMac).Scan(&task.Bucket, &task.CpeMac, &task.TransactionId, &task.Url, &task.Header, &task.Payload, &task.Status, &task.Attempts, &task.ErrorDetails, &ctime, &utime)
+	if err != nil {
+		return nil, common.NewError(err)
+	}
+	task.CreatedTime = toMilli(ctime)
+	task.UpdatedTime = toMilli(utime)
+	return &task, nil
+}
+
+func (c *CassandraClient) SetPokeTask(task *common.PokeTask) error {
+	c.concurrentQueries <- true
+	defer func() { <-c.concurrentQueries }()
+
+	stmt := "INSERT INTO poke_queue(" + pokeQueueColumns + ") VALUES(?,?,?,?,?,?,?,?,?,?,?)"
+	err := c.Query(stmt, task.Bucket, task.CpeMac, task.TransactionId, task.Url, task.Header, task.Payload, task.Status, task.Attempts, task.ErrorDetails, task.CreatedTime, task.UpdatedTime).Exec()
+	if err != nil {
+		return common.NewError(err)
+	}
+	return nil
+}
+
+// ClaimPokeTask uses a lightweight transaction so that only one worker across
+// all instances moves a given row to in_progress. The task is updated in place
+// when the claim succeeds.
+func (c *CassandraClient) ClaimPokeTask(task *common.PokeTask) (bool, error) {
+	c.concurrentQueries <- true
+	defer func() { <-c.concurrentQueries }()
+
+	now := time.Now().UnixMilli()
+	stmt := "UPDATE poke_queue SET status=?,attempts=?,updated_time=? WHERE bucket=? AND cpe_mac=? IF transaction_id=? AND status=? AND updated_time=?"
+	applied, err := c.Query(stmt, common.PokeTaskInProgress, task.Attempts+1, now, task.Bucket, task.CpeMac, task.TransactionId, task.Status, task.UpdatedTime).MapScanCAS(map[string]interface{}{})
+	if err != nil {
+		return false, common.NewError(err)
+	}
+	if !applied {
+		return false, nil
+	}
+	task.Status = common.PokeTaskInProgress
+	task.Attempts++
+	task.UpdatedTime = now
+	return true, nil
+}
+
+func (c *CassandraClient) DeletePokeTask(bucket int, cpeMac string, transactionId string) error {
+	c.concurrentQueries <- true
+	defer func() { <-c.concurrentQueries }()
+
+	stmt := "DELETE FROM poke_queue WHERE bucket=? AND cpe_mac=? IF transaction_id=?"
+	if _, err := c.Query(stmt, bucket, cpeMac, transactionId).MapScanCAS(map[string]interface{}{}); err != nil {
+		return common.NewError(err)
+	}
+	return nil
+}
+
+func (c *CassandraClient) GetPokeStatus(transactionId string) (*common.PokeTask, error) {
+	c.concurrentQueries <- true
+	defer func() { <-c.concurrentQueries }()
+
+	var task common.PokeTask
+	var ctime, utime time.Time
+	stmt := "SELECT " + pokeStatusColumns + " FROM poke_status WHERE transaction_id=?"
+	err := c.Query(stmt, transactionId).Scan(&task.TransactionId, &task.CpeMac, &task.Status, &task.Attempts, &task.ErrorDetails, &ctime, &utime)
+	if err != nil {
+		return nil, common.NewError(err)
+	}
+	if len(task.TransactionId) == 0 {
+		return nil, common.NewError(gocql.ErrNotFound)
+	}
+	task.CreatedTime = toMilli(ctime)
+	task.UpdatedTime = toMilli(utime)
+	return &task, nil
+}
+
+func (c *CassandraClient) SetPokeStatus(task *common.PokeTask) error {
+	c.concurrentQueries <- true
+	defer func() { <-c.concurrentQueries }()
+
+	stmt := "INSERT INTO poke_status(" + pokeStatusColumns + ") VALUES(?,?,?,?,?,?,?) USING TTL ?"
+	ttl := c.pokeStatusTTLDays * 86400
+	err := c.Query(stmt, task.TransactionId, task.CpeMac, task.Status, task.Attempts, task.ErrorDetails, task.CreatedTime, task.UpdatedTime, ttl).Exec()
+	if err != nil {
+		return common.NewError(err)
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package cassandra
+
+import (
+	"time"
+
+	"github.com/rdkcentral/webconfig/common"
+)
+
+const (
+	remediationColumns = "cpe_mac,group_id,attempts,last_poke_time,updated_time"
+	// remediation rows of the subdocs recovered by themselves are never deleted explicitly
+	remediationTTLSecs = 7 * 86400
+)
+
+// GetStaleSubDocuments reads one page of the (state, bucket) partition of the
+// stale subdoc index. The returned page state is empty after the last page.
+func (c *CassandraClient) GetStaleSubDocuments(state int, bucket int64, pageState []byte, pageSize int) ([]*common.StuckSubDocument, []byte, error) {
+	c.concurrentQueries <- true
+	defer func() { <-c.concurrentQueries }()
+
+	subdocs := []*common.StuckSubDocument{}
+	var cpeMac, groupId string
+	var updatedTime time.Time
+	stmt := "SELECT cpe_mac,group_id,updated_time FROM stale_subdoc_index WHERE state=? AND bucket=?"
+	iter := c.Query(stmt, state, bucket).PageSize(pageSize).PageState(pageState).Iter()
+	nextPageState := iter.PageState()
+	for iter.Scan(&cpeMac, &groupId, &updatedTime) {
+		subdoc := &common.StuckSubDocument{
+			CpeMac:      cpeMac,
+			SubdocId:    groupId,
+			State:       state,
+			UpdatedTime: toMilli(updatedTime),
+		}
+		subdocs = append(subdocs, subdoc)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, nil, common.NewError(err)
+	}
+	return subdocs, nextPageState, nil
+}
+
+// indexStaleSubDocument adds the written subdoc to the stale subdoc index. The
+// entries are not removed on later writes, they expire by TTL.
+func (c *CassandraClient) indexStaleSubDocument(cpeMac string, groupId string, subdoc *common.SubDocument) error {
+	since, ok := common.StaleIndexTime(subdoc)
+	if !ok {
+		return nil
+	}
+	stmt := "INSERT INTO stale_subdoc_index(state,bucket,since_time,cpe_mac,group_id,updated_time) VALUES(?,?,?,?,?,?) USING TTL ?"
+	err := c.Query(stmt, *subdoc.State(), common.StaleIndexBucket(since), since, cpeMac, groupId, int64(*subdoc.UpdatedTime()), common.StaleIndexTTLSecs).Exec()
+	if err != nil {
+		return common.NewError(err)
+	}
+	return nil
+}
+
+func (c *CassandraClient) GetRemediation(cpeMac string, groupId string) (*common.Remediation, error) {
+	c.concurrentQueries <- true
+	defer func() { <-c.concurrentQueries }()
+
+	var remediation common.Remediation
+	var ptime, utime time.Time
+	stmt := "SELECT " + remediationColumns + " FROM remediation WHERE cpe_mac=? AND group_id=?"
+	err := c.Query(stmt, cpeMac, groupId).Scan(&remediation.CpeMac, &remediation.SubdocId, &remediation.Attempts, &ptime, &utime)
+	if err != nil {
+		return nil, common.NewError(err)
+	}
+	remediation.LastPokeTime = toMilli(ptime)
+	remediation.UpdatedTime = toMilli(utime)
+	return &remediation, nil
+}
+
+func (c *CassandraClient) SetRemediation(remediation *common.Remediation) error {
+	c.concurrentQueries <- true
+	defer func() { <-c.concurrentQueries }()
+
+	stmt := "INSERT INTO remediation(" + remediationColumns + ") VALUES(?,?,?,?,?) USING TTL ?"
+	err := c.Query(stmt, remediation.CpeMac, remediation.SubdocId, remediation.Attempts, remediation.LastPokeTime, remediation.UpdatedTime, remediationTTLSecs).Exec()
+	if err != nil {
+		return common.NewError(err)
+	}
+	return nil
+}
+
+func (c *CassandraClient) DeleteRemediation(cpeMac string, groupId string) error {
+	c.concurrentQueries <- true
+	defer func() { <-c.concurrentQueries }()
+
+	stmt := "DELETE FROM remediation WHERE cpe_mac=? AND group_id=?"
+	if err := c.Query(stmt, cpeMac, groupId).Exec(); err != nil {
+		return common.NewError(err)
+	}
+	return nil
+}
@@ -28,7 +28,11 @@ var (
     group_id text,
     error_code int,
     error_details text,
+    effective_time timestamp,
     expiry timestamp,
+    retry_attempts int,
+    retry_time timestamp,
+    deployment_groups boolean static,
     payload blob,
     state int,
     updated_time timestamp,
@@ -47,26 +51,183 @@ var (
     query_params text,
     route text,
     schema_version text,
+    time_zone text,
     version text
 )`,
 		`CREATE TABLE IF NOT EXISTS reference_document (
     ref_id text PRIMARY KEY,
     payload blob,
     version text
+)`,
+		`CREATE TABLE IF NOT EXISTS subdoc_schedule (
+    bucket bigint,
+    effective_time timestamp,
+    cpe_mac text,
+    group_id text,
+    PRIMARY KEY (bucket, effective_time, cpe_mac, group_id)
+)`,
+		`CREATE TABLE IF NOT EXISTS subdoc_override (
+    cpe_mac text,
+    group_id text,
+    expiry timestamp,
+    prior_payload blob,
+    prior_version text,
+    created_time timestamp,
+    PRIMARY KEY (cpe_mac, group_id)
+)`,
+		`CREATE TABLE IF NOT EXISTS subdoc_override_expiry (
+    bucket bigint,
+    expiry timestamp,
+    cpe_mac text,
+    group_id text,
+    PRIMARY KEY (bucket, expiry, cpe_mac, group_id)
+)`,
+		`CREATE TABLE IF NOT EXISTS remediation (
+    cpe_mac text,
+    group_id text,
+    attempts int,
+    last_poke_time timestamp,
+    updated_time timestamp,
+    PRIMARY KEY (cpe_mac, group_id)
+)`,
+		`CREATE TABLE IF NOT EXISTS stale_subdoc_index (
+    state int,
+    bucket bigint,
+    since_time timestamp,
+    cpe_mac text,
+    group_id text,
+    updated_time timestamp,
+    PRIMARY KEY ((state, bucket), since_time, cpe_mac, group_id)
+)`,
+		`CREATE TABLE IF NOT EXISTS leader_lease (
+    name text PRIMARY KEY,
+    owner text
+)`,
+		`CREATE TABLE IF NOT EXISTS last_known_good (
+    cpe_mac text,
+    group_id text,
+    payload blob,
+    version text,
+    deployed_time timestamp,
+    failed_version text,
+    failure_count int,
+    PRIMARY KEY (cpe_mac, group_id)
+)`,
+		`CREATE TABLE IF NOT EXISTS device_history (
+    cpe_mac text,
+    event_time timestamp,
+    event text,
+    group_id text,
+    details text,
+    PRIMARY KEY (cpe_mac, event_time)
+) WITH CLUSTERING ORDER BY (event_time DESC)`,
+		`CREATE TABLE IF NOT EXISTS deployment_group (
+    cpe_mac text,
+    deployment_id text,
+    subdoc_ids text,
+    state int,
+    created_time timestamp,
+    committed_time timestamp,
+    PRIMARY KEY (cpe_mac, deployment_id)
+)`,
+		`CREATE TABLE IF NOT EXISTS audit_log (
+    cpe_mac text,
+    day bigint,
+    event_time timestamp,
+    audit_id text,
+    action text,
+    group_id text,
+    ref_id text,
+    status int,
+    subject text,
+    kid text,
+    capabilities text,
+    source_app text,
+    old_version text,
+    new_version text,
+    payload_hash text,
+    PRIMARY KEY ((cpe_mac, day), event_time, audit_id)
+) WITH CLUSTERING ORDER BY (event_time DESC, audit_id ASC)`,
+		`CREATE TABLE IF NOT EXISTS audit_log_by_subject (
+    subject text,
+    day bigint,
+    event_time timestamp,
+    audit_id text,
+    cpe_mac text,
+    action text,
+    group_id text,
+    ref_id text,
+    status int,
+    kid text,
+    capabilities text,
+    source_app text,
+    old_version text,
+    new_version text,
+    payload_hash text,
+    PRIMARY KEY ((subject, day), event_time, audit_id, cpe_mac)
+) WITH CLUSTERING ORDER BY (event_time DESC, audit_id ASC, cpe_mac ASC)`,
+		`CREATE TABLE IF NOT EXISTS revoked_token (
+    jti text,
+    expiry bigint,
+    reason text,
+    created_time timestamp,
+    PRIMARY KEY (jti)
+)`,
+		`CREATE TABLE IF NOT EXISTS revoked_device_token (
+    cpe_mac text,
+    issued_before bigint,
+    reason text,
+    created_time timestamp,
+    PRIMARY KEY (cpe_mac)
+)`,
+		`CREATE TABLE IF NOT EXISTS kafka_consumer_control (
+    cluster_name text PRIMARY KEY,
+    paused boolean,
+    seek_id text,
+    seek_offsets text,
+    seek_time timestamp,
+    updated_time timestamp
+)`,
+		`CREATE TABLE IF NOT EXISTS poke_queue (
+    bucket int,
+    cpe_mac text,
+    attempts int,
+    created_time timestamp,
+    error_details text,
+    header blob,
+    payload blob,
+    status text,
+    transaction_id text,
+    updated_time timestamp,
+    url text,
+    PRIMARY KEY (bucket, cpe_mac)
+)`,
+		`CREATE TABLE IF NOT EXISTS poke_status (
+    transaction_id text PRIMARY KEY,
+    attempts int,
+    cpe_mac text,
+    created_time timestamp,
+    error_details text,
+    status text,
+    updated_time timestamp
 )`,
 	}
 
 	CassandraSchemas = map[string]map[string]gocql.Type{
 		"xpc_group_config": {
-			"cpe_mac":       gocql.TypeText,
-			"group_id":      gocql.TypeText,
-			"error_code":    gocql.TypeInt,
-			"error_details": gocql.TypeText,
-			"expiry":        gocql.TypeTimestamp,
-			"payload":       gocql.TypeBlob,
-			"state":         gocql.TypeInt,
-			"updated_time":  gocql.TypeTimestamp,
-			"version":       gocql.TypeText,
+			"cpe_mac":           gocql.TypeText,
+			"group_id":          gocql.TypeText,
+			"deployment_groups": gocql.TypeBoolean,
+			"error_code":        gocql.TypeInt,
+			"error_details":     gocql.TypeText,
+			"effective_time":    gocql.TypeTimestamp,
+			"expiry":            gocql.TypeTimestamp,
+			"payload":           gocql.TypeBlob,
+			"retry_attempts":    gocql.TypeInt,
+			"retry_time":        gocql.TypeTimestamp,
+			"state":             gocql.TypeInt,
+			"updated_time":      gocql.TypeTimestamp,
+			"version":           gocql.TypeText,
 		},
 		"root_document": {
 			"cpe_mac":          gocql.TypeText,
@@ -78,7 +239,147 @@ var (
 			"product_class":    gocql.TypeText,
 			"route":            gocql.TypeText,
 			"schema_version":   gocql.TypeText,
+			"time_zone":        gocql.TypeText,
 			"version":          gocql.TypeText,
 		},
+		"subdoc_schedule": {
+			"bucket":         gocql.TypeBigInt,
+			"effective_time": gocql.TypeTimestamp,
+			"cpe_mac":        gocql.TypeText,
+			"group_id":       gocql.TypeText,
+		},
+		"subdoc_override": {
+			"cpe_mac":       gocql.TypeText,
+			"group_id":      gocql.TypeText,
+			"expiry":        gocql.TypeTimestamp,
+			"prior_payload": gocql.TypeBlob,
+			"prior_version": gocql.TypeText,
+			"created_time":  gocql.TypeTimestamp,
+		},
+		"subdoc_override_expiry": {
+			"bucket":   gocql.TypeBigInt,
+			"expiry":   gocql.TypeTimestamp,
+			"cpe_mac":  gocql.TypeText,
+			"group_id": gocql.TypeText,
+		},
+		"remediation": {
+			"cpe_mac":        gocql.TypeText,
+			"group_id":       gocql.TypeText,
+			"attempts":       gocql.TypeInt,
+			"last_poke_time": gocql.TypeTimestamp,
+			"updated_time":   gocql.TypeTimestamp,
+		},
+		"stale_subdoc_index": {
+			"state":        gocql.TypeInt,
+			"bucket":       gocql.TypeBigInt,
+			"since_time":   gocql.TypeTimestamp,
+			"cpe_mac":      gocql.TypeText,
+			"group_id":     gocql.TypeText,
+			"updated_time": gocql.TypeTimestamp,
+		},
+		"leader_lease": {
+			"name":  gocql.TypeText,
+			"owner": gocql.TypeText,
+		},
+		"last_known_good": {
+			"cpe_mac":        gocql.TypeText,
+			"group_id":       gocql.TypeText,
+			"payload":        gocql.TypeBlob,
+			"version":        gocql.TypeText,
+			"deployed_time":  gocql.TypeTimestamp,
+			"failed_version": gocql.TypeText,
+			"failure_count":  gocql.TypeInt,
+		},
+		"device_history": {
+			"cpe_mac":    gocql.TypeText,
+			"event_time": gocql.TypeTimestamp,
+			"event":      gocql.TypeText,
+			"group_id":   gocql.TypeText,
+			"details":    gocql.TypeText,
+		},
+		"deployment_group": {
+			"cpe_mac":        gocql.TypeText,
+			"deployment_id":  gocql.TypeText,
+			"subdoc_ids":     gocql.TypeText,
+			"state":          gocql.TypeInt,
+			"created_time":   gocql.TypeTimestamp,
+			"committed_time": gocql.TypeTimestamp,
+		},
+		"audit_log": {
+			"cpe_mac":      gocql.TypeText,
+			"day":          gocql.TypeBigInt,
+			"event_time":   gocql.TypeTimestamp,
+			"audit_id":     gocql.TypeText,
+			"action":       gocql.TypeText,
+			"group_id":     gocql.TypeText,
+			"ref_id":       gocql.TypeText,
+			"status":       gocql.TypeInt,
+			"subject":      gocql.TypeText,
+			"kid":          gocql.TypeText,
+			"capabilities": gocql.TypeText,
+			"source_app":   gocql.TypeText,
+			"old_version":  gocql.TypeText,
+			"new_version":  gocql.TypeText,
+			"payload_hash": gocql.TypeText,
+		},
+		"audit_log_by_subject": {
+			"cpe_mac":      gocql.TypeText,
+			"day":          gocql.TypeBigInt,
+			"event_time":   gocql.TypeTimestamp,
+			"audit_id":     gocql.TypeText,
+			"action":       gocql.TypeText,
+			"group_id":     gocql.TypeText,
+			"ref_id":       gocql.TypeText,
+			"status":       gocql.TypeInt,
+			"subject":      gocql.TypeText,
+			"kid":          gocql.TypeText,
+			"capabilities": gocql.TypeText,
+			"source_app":   gocql.TypeText,
+			"old_version":  gocql.TypeText,
+			"new_version":  gocql.TypeText,
+			"payload_hash": gocql.TypeText,
+		},
+		"revoked_token": {
+			"jti":          gocql.TypeText,
+			"expiry":       gocql.TypeBigInt,
+			"reason":       gocql.TypeText,
+			"created_time": gocql.TypeTimestamp,
+		},
+		"revoked_device_token": {
+			"cpe_mac":       gocql.TypeText,
+			"issued_before": gocql.TypeBigInt,
+			"reason":        gocql.TypeText,
+			"created_time":  gocql.TypeTimestamp,
+		},
+		"kafka_consumer_control": {
+			"cluster_name": gocql.TypeText,
+			"paused":       gocql.TypeBoolean,
+			"seek_id":      gocql.TypeText,
+			"seek_offsets": gocql.TypeText,
+			"seek_time":    gocql.TypeTimestamp,
+			"updated_time": gocql.TypeTimestamp,
+		},
+		"poke_queue": {
+			"bucket":         gocql.TypeInt,
+			"cpe_mac":        gocql.TypeText,
+			"attempts":       gocql.TypeInt,
+			"created_time":   gocql.TypeTimestamp,
+			"error_details":  gocql.TypeText,
+			"header":         gocql.TypeBlob,
+			"payload":        gocql.TypeBlob,
+			"status":         gocql.TypeText,
+			"transaction_id": gocql.TypeText,
+			"updated_time":   gocql.TypeTimestamp,
+			"url":            gocql.TypeText,
+		},
+		"poke_status": {
+			"transaction_id": gocql.TypeText,
+			"attempts":       gocql.TypeInt,
+			"cpe_mac":        gocql.TypeText,
+			"created_time":   gocql.TypeTimestamp,
+			"error_details":  gocql.TypeText,
+			"status":         gocql.TypeText,
+			"updated_time":   gocql.TypeTimestamp,
+		},
 	}
 )
@@ -0,0 +1,136 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package cassandra
+
+import (
+	"time"
+
+	"github.com/rdkcentral/webconfig/common"
+)
+
+const subdocOverrideColumns = "cpe_mac,group_id,expiry,prior_payload,prior_version,created_time"
+
+// the prior payloads of the encrypted groups are encrypted like in xpc_group_config
+func (c *CassandraClient) decryptPriorPayload(override *common.SubDocumentOverride) error {
+	if len(override.PriorPayload) == 0 || !c.IsEncryptedGroup(override.SubdocId) {
+		return nil
+	}
+	payload, err := c.DecryptBytes(override.PriorPayload)
+	if err != nil {
+		return common.NewError(err)
+	}
+	override.PriorPayload = payload
+	return nil
+}
+
+// GetSubDocumentOverrideExpiries reads one page of a bucket of the override expiry
+// index, ordered by expiry. The returned page state is empty after the last page.
+func (c *CassandraClient) GetSubDocumentOverrideExpiries(bucket int64, pageState []byte, pageSize int) ([]*common.SubDocumentOverrideExpiry, []byte, error) {
+	c.concurrentQueries <- true
+	defer func() { <-c.concurrentQueries }()
+
+	expiries := []*common.SubDocumentOverrideExpiry{}
+	var cpeMac, groupId string
+	var expiry time.Time
+	stmt := "SELECT expiry,cpe_mac,group_id FROM subdoc_override_expiry WHERE bucket=?"
+	iter := c.Query(stmt, bucket).PageSize(pageSize).PageState(pageState).Iter()
+	nextPageState := iter.PageState()
+	for iter.Scan(&expiry, &cpeMac, &groupId) {
+		entry := &common.SubDocumentOverrideExpiry{
+			CpeMac:   cpeMac,
+			SubdocId: groupId,
+			Expiry:   toMilli(expiry),
+		}
+		expiries = append(expiries, entry)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, nil, common.NewError(err)
+	}
+	return expiries, nextPageState, nil
+}
+
+func (c *CassandraClient) DeleteSubDocumentOverrideExpiry(entry *common.SubDocumentOverrideExpiry) error {
+	c.concurrentQueries <- true
+	defer func() { <-c.concurrentQueries }()
+
+	stmt := "DELETE FROM subdoc_override_expiry WHERE bucket=? AND expiry=? AND cpe_mac=? AND group_id=?"
+	err := c.Query(stmt, common.SubDocumentOverrideBucket(entry.Expiry), entry.Expiry, entry.CpeMac, entry.SubdocId).Exec()
+	if err != nil {
+		return common.NewError(err)
+	}
+	return nil
+}
+
+func (c *CassandraClient) GetSubDocumentOverride(cpeMac string, groupId string) (*common.SubDocumentOverride, error) {
+	c.concurrentQueries <- true
+	defer func() { <-c.concurrentQueries }()
+
+	var override common.SubDocumentOverride
+	var expiry, ctime time.Time
+	stmt := "SELECT " + subdocOverrideColumns + " FROM subdoc_override WHERE cpe_mac=? AND group_id=?"
+	err := c.Query(stmt, cpeMac, groupId).Scan(&override.CpeMac, &override.SubdocId, &expiry, &override.PriorPayload, &override.PriorVersion, &ctime)
+	if err != nil {
+		return nil, common.NewError(err)
+	}
+	override.Expiry = toMilli(expiry)
+	override.CreatedTime = toMilli(ctime)
+	if err := c.decryptPriorPayload(&override); err != nil {
+		return nil, common.NewError(err)
+	}
+	return &override, nil
+}
+
+func (c *CassandraClient) SetSubDocumentOverride(override *common.SubDocumentOverride) error {
+	c.concurrentQueries <- true
+	defer func() { <-c.concurrentQueries }()
+
+	priorPayload := override.PriorPayload
+	if len(priorPayload) > 0 && c.IsEncryptedGroup(override.SubdocId) {
+		encbytes, err := c.EncryptBytes(priorPayload)
+		if err != nil {
+			return common.NewError(err)
+		}
+		priorPayload = encbytes
+	}
+
+	stmt := "INSERT INTO subdoc_override(" + subdocOverrideColumns + ") VALUES(?,?,?,?,?,?)"
+	err := c.Query(stmt, override.CpeMac, override.SubdocId, override.Expiry, priorPayload, override.PriorVersion, override.CreatedTime).Exec()
+	if err != nil {
+		return common.NewError(err)
+	}
+
+	// the entry of a previous expiry is not removed, it is dropped by the reverter
+	ttl := common.SubDocumentOverrideTTLSecs + max(override.Expiry-time.Now().UnixMilli(), 0)/1000
+	stmt = "INSERT INTO subdoc_override_expiry(bucket,expiry,cpe_mac,group_id) VALUES(?,?,?,?) USING TTL ?"
+	err = c.Query(stmt, common.SubDocumentOverrideBucket(override.Expiry), override.Expiry, override.CpeMac, override.SubdocId, ttl).Exec()
+	if err != nil {
+		return common.NewError(err)
+	}
+	return nil
+}
+
+func (c *CassandraClient) DeleteSubDocumentOverride(cpeMac string, groupId string) error {
+	c.concurrentQueries <- true
+	defer func() { <-c.concurrentQueries }()
+
+	stmt := "DELETE FROM subdoc_override WHERE cpe_mac=? AND group_id=?"
+	if err := c.Query(stmt, cpeMac, groupId).Exec(); err != nil {
+		return common.NewError(err)
+	}
+	return nil
+}
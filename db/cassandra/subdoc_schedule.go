@@ -0,0 +1,77 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package cassandra
+
+import (
+	"time"
+
+	"github.com/rdkcentral/webconfig/common"
+)
+
+// GetSubDocumentSchedules reads one page of a bucket of the schedules, ordered by
+// effective_time. The returned page state is empty after the last page.
+func (c *CassandraClient) GetSubDocumentSchedules(bucket int64, pageState []byte, pageSize int) ([]*common.SubDocumentSchedule, []byte, error) {
+	c.concurrentQueries <- true
+	defer func() { <-c.concurrentQueries }()
+
+	schedules := []*common.SubDocumentSchedule{}
+	var cpeMac, groupId string
+	var effectiveTime time.Time
+	stmt := "SELECT effective_time,cpe_mac,group_id FROM subdoc_schedule WHERE bucket=?"
+	iter := c.Query(stmt, bucket).PageSize(pageSize).PageState(pageState).Iter()
+	nextPageState := iter.PageState()
+	for iter.Scan(&effectiveTime, &cpeMac, &groupId) {
+		schedule := &common.SubDocumentSchedule{
+			CpeMac:        cpeMac,
+			SubdocId:      groupId,
+			EffectiveTime: toMilli(effectiveTime),
+		}
+		schedules = append(schedules, schedule)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, nil, common.NewError(err)
+	}
+	return schedules, nextPageState, nil
+}
+
+// SetSubDocumentSchedule adds the schedule to the bucket of its effective_time. The
+// rows expire by TTL, a week after the effective_time.
+func (c *CassandraClient) SetSubDocumentSchedule(schedule *common.SubDocumentSchedule) error {
+	c.concurrentQueries <- true
+	defer func() { <-c.concurrentQueries }()
+
+	ttl := common.SubDocumentScheduleTTLSecs + max(schedule.EffectiveTime-time.Now().UnixMilli(), 0)/1000
+	stmt := "INSERT INTO subdoc_schedule(bucket,effective_time,cpe_mac,group_id) VALUES(?,?,?,?) USING TTL ?"
+	err := c.Query(stmt, common.SubDocumentScheduleBucket(schedule.EffectiveTime), schedule.EffectiveTime, schedule.CpeMac, schedule.SubdocId, ttl).Exec()
+	if err != nil {
+		return common.NewError(err)
+	}
+	return nil
+}
+
+func (c *CassandraClient) DeleteSubDocumentSchedule(schedule *common.SubDocumentSchedule) error {
+	c.concurrentQueries <- true
+	defer func() { <-c.concurrentQueries }()
+
+	stmt := "DELETE FROM subdoc_schedule WHERE bucket=? AND effective_time=? AND cpe_mac=? AND group_id=?"
+	err := c.Query(stmt, common.SubDocumentScheduleBucket(schedule.EffectiveTime), schedule.EffectiveTime, schedule.CpeMac, schedule.SubdocId).Exec()
+	if err != nil {
+		return common.NewError(err)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package cassandra
+
+import (
+	"time"
+
+	"github.com/rdkcentral/webconfig/common"
+)
+
+func (c *CassandraClient) GetTokenRevocation(jti string) (*common.TokenRevocation, error) {
+	c.concurrentQueries <- true
+	defer func() { <-c.concurrentQueries }()
+
+	r := common.TokenRevocation{
+		Jti: jti,
+	}
+	var ctime time.Time
+	err := c.Query("SELECT expiry,reason,created_time FROM revoked_token WHERE jti=?", jti).Scan(&r.Expiry, &r.Reason, &ctime)
+	if err != nil {
+		return nil, common.NewError(err)
+	}
+	r.CreatedTime = toMilli(ctime)
+	return &r, nil
+}
+
+func (c *CassandraClient) GetDeviceTokenRevocation(cpeMac string) (*common.TokenRevocation, error) {
+	c.concurrentQueries <- true
+	defer func() { <-c.concurrentQueries }()
+
+	r := common.TokenRevocation{
+		CpeMac: cpeMac,
+	}
+	var ctime time.Time
+	err := c.Query("SELECT issued_before,reason,created_time FROM revoked_device_token WHERE cpe_mac=?", cpeMac).Scan(&r.IssuedBefore, &r.Reason, &ctime)
+	if err != nil {
+		return nil, common.NewError(err)
+	}
+	r.CreatedTime = toMilli(ctime)
+	return &r, nil
+}
+
+// SetTokenRevocation stores a jti revocation if Jti is set, otherwise a revocation of the mac. A jti
+// revocation expires with the token.
+func (c *CassandraClient) SetTokenRevocation(r *common.TokenRevocation) error {
+	c.concurrentQueries <- true
+	defer func() { <-c.concurrentQueries }()
+
+	var err error
+	if len(r.Jti) > 0 {
+		ttl := 0
+		if r.Expiry > 0 {
+			ttl = int(r.Expiry - time.Now().Unix())
+			if ttl <= 0 {
+				return nil
+			}
+		}
+		stmt := "INSERT INTO revoked_token(jti,expiry,reason,created_time) VALUES(?,?,?,?) USING TTL ?"
+		err = c.Query(stmt, r.Jti, r.Expiry, r.Reason, r.CreatedTime, ttl).Exec()
+	} else {
+		stmt := "INSERT INTO revoked_device_token(cpe_mac,issued_before,reason,created_time) VALUES(?,?,?,?)"
+		err = c.Query(stmt, r.CpeMac, r.IssuedBefore, r.Reason, r.CreatedTime).Exec()
+	}
+	if err != nil {
+		return common.NewError(err)
+	}
+	return nil
+}
@@ -28,6 +28,7 @@ type DatabaseClient interface {
 
 	// SubDocument and Document
 	GetSubDocument(string, string) (*common.SubDocument, error)
+	GetRawSubDocument(string, string) (*common.SubDocument, error)
 	SetSubDocument(string, string, *common.SubDocument, ...interface{}) error
 	DeleteSubDocument(string, string) error
 	DeleteSubDocumentColumns(string, string, ...string) error
@@ -78,4 +79,61 @@ type DatabaseClient interface {
 	SetSupplementaryPrecookEnabled(bool)
 	SupplementaryPrecookStateTTLDays() int
 	SetSupplementaryPrecookStateTTLDays(int)
+
+	// scheduled deliveries
+	GetSubDocumentSchedules(int64, []byte, int) ([]*common.SubDocumentSchedule, []byte, error)
+	SetSubDocumentSchedule(*common.SubDocumentSchedule) error
+	DeleteSubDocumentSchedule(*common.SubDocumentSchedule) error
+
+	// temporary overrides
+	GetSubDocumentOverrideExpiries(int64, []byte, int) ([]*common.SubDocumentOverrideExpiry, []byte, error)
+	DeleteSubDocumentOverrideExpiry(*common.SubDocumentOverrideExpiry) error
+	GetSubDocumentOverride(string, string) (*common.SubDocumentOverride, error)
+	SetSubDocumentOverride(*common.SubDocumentOverride) error
+	DeleteSubDocumentOverride(string, string) error
+
+	// stuck deployments
+	GetStaleSubDocuments(int, int64, []byte, int) ([]*common.StuckSubDocument, []byte, error)
+	GetRemediation(string, string) (*common.Remediation, error)
+	SetRemediation(*common.Remediation) error
+	DeleteRemediation(string, string) error
+
+	// leader election
+	AcquireLease(string, string, int) (bool, error)
+
+	// last known good
+	GetLastKnownGood(string, string) (*common.LastKnownGood, error)
+	SetLastKnownGood(*common.LastKnownGood) error
+
+	// device history, the latest first
+	GetDeviceHistory(string, int) ([]*common.DeviceEvent, error)
+	AppendDeviceHistory(*common.DeviceEvent) error
+
+	// deployment groups, GetDocument holds back the subdocs of staged groups
+	GetDeploymentGroups(string) ([]common.DeploymentGroup, error)
+	SetDeploymentGroup(*common.DeploymentGroup) error
+	DeleteDeploymentGroup(string, string) error
+
+	// append-only audit log, the latest first
+	AppendAuditRecord(*common.AuditRecord) error
+	GetAuditRecords(*common.AuditQuery) ([]*common.AuditRecord, error)
+
+	// token revocations, by jti or by mac
+	GetTokenRevocation(string) (*common.TokenRevocation, error)
+	GetDeviceTokenRevocation(string) (*common.TokenRevocation, error)
+	SetTokenRevocation(*common.TokenRevocation) error
+
+	// kafka consumer group pause and seek, shared by the replicas
+	GetKafkaConsumerControl(string) (*common.KafkaConsumerControl, error)
+	SetKafkaConsumerPaused(string, bool) error
+	SetKafkaConsumerSeek(*common.KafkaConsumerControl) error
+
+	// async poke queue
+	GetPokeTasks(int) ([]*common.PokeTask, error)
+	GetPokeTask(int, string) (*common.PokeTask, error)
+	SetPokeTask(*common.PokeTask) error
+	ClaimPokeTask(*common.PokeTask) (bool, error)
+	DeletePokeTask(int, string, string) error
+	GetPokeStatus(string) (*common.PokeTask, error)
+	SetPokeStatus(*common.PokeTask) error
 }
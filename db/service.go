@@ -631,7 +631,7 @@ func RebuildDeviceVersionMap(versions []string, cloudVersionMap map[string]strin
 }
 
 func RefreshRootDocumentVersion(doc *common.Document) {
-	versionMap := doc.VersionMap()
+	versionMap := doc.EffectiveVersionMap(int(time.Now().UnixMilli()))
 	rootVersion := HashRootVersion(versionMap)
 	rootDoc := doc.GetRootDocument()
 	if rootDoc != nil {
@@ -693,6 +693,7 @@ func GetRefId(payload []byte) (string, bool) {
 
 func LoadRefSubDocuments(c DatabaseClient, document *common.Document, fields log.Fields) (*common.Document, error) {
 	newDocument := common.NewDocument(document.GetRootDocument())
+	newDocument.SetOrder(document.Order())
 	for subdocId, subDocument := range document.Items() {
 		payload := subDocument.Payload()
 		if refId, ok := GetRefId(payload); ok {
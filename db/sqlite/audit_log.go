@@ -0,0 +1,104 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package sqlite
+
+import (
+	"database/sql"
+	"strings"
+
+	"github.com/rdkcentral/webconfig/common"
+)
+
+const auditLogColumns = "cpe_mac,event_time,audit_id,action,group_id,ref_id,status,subject,kid,capabilities,source_app,old_version,new_version,payload_hash"
+
+func (c *SqliteClient) AppendAuditRecord(r *common.AuditRecord) error {
+	c.concurrentQueries <- true
+	defer func() { <-c.concurrentQueries }()
+
+	// the log is append-only, a duplicated key is an error rather than a replace
+	stmt, err := c.Prepare("INSERT INTO audit_log(" + auditLogColumns + ") VALUES(?,?,?,?,?,?,?,?,?,?,?,?,?,?)")
+	if err != nil {
+		return common.NewError(err)
+	}
+	_, err = stmt.Exec(r.CpeMac, r.EventTime, r.AuditId, r.Action, r.SubdocId, r.RefId, r.Status, r.Subject, r.Kid,
+		strings.Join(r.Capabilities, ","), r.SourceApp, r.OldVersion, r.NewVersion, r.PayloadHash)
+	if err != nil {
+		return common.NewError(err)
+	}
+	return nil
+}
+
+func (c *SqliteClient) GetAuditRecords(q *common.AuditQuery) ([]*common.AuditRecord, error) {
+	c.concurrentQueries <- true
+	defer func() { <-c.concurrentQueries }()
+
+	conditions := []string{"event_time>=?"}
+	args := []interface{}{q.StartTime}
+	if q.EndTime > 0 {
+		conditions = append(conditions, "event_time<?")
+		args = append(args, q.EndTime)
+	}
+	if len(q.CpeMac) > 0 {
+		conditions = append(conditions, "cpe_mac=?")
+		args = append(args, q.CpeMac)
+	}
+	if len(q.Subject) > 0 {
+		conditions = append(conditions, "subject=?")
+		args = append(args, q.Subject)
+	}
+	stmt := "SELECT " + auditLogColumns + " FROM audit_log WHERE " + strings.Join(conditions, " AND ") + " ORDER BY event_time DESC"
+	if q.Limit > 0 {
+		stmt += " LIMIT ?"
+		args = append(args, q.Limit)
+	}
+
+	rows, err := c.Query(stmt, args...)
+	if err != nil {
+		return nil, common.NewError(err)
+	}
+	defer rows.Close()
+
+	records := []*common.AuditRecord{}
+	for rows.Next() {
+		var ns1, ns2, ns3, ns4, ns5, ns6, ns7, ns8, ns9, ns10, ns11, ns12 sql.NullString
+		var ni1, ni2 sql.NullInt64
+		if err := rows.Scan(&ns1, &ni1, &ns2, &ns3, &ns4, &ns5, &ni2, &ns6, &ns7, &ns8, &ns9, &ns10, &ns11, &ns12); err != nil {
+			return nil, common.NewError(err)
+		}
+		r := &common.AuditRecord{
+			CpeMac:      ns1.String,
+			EventTime:   ni1.Int64,
+			AuditId:     ns2.String,
+			Action:      ns3.String,
+			SubdocId:    ns4.String,
+			RefId:       ns5.String,
+			Status:      int(ni2.Int64),
+			Subject:     ns6.String,
+			Kid:         ns7.String,
+			SourceApp:   ns9.String,
+			OldVersion:  ns10.String,
+			NewVersion:  ns11.String,
+			PayloadHash: ns12.String,
+		}
+		if len(ns8.String) > 0 {
+			r.Capabilities = strings.Split(ns8.String, ",")
+		}
+		records = append(records, r)
+	}
+	return records, nil
+}
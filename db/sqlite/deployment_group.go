@@ -0,0 +1,89 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package sqlite
+
+import (
+	"database/sql"
+	"strings"
+
+	"github.com/rdkcentral/webconfig/common"
+)
+
+func (c *SqliteClient) GetDeploymentGroups(cpeMac string) ([]common.DeploymentGroup, error) {
+	c.concurrentQueries <- true
+	defer func() { <-c.concurrentQueries }()
+
+	return c.getDeploymentGroups(cpeMac)
+}
+
+// getDeploymentGroups does not take a query slot, so it can be called within GetDocument
+func (c *SqliteClient) getDeploymentGroups(cpeMac string) ([]common.DeploymentGroup, error) {
+	rows, err := c.Query("SELECT deployment_id,subdoc_ids,state,created_time,committed_time FROM deployment_group WHERE cpe_mac=?", cpeMac)
+	if err != nil {
+		return nil, common.NewError(err)
+	}
+	defer rows.Close()
+
+	groups := []common.DeploymentGroup{}
+	for rows.Next() {
+		var ns1, ns2 sql.NullString
+		var ni1, ni2, ni3 sql.NullInt64
+		if err := rows.Scan(&ns1, &ns2, &ni1, &ni2, &ni3); err != nil {
+			return nil, common.NewError(err)
+		}
+		groups = append(groups, common.DeploymentGroup{
+			CpeMac:        cpeMac,
+			DeploymentId:  ns1.String,
+			SubdocIds:     strings.Split(ns2.String, ","),
+			State:         int(ni1.Int64),
+			CreatedTime:   ni2.Int64,
+			CommittedTime: ni3.Int64,
+		})
+	}
+	return groups, nil
+}
+
+func (c *SqliteClient) SetDeploymentGroup(g *common.DeploymentGroup) error {
+	c.concurrentQueries <- true
+	defer func() { <-c.concurrentQueries }()
+
+	stmt, err := c.Prepare("INSERT OR REPLACE INTO deployment_group(cpe_mac,deployment_id,subdoc_ids,state,created_time,committed_time) VALUES(?,?,?,?,?,?)")
+	if err != nil {
+		return common.NewError(err)
+	}
+	_, err = stmt.Exec(g.CpeMac, g.DeploymentId, strings.Join(g.SubdocIds, ","), g.State, g.CreatedTime, g.CommittedTime)
+	if err != nil {
+		return common.NewError(err)
+	}
+	return nil
+}
+
+func (c *SqliteClient) DeleteDeploymentGroup(cpeMac string, deploymentId string) error {
+	c.concurrentQueries <- true
+	defer func() { <-c.concurrentQueries }()
+
+	stmt, err := c.Prepare("DELETE FROM deployment_group WHERE cpe_mac=? AND deployment_id=?")
+	if err != nil {
+		return common.NewError(err)
+	}
+	_, err = stmt.Exec(cpeMac, deploymentId)
+	if err != nil {
+		return common.NewError(err)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package sqlite
+
+import (
+	"database/sql"
+
+	"github.com/rdkcentral/webconfig/common"
+)
+
+func (c *SqliteClient) GetDeviceHistory(cpeMac string, limit int) ([]*common.DeviceEvent, error) {
+	c.concurrentQueries <- true
+	defer func() { <-c.concurrentQueries }()
+
+	rows, err := c.Query("SELECT cpe_mac,event_time,event,group_id,details FROM device_history WHERE cpe_mac=? ORDER BY event_time DESC LIMIT ?", cpeMac, limit)
+	if err != nil {
+		return nil, common.NewError(err)
+	}
+	defer rows.Close()
+
+	events := []*common.DeviceEvent{}
+	for rows.Next() {
+		var ns1, ns2, ns3, ns4 sql.NullString
+		var ni1 sql.NullInt64
+		if err := rows.Scan(&ns1, &ni1, &ns2, &ns3, &ns4); err != nil {
+			return nil, common.NewError(err)
+		}
+		event := &common.DeviceEvent{
+			CpeMac:    ns1.String,
+			EventTime: ni1.Int64,
+			Event:     ns2.String,
+			SubdocId:  ns3.String,
+			Details:   ns4.String,
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+func (c *SqliteClient) AppendDeviceHistory(event *common.DeviceEvent) error {
+	c.concurrentQueries <- true
+	defer func() { <-c.concurrentQueries }()
+
+	stmt, err := c.Prepare("INSERT OR REPLACE INTO device_history(cpe_mac,event_time,event,group_id,details) VALUES(?,?,?,?,?)")
+	if err != nil {
+		return common.NewError(err)
+	}
+	if _, err = stmt.Exec(event.CpeMac, event.EventTime, event.Event, event.SubdocId, event.Details); err != nil {
+		return common.NewError(err)
+	}
+	return nil
+}
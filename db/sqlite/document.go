@@ -21,6 +21,7 @@ import (
 	"database/sql"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rdkcentral/webconfig/common"
@@ -30,23 +31,33 @@ import (
 )
 
 func (c *SqliteClient) GetSubDocument(cpeMac string, groupId string) (*common.SubDocument, error) {
+	return c.getSubDocument(cpeMac, groupId, true)
+}
+
+// GetRawSubDocument returns the subdoc as stored, a reference to a refsubdocument
+// is not resolved
+func (c *SqliteClient) GetRawSubDocument(cpeMac string, groupId string) (*common.SubDocument, error) {
+	return c.getSubDocument(cpeMac, groupId, false)
+}
+
+func (c *SqliteClient) getSubDocument(cpeMac string, groupId string, resolveRef bool) (*common.SubDocument, error) {
 	c.concurrentQueries <- true
 	defer func() { <-c.concurrentQueries }()
 
-	rows, err := c.Query("SELECT payload,state,updated_time,version,error_code,error_details,expiry FROM xpc_group_config WHERE cpe_mac=? AND group_id=?", cpeMac, groupId)
+	rows, err := c.Query("SELECT payload,state,updated_time,version,error_code,error_details,expiry,effective_time,retry_attempts,retry_time FROM xpc_group_config WHERE cpe_mac=? AND group_id=?", cpeMac, groupId)
 	if err != nil {
 		return nil, common.NewError(err)
 	}
 
 	var ns1, ns2 sql.NullString
 	var b1 []byte
-	var nt1, nt2 sql.NullInt64
-	var ni1, ni2 sql.NullInt64
+	var nt1, nt2, nt3, nt4 sql.NullInt64
+	var ni1, ni2, ni3 sql.NullInt64
 
 	if !rows.Next() {
 		return nil, sql.ErrNoRows
 	}
-	err = rows.Scan(&b1, &ni1, &nt1, &ns1, &ni2, &ns2, &nt2)
+	err = rows.Scan(&b1, &ni1, &nt1, &ns1, &ni2, &ns2, &nt2, &nt3, &ni3, &nt4)
 	defer rows.Close()
 	if err != nil {
 		return nil, common.NewError(err)
@@ -79,7 +90,7 @@ func (c *SqliteClient) GetSubDocument(cpeMac string, groupId string) (*common.Su
 	}
 
 	// Check if payload contains a reference to a refsubdocument
-	if refId, ok := db.GetRefId(b1); ok {
+	if refId, ok := db.GetRefId(b1); ok && resolveRef {
 		refsubdocument, err := c.GetRefSubDocument(refId)
 		if err != nil {
 			if !c.IsDbNotFound(err) {
@@ -96,6 +107,18 @@ func (c *SqliteClient) GetSubDocument(cpeMac string, groupId string) (*common.Su
 	if expiry != nil {
 		doc.SetExpiry(expiry)
 	}
+	if nt3.Valid && nt3.Int64 > 0 {
+		tt := int(nt3.Int64)
+		doc.SetEffectiveTime(&tt)
+	}
+	if ni3.Valid && ni3.Int64 > 0 {
+		attempts := int(ni3.Int64)
+		doc.SetRetryAttempts(&attempts)
+	}
+	if nt4.Valid && nt4.Int64 > 0 {
+		tt := int(nt4.Int64)
+		doc.SetRetryTime(&tt)
+	}
 	return doc, nil
 }
 
@@ -126,6 +149,18 @@ func (c *SqliteClient) insertSubDocument(cpeMac string, groupId string, doc *com
 		columns = append(columns, "expiry")
 		values = append(values, doc.Expiry())
 	}
+	if doc.EffectiveTime() != nil {
+		columns = append(columns, "effective_time")
+		values = append(values, doc.EffectiveTime())
+	}
+	if doc.RetryAttempts() != nil {
+		columns = append(columns, "retry_attempts")
+		values = append(values, doc.RetryAttempts())
+	}
+	if doc.RetryTime() != nil {
+		columns = append(columns, "retry_time")
+		values = append(values, doc.RetryTime())
+	}
 	if doc.ErrorCode() != nil {
 		columns = append(columns, "error_code")
 		values = append(values, doc.ErrorCode())
@@ -178,6 +213,22 @@ func (c *SqliteClient) updateSubDocument(cpeMac string, groupId string, doc *com
 		columns = append(columns, "error_details")
 		values = append(values, doc.ErrorDetails())
 	}
+	if doc.Expiry() != nil {
+		columns = append(columns, "expiry")
+		values = append(values, doc.Expiry())
+	}
+	if doc.EffectiveTime() != nil {
+		columns = append(columns, "effective_time")
+		values = append(values, doc.EffectiveTime())
+	}
+	if doc.RetryAttempts() != nil {
+		columns = append(columns, "retry_attempts")
+		values = append(values, doc.RetryAttempts())
+	}
+	if doc.RetryTime() != nil {
+		columns = append(columns, "retry_time")
+		values = append(values, doc.RetryTime())
+	}
 	values = append(values, cpeMac)
 	values = append(values, groupId)
 	qstr := fmt.Sprintf("UPDATE xpc_group_config SET %v WHERE cpe_mac=? AND group_id=?", db.GetSetColumnsStr(columns))
@@ -233,6 +284,9 @@ func (c *SqliteClient) SetSubDocument(cpeMac string, groupId string, doc *common
 			return common.NewError(err)
 		}
 	}
+	if err := c.indexStaleSubDocument(cpeMac, groupId, doc); err != nil {
+		return common.NewError(err)
+	}
 
 	// update state metrics
 	if c.IsMetricsEnabled() {
@@ -307,8 +361,14 @@ func (c *SqliteClient) GetDocument(cpeMac string, xargs ...interface{}) (*common
 
 	c.concurrentQueries <- true
 	defer func() { <-c.concurrentQueries }()
+
+	groups, err := c.getDeploymentGroups(cpeMac)
+	if err != nil {
+		return nil, common.NewError(err)
+	}
+
 	// ns0,    b1,     ni1,  nt1,        ns1,     nil2      ns2
-	rows, err := c.Query("SELECT group_id,payload,state,updated_time,version,error_code,error_details FROM xpc_group_config WHERE cpe_mac=?", cpeMac)
+	rows, err := c.Query("SELECT group_id,payload,state,updated_time,version,error_code,error_details,effective_time,retry_time FROM xpc_group_config WHERE cpe_mac=?", cpeMac)
 	if err != nil {
 		return nil, common.NewError(err)
 	}
@@ -317,10 +377,10 @@ func (c *SqliteClient) GetDocument(cpeMac string, xargs ...interface{}) (*common
 	for rows.Next() {
 		var ns0, ns1, ns2 sql.NullString
 		var b1 []byte
-		var nt1 sql.NullInt64
+		var nt1, nt2, nt3 sql.NullInt64
 		var ni1, ni2 sql.NullInt64
 
-		err = rows.Scan(&ns0, &b1, &ni1, &nt1, &ns1, &ni2, &ns2)
+		err = rows.Scan(&ns0, &b1, &ni1, &nt1, &ns1, &ni2, &ns2, &nt2, &nt3)
 		if err != nil {
 			return nil, common.NewError(err)
 		}
@@ -353,9 +413,20 @@ func (c *SqliteClient) GetDocument(cpeMac string, xargs ...interface{}) (*common
 		}
 
 		doc := common.NewSubDocument(b1, s1, i1, ts, i2, s2)
+		if nt2.Valid && nt2.Int64 > 0 {
+			tt := int(nt2.Int64)
+			doc.SetEffectiveTime(&tt)
+		}
+		if nt3.Valid && nt3.Int64 > 0 {
+			tt := int(nt3.Int64)
+			doc.SetRetryTime(&tt)
+		}
 		Document.SetSubDocument(groupId, doc)
 	}
 
+	// the subdocs of staged deployment groups are held back until committed
+	Document.ApplyDeploymentGroups(groups, time.Now().UnixMilli())
+
 	if Document.Length() == 0 {
 		return Document, common.NewError(sql.ErrNoRows)
 	} else {
@@ -0,0 +1,92 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package sqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/rdkcentral/webconfig/common"
+)
+
+func (c *SqliteClient) GetKafkaConsumerControl(clusterName string) (*common.KafkaConsumerControl, error) {
+	c.concurrentQueries <- true
+	defer func() { <-c.concurrentQueries }()
+
+	rows, err := c.Query("SELECT paused,seek_id,seek_offsets,seek_time FROM kafka_consumer_control WHERE cluster_name=?", clusterName)
+	if err != nil {
+		return nil, common.NewError(err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, sql.ErrNoRows
+	}
+
+	var ns1, ns2 sql.NullString
+	var ni1, ni2 sql.NullInt64
+	if err := rows.Scan(&ni1, &ns1, &ns2, &ni2); err != nil {
+		return nil, common.NewError(err)
+	}
+	control := &common.KafkaConsumerControl{
+		ClusterName: clusterName,
+		Paused:      ni1.Int64 != 0,
+		SeekId:      ns1.String,
+		SeekTime:    ni2.Int64,
+	}
+	if len(ns2.String) > 0 {
+		if err := json.Unmarshal([]byte(ns2.String), &control.SeekOffsets); err != nil {
+			return nil, common.NewError(err)
+		}
+	}
+	return control, nil
+}
+
+func (c *SqliteClient) SetKafkaConsumerPaused(clusterName string, paused bool) error {
+	c.concurrentQueries <- true
+	defer func() { <-c.concurrentQueries }()
+
+	stmt, err := c.Prepare("INSERT INTO kafka_consumer_control(cluster_name,paused,updated_time) VALUES(?,?,?) ON CONFLICT(cluster_name) DO UPDATE SET paused=excluded.paused,updated_time=excluded.updated_time")
+	if err != nil {
+		return common.NewError(err)
+	}
+	if _, err := stmt.Exec(clusterName, paused, time.Now().UnixMilli()); err != nil {
+		return common.NewError(err)
+	}
+	return nil
+}
+
+// SetKafkaConsumerSeek replaces the last seek of the cluster, the pause is not changed
+func (c *SqliteClient) SetKafkaConsumerSeek(control *common.KafkaConsumerControl) error {
+	c.concurrentQueries <- true
+	defer func() { <-c.concurrentQueries }()
+
+	bbytes, err := json.Marshal(control.SeekOffsets)
+	if err != nil {
+		return common.NewError(err)
+	}
+	stmt, err := c.Prepare("INSERT INTO kafka_consumer_control(cluster_name,seek_id,seek_offsets,seek_time,updated_time) VALUES(?,?,?,?,?) ON CONFLICT(cluster_name) DO UPDATE SET seek_id=excluded.seek_id,seek_offsets=excluded.seek_offsets,seek_time=excluded.seek_time,updated_time=excluded.updated_time")
+	if err != nil {
+		return common.NewError(err)
+	}
+	if _, err := stmt.Exec(control.ClusterName, control.SeekId, string(bbytes), control.SeekTime, time.Now().UnixMilli()); err != nil {
+		return common.NewError(err)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package sqlite
+
+import (
+	"database/sql"
+
+	"github.com/rdkcentral/webconfig/common"
+)
+
+const lastKnownGoodColumns = "cpe_mac,group_id,payload,version,deployed_time,failed_version,failure_count"
+
+func (c *SqliteClient) GetLastKnownGood(cpeMac string, groupId string) (*common.LastKnownGood, error) {
+	c.concurrentQueries <- true
+	defer func() { <-c.concurrentQueries }()
+
+	rows, err := c.Query("SELECT "+lastKnownGoodColumns+" FROM last_known_good WHERE cpe_mac=? AND group_id=?", cpeMac, groupId)
+	if err != nil {
+		return nil, common.NewError(err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, sql.ErrNoRows
+	}
+	var ns1, ns2, ns3, ns4 sql.NullString
+	var ni1, ni2 sql.NullInt64
+	var payload []byte
+	if err := rows.Scan(&ns1, &ns2, &payload, &ns3, &ni1, &ns4, &ni2); err != nil {
+		return nil, common.NewError(err)
+	}
+	lkg := &common.LastKnownGood{
+		CpeMac:        ns1.String,
+		SubdocId:      ns2.String,
+		Payload:       payload,
+		Version:       ns3.String,
+		DeployedTime:  ni1.Int64,
+		FailedVersion: ns4.String,
+		FailureCount:  int(ni2.Int64),
+	}
+	return lkg, nil
+}
+
+func (c *SqliteClient) SetLastKnownGood(lkg *common.LastKnownGood) error {
+	c.concurrentQueries <- true
+	defer func() { <-c.concurrentQueries }()
+
+	stmt, err := c.Prepare("INSERT OR REPLACE INTO last_known_good(" + lastKnownGoodColumns + ") VALUES(?,?,?,?,?,?,?)")
+	if err != nil {
+		return common.NewError(err)
+	}
+	_, err = stmt.Exec(lkg.CpeMac, lkg.SubdocId, lkg.Payload, lkg.Version, lkg.DeployedTime, lkg.FailedVersion, lkg.FailureCount)
+	if err != nil {
+		return common.NewError(err)
+	}
+	return nil
+}
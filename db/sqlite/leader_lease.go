@@ -0,0 +1,46 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package sqlite
+
+import (
+	"time"
+
+	"github.com/rdkcentral/webconfig/common"
+)
+
+// AcquireLease takes or renews the lease of name for ttlSecs. It fails if the
+// lease is held by another owner and not expired yet.
+func (c *SqliteClient) AcquireLease(name string, owner string, ttlSecs int) (bool, error) {
+	c.concurrentQueries <- true
+	defer func() { <-c.concurrentQueries }()
+
+	stmt, err := c.Prepare("INSERT INTO leader_lease(name,owner,expiry) VALUES(?,?,?) ON CONFLICT(name) DO UPDATE SET owner=excluded.owner,expiry=excluded.expiry WHERE leader_lease.owner=excluded.owner OR leader_lease.expiry<?")
+	if err != nil {
+		return false, common.NewError(err)
+	}
+	now := time.Now().UnixMilli()
+	res, err := stmt.Exec(name, owner, now+int64(ttlSecs)*1000, now)
+	if err != nil {
+		return false, common.NewError(err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, common.NewError(err)
+	}
+	return n > 0, nil
+}
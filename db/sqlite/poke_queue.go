@@ -0,0 +1,210 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package sqlite
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/rdkcentral/webconfig/common"
+)
+
+const (
+	pokeQueueColumns  = "bucket,cpe_mac,transaction_id,url,header,payload,status,attempts,error_details,created_time,updated_time"
+	pokeStatusColumns = "transaction_id,cpe_mac,status,attempts,error_details,created_time,updated_time"
+)
+
+func scanPokeTask(rows *sql.Rows) (*common.PokeTask, error) {
+	var ns1, ns2, ns3, ns4, ns5 sql.NullString
+	var ni0, ni1, ni2, ni3 sql.NullInt64
+	var header, payload []byte
+	if err := rows.Scan(&ni0, &ns1, &ns2, &ns3, &header, &payload, &ns4, &ni1, &ns5, &ni2, &ni3); err != nil {
+		return nil, common.NewError(err)
+	}
+	task := &common.PokeTask{
+		Bucket:        int(ni0.Int64),
+		CpeMac:        ns1.String,
+		TransactionId: ns2.String,
+		Url:           ns3.String,
+		Header:        header,
+		Payload:       payload,
+		Status:        ns4.String,
+		Attempts:      int(ni1.Int64),
+		ErrorDetails:  ns5.String,
+		CreatedTime:   ni2.Int64,
+		UpdatedTime:   ni3.Int64,
+	}
+	return task, nil
+}
+
+// GetPokeTasks reads one partition of the queue
+func (c *SqliteClient) GetPokeTasks(bucket int) ([]*common.PokeTask, error) {
+	c.concurrentQueries <- true
+	defer func() { <-c.concurrentQueries }()
+
+	rows, err := c.Query("SELECT "+pokeQueueColumns+" FROM poke_queue WHERE bucket=? ORDER BY updated_time", bucket)
+	if err != nil {
+		return nil, common.NewError(err)
+	}
+	defer rows.Close()
+
+	tasks := []*common.PokeTask{}
+	for rows.Next() {
+		task, err := scanPokeTask(rows)
+		if err != nil {
+			return nil, common.NewError(err)
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, nil
+}
+
+func (c *SqliteClient) GetPokeTask(bucket int, cpeMac string) (*common.PokeTask, error) {
+	c.concurrentQueries <- true
+	defer func() { <-c.concurrentQueries }()
+
+	rows, err := c.Query("SELECT "+pokeQueueColumns+" FROM poke_queue WHERE bucket=? AND cpe_mac=?", bucket, cpeMac)
+	if err != nil {
+		return nil, common.NewError(err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, sql.ErrNoRows
+	}
+	return scanPokeTask(rows)
+}
+
+func (c *SqliteClient) SetPokeTask(task *common.PokeTask) error {
+	c.concurrentQueries <- true
+	defer func() { <-c.concurrentQueries }()
+
+	stmt, err := c.Prepare("INSERT OR REPLACE INTO poke_queue(" + pokeQueueColumns + ") VALUES(?,?,?,?,?,?,?,?,?,?,?)")
+	if err != nil {
+		return common.NewError(err)
+	}
+	_, err = stmt.Exec(task.Bucket, task.CpeMac, task.TransactionId, task.Url, task.Header, task.Payload, task.Status, task.Attempts, task.ErrorDetails, task.CreatedTime, task.UpdatedTime)
+	if err != nil {
+		return common.NewError(err)
+	}
+	return nil
+}
+
+// ClaimPokeTask moves the task to in_progress only if the row still matches the
+// transaction_id/status/updated_time read by the caller. The task is updated in
+// place when the claim succeeds.
+func (c *SqliteClient) ClaimPokeTask(task *common.PokeTask) (bool, error) {
+	c.concurrentQueries <- true
+	defer func() { <-c.concurrentQueries }()
+
+	stmt, err := c.Prepare("UPDATE poke_queue SET status=?,attempts=?,updated_time=? WHERE bucket=? AND cpe_mac=? AND transaction_id=? AND status=? AND updated_time=?")
+	if err != nil {
+		return false, common.NewError(err)
+	}
+	now := time.Now().UnixMilli()
+	res, err := stmt.Exec(common.PokeTaskInProgress, task.Attempts+1, now, task.Bucket, task.CpeMac, task.TransactionId, task.Status, task.UpdatedTime)
+	if err != nil {
+		return false, common.NewError(err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, common.NewError(err)
+	}
+	if n == 0 {
+		return false, nil
+	}
+	task.Status = common.PokeTaskInProgress
+	task.Attempts++
+	task.UpdatedTime = now
+	return true, nil
+}
+
+func (c *SqliteClient) DeletePokeTask(bucket int, cpeMac string, transactionId string) error {
+	c.concurrentQueries <- true
+	defer func() { <-c.concurrentQueries }()
+
+	stmt, err := c.Prepare("DELETE FROM poke_queue WHERE bucket=? AND cpe_mac=? AND transaction_id=?")
+	if err != nil {
+		return common.NewError(err)
+	}
+	if _, err = stmt.Exec(bucket, cpeMac, transactionId); err != nil {
+		return common.NewError(err)
+	}
+	return nil
+}
+
+func (c *SqliteClient) GetPokeStatus(transactionId string) (*common.PokeTask, error) {
+	c.concurrentQueries <- true
+	defer func() { <-c.concurrentQueries }()
+
+	// the expired rows are deleted by SetPokeStatus, skip those not deleted yet
+	rows, err := c.Query("SELECT "+pokeStatusColumns+" FROM poke_status WHERE transaction_id=? AND updated_time>=?", transactionId, c.pokeStatusExpiry())
+	if err != nil {
+		return nil, common.NewError(err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, sql.ErrNoRows
+	}
+
+	var ns1, ns2, ns3, ns4 sql.NullString
+	var ni1, ni2, ni3 sql.NullInt64
+	if err := rows.Scan(&ns1, &ns2, &ns3, &ni1, &ns4, &ni2, &ni3); err != nil {
+		return nil, common.NewError(err)
+	}
+	task := &common.PokeTask{
+		TransactionId: ns1.String,
+		CpeMac:        ns2.String,
+		Status:        ns3.String,
+		Attempts:      int(ni1.Int64),
+		ErrorDetails:  ns4.String,
+		CreatedTime:   ni2.Int64,
+		UpdatedTime:   ni3.Int64,
+	}
+	return task, nil
+}
+
+// SetPokeStatus also deletes the statuses older than webconfig.poke_status_ttl_days,
+// like the ttl of the cassandra rows
+func (c *SqliteClient) SetPokeStatus(task *common.PokeTask) error {
+	c.concurrentQueries <- true
+	defer func() { <-c.concurrentQueries }()
+
+	stmt, err := c.Prepare("DELETE FROM poke_status WHERE updated_time<?")
+	if err != nil {
+		return common.NewError(err)
+	}
+	if _, err = stmt.Exec(c.pokeStatusExpiry()); err != nil {
+		return common.NewError(err)
+	}
+
+	stmt, err = c.Prepare("INSERT OR REPLACE INTO poke_status(" + pokeStatusColumns + ") VALUES(?,?,?,?,?,?,?)")
+	if err != nil {
+		return common.NewError(err)
+	}
+	_, err = stmt.Exec(task.TransactionId, task.CpeMac, task.Status, task.Attempts, task.ErrorDetails, task.CreatedTime, task.UpdatedTime)
+	if err != nil {
+		return common.NewError(err)
+	}
+	return nil
+}
+
+func (c *SqliteClient) pokeStatusExpiry() int64 {
+	return time.Now().Add(-time.Duration(c.pokeStatusTTLDays) * 24 * time.Hour).UnixMilli()
+}
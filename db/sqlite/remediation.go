@@ -0,0 +1,160 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package sqlite
+
+import (
+	"database/sql"
+	"strconv"
+	"time"
+
+	"github.com/rdkcentral/webconfig/common"
+)
+
+const remediationColumns = "cpe_mac,group_id,attempts,last_poke_time,updated_time"
+
+// GetStaleSubDocuments reads one page of the (state, bucket) partition of the
+// stale subdoc index. The page state is the offset of the next page, it is empty
+// after the last page.
+func (c *SqliteClient) GetStaleSubDocuments(state int, bucket int64, pageState []byte, pageSize int) ([]*common.StuckSubDocument, []byte, error) {
+	offset := 0
+	if len(pageState) > 0 {
+		x, err := strconv.Atoi(string(pageState))
+		if err != nil {
+			return nil, nil, common.NewError(err)
+		}
+		offset = x
+	}
+
+	c.concurrentQueries <- true
+	defer func() { <-c.concurrentQueries }()
+
+	qstr := "SELECT cpe_mac,group_id,updated_time FROM stale_subdoc_index WHERE state=? AND bucket=? ORDER BY since_time,cpe_mac,group_id LIMIT ? OFFSET ?"
+	rows, err := c.Query(qstr, state, bucket, pageSize, offset)
+	if err != nil {
+		return nil, nil, common.NewError(err)
+	}
+	defer rows.Close()
+
+	subdocs := []*common.StuckSubDocument{}
+	for rows.Next() {
+		var ns1, ns2 sql.NullString
+		var ni1 sql.NullInt64
+		if err := rows.Scan(&ns1, &ns2, &ni1); err != nil {
+			return nil, nil, common.NewError(err)
+		}
+		subdoc := &common.StuckSubDocument{
+			CpeMac:      ns1.String,
+			SubdocId:    ns2.String,
+			State:       state,
+			UpdatedTime: ni1.Int64,
+		}
+		subdocs = append(subdocs, subdoc)
+	}
+	var nextPageState []byte
+	if len(subdocs) == pageSize {
+		nextPageState = []byte(strconv.Itoa(offset + pageSize))
+	}
+	return subdocs, nextPageState, nil
+}
+
+// indexStaleSubDocument adds the written subdoc to the stale subdoc index. The
+// entries are not removed on later writes, the expired buckets are deleted here.
+func (c *SqliteClient) indexStaleSubDocument(cpeMac string, groupId string, doc *common.SubDocument) error {
+	since, ok := common.StaleIndexTime(doc)
+	if !ok {
+		return nil
+	}
+
+	c.concurrentQueries <- true
+	defer func() { <-c.concurrentQueries }()
+
+	stmt, err := c.Prepare("DELETE FROM stale_subdoc_index WHERE bucket<?")
+	if err != nil {
+		return common.NewError(err)
+	}
+	expiry := time.Now().Add(-common.StaleIndexTTLSecs * time.Second).UnixMilli()
+	if _, err = stmt.Exec(common.StaleIndexBucket(expiry)); err != nil {
+		return common.NewError(err)
+	}
+
+	stmt, err = c.Prepare("INSERT OR REPLACE INTO stale_subdoc_index(state,bucket,since_time,cpe_mac,group_id,updated_time) VALUES(?,?,?,?,?,?)")
+	if err != nil {
+		return common.NewError(err)
+	}
+	if _, err = stmt.Exec(*doc.State(), common.StaleIndexBucket(since), since, cpeMac, groupId, *doc.UpdatedTime()); err != nil {
+		return common.NewError(err)
+	}
+	return nil
+}
+
+func (c *SqliteClient) GetRemediation(cpeMac string, groupId string) (*common.Remediation, error) {
+	c.concurrentQueries <- true
+	defer func() { <-c.concurrentQueries }()
+
+	rows, err := c.Query("SELECT "+remediationColumns+" FROM remediation WHERE cpe_mac=? AND group_id=?", cpeMac, groupId)
+	if err != nil {
+		return nil, common.NewError(err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, sql.ErrNoRows
+	}
+	var ns1, ns2 sql.NullString
+	var ni1, ni2, ni3 sql.NullInt64
+	if err := rows.Scan(&ns1, &ns2, &ni1, &ni2, &ni3); err != nil {
+		return nil, common.NewError(err)
+	}
+	remediation := &common.Remediation{
+		CpeMac:       ns1.String,
+		SubdocId:     ns2.String,
+		Attempts:     int(ni1.Int64),
+		LastPokeTime: ni2.Int64,
+		UpdatedTime:  ni3.Int64,
+	}
+	return remediation, nil
+}
+
+func (c *SqliteClient) SetRemediation(remediation *common.Remediation) error {
+	c.concurrentQueries <- true
+	defer func() { <-c.concurrentQueries }()
+
+	stmt, err := c.Prepare("INSERT OR REPLACE INTO remediation(" + remediationColumns + ") VALUES(?,?,?,?,?)")
+	if err != nil {
+		return common.NewError(err)
+	}
+	_, err = stmt.Exec(remediation.CpeMac, remediation.SubdocId, remediation.Attempts, remediation.LastPokeTime, remediation.UpdatedTime)
+	if err != nil {
+		return common.NewError(err)
+	}
+	return nil
+}
+
+func (c *SqliteClient) DeleteRemediation(cpeMac string, groupId string) error {
+	c.concurrentQueries <- true
+	defer func() { <-c.concurrentQueries }()
+
+	stmt, err := c.Prepare("DELETE FROM remediation WHERE cpe_mac=? AND group_id=?")
+	if err != nil {
+		return common.NewError(err)
+	}
+	if _, err = stmt.Exec(cpeMac, groupId); err != nil {
+		return common.NewError(err)
+	}
+	return nil
+}
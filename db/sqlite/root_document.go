@@ -28,7 +28,7 @@ func (c *SqliteClient) GetRootDocument(cpeMac string) (*common.RootDocument, err
 	c.concurrentQueries <- true
 	defer func() { <-c.concurrentQueries }()
 
-	rows, err := c.Query("SELECT bitmap,firmware_version,model_name,partner_id,schema_version,version,product_class,account_type FROM root_document WHERE cpe_mac=?", cpeMac)
+	rows, err := c.Query("SELECT bitmap,firmware_version,model_name,partner_id,schema_version,version,product_class,account_type,route,time_zone FROM root_document WHERE cpe_mac=?", cpeMac)
 	if err != nil {
 		return nil, common.NewError(err)
 	}
@@ -38,8 +38,8 @@ func (c *SqliteClient) GetRootDocument(cpeMac string) (*common.RootDocument, err
 	}
 
 	var ni sql.NullInt64
-	var ns1, ns2, ns3, ns4, ns5, ns6, ns7 sql.NullString
-	err = rows.Scan(&ni, &ns1, &ns2, &ns3, &ns4, &ns5, &ns6, &ns7)
+	var ns1, ns2, ns3, ns4, ns5, ns6, ns7, ns8, ns9 sql.NullString
+	err = rows.Scan(&ni, &ns1, &ns2, &ns3, &ns4, &ns5, &ns6, &ns7, &ns8, &ns9)
 	defer rows.Close()
 	if err != nil {
 		return nil, common.NewError(err)
@@ -75,7 +75,14 @@ func (c *SqliteClient) GetRootDocument(cpeMac string) (*common.RootDocument, err
 		account_type = ns7.String
 	}
 
-	return common.NewRootDocument(bitmap, firmware_version, model_name, partner_id, schema_version, version, "", product_class, account_type), nil
+	rdoc := common.NewRootDocument(bitmap, firmware_version, model_name, partner_id, schema_version, version, "", product_class, account_type)
+	if ns8.Valid {
+		rdoc.Route = ns8.String
+	}
+	if ns9.Valid {
+		rdoc.TimeZone = ns9.String
+	}
+	return rdoc, nil
 }
 
 func (c *SqliteClient) insertRootDocumentVersion(cpeMac, version string) error {
@@ -214,12 +221,12 @@ func (c *SqliteClient) insertRootDocument(cpeMac string, rd *common.RootDocument
 	c.concurrentQueries <- true
 	defer func() { <-c.concurrentQueries }()
 
-	stmt, err := c.Prepare("INSERT INTO root_document(cpe_mac,bitmap,firmware_version,model_name,partner_id,schema_version,version,product_class,account_type) VALUES(?,?,?,?,?,?,?,?,?)")
+	stmt, err := c.Prepare("INSERT INTO root_document(cpe_mac,bitmap,firmware_version,model_name,partner_id,schema_version,version,product_class,account_type,route,time_zone) VALUES(?,?,?,?,?,?,?,?,?,?,?)")
 	if err != nil {
 		return common.NewError(err)
 	}
 
-	_, err = stmt.Exec(cpeMac, rd.Bitmap, rd.FirmwareVersion, rd.ModelName, rd.PartnerId, rd.SchemaVersion, rd.Version, rd.ProductClass, rd.AccountType)
+	_, err = stmt.Exec(cpeMac, rd.Bitmap, rd.FirmwareVersion, rd.ModelName, rd.PartnerId, rd.SchemaVersion, rd.Version, rd.ProductClass, rd.AccountType, rd.Route, rd.TimeZone)
 	if err != nil {
 		return common.NewError(err)
 	}
@@ -230,11 +237,11 @@ func (c *SqliteClient) updateRootDocument(cpeMac string, rd *common.RootDocument
 	c.concurrentQueries <- true
 	defer func() { <-c.concurrentQueries }()
 
-	stmt, err := c.Prepare("UPDATE root_document SET bitmap=?,firmware_version=?,model_name=?,partner_id=?,schema_version=?,version=?,product_class=?,account_type=?  WHERE cpe_mac=?")
+	stmt, err := c.Prepare("UPDATE root_document SET bitmap=?,firmware_version=?,model_name=?,partner_id=?,schema_version=?,version=?,product_class=?,account_type=?,route=?,time_zone=?  WHERE cpe_mac=?")
 	if err != nil {
 		return common.NewError(err)
 	}
-	_, err = stmt.Exec(rd.Bitmap, rd.FirmwareVersion, rd.ModelName, rd.PartnerId, rd.SchemaVersion, rd.Version, rd.ProductClass, rd.AccountType, cpeMac)
+	_, err = stmt.Exec(rd.Bitmap, rd.FirmwareVersion, rd.ModelName, rd.PartnerId, rd.SchemaVersion, rd.Version, rd.ProductClass, rd.AccountType, rd.Route, rd.TimeZone, cpeMac)
 	if err != nil {
 		return common.NewError(err)
 	}
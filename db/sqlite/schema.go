@@ -42,7 +42,10 @@ var (
     state int,
     error_code int,
     error_details text,
+    effective_time timestamp,
     expiry timestamp,
+    retry_attempts int,
+    retry_time timestamp,
     PRIMARY KEY (cpe_mac, group_id)
 )`,
 		`CREATE TABLE IF NOT EXISTS root_document (
@@ -57,12 +60,146 @@ var (
     query_params text,
     route text,
     schema_version,
+    time_zone text,
     version text
 )`,
 		`CREATE TABLE IF NOT EXISTS reference_document (
     ref_id text PRIMARY KEY,
     payload blob,
     version text
+)`,
+		`CREATE TABLE IF NOT EXISTS subdoc_schedule (
+    bucket bigint NOT NULL,
+    effective_time bigint NOT NULL,
+    cpe_mac text NOT NULL,
+    group_id text NOT NULL,
+    PRIMARY KEY (bucket, effective_time, cpe_mac, group_id)
+)`,
+		`CREATE TABLE IF NOT EXISTS subdoc_override (
+    cpe_mac text NOT NULL,
+    group_id text NOT NULL,
+    expiry bigint,
+    prior_payload blob,
+    prior_version text,
+    created_time bigint,
+    PRIMARY KEY (cpe_mac, group_id)
+)`,
+		`CREATE TABLE IF NOT EXISTS subdoc_override_expiry (
+    bucket bigint NOT NULL,
+    expiry bigint NOT NULL,
+    cpe_mac text NOT NULL,
+    group_id text NOT NULL,
+    PRIMARY KEY (bucket, expiry, cpe_mac, group_id)
+)`,
+		`CREATE TABLE IF NOT EXISTS remediation (
+    cpe_mac text NOT NULL,
+    group_id text NOT NULL,
+    attempts int,
+    last_poke_time bigint,
+    updated_time bigint,
+    PRIMARY KEY (cpe_mac, group_id)
+)`,
+		`CREATE TABLE IF NOT EXISTS stale_subdoc_index (
+    state int NOT NULL,
+    bucket bigint NOT NULL,
+    since_time bigint NOT NULL,
+    cpe_mac text NOT NULL,
+    group_id text NOT NULL,
+    updated_time bigint,
+    PRIMARY KEY (state, bucket, since_time, cpe_mac, group_id)
+)`,
+		`CREATE TABLE IF NOT EXISTS leader_lease (
+    name text PRIMARY KEY,
+    owner text,
+    expiry bigint
+)`,
+		`CREATE TABLE IF NOT EXISTS last_known_good (
+    cpe_mac text NOT NULL,
+    group_id text NOT NULL,
+    payload blob,
+    version text,
+    deployed_time bigint,
+    failed_version text,
+    failure_count int,
+    PRIMARY KEY (cpe_mac, group_id)
+)`,
+		`CREATE TABLE IF NOT EXISTS device_history (
+    cpe_mac text NOT NULL,
+    event_time bigint NOT NULL,
+    event text,
+    group_id text,
+    details text,
+    PRIMARY KEY (cpe_mac, event_time)
+)`,
+		`CREATE TABLE IF NOT EXISTS deployment_group (
+    cpe_mac text NOT NULL,
+    deployment_id text NOT NULL,
+    subdoc_ids text,
+    state int,
+    created_time bigint,
+    committed_time bigint,
+    PRIMARY KEY (cpe_mac, deployment_id)
+)`,
+		`CREATE TABLE IF NOT EXISTS audit_log (
+    cpe_mac text NOT NULL,
+    event_time bigint NOT NULL,
+    audit_id text NOT NULL,
+    action text,
+    group_id text,
+    ref_id text,
+    status int,
+    subject text,
+    kid text,
+    capabilities text,
+    source_app text,
+    old_version text,
+    new_version text,
+    payload_hash text,
+    PRIMARY KEY (cpe_mac, event_time, audit_id)
+)`,
+		`CREATE TABLE IF NOT EXISTS revoked_token (
+    jti text NOT NULL,
+    expiry bigint,
+    reason text,
+    created_time bigint,
+    PRIMARY KEY (jti)
+)`,
+		`CREATE TABLE IF NOT EXISTS revoked_device_token (
+    cpe_mac text NOT NULL,
+    issued_before bigint,
+    reason text,
+    created_time bigint,
+    PRIMARY KEY (cpe_mac)
+)`,
+		`CREATE TABLE IF NOT EXISTS kafka_consumer_control (
+    cluster_name text PRIMARY KEY,
+    paused int,
+    seek_id text,
+    seek_offsets text,
+    seek_time bigint,
+    updated_time bigint
+)`,
+		`CREATE TABLE IF NOT EXISTS poke_queue (
+    cpe_mac text PRIMARY KEY,
+    bucket int,
+    transaction_id text,
+    url text,
+    header blob,
+    payload blob,
+    status text,
+    attempts int,
+    error_details text,
+    created_time bigint,
+    updated_time bigint
+)`,
+		`CREATE TABLE IF NOT EXISTS poke_status (
+    transaction_id text PRIMARY KEY,
+    cpe_mac text,
+    status text,
+    attempts int,
+    error_details text,
+    created_time bigint,
+    updated_time bigint
 )`,
 	}
 )
@@ -49,6 +49,7 @@ type SqliteClient struct {
 	lockRootDocumentEnabled          bool
 	supplementaryPrecookEnabled      bool
 	supplementaryPrecookStateTTLDays int
+	pokeStatusTTLDays                int
 }
 
 func NewSqliteClient(conf *configuration.Config, testOnly bool) (*SqliteClient, error) {
@@ -66,6 +67,7 @@ func NewSqliteClient(conf *configuration.Config, testOnly bool) (*SqliteClient,
 	lockRootDocumentEnabled := conf.GetBoolean("webconfig.lock_root_document_enabled")
 	supplementaryPrecookEnabled := conf.GetBoolean("webconfig.supplementary_precook_enabled")
 	supplementaryPrecookStateTTLDays := int(conf.GetInt32("webconfig.supplementary_precook_state_ttl_days", 7))
+	pokeStatusTTLDays := int(conf.GetInt32("webconfig.poke_status_ttl_days", 7))
 
 	db, err := sql.Open("sqlite", dbfile)
 	if err != nil {
@@ -80,6 +82,7 @@ func NewSqliteClient(conf *configuration.Config, testOnly bool) (*SqliteClient,
 		lockRootDocumentEnabled:          lockRootDocumentEnabled,
 		supplementaryPrecookEnabled:      supplementaryPrecookEnabled,
 		supplementaryPrecookStateTTLDays: supplementaryPrecookStateTTLDays,
+		pokeStatusTTLDays:                pokeStatusTTLDays,
 	}, nil
 }
 
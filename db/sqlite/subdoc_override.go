@@ -0,0 +1,169 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package sqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/rdkcentral/webconfig/common"
+)
+
+const subdocOverrideColumns = "cpe_mac,group_id,expiry,prior_payload,prior_version,created_time"
+
+func scanSubDocumentOverride(rows *sql.Rows) (*common.SubDocumentOverride, error) {
+	var ns1, ns2, ns3 sql.NullString
+	var ni1, ni2 sql.NullInt64
+	var payload []byte
+	if err := rows.Scan(&ns1, &ns2, &ni1, &payload, &ns3, &ni2); err != nil {
+		return nil, common.NewError(err)
+	}
+	override := &common.SubDocumentOverride{
+		CpeMac:       ns1.String,
+		SubdocId:     ns2.String,
+		Expiry:       ni1.Int64,
+		PriorPayload: payload,
+		PriorVersion: ns3.String,
+		CreatedTime:  ni2.Int64,
+	}
+	return override, nil
+}
+
+// GetSubDocumentOverrideExpiries reads one page of a bucket of the override expiry
+// index, ordered by expiry. The page state is the last entry read, so that the
+// entries deleted between the pages do not shift the next page. It is empty after
+// the last page.
+func (c *SqliteClient) GetSubDocumentOverrideExpiries(bucket int64, pageState []byte, pageSize int) ([]*common.SubDocumentOverrideExpiry, []byte, error) {
+	var last common.SubDocumentOverrideExpiry
+	if len(pageState) > 0 {
+		if err := json.Unmarshal(pageState, &last); err != nil {
+			return nil, nil, common.NewError(err)
+		}
+	}
+
+	c.concurrentQueries <- true
+	defer func() { <-c.concurrentQueries }()
+
+	qstr := "SELECT expiry,cpe_mac,group_id FROM subdoc_override_expiry WHERE bucket=? AND (expiry,cpe_mac,group_id)>(?,?,?) ORDER BY expiry,cpe_mac,group_id LIMIT ?"
+	rows, err := c.Query(qstr, bucket, last.Expiry, last.CpeMac, last.SubdocId, pageSize)
+	if err != nil {
+		return nil, nil, common.NewError(err)
+	}
+	defer rows.Close()
+
+	expiries := []*common.SubDocumentOverrideExpiry{}
+	for rows.Next() {
+		var ni1 sql.NullInt64
+		var ns1, ns2 sql.NullString
+		if err := rows.Scan(&ni1, &ns1, &ns2); err != nil {
+			return nil, nil, common.NewError(err)
+		}
+		entry := &common.SubDocumentOverrideExpiry{
+			CpeMac:   ns1.String,
+			SubdocId: ns2.String,
+			Expiry:   ni1.Int64,
+		}
+		expiries = append(expiries, entry)
+	}
+	var nextPageState []byte
+	if len(expiries) == pageSize {
+		nextPageState, err = json.Marshal(expiries[len(expiries)-1])
+		if err != nil {
+			return nil, nil, common.NewError(err)
+		}
+	}
+	return expiries, nextPageState, nil
+}
+
+func (c *SqliteClient) DeleteSubDocumentOverrideExpiry(entry *common.SubDocumentOverrideExpiry) error {
+	c.concurrentQueries <- true
+	defer func() { <-c.concurrentQueries }()
+
+	stmt, err := c.Prepare("DELETE FROM subdoc_override_expiry WHERE bucket=? AND expiry=? AND cpe_mac=? AND group_id=?")
+	if err != nil {
+		return common.NewError(err)
+	}
+	if _, err = stmt.Exec(common.SubDocumentOverrideBucket(entry.Expiry), entry.Expiry, entry.CpeMac, entry.SubdocId); err != nil {
+		return common.NewError(err)
+	}
+	return nil
+}
+
+func (c *SqliteClient) GetSubDocumentOverride(cpeMac string, groupId string) (*common.SubDocumentOverride, error) {
+	c.concurrentQueries <- true
+	defer func() { <-c.concurrentQueries }()
+
+	rows, err := c.Query("SELECT "+subdocOverrideColumns+" FROM subdoc_override WHERE cpe_mac=? AND group_id=?", cpeMac, groupId)
+	if err != nil {
+		return nil, common.NewError(err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, sql.ErrNoRows
+	}
+	return scanSubDocumentOverride(rows)
+}
+
+func (c *SqliteClient) SetSubDocumentOverride(override *common.SubDocumentOverride) error {
+	c.concurrentQueries <- true
+	defer func() { <-c.concurrentQueries }()
+
+	stmt, err := c.Prepare("INSERT OR REPLACE INTO subdoc_override(" + subdocOverrideColumns + ") VALUES(?,?,?,?,?,?)")
+	if err != nil {
+		return common.NewError(err)
+	}
+	_, err = stmt.Exec(override.CpeMac, override.SubdocId, override.Expiry, override.PriorPayload, override.PriorVersion, override.CreatedTime)
+	if err != nil {
+		return common.NewError(err)
+	}
+
+	// the entry of a previous expiry is not removed, it is dropped by the reverter,
+	// and the buckets older than a week are deleted here
+	stmt, err = c.Prepare("DELETE FROM subdoc_override_expiry WHERE bucket<?")
+	if err != nil {
+		return common.NewError(err)
+	}
+	expired := time.Now().Add(-common.SubDocumentOverrideTTLSecs * time.Second).UnixMilli()
+	if _, err = stmt.Exec(common.SubDocumentOverrideBucket(expired)); err != nil {
+		return common.NewError(err)
+	}
+	stmt, err = c.Prepare("INSERT OR REPLACE INTO subdoc_override_expiry(bucket,expiry,cpe_mac,group_id) VALUES(?,?,?,?)")
+	if err != nil {
+		return common.NewError(err)
+	}
+	if _, err = stmt.Exec(common.SubDocumentOverrideBucket(override.Expiry), override.Expiry, override.CpeMac, override.SubdocId); err != nil {
+		return common.NewError(err)
+	}
+	return nil
+}
+
+func (c *SqliteClient) DeleteSubDocumentOverride(cpeMac string, groupId string) error {
+	c.concurrentQueries <- true
+	defer func() { <-c.concurrentQueries }()
+
+	stmt, err := c.Prepare("DELETE FROM subdoc_override WHERE cpe_mac=? AND group_id=?")
+	if err != nil {
+		return common.NewError(err)
+	}
+	if _, err = stmt.Exec(cpeMac, groupId); err != nil {
+		return common.NewError(err)
+	}
+	return nil
+}
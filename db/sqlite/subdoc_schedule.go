@@ -0,0 +1,111 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package sqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/rdkcentral/webconfig/common"
+)
+
+// GetSubDocumentSchedules reads one page of a bucket of the schedules, ordered by
+// effective_time. The page state is the last schedule read, so that the rows
+// deleted between the pages do not shift the next page. It is empty after the
+// last page.
+func (c *SqliteClient) GetSubDocumentSchedules(bucket int64, pageState []byte, pageSize int) ([]*common.SubDocumentSchedule, []byte, error) {
+	var last common.SubDocumentSchedule
+	if len(pageState) > 0 {
+		if err := json.Unmarshal(pageState, &last); err != nil {
+			return nil, nil, common.NewError(err)
+		}
+	}
+
+	c.concurrentQueries <- true
+	defer func() { <-c.concurrentQueries }()
+
+	qstr := "SELECT effective_time,cpe_mac,group_id FROM subdoc_schedule WHERE bucket=? AND (effective_time,cpe_mac,group_id)>(?,?,?) ORDER BY effective_time,cpe_mac,group_id LIMIT ?"
+	rows, err := c.Query(qstr, bucket, last.EffectiveTime, last.CpeMac, last.SubdocId, pageSize)
+	if err != nil {
+		return nil, nil, common.NewError(err)
+	}
+	defer rows.Close()
+
+	schedules := []*common.SubDocumentSchedule{}
+	for rows.Next() {
+		var nt1 sql.NullInt64
+		var ns1, ns2 sql.NullString
+		if err := rows.Scan(&nt1, &ns1, &ns2); err != nil {
+			return nil, nil, common.NewError(err)
+		}
+		schedule := &common.SubDocumentSchedule{
+			CpeMac:        ns1.String,
+			SubdocId:      ns2.String,
+			EffectiveTime: nt1.Int64,
+		}
+		schedules = append(schedules, schedule)
+	}
+	var nextPageState []byte
+	if len(schedules) == pageSize {
+		nextPageState, err = json.Marshal(schedules[len(schedules)-1])
+		if err != nil {
+			return nil, nil, common.NewError(err)
+		}
+	}
+	return schedules, nextPageState, nil
+}
+
+// SetSubDocumentSchedule adds the schedule to the bucket of its effective_time.
+// The buckets older than a week are deleted here.
+func (c *SqliteClient) SetSubDocumentSchedule(schedule *common.SubDocumentSchedule) error {
+	c.concurrentQueries <- true
+	defer func() { <-c.concurrentQueries }()
+
+	stmt, err := c.Prepare("DELETE FROM subdoc_schedule WHERE bucket<?")
+	if err != nil {
+		return common.NewError(err)
+	}
+	expiry := time.Now().Add(-common.SubDocumentScheduleTTLSecs * time.Second).UnixMilli()
+	if _, err = stmt.Exec(common.SubDocumentScheduleBucket(expiry)); err != nil {
+		return common.NewError(err)
+	}
+
+	stmt, err = c.Prepare("INSERT OR REPLACE INTO subdoc_schedule(bucket,effective_time,cpe_mac,group_id) VALUES(?,?,?,?)")
+	if err != nil {
+		return common.NewError(err)
+	}
+	if _, err = stmt.Exec(common.SubDocumentScheduleBucket(schedule.EffectiveTime), schedule.EffectiveTime, schedule.CpeMac, schedule.SubdocId); err != nil {
+		return common.NewError(err)
+	}
+	return nil
+}
+
+func (c *SqliteClient) DeleteSubDocumentSchedule(schedule *common.SubDocumentSchedule) error {
+	c.concurrentQueries <- true
+	defer func() { <-c.concurrentQueries }()
+
+	stmt, err := c.Prepare("DELETE FROM subdoc_schedule WHERE bucket=? AND effective_time=? AND cpe_mac=? AND group_id=?")
+	if err != nil {
+		return common.NewError(err)
+	}
+	if _, err = stmt.Exec(common.SubDocumentScheduleBucket(schedule.EffectiveTime), schedule.EffectiveTime, schedule.CpeMac, schedule.SubdocId); err != nil {
+		return common.NewError(err)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package sqlite
+
+import (
+	"database/sql"
+
+	"github.com/rdkcentral/webconfig/common"
+)
+
+func (c *SqliteClient) GetTokenRevocation(jti string) (*common.TokenRevocation, error) {
+	c.concurrentQueries <- true
+	defer func() { <-c.concurrentQueries }()
+
+	rows, err := c.Query("SELECT expiry,reason,created_time FROM revoked_token WHERE jti=?", jti)
+	if err != nil {
+		return nil, common.NewError(err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, sql.ErrNoRows
+	}
+
+	var ns1 sql.NullString
+	var ni1, ni2 sql.NullInt64
+	if err := rows.Scan(&ni1, &ns1, &ni2); err != nil {
+		return nil, common.NewError(err)
+	}
+	r := &common.TokenRevocation{
+		Jti:         jti,
+		Expiry:      ni1.Int64,
+		Reason:      ns1.String,
+		CreatedTime: ni2.Int64,
+	}
+	return r, nil
+}
+
+func (c *SqliteClient) GetDeviceTokenRevocation(cpeMac string) (*common.TokenRevocation, error) {
+	c.concurrentQueries <- true
+	defer func() { <-c.concurrentQueries }()
+
+	rows, err := c.Query("SELECT issued_before,reason,created_time FROM revoked_device_token WHERE cpe_mac=?", cpeMac)
+	if err != nil {
+		return nil, common.NewError(err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, sql.ErrNoRows
+	}
+
+	var ns1 sql.NullString
+	var ni1, ni2 sql.NullInt64
+	if err := rows.Scan(&ni1, &ns1, &ni2); err != nil {
+		return nil, common.NewError(err)
+	}
+	r := &common.TokenRevocation{
+		CpeMac:       cpeMac,
+		IssuedBefore: ni1.Int64,
+		Reason:       ns1.String,
+		CreatedTime:  ni2.Int64,
+	}
+	return r, nil
+}
+
+// SetTokenRevocation stores a jti revocation if Jti is set, otherwise a revocation of the mac
+func (c *SqliteClient) SetTokenRevocation(r *common.TokenRevocation) error {
+	c.concurrentQueries <- true
+	defer func() { <-c.concurrentQueries }()
+
+	var stmt *sql.Stmt
+	var err error
+	var args []interface{}
+	if len(r.Jti) > 0 {
+		stmt, err = c.Prepare("INSERT OR REPLACE INTO revoked_token(jti,expiry,reason,created_time) VALUES(?,?,?,?)")
+		args = []interface{}{r.Jti, r.Expiry, r.Reason, r.CreatedTime}
+	} else {
+		stmt, err = c.Prepare("INSERT OR REPLACE INTO revoked_device_token(cpe_mac,issued_before,reason,created_time) VALUES(?,?,?,?)")
+		args = []interface{}{r.CpeMac, r.IssuedBefore, r.Reason, r.CreatedTime}
+	}
+	if err != nil {
+		return common.NewError(err)
+	}
+	_, err = stmt.Exec(args...)
+	if err != nil {
+		return common.NewError(err)
+	}
+	return nil
+}
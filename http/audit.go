@@ -0,0 +1,187 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package http
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/rdkcentral/webconfig/common"
+	"github.com/rdkcentral/webconfig/security"
+	log "github.com/sirupsen/logrus"
+)
+
+const defaultAuditQueryLimit = 100
+
+// AuditMiddleware appends an audit record for every mutating call through the wrapped routes. It is
+// placed after the auth middleware so the XResponseWriter is created already. A write fanned out to
+// more devices by ?device_id= is recorded once per device.
+func (s *WebconfigServer) AuditMiddleware(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		xw, ok := w.(*XResponseWriter)
+		if !s.AuditEnabled() || !ok || r.Method == "GET" || r.Method == "HEAD" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		params := mux.Vars(r)
+		macs := auditMacs(r, params["mac"])
+		subdocId := params["subdoc_id"]
+		refId := params["ref"]
+		oldVersions := make([]string, len(macs))
+		for i, mac := range macs {
+			oldVersions[i] = s.auditVersion(mac, subdocId, refId)
+		}
+
+		next.ServeHTTP(xw, r)
+
+		record := common.AuditRecord{
+			EventTime: time.Now().UnixMilli(),
+			AuditId:   xw.AuditId(),
+			Action:    r.Method + " " + r.URL.Path,
+			SubdocId:  subdocId,
+			RefId:     refId,
+			Status:    xw.Status(),
+			SourceApp: r.Header.Get(common.HeaderSourceAppName),
+		}
+		if route := mux.CurrentRoute(r); route != nil {
+			if pathTemplate, err := route.GetPathTemplate(); err == nil {
+				record.Action = r.Method + " " + pathTemplate
+			}
+		}
+		if bbytes := xw.BodyBytes(); len(bbytes) > 0 {
+			sum := sha256.Sum256(bbytes)
+			record.PayloadHash = hex.EncodeToString(sum[:])
+		}
+		if token := xw.Token(); len(token) > 0 {
+			if subject, kid, capabilities, err := security.ParseApiTokenIdentity(token); err == nil {
+				record.Subject = subject
+				record.Kid = kid
+				record.Capabilities = capabilities
+			}
+		}
+
+		for i, mac := range macs {
+			devRecord := record
+			devRecord.CpeMac = mac
+			devRecord.OldVersion = oldVersions[i]
+			devRecord.NewVersion = s.auditVersion(mac, subdocId, refId)
+
+			// an audit failure does not fail the call that has been served
+			if err := s.AppendAuditRecord(&devRecord); err != nil {
+				tfields := common.FilterLogFields(xw.Audit())
+				tfields["logger"] = "audit"
+				tfields["audit_mac"] = mac
+				log.WithFields(tfields).Error(common.NewError(err))
+			}
+		}
+	}
+	return http.HandlerFunc(fn)
+}
+
+// auditMacs returns the mac of the route followed by the other devices of ?device_id=,
+// or a single empty mac for the routes not targeting a device
+func auditMacs(r *http.Request, mac string) []string {
+	if len(mac) == 0 {
+		return []string{""}
+	}
+	macs := []string{strings.ToUpper(mac)}
+	seen := map[string]bool{macs[0]: true}
+	if x := r.URL.Query().Get("device_id"); len(x) > 0 {
+		for _, deviceId := range strings.Split(x, ",") {
+			deviceId = strings.ToUpper(deviceId)
+			if len(deviceId) > 0 && !seen[deviceId] {
+				seen[deviceId] = true
+				macs = append(macs, deviceId)
+			}
+		}
+	}
+	return macs
+}
+
+// auditVersion returns the version of the target of a call, the reference subdoc, the subdoc or
+// the root document. An empty string is returned if the target does not exist.
+func (s *WebconfigServer) auditVersion(mac, subdocId, refId string) string {
+	if len(refId) > 0 {
+		if refsubdoc, err := s.GetRefSubDocument(refId); err == nil && refsubdoc.Version() != nil {
+			return *refsubdoc.Version()
+		}
+		return ""
+	}
+	if len(mac) == 0 {
+		return ""
+	}
+	if len(subdocId) > 0 {
+		if subdoc, err := s.GetSubDocument(mac, subdocId); err == nil && subdoc.Version() != nil {
+			return *subdoc.Version()
+		}
+		return ""
+	}
+	if rootdoc, err := s.GetRootDocument(mac); err == nil {
+		return rootdoc.Version
+	}
+	return ""
+}
+
+func (s *WebconfigServer) GetAuditRecordsHandler(w http.ResponseWriter, r *http.Request) {
+	qparams := r.URL.Query()
+	q := &common.AuditQuery{
+		CpeMac:  strings.ToUpper(qparams.Get("mac")),
+		Subject: qparams.Get("subject"),
+		Limit:   defaultAuditQueryLimit,
+	}
+	if len(q.CpeMac) == 0 && len(q.Subject) == 0 {
+		err := *common.NewHttp400Error("mac or subject is required")
+		Error(w, http.StatusBadRequest, common.NewError(err))
+		return
+	}
+
+	for k, p := range map[string]*int64{"start_time": &q.StartTime, "end_time": &q.EndTime} {
+		if x := qparams.Get(k); len(x) > 0 {
+			i, err := strconv.ParseInt(x, 10, 64)
+			if err != nil || i < 0 {
+				err := *common.NewHttp400Error("invalid " + k)
+				Error(w, http.StatusBadRequest, common.NewError(err))
+				return
+			}
+			*p = i
+		}
+	}
+
+	if x := qparams.Get("limit"); len(x) > 0 {
+		i, err := strconv.Atoi(x)
+		if err != nil || i <= 0 {
+			err := *common.NewHttp400Error("invalid limit")
+			Error(w, http.StatusBadRequest, common.NewError(err))
+			return
+		}
+		q.Limit = i
+	}
+
+	records, err := s.GetAuditRecords(q)
+	if err != nil {
+		Error(w, http.StatusInternalServerError, common.NewError(err))
+		return
+	}
+	WriteOkResponse(w, records)
+}
@@ -0,0 +1,160 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package http
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/rdkcentral/webconfig/common"
+	"github.com/rdkcentral/webconfig/util"
+	"gotest.tools/assert"
+)
+
+func TestAuditMiddleware(t *testing.T) {
+	server := NewWebconfigServer(sc, true)
+	signToken := setupApiTokenAuth(t, server)
+	server.SetAuditEnabled(true)
+	defer server.SetAuditEnabled(false)
+	router := server.GetRouter(false)
+	cpeMac := util.GenerateRandomCpeMac()
+	server.SetRootDocument(cpeMac, common.NewRootDocument(0, "fw1", "model1", "comcast", "", "", "", "", ""))
+	startTime := time.Now().UnixMilli()
+
+	subject := fmt.Sprintf("app-%v", cpeMac)
+	token := signToken(jwt.MapClaims{
+		"sub":          subject,
+		"capabilities": []string{"webconfig:all"},
+	})
+
+	// ==== a write is recorded with the token identity and both versions ====
+	lanBytes := common.RandomBytes(100, 150)
+	url := fmt.Sprintf("/api/v1/device/%v/document/lan", cpeMac)
+	req, err := http.NewRequest("POST", url, bytes.NewReader(lanBytes))
+	assert.NilError(t, err)
+	req.Header.Set(common.HeaderContentType, common.HeaderApplicationMsgpack)
+	req.Header.Set(common.HeaderSourceAppName, "test-app")
+	req.Header.Set("Authorization", "Bearer "+token)
+	res := ExecuteRequest(req, router).Result()
+	_, err = io.ReadAll(res.Body)
+	assert.NilError(t, err)
+	res.Body.Close()
+	assert.Equal(t, res.StatusCode, http.StatusOK)
+
+	subdoc, err := server.GetSubDocument(cpeMac, "lan")
+	assert.NilError(t, err)
+	lanVersion := *subdoc.Version()
+
+	// ==== reads are not recorded ====
+	status := callWithApiToken(t, router, "GET", url, nil, token)
+	assert.Equal(t, status, http.StatusOK)
+
+	status = callWithApiToken(t, router, "DELETE", url, nil, token)
+	assert.Equal(t, status, http.StatusOK)
+
+	// ==== query by mac, the latest first ====
+	auditUrl := fmt.Sprintf("/api/v1/audit?mac=%v&start_time=%v", cpeMac, startTime)
+	records := getAuditRecords(t, router, auditUrl, token)
+	assert.Equal(t, len(records), 2)
+
+	deleted := records[0]
+	assert.Equal(t, deleted.Action, "DELETE /api/v1/device/{mac}/document/{subdoc_id}")
+	assert.Equal(t, deleted.OldVersion, lanVersion)
+	assert.Equal(t, deleted.NewVersion, "")
+	assert.Equal(t, deleted.Status, http.StatusOK)
+
+	posted := records[1]
+	sum := sha256.Sum256(lanBytes)
+	assert.Equal(t, posted.CpeMac, cpeMac)
+	assert.Equal(t, posted.Action, "POST /api/v1/device/{mac}/document/{subdoc_id}")
+	assert.Equal(t, posted.SubdocId, "lan")
+	assert.Equal(t, posted.Status, http.StatusOK)
+	assert.Equal(t, posted.Subject, subject)
+	assert.Equal(t, posted.Kid, "webconfig_key")
+	assert.DeepEqual(t, posted.Capabilities, []string{"webconfig:all"})
+	assert.Equal(t, posted.SourceApp, "test-app")
+	assert.Equal(t, posted.OldVersion, "")
+	assert.Equal(t, posted.NewVersion, lanVersion)
+	assert.Equal(t, posted.PayloadHash, hex.EncodeToString(sum[:]))
+
+	// ==== query by subject and time range ====
+	auditUrl = fmt.Sprintf("/api/v1/audit?subject=%v&start_time=%v&limit=1", subject, startTime)
+	records = getAuditRecords(t, router, auditUrl, token)
+	assert.Equal(t, len(records), 1)
+	assert.Equal(t, records[0].AuditId, deleted.AuditId)
+
+	auditUrl = fmt.Sprintf("/api/v1/audit?subject=%v&end_time=%v", subject, startTime)
+	records = getAuditRecords(t, router, auditUrl, token)
+	assert.Equal(t, len(records), 0)
+
+	// ==== a fanned out write is recorded per device ====
+	cpeMac2 := util.GenerateRandomCpeMac()
+	server.SetRootDocument(cpeMac2, common.NewRootDocument(0, "fw1", "model1", "comcast", "", "", "", "", ""))
+	wanUrl := fmt.Sprintf("/api/v1/device/%v/document/wan?device_id=%v", cpeMac, cpeMac2)
+	status = callWithApiToken(t, router, "POST", wanUrl, common.RandomBytes(100, 150), token)
+	assert.Equal(t, status, http.StatusOK)
+	subdoc, err = server.GetSubDocument(cpeMac2, "wan")
+	assert.NilError(t, err)
+	auditUrl = fmt.Sprintf("/api/v1/audit?mac=%v", cpeMac2)
+	records = getAuditRecords(t, router, auditUrl, token)
+	assert.Equal(t, len(records), 1)
+	assert.Equal(t, records[0].SubdocId, "wan")
+	assert.Equal(t, records[0].NewVersion, *subdoc.Version())
+	auditUrl = fmt.Sprintf("/api/v1/audit?mac=%v&start_time=%v", cpeMac, startTime)
+	records = getAuditRecords(t, router, auditUrl, token)
+	assert.Equal(t, len(records), 3)
+	assert.Equal(t, records[0].AuditId, getAuditRecords(t, router, fmt.Sprintf("/api/v1/audit?mac=%v", cpeMac2), token)[0].AuditId)
+
+	// ==== mac or subject is required ====
+	status = callWithApiToken(t, router, "GET", "/api/v1/audit", nil, token)
+	assert.Equal(t, status, http.StatusBadRequest)
+
+	// ==== nothing is recorded when disabled ====
+	server.SetAuditEnabled(false)
+	status = callWithApiToken(t, router, "POST", url, lanBytes, token)
+	assert.Equal(t, status, http.StatusOK)
+	auditUrl = fmt.Sprintf("/api/v1/audit?mac=%v", cpeMac)
+	records = getAuditRecords(t, router, auditUrl, token)
+	assert.Equal(t, len(records), 3)
+}
+
+func getAuditRecords(t *testing.T, router http.Handler, url, token string) []common.AuditRecord {
+	req, err := http.NewRequest("GET", url, nil)
+	assert.NilError(t, err)
+	req.Header.Set("Authorization", "Bearer "+token)
+	res := ExecuteRequest(req, router).Result()
+	rbytes, err := io.ReadAll(res.Body)
+	assert.NilError(t, err)
+	res.Body.Close()
+	assert.Equal(t, res.StatusCode, http.StatusOK)
+
+	var resp struct {
+		Data []common.AuditRecord `json:"data"`
+	}
+	err = json.Unmarshal(rbytes, &resp)
+	assert.NilError(t, err)
+	return resp.Data
+}
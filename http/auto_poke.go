@@ -0,0 +1,171 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package http
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-akka/configuration"
+	"github.com/rdkcentral/webconfig/common"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultAutoPokeDebounceInMsecs = 3000
+)
+
+var (
+	autoPokeForwardedHeaders = []string{
+		common.HeaderAuthorization,
+		common.HeaderTraceparent,
+		common.HeaderTracestate,
+		common.HeaderMoracide,
+	}
+)
+
+type pendingPoke struct {
+	timer  *time.Timer
+	header http.Header
+	fields log.Fields
+}
+
+// AutoPoker coalesces the pokes requested by the subdoc writes. The first write
+// for a mac opens the debounce window and all writes within the window share a
+// single poke when it closes.
+type AutoPoker struct {
+	sync.Mutex
+	debounce time.Duration
+	pending  map[string]*pendingPoke
+	pokeFn   func(string, http.Header, log.Fields) error
+}
+
+func NewAutoPoker(conf *configuration.Config, pokeFn func(string, http.Header, log.Fields) error) *AutoPoker {
+	debounceInMsecs := conf.GetInt32("webconfig.auto_poke.debounce_in_msecs", defaultAutoPokeDebounceInMsecs)
+	return &AutoPoker{
+		debounce: time.Duration(debounceInMsecs) * time.Millisecond,
+		pending:  make(map[string]*pendingPoke),
+		pokeFn:   pokeFn,
+	}
+}
+
+func (p *AutoPoker) Debounce() time.Duration {
+	return p.debounce
+}
+
+func (p *AutoPoker) SetDebounce(x time.Duration) {
+	p.debounce = x
+}
+
+func (p *AutoPoker) Pending() int {
+	p.Lock()
+	defer p.Unlock()
+	return len(p.pending)
+}
+
+// Schedule returns false if the poke is coalesced into one already scheduled.
+// The header and fields of the latest write are used for the poke.
+func (p *AutoPoker) Schedule(mac string, header http.Header, fields log.Fields) bool {
+	tfields := common.FilterLogFields(fields)
+	p.Lock()
+	defer p.Unlock()
+
+	if pp, ok := p.pending[mac]; ok {
+		pp.header = header.Clone()
+		pp.fields = tfields
+		return false
+	}
+
+	pp := &pendingPoke{
+		header: header.Clone(),
+		fields: tfields,
+	}
+	pp.timer = time.AfterFunc(p.debounce, func() {
+		p.fire(mac)
+	})
+	p.pending[mac] = pp
+	return true
+}
+
+func (p *AutoPoker) fire(mac string) {
+	p.Lock()
+	pp, ok := p.pending[mac]
+	delete(p.pending, mac)
+	p.Unlock()
+	if !ok {
+		return
+	}
+
+	if err := p.pokeFn(mac, pp.header, pp.fields); err != nil {
+		tfields := common.FilterLogFields(pp.fields)
+		tfields["logger"] = "autopoke"
+		log.WithFields(tfields).Warnf("auto poke failed: %v", err)
+	}
+}
+
+// Stop drops the pokes not yet sent
+func (p *AutoPoker) Stop() {
+	p.Lock()
+	defer p.Unlock()
+	for mac, pp := range p.pending {
+		pp.timer.Stop()
+		delete(p.pending, mac)
+	}
+}
+
+// AutoPoke sends the poke scheduled by the writes. The route column of the root
+// document decides if the device is poked through mqtt or webpa. The webpa poke
+// uses the credential of the WebpaConnector when the header has none.
+func (s *WebconfigServer) AutoPoke(mac string, header http.Header, fields log.Fields) error {
+	var route string
+	rdoc, err := s.GetRootDocument(mac)
+	if err != nil {
+		if !s.IsDbNotFound(err) {
+			return common.NewError(err)
+		}
+	} else {
+		route = rdoc.Route
+	}
+
+	if route == common.RouteMqtt {
+		metricsAgent := "default"
+		if itf, ok := fields["metrics_agent"]; ok {
+			if x, ok := itf.(string); ok && len(x) > 0 {
+				metricsAgent = x
+			}
+		}
+		if _, err := s.PokeMqtt(mac, metricsAgent, fields); err != nil {
+			return common.NewError(err)
+		}
+		return nil
+	}
+
+	if _, err := s.Poke(header, mac, "", "root", fields); err != nil {
+		return common.NewError(err)
+	}
+	return nil
+}
+
+func (s *WebconfigServer) AutoPoker() *AutoPoker {
+	return s.autoPoker
+}
+
+func (s *WebconfigServer) SetAutoPoker(p *AutoPoker) {
+	s.autoPoker = p
+}
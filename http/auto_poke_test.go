@@ -0,0 +1,202 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-akka/configuration"
+	"github.com/rdkcentral/webconfig/common"
+	"github.com/rdkcentral/webconfig/util"
+	log "github.com/sirupsen/logrus"
+	"gotest.tools/assert"
+)
+
+func waitForCount(counter *atomic.Int32, expected int32, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if counter.Load() >= expected {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return counter.Load() >= expected
+}
+
+func TestAutoPokerCoalesce(t *testing.T) {
+	conf := configuration.ParseString(`webconfig.auto_poke.debounce_in_msecs = 50`)
+	var count atomic.Int32
+	var authorization atomic.Value
+	p := NewAutoPoker(conf, func(mac string, header http.Header, fields log.Fields) error {
+		count.Add(1)
+		authorization.Store(header.Get("Authorization"))
+		return nil
+	})
+	assert.Equal(t, p.Debounce(), 50*time.Millisecond)
+
+	cpeMac := util.GenerateRandomCpeMac()
+	header := make(http.Header)
+	header.Set("Authorization", "Bearer foo")
+	assert.Assert(t, p.Schedule(cpeMac, header, log.Fields{}))
+	header.Set("Authorization", "Bearer bar")
+	assert.Assert(t, !p.Schedule(cpeMac, header, log.Fields{}))
+	assert.Assert(t, !p.Schedule(cpeMac, header, log.Fields{}))
+	assert.Equal(t, p.Pending(), 1)
+
+	assert.Assert(t, waitForCount(&count, 1, time.Second))
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, count.Load(), int32(1))
+	assert.Equal(t, p.Pending(), 0)
+	assert.Equal(t, authorization.Load(), "Bearer bar")
+
+	// a write after the window schedules a new poke
+	assert.Assert(t, p.Schedule(cpeMac, header, log.Fields{}))
+	p.Stop()
+	assert.Equal(t, p.Pending(), 0)
+}
+
+func TestAutoPokeAfterSubdocWrites(t *testing.T) {
+	server := NewWebconfigServer(sc, true)
+	router := server.GetRouter(true)
+	server.AutoPoker().SetDebounce(100 * time.Millisecond)
+	cpeMac := util.GenerateRandomCpeMac()
+
+	var webpaCount, mqttCount atomic.Int32
+	var webpaHeader atomic.Value
+	webpaMockServer := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			webpaHeader.Store(r.Header.Clone())
+			webpaCount.Add(1)
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write(mockWebpaPokeResponse)
+		}))
+	defer webpaMockServer.Close()
+	server.SetWebpaHost(webpaMockServer.URL)
+
+	mqttMockServer := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mqttCount.Add(1)
+			w.WriteHeader(http.StatusOK)
+		}))
+	defer mqttMockServer.Close()
+	server.SetMqttHost(mqttMockServer.URL)
+
+	server.SetRootDocument(cpeMac, common.NewRootDocument(0, "fw1", "model1", "comcast", "", "", "", "", ""))
+
+	postSubdoc := func(subdocId string, autoPoke bool) {
+		url := fmt.Sprintf("/api/v1/device/%v/document/%v", cpeMac, subdocId)
+		if autoPoke {
+			url += "?auto_poke=true"
+		}
+		req, err := http.NewRequest("POST", url, bytes.NewReader(common.RandomBytes(50, 100)))
+		assert.NilError(t, err)
+		req.Header.Set(common.HeaderContentType, common.HeaderApplicationMsgpack)
+		req.Header.Set("Authorization", "Bearer foobar")
+		req.Header.Set(common.HeaderTraceparent, "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+		res := ExecuteRequest(req, router).Result()
+		rbytes, err := io.ReadAll(res.Body)
+		assert.NilError(t, err)
+		res.Body.Close()
+		assert.Equal(t, res.StatusCode, http.StatusOK)
+		if autoPoke {
+			var resp map[string]interface{}
+			err = json.Unmarshal(rbytes, &resp)
+			assert.NilError(t, err)
+			assert.Equal(t, resp["auto_poke"], true)
+		}
+	}
+
+	// ==== no poke unless requested ====
+	postSubdoc("lan", false)
+	assert.Equal(t, server.AutoPoker().Pending(), 0)
+
+	// ==== 3 writes within the window coalesce into 1 webpa poke ====
+	postSubdoc("lan", true)
+	postSubdoc("wan", true)
+	postSubdoc("mesh", true)
+	assert.Equal(t, server.AutoPoker().Pending(), 1)
+	assert.Assert(t, waitForCount(&webpaCount, 1, 2*time.Second))
+	time.Sleep(200 * time.Millisecond)
+	assert.Equal(t, webpaCount.Load(), int32(1))
+	assert.Equal(t, mqttCount.Load(), int32(0))
+
+	// only the credential and the tracing headers of the write reach webpa
+	header := webpaHeader.Load().(http.Header)
+	assert.Equal(t, header.Get("Authorization"), "Bearer foobar")
+	assert.Assert(t, len(header.Get(common.HeaderTraceparent)) > 0)
+	assert.Assert(t, header.Get(common.HeaderContentType) != common.HeaderApplicationMsgpack)
+
+	// ==== the route column switches the poke to mqtt ====
+	rdoc, err := server.GetRootDocument(cpeMac)
+	assert.NilError(t, err)
+	rdoc.Route = common.RouteMqtt
+	err = server.SetRootDocument(cpeMac, rdoc)
+	assert.NilError(t, err)
+
+	postSubdoc("lan", true)
+	postSubdoc("wan", true)
+	assert.Assert(t, waitForCount(&mqttCount, 1, 2*time.Second))
+	time.Sleep(200 * time.Millisecond)
+	assert.Equal(t, mqttCount.Load(), int32(1))
+	assert.Equal(t, webpaCount.Load(), int32(1))
+}
+
+func TestAutoPokeWebpaCredential(t *testing.T) {
+	server := NewWebconfigServer(sc, true)
+	cpeMac := util.GenerateRandomCpeMac()
+
+	var authorization atomic.Value
+	webpaMockServer := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authorization.Store(r.Header.Get("Authorization"))
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write(mockWebpaPokeResponse)
+		}))
+	defer webpaMockServer.Close()
+
+	// ==== the secret of the connector is used by the background pokes ====
+	t.Setenv("WEBCONFIG_TEST_WEBPA_TOKEN", "secrettoken")
+	conf := configuration.ParseString(`webconfig.webpa.auth_token_secret = "WEBCONFIG_TEST_WEBPA_TOKEN"`)
+	connector := NewWebpaConnector(conf, nil)
+	connector.SetWebpaHost(webpaMockServer.URL)
+	_, err := connector.Patch(make(http.Header), cpeMac, "", PokeBody, log.Fields{})
+	assert.NilError(t, err)
+	assert.Equal(t, authorization.Load(), "Bearer secrettoken")
+
+	// ==== a forwarded credential takes precedence ====
+	header := make(http.Header)
+	header.Set("Authorization", "Bearer foobar")
+	_, err = connector.Patch(header, cpeMac, "", PokeBody, log.Fields{})
+	assert.NilError(t, err)
+	assert.Equal(t, authorization.Load(), "Bearer foobar")
+
+	// ==== the auto poke of the server ====
+	server.SetWebpaHost(webpaMockServer.URL)
+	server.WebpaConnector.SetAuthToken("fixedtoken")
+	err = server.AutoPoke(cpeMac, make(http.Header), log.Fields{})
+	assert.NilError(t, err)
+	assert.Equal(t, authorization.Load(), "Bearer fixedtoken")
+}
@@ -0,0 +1,278 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-akka/configuration"
+	"github.com/rdkcentral/webconfig/common"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultCircuitBreakerFailureRate      = 50
+	defaultCircuitBreakerMinRequests      = 20
+	defaultCircuitBreakerWindowInSecs     = 60
+	defaultCircuitBreakerCoolDownInSecs   = 30
+	defaultCircuitBreakerHalfOpenRequests = 3
+)
+
+type CircuitBreakerState int
+
+// the values are exported as the circuit_breaker_state gauge
+const (
+	CircuitBreakerClosed CircuitBreakerState = iota
+	CircuitBreakerHalfOpen
+	CircuitBreakerOpen
+)
+
+var (
+	circuitBreakerStateNames = [3]string{"closed", "half-open", "open"}
+)
+
+func (s CircuitBreakerState) String() string {
+	return circuitBreakerStateNames[s]
+}
+
+type CircuitBreakerStatus struct {
+	Service           string `json:"service"`
+	State             string `json:"state"`
+	Requests          int    `json:"requests"`
+	Failures          int    `json:"failures"`
+	OpenedAt          *int64 `json:"opened_at,omitempty"`
+	HalfOpenSuccesses int    `json:"half_open_successes"`
+}
+
+// CircuitBreaker stops calling a remote service once the failure rate within
+// a window reaches the threshold. After the cool-down, a few trial calls are
+// let through (half-open), and the breaker closes again when they all succeed.
+// All methods are safe on a nil receiver, which behaves as always closed.
+type CircuitBreaker struct {
+	sync.Mutex
+	service           string
+	failureRate       int
+	minRequests       int
+	window            time.Duration
+	coolDown          time.Duration
+	halfOpenRequests  int
+	state             CircuitBreakerState
+	windowStart       time.Time
+	requests          int
+	failures          int
+	openedAt          time.Time
+	halfOpenInFlight  int
+	halfOpenSuccesses int
+	metrics           *common.AppMetrics
+	nowFn             func() time.Time
+}
+
+// NewCircuitBreaker returns nil unless webconfig.<service>.circuit_breaker_enabled is set
+func NewCircuitBreaker(conf *configuration.Config, service string) *CircuitBreaker {
+	prefix := fmt.Sprintf("webconfig.%v.circuit_breaker", service)
+	if !conf.GetBoolean(prefix + "_enabled") {
+		return nil
+	}
+	b := &CircuitBreaker{
+		service:          service,
+		failureRate:      int(conf.GetInt32(prefix+"_failure_rate", defaultCircuitBreakerFailureRate)),
+		minRequests:      int(conf.GetInt32(prefix+"_min_requests", defaultCircuitBreakerMinRequests)),
+		window:           time.Duration(conf.GetInt32(prefix+"_window_in_secs", defaultCircuitBreakerWindowInSecs)) * time.Second,
+		coolDown:         time.Duration(conf.GetInt32(prefix+"_cool_down_in_secs", defaultCircuitBreakerCoolDownInSecs)) * time.Second,
+		halfOpenRequests: int(conf.GetInt32(prefix+"_half_open_requests", defaultCircuitBreakerHalfOpenRequests)),
+		nowFn:            time.Now,
+	}
+	b.windowStart = b.nowFn()
+	return b
+}
+
+func (b *CircuitBreaker) Service() string {
+	if b == nil {
+		return ""
+	}
+	return b.service
+}
+
+func (b *CircuitBreaker) State() CircuitBreakerState {
+	if b == nil {
+		return CircuitBreakerClosed
+	}
+	b.Lock()
+	defer b.Unlock()
+	return b.state
+}
+
+func (b *CircuitBreaker) SetMetrics(m *common.AppMetrics) {
+	if b == nil {
+		return
+	}
+	b.Lock()
+	defer b.Unlock()
+	b.metrics = m
+	if m != nil {
+		m.SetCircuitBreakerState(b.service, int(b.state))
+	}
+}
+
+// Allow reports if a call can go out. A true in the half-open state takes one
+// of the trial slots, so every allowed call must be followed by a Record().
+func (b *CircuitBreaker) Allow() bool {
+	if b == nil {
+		return true
+	}
+	b.Lock()
+	defer b.Unlock()
+
+	now := b.nowFn()
+	if b.state == CircuitBreakerOpen {
+		if now.Sub(b.openedAt) < b.coolDown {
+			if b.metrics != nil {
+				b.metrics.CountCircuitBreakerReject(b.service)
+			}
+			return false
+		}
+		b.setStateLocked(CircuitBreakerHalfOpen, now)
+	}
+	if b.state == CircuitBreakerHalfOpen {
+		if b.halfOpenInFlight >= b.halfOpenRequests {
+			if b.metrics != nil {
+				b.metrics.CountCircuitBreakerReject(b.service)
+			}
+			return false
+		}
+		b.halfOpenInFlight++
+	}
+	return true
+}
+
+func (b *CircuitBreaker) Record(success bool) {
+	if b == nil {
+		return
+	}
+	b.Lock()
+	defer b.Unlock()
+
+	now := b.nowFn()
+	switch b.state {
+	case CircuitBreakerClosed:
+		if now.Sub(b.windowStart) >= b.window {
+			b.windowStart = now
+			b.requests = 0
+			b.failures = 0
+		}
+		b.requests++
+		if !success {
+			b.failures++
+		}
+		if b.requests >= b.minRequests && b.failures*100 >= b.failureRate*b.requests {
+			b.setStateLocked(CircuitBreakerOpen, now)
+		}
+	case CircuitBreakerHalfOpen:
+		if !success {
+			b.setStateLocked(CircuitBreakerOpen, now)
+			return
+		}
+		b.halfOpenSuccesses++
+		if b.halfOpenSuccesses >= b.halfOpenRequests {
+			b.setStateLocked(CircuitBreakerClosed, now)
+		}
+	}
+	// results coming back while open are from calls allowed before the trip
+}
+
+func (b *CircuitBreaker) setStateLocked(state CircuitBreakerState, now time.Time) {
+	fields := log.Fields{
+		"logger":    "circuit_breaker",
+		"service":   b.service,
+		"old_state": b.state.String(),
+		"new_state": state.String(),
+		"requests":  b.requests,
+		"failures":  b.failures,
+	}
+	b.state = state
+	b.halfOpenInFlight = 0
+	b.halfOpenSuccesses = 0
+	switch state {
+	case CircuitBreakerOpen:
+		b.openedAt = now
+	case CircuitBreakerClosed:
+		b.windowStart = now
+		b.requests = 0
+		b.failures = 0
+	}
+	if b.metrics != nil {
+		b.metrics.SetCircuitBreakerState(b.service, int(state))
+	}
+	log.WithFields(fields).Warn("circuit breaker state changed")
+}
+
+func (b *CircuitBreaker) Status() CircuitBreakerStatus {
+	b.Lock()
+	defer b.Unlock()
+	status := CircuitBreakerStatus{
+		Service:           b.service,
+		State:             b.state.String(),
+		Requests:          b.requests,
+		Failures:          b.failures,
+		HalfOpenSuccesses: b.halfOpenSuccesses,
+	}
+	if b.state != CircuitBreakerClosed {
+		x := b.openedAt.UnixMilli()
+		status.OpenedAt = &x
+	}
+	return status
+}
+
+// the error returned for the calls short-circuited
+func (b *CircuitBreaker) openError() error {
+	return common.RemoteHttpError{
+		Message:    fmt.Sprintf("circuit breaker %v for %v", b.State(), b.service),
+		StatusCode: http.StatusServiceUnavailable,
+	}
+}
+
+// CircuitBreakers returns the breakers of all the connectors that have one enabled
+func (s *WebconfigServer) CircuitBreakers() []*CircuitBreaker {
+	breakers := []*CircuitBreaker{}
+	for _, c := range []*HttpClient{
+		s.WebpaConnector.syncClient,
+		s.WebpaConnector.asyncClient,
+		s.XconfConnector.HttpClient,
+		s.MqttConnector.HttpClient,
+		s.UpstreamConnector.HttpClient,
+	} {
+		if b := c.CircuitBreaker(); b != nil {
+			breakers = append(breakers, b)
+		}
+	}
+	return breakers
+}
+
+// SetMetrics also exports the breaker states and the poke queue depth through the same metrics
+func (s *WebconfigServer) SetMetrics(m *common.AppMetrics) {
+	s.DatabaseClient.SetMetrics(m)
+	for _, b := range s.CircuitBreakers() {
+		b.SetMetrics(m)
+	}
+	if q := s.PokeQueue(); q != nil {
+		q.SetMetrics(m)
+	}
+}
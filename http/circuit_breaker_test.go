@@ -0,0 +1,162 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-akka/configuration"
+	"github.com/rdkcentral/webconfig/common"
+	log "github.com/sirupsen/logrus"
+	"gotest.tools/assert"
+)
+
+var (
+	testCircuitBreakerConfig = `webconfig.xconf {
+	retries = 0
+	circuit_breaker_enabled = true
+	circuit_breaker_failure_rate = 50
+	circuit_breaker_min_requests = 4
+	circuit_breaker_window_in_secs = 60
+	circuit_breaker_cool_down_in_secs = 10
+	circuit_breaker_half_open_requests = 2
+}`
+)
+
+func TestCircuitBreakerStates(t *testing.T) {
+	conf := configuration.ParseString(testCircuitBreakerConfig)
+	b := NewCircuitBreaker(conf, "xconf")
+	assert.Assert(t, b != nil)
+	now := time.Now()
+	b.nowFn = func() time.Time { return now }
+
+	// below min_requests, the breaker stays closed
+	for i := 0; i < 3; i++ {
+		assert.Assert(t, b.Allow())
+		b.Record(false)
+	}
+	assert.Equal(t, b.State(), CircuitBreakerClosed)
+
+	// 4 failures out of 4 trips the breaker
+	assert.Assert(t, b.Allow())
+	b.Record(false)
+	assert.Equal(t, b.State(), CircuitBreakerOpen)
+	assert.Assert(t, !b.Allow())
+
+	// after the cool-down, only half_open_requests calls are let through
+	now = now.Add(11 * time.Second)
+	assert.Assert(t, b.Allow())
+	assert.Equal(t, b.State(), CircuitBreakerHalfOpen)
+	assert.Assert(t, b.Allow())
+	assert.Assert(t, !b.Allow())
+
+	// a failed trial call opens it again
+	b.Record(false)
+	assert.Equal(t, b.State(), CircuitBreakerOpen)
+
+	// all trial calls succeed and the breaker closes
+	now = now.Add(11 * time.Second)
+	assert.Assert(t, b.Allow())
+	assert.Assert(t, b.Allow())
+	b.Record(true)
+	assert.Equal(t, b.State(), CircuitBreakerHalfOpen)
+	b.Record(true)
+	assert.Equal(t, b.State(), CircuitBreakerClosed)
+
+	// the counts restart with a new window
+	for i := 0; i < 3; i++ {
+		b.Record(true)
+		b.Record(false)
+	}
+	assert.Equal(t, b.State(), CircuitBreakerOpen)
+	now = now.Add(11 * time.Second)
+	assert.Assert(t, b.Allow())
+	b.Record(true)
+	b.Record(true)
+	assert.Equal(t, b.State(), CircuitBreakerClosed)
+	now = now.Add(2 * time.Minute)
+	b.Record(false)
+	b.Record(true)
+	b.Record(true)
+	b.Record(true)
+	assert.Equal(t, b.State(), CircuitBreakerClosed)
+	assert.Equal(t, b.Status().Failures, 1)
+
+	// not enabled
+	b = NewCircuitBreaker(conf, "upstream")
+	assert.Assert(t, b == nil)
+	assert.Assert(t, b.Allow())
+	assert.Equal(t, b.State(), CircuitBreakerClosed)
+}
+
+func TestCircuitBreakerConnector(t *testing.T) {
+	server := NewWebconfigServer(sc, true)
+	router := server.GetRouter(true)
+
+	var calls int32
+	mockServer := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+	defer mockServer.Close()
+
+	conf := configuration.ParseString(testCircuitBreakerConfig)
+	server.XconfConnector = NewXconfConnector(conf, nil)
+	server.SetXconfHost(mockServer.URL)
+	assert.Equal(t, len(server.CircuitBreakers()), 1)
+
+	for i := 0; i < 4; i++ {
+		_, _, err := server.GetProfiles("foo", log.Fields{})
+		assert.Assert(t, err != nil)
+	}
+	assert.Equal(t, atomic.LoadInt32(&calls), int32(4))
+
+	// short-circuited without calling the remote
+	_, _, err := server.GetProfiles("foo", log.Fields{})
+	var rherr common.RemoteHttpError
+	assert.Assert(t, errors.As(err, &rherr))
+	assert.Equal(t, rherr.StatusCode, http.StatusServiceUnavailable)
+	assert.Equal(t, atomic.LoadInt32(&calls), int32(4))
+
+	// ==== health endpoint ====
+	req, err := http.NewRequest("GET", "/healthz/circuit_breakers", nil)
+	assert.NilError(t, err)
+	res := ExecuteRequest(req, router).Result()
+	rbytes, err := io.ReadAll(res.Body)
+	assert.NilError(t, err)
+	res.Body.Close()
+	assert.Equal(t, res.StatusCode, http.StatusServiceUnavailable)
+
+	var resp struct {
+		Data []CircuitBreakerStatus `json:"data"`
+	}
+	err = json.Unmarshal(rbytes, &resp)
+	assert.NilError(t, err)
+	assert.Equal(t, len(resp.Data), 1)
+	assert.Equal(t, resp.Data[0].Service, "xconf")
+	assert.Equal(t, resp.Data[0].State, "open")
+	assert.Assert(t, resp.Data[0].OpenedAt != nil)
+}
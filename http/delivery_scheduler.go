@@ -0,0 +1,312 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package http
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-akka/configuration"
+	"github.com/google/uuid"
+	"github.com/rdkcentral/webconfig/common"
+	"github.com/rdkcentral/webconfig/db"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultDeliverySchedulerIntervalInSecs = 30
+	defaultDeliverySchedulerLeaseInSecs    = 90
+	defaultMaintenanceWindowTimeZone       = "UTC"
+	deliverySchedulerLeaseName             = "delivery_scheduler"
+	deliverySchedulerPageSize              = 500
+)
+
+// MaintenanceWindow is a daily window in minutes of the day. End is exclusive
+// and a window may cross midnight, e.g. 23:00-02:00.
+type MaintenanceWindow struct {
+	Start int
+	End   int
+}
+
+// ParseMaintenanceWindow parses "HH:MM-HH:MM"
+func ParseMaintenanceWindow(s string) (*MaintenanceWindow, error) {
+	var h1, m1, h2, m2 int
+	if _, err := fmt.Sscanf(s, "%d:%d-%d:%d", &h1, &m1, &h2, &m2); err != nil {
+		err := fmt.Errorf("invalid maintenance window %q: %v", s, err)
+		return nil, common.NewError(err)
+	}
+	for _, x := range [][2]int{{h1, m1}, {h2, m2}} {
+		if x[0] < 0 || x[0] > 24 || x[1] < 0 || x[1] > 59 || (x[0] == 24 && x[1] > 0) {
+			err := fmt.Errorf("invalid maintenance window %q", s)
+			return nil, common.NewError(err)
+		}
+	}
+	return &MaintenanceWindow{
+		Start: h1*60 + m1,
+		End:   h2*60 + m2,
+	}, nil
+}
+
+func (w *MaintenanceWindow) Contains(t time.Time) bool {
+	m := t.Hour()*60 + t.Minute()
+	if w.Start <= w.End {
+		return m >= w.Start && m < w.End
+	}
+	return m >= w.Start || m < w.End
+}
+
+// DeliveryScheduler pokes the devices when their scheduled subdocs become
+// effective. If the partner of the device has a maintenance window, the poke is
+// held until the window opens in the time zone of the device. Only the replica
+// holding the lease activates the schedules.
+type DeliveryScheduler struct {
+	interval        time.Duration
+	leaseSecs       int
+	owner           string
+	windows         map[string]*MaintenanceWindow
+	defaultLocation *time.Location
+	// the oldest bucket left with schedules in the last round, 0 to read them all
+	firstBucket int64
+}
+
+func NewDeliveryScheduler(conf *configuration.Config) (*DeliveryScheduler, error) {
+	intervalInSecs := conf.GetInt32("webconfig.delivery_scheduler.interval_in_secs", defaultDeliverySchedulerIntervalInSecs)
+	leaseInSecs := conf.GetInt32("webconfig.delivery_scheduler.lease_in_secs", defaultDeliverySchedulerLeaseInSecs)
+
+	tz := conf.GetString("webconfig.delivery_scheduler.maintenance_windows.default_time_zone", defaultMaintenanceWindowTimeZone)
+	location, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, common.NewError(err)
+	}
+
+	windows := map[string]*MaintenanceWindow{}
+	path := "webconfig.delivery_scheduler.maintenance_windows.partners"
+	if node := conf.GetNode(path); node != nil && node.IsObject() {
+		for _, partner := range node.GetObject().GetKeys() {
+			w, err := ParseMaintenanceWindow(conf.GetString(path + "." + partner))
+			if err != nil {
+				return nil, common.NewError(err)
+			}
+			windows[partner] = w
+		}
+	}
+
+	return &DeliveryScheduler{
+		interval:        time.Duration(intervalInSecs) * time.Second,
+		leaseSecs:       int(leaseInSecs),
+		owner:           uuid.New().String(),
+		windows:         windows,
+		defaultLocation: location,
+	}, nil
+}
+
+func (d *DeliveryScheduler) Interval() time.Duration {
+	return d.interval
+}
+
+func (d *DeliveryScheduler) Owner() string {
+	return d.owner
+}
+
+func (d *DeliveryScheduler) SetMaintenanceWindow(partnerId string, w *MaintenanceWindow) {
+	d.windows[partnerId] = w
+}
+
+// PokeAllowed tells if the device can be poked at t. Partners without a window
+// can be poked anytime. An unknown time zone falls back to the default one.
+func (d *DeliveryScheduler) PokeAllowed(rdoc *common.RootDocument, t time.Time) bool {
+	w, ok := d.windows[rdoc.PartnerId]
+	if !ok {
+		return true
+	}
+	location := d.defaultLocation
+	if len(rdoc.TimeZone) > 0 {
+		if x, err := time.LoadLocation(rdoc.TimeZone); err == nil {
+			location = x
+		}
+	}
+	return w.Contains(t.In(location))
+}
+
+func (s *WebconfigServer) DeliveryScheduler() *DeliveryScheduler {
+	return s.deliveryScheduler
+}
+
+func (s *WebconfigServer) SetDeliveryScheduler(d *DeliveryScheduler) {
+	s.deliveryScheduler = d
+}
+
+// RunDeliveryScheduler activates the due schedules periodically until ctx is done.
+// A round is skipped if another replica holds the lease.
+func (s *WebconfigServer) RunDeliveryScheduler(ctx context.Context) {
+	fields := log.Fields{
+		"logger": "scheduler",
+		"owner":  s.deliveryScheduler.Owner(),
+	}
+	ticker := time.NewTicker(s.deliveryScheduler.Interval())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case t := <-ticker.C:
+			ok, err := s.AcquireLease(deliverySchedulerLeaseName, s.deliveryScheduler.Owner(), s.deliveryScheduler.leaseSecs)
+			if err != nil {
+				log.WithFields(fields).Error(err)
+				continue
+			}
+			if !ok {
+				continue
+			}
+			if err := s.ActivateScheduledSubDocuments(t); err != nil {
+				log.WithFields(fields).Error(err)
+			}
+		}
+	}
+}
+
+// ActivateScheduledSubDocuments handles the schedules whose effective_time has passed.
+// It reads the buckets up to now, from the oldest one that still had schedules in
+// the previous round, or from the TTL of the schedules after a restart.
+func (s *WebconfigServer) ActivateScheduledSubDocuments(now time.Time) error {
+	nowMs := now.UnixMilli()
+	lastBucket := common.SubDocumentScheduleBucket(nowMs)
+	firstBucket := common.SubDocumentScheduleBucket(now.Add(-common.SubDocumentScheduleTTLSecs * time.Second).UnixMilli())
+	firstBucket = max(firstBucket, s.deliveryScheduler.firstBucket)
+
+	// the previous bucket is read again so that a schedule written by a replica
+	// with a late clock is not skipped
+	nextFirstBucket := lastBucket - 1
+	for bucket := firstBucket; bucket <= lastBucket; bucket++ {
+		left, err := s.activateScheduledBucket(bucket, nowMs, now)
+		if err != nil {
+			return common.NewError(err)
+		}
+		if left {
+			nextFirstBucket = min(nextFirstBucket, bucket)
+		}
+	}
+	s.deliveryScheduler.firstBucket = nextFirstBucket
+	return nil
+}
+
+// activateScheduledBucket handles the due schedules of one bucket page by page. It
+// returns true if some schedules are left in the bucket.
+func (s *WebconfigServer) activateScheduledBucket(bucket int64, nowMs int64, now time.Time) (bool, error) {
+	left := false
+	var pageState []byte
+	for {
+		schedules, nextPageState, err := s.GetSubDocumentSchedules(bucket, pageState, deliverySchedulerPageSize)
+		if err != nil {
+			return false, common.NewError(err)
+		}
+
+		dueMap := map[string][]*common.SubDocumentSchedule{}
+		for _, schedule := range schedules {
+			if schedule.EffectiveTime <= nowMs {
+				dueMap[schedule.CpeMac] = append(dueMap[schedule.CpeMac], schedule)
+			} else {
+				left = true
+			}
+		}
+
+		for cpeMac, dues := range dueMap {
+			fields := log.Fields{
+				"logger":  "scheduler",
+				"cpe_mac": cpeMac,
+			}
+			// one device failing does not block the others, it is retried in the next round
+			done, err := s.activateScheduledSubDocuments(cpeMac, dues, now, fields)
+			if err != nil {
+				log.WithFields(fields).Warn(err)
+			}
+			if !done {
+				left = true
+			}
+		}
+
+		if len(nextPageState) == 0 {
+			return left, nil
+		}
+		pageState = nextPageState
+	}
+}
+
+func (s *WebconfigServer) deleteSubDocumentSchedules(schedules []*common.SubDocumentSchedule) (bool, error) {
+	for _, schedule := range schedules {
+		if err := s.DeleteSubDocumentSchedule(schedule); err != nil {
+			return false, common.NewError(err)
+		}
+	}
+	return true, nil
+}
+
+// activateScheduledSubDocuments returns true once the due schedules of the device
+// are deleted, and false if they are held back for the maintenance window
+func (s *WebconfigServer) activateScheduledSubDocuments(cpeMac string, dues []*common.SubDocumentSchedule, now time.Time, fields log.Fields) (bool, error) {
+	rdoc, err := s.GetRootDocument(cpeMac)
+	if err != nil {
+		if s.IsDbNotFound(err) {
+			return s.deleteSubDocumentSchedules(dues)
+		}
+		return false, common.NewError(err)
+	}
+
+	doc, err := s.GetDocument(cpeMac, fields)
+	if err != nil {
+		if s.IsDbNotFound(err) {
+			return s.deleteSubDocumentSchedules(dues)
+		}
+		return false, common.NewError(err)
+	}
+
+	// drop the schedules overwritten or deleted since
+	actives := []*common.SubDocumentSchedule{}
+	for _, schedule := range dues {
+		subdoc := doc.SubDocument(schedule.SubdocId)
+		if subdoc == nil || int64(subdoc.HeldUntil()) != schedule.EffectiveTime {
+			if err := s.DeleteSubDocumentSchedule(schedule); err != nil {
+				return false, common.NewError(err)
+			}
+			continue
+		}
+		actives = append(actives, schedule)
+	}
+	if len(actives) == 0 {
+		return true, nil
+	}
+
+	// the root version changes so that the next GET returns the effective subdocs
+	nowMs := int(now.UnixMilli())
+	rootVersion := db.HashRootVersion(doc.EffectiveVersionMap(nowMs))
+	if rootVersion != rdoc.Version {
+		if err := s.SetRootDocumentVersion(cpeMac, rootVersion); err != nil {
+			return false, common.NewError(err)
+		}
+	}
+
+	if !s.deliveryScheduler.PokeAllowed(rdoc, now) {
+		return false, nil
+	}
+	if err := s.AutoPoke(cpeMac, make(http.Header), fields); err != nil {
+		return false, common.NewError(err)
+	}
+	return s.deleteSubDocumentSchedules(actives)
+}
@@ -0,0 +1,210 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package http
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-akka/configuration"
+	"github.com/rdkcentral/webconfig/common"
+	"github.com/rdkcentral/webconfig/util"
+	"gotest.tools/assert"
+)
+
+func TestMaintenanceWindow(t *testing.T) {
+	w, err := ParseMaintenanceWindow("01:30-04:00")
+	assert.NilError(t, err)
+	assert.Equal(t, w.Start, 90)
+	assert.Equal(t, w.End, 240)
+	assert.Assert(t, w.Contains(time.Date(2024, 1, 1, 1, 30, 0, 0, time.UTC)))
+	assert.Assert(t, w.Contains(time.Date(2024, 1, 1, 3, 59, 0, 0, time.UTC)))
+	assert.Assert(t, !w.Contains(time.Date(2024, 1, 1, 4, 0, 0, 0, time.UTC)))
+	assert.Assert(t, !w.Contains(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)))
+
+	// crossing midnight
+	w, err = ParseMaintenanceWindow("23:00-02:00")
+	assert.NilError(t, err)
+	assert.Assert(t, w.Contains(time.Date(2024, 1, 1, 23, 30, 0, 0, time.UTC)))
+	assert.Assert(t, w.Contains(time.Date(2024, 1, 1, 1, 0, 0, 0, time.UTC)))
+	assert.Assert(t, !w.Contains(time.Date(2024, 1, 1, 2, 0, 0, 0, time.UTC)))
+
+	for _, s := range []string{"", "foo", "25:00-01:00", "01:60-02:00"} {
+		_, err = ParseMaintenanceWindow(s)
+		assert.Assert(t, err != nil, s)
+	}
+}
+
+func TestDeliverySchedulerPokeAllowed(t *testing.T) {
+	conf := configuration.ParseString(`
+webconfig.delivery_scheduler.maintenance_windows {
+    default_time_zone = "UTC"
+    partners {
+        comcast = "01:00-03:00"
+    }
+}`)
+	d, err := NewDeliveryScheduler(conf)
+	assert.NilError(t, err)
+
+	at := time.Date(2024, 1, 1, 2, 0, 0, 0, time.UTC)
+	rdoc := common.NewRootDocument(0, "fw1", "model1", "comcast", "", "", "", "", "")
+	assert.Assert(t, d.PokeAllowed(rdoc, at))
+
+	// 02:00 UTC is 21:00 in New York
+	rdoc.TimeZone = "America/New_York"
+	assert.Assert(t, !d.PokeAllowed(rdoc, at))
+	assert.Assert(t, d.PokeAllowed(rdoc, at.Add(5*time.Hour)))
+
+	// an unknown time zone falls back to the default
+	rdoc.TimeZone = "foo/bar"
+	assert.Assert(t, d.PokeAllowed(rdoc, at))
+
+	// no window for the partner
+	rdoc.PartnerId = "cox"
+	assert.Assert(t, d.PokeAllowed(rdoc, at.Add(12*time.Hour)))
+}
+
+// getSubDocumentSchedules reads all the pages of the bucket of the effective time
+func getSubDocumentSchedules(t *testing.T, server *WebconfigServer, effectiveTime int64) []*common.SubDocumentSchedule {
+	schedules := []*common.SubDocumentSchedule{}
+	var pageState []byte
+	for {
+		page, nextPageState, err := server.GetSubDocumentSchedules(common.SubDocumentScheduleBucket(effectiveTime), pageState, 100)
+		assert.NilError(t, err)
+		schedules = append(schedules, page...)
+		if len(nextPageState) == 0 {
+			return schedules
+		}
+		pageState = nextPageState
+	}
+}
+
+func TestActivateScheduledSubDocuments(t *testing.T) {
+	server := NewWebconfigServer(sc, true)
+	router := server.GetRouter(true)
+	d, err := NewDeliveryScheduler(configuration.ParseString(``))
+	assert.NilError(t, err)
+	server.SetDeliveryScheduler(d)
+	cpeMac := util.GenerateRandomCpeMac()
+
+	var webpaCount atomic.Int32
+	webpaMockServer := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			webpaCount.Add(1)
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write(mockWebpaPokeResponse)
+		}))
+	defer webpaMockServer.Close()
+	server.SetWebpaHost(webpaMockServer.URL)
+
+	server.SetRootDocument(cpeMac, common.NewRootDocument(0, "fw1", "model1", "comcast", "", "", "", "", ""))
+
+	postSubdoc := func(subdocId string, effectiveTime int64) {
+		url := fmt.Sprintf("/api/v1/device/%v/document/%v", cpeMac, subdocId)
+		req, err := http.NewRequest("POST", url, bytes.NewReader(common.RandomBytes(50, 100)))
+		assert.NilError(t, err)
+		req.Header.Set(common.HeaderContentType, common.HeaderApplicationMsgpack)
+		if effectiveTime > 0 {
+			req.Header.Set(common.HeaderSubdocumentEffectiveTime, strconv.FormatInt(effectiveTime, 10))
+		}
+		res := ExecuteRequest(req, router).Result()
+		_, err = io.ReadAll(res.Body)
+		assert.NilError(t, err)
+		res.Body.Close()
+		assert.Equal(t, res.StatusCode, http.StatusOK)
+	}
+
+	// ==== an invalid effective time is rejected ====
+	url := fmt.Sprintf("/api/v1/device/%v/document/lan", cpeMac)
+	req, err := http.NewRequest("POST", url, bytes.NewReader(common.RandomBytes(50, 100)))
+	assert.NilError(t, err)
+	req.Header.Set(common.HeaderContentType, common.HeaderApplicationMsgpack)
+	req.Header.Set(common.HeaderSubdocumentEffectiveTime, "foo")
+	res := ExecuteRequest(req, router).Result()
+	res.Body.Close()
+	assert.Equal(t, res.StatusCode, http.StatusBadRequest)
+
+	// ==== an effective time is rejected without the scheduler ====
+	server.SetDeliveryScheduler(nil)
+	req, err = http.NewRequest("POST", url, bytes.NewReader(common.RandomBytes(50, 100)))
+	assert.NilError(t, err)
+	req.Header.Set(common.HeaderContentType, common.HeaderApplicationMsgpack)
+	req.Header.Set(common.HeaderSubdocumentEffectiveTime, strconv.FormatInt(time.Now().Add(time.Hour).UnixMilli(), 10))
+	res = ExecuteRequest(req, router).Result()
+	res.Body.Close()
+	assert.Equal(t, res.StatusCode, http.StatusBadRequest)
+	server.SetDeliveryScheduler(d)
+
+	// ==== the scheduled subdoc is held back ====
+	now := time.Now()
+	effectiveTime := now.Add(time.Hour).UnixMilli()
+	postSubdoc("lan", 0)
+	postSubdoc("wan", effectiveTime)
+
+	doc, err := server.GetDocument(cpeMac)
+	assert.NilError(t, err)
+	assert.Equal(t, len(doc.FilterForGet(nil).Items()), 1)
+	rdoc, err := server.GetRootDocument(cpeMac)
+	assert.NilError(t, err)
+	rootVersion := rdoc.Version
+
+	schedules := getSubDocumentSchedules(t, server, effectiveTime)
+	found := false
+	for _, schedule := range schedules {
+		if schedule.CpeMac == cpeMac {
+			assert.Equal(t, schedule.SubdocId, "wan")
+			assert.Equal(t, schedule.EffectiveTime, effectiveTime)
+			found = true
+		}
+	}
+	assert.Assert(t, found)
+
+	// ==== nothing happens before the effective time ====
+	err = server.ActivateScheduledSubDocuments(now)
+	assert.NilError(t, err)
+	assert.Equal(t, webpaCount.Load(), int32(0))
+
+	// ==== outside the maintenance window, the root version changes but no poke ====
+	later := time.UnixMilli(effectiveTime).Add(time.Minute)
+	start := later.UTC().Hour()*60 + later.UTC().Minute() + 60
+	d.SetMaintenanceWindow("comcast", &MaintenanceWindow{Start: start, End: start + 60})
+	err = server.ActivateScheduledSubDocuments(later)
+	assert.NilError(t, err)
+	assert.Equal(t, webpaCount.Load(), int32(0))
+	rdoc, err = server.GetRootDocument(cpeMac)
+	assert.NilError(t, err)
+	assert.Assert(t, rdoc.Version != rootVersion)
+
+	// ==== inside the window, the device is poked and the schedule removed ====
+	d.SetMaintenanceWindow("comcast", &MaintenanceWindow{Start: 0, End: 24 * 60})
+	err = server.ActivateScheduledSubDocuments(later)
+	assert.NilError(t, err)
+	assert.Equal(t, webpaCount.Load(), int32(1))
+
+	schedules = getSubDocumentSchedules(t, server, effectiveTime)
+	for _, schedule := range schedules {
+		assert.Assert(t, schedule.CpeMac != cpeMac)
+	}
+}
@@ -0,0 +1,308 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rdkcentral/webconfig/common"
+	"github.com/rdkcentral/webconfig/db"
+	"github.com/rdkcentral/webconfig/util"
+	log "github.com/sirupsen/logrus"
+)
+
+// PostDeploymentGroupHandler writes several subdocs of a device atomically. The body is either a
+// multipart of subdocs or a json common.DeploymentGroupRequest. For a multipart, the ordering hint
+// is given by ?order=lan,portforwarding
+func (s *WebconfigServer) PostDeploymentGroupHandler(w http.ResponseWriter, r *http.Request) {
+	mac, _, _, fields, err := s.Validate(w, r, false)
+	if err != nil {
+		var status int
+		if errors.As(err, common.Http400ErrorType) {
+			status = http.StatusBadRequest
+		} else {
+			status = http.StatusInternalServerError
+		}
+		Error(w, status, common.NewError(err))
+		return
+	}
+
+	xw, ok := w.(*XResponseWriter)
+	if !ok {
+		err := *common.NewHttp500Error("responsewriter cast error")
+		Error(w, http.StatusInternalServerError, common.NewError(err))
+		return
+	}
+
+	req, err := parseDeploymentGroupRequest(r.Header, xw.BodyBytes())
+	if err != nil {
+		Error(w, http.StatusBadRequest, common.NewError(err))
+		return
+	}
+	if x := r.URL.Query().Get("order"); len(x) > 0 {
+		req.Order = strings.Split(x, ",")
+	}
+
+	subdocIds, subdocs, err := buildDeploymentGroup(req)
+	if err != nil {
+		Error(w, http.StatusBadRequest, common.NewError(err))
+		return
+	}
+
+	metricsAgent := r.Header.Get(common.HeaderMetricsAgent)
+	if len(metricsAgent) == 0 {
+		metricsAgent = "default"
+	}
+
+	group, rootVersion, err := s.WriteDeploymentGroup(mac, subdocIds, subdocs, metricsAgent, fields)
+	if err != nil {
+		Error(w, http.StatusInternalServerError, common.NewError(err))
+		return
+	}
+
+	d := util.Dict{
+		"deployment_id": group.DeploymentId,
+		"subdoc_ids":    group.SubdocIds,
+		"root_version":  rootVersion,
+	}
+
+	if autoPokeRequested(r) {
+		s.scheduleAutoPokes([]string{mac}, r.Header, fields)
+		d["auto_poke"] = true
+	}
+
+	WriteByMarshal(w, http.StatusOK, d)
+}
+
+func parseDeploymentGroupRequest(header http.Header, bbytes []byte) (*common.DeploymentGroupRequest, error) {
+	if len(bbytes) == 0 {
+		return nil, *common.NewHttp400Error("empty body")
+	}
+
+	mediaType, _, err := mime.ParseMediaType(header.Get(common.HeaderContentType))
+	if err != nil {
+		return nil, *common.NewHttp400Error("invalid content-type")
+	}
+
+	req := &common.DeploymentGroupRequest{}
+	switch {
+	case strings.HasPrefix(mediaType, "multipart/"):
+		mparts, err := util.ParseMultipartAsList(header, bbytes)
+		if err != nil {
+			return nil, *common.NewHttp400Error(err.Error())
+		}
+		for _, mpart := range mparts {
+			gsubdoc := common.DeploymentGroupSubDocument{
+				SubdocId: mpart.Name,
+				Payload:  mpart.Bytes,
+			}
+			if len(mpart.Version) > 0 {
+				version := mpart.Version
+				gsubdoc.Version = &version
+			}
+			req.SubDocuments = append(req.SubDocuments, gsubdoc)
+		}
+	case mediaType == common.HeaderApplicationJson:
+		if err := json.Unmarshal(bbytes, req); err != nil {
+			return nil, *common.NewHttp400Error(err.Error())
+		}
+	default:
+		return nil, *common.NewHttp400Error("content-type not multipart or json")
+	}
+	return req, nil
+}
+
+// buildDeploymentGroup validates the request and returns the subdoc ids in the delivery order,
+// the ones in the ordering hint first and then the rest as they are posted
+func buildDeploymentGroup(req *common.DeploymentGroupRequest) ([]string, map[string]*common.SubDocument, error) {
+	if len(req.SubDocuments) == 0 {
+		return nil, nil, *common.NewHttp400Error("no subdocs")
+	}
+
+	updatedTime := int(time.Now().UnixMilli())
+	postedIds := []string{}
+	subdocs := map[string]*common.SubDocument{}
+	for _, gsubdoc := range req.SubDocuments {
+		if len(gsubdoc.SubdocId) == 0 {
+			return nil, nil, *common.NewHttp400Error("missing subdoc_id")
+		}
+		if _, ok := subdocs[gsubdoc.SubdocId]; ok {
+			return nil, nil, *common.NewHttp400Error("duplicate subdoc " + gsubdoc.SubdocId)
+		}
+		if len(gsubdoc.Payload) == 0 {
+			return nil, nil, *common.NewHttp400Error("empty payload of subdoc " + gsubdoc.SubdocId)
+		}
+
+		var version string
+		if gsubdoc.Version != nil && len(*gsubdoc.Version) > 0 {
+			version = *gsubdoc.Version
+		} else {
+			version = util.GetMurmur3Hash(gsubdoc.Payload)
+		}
+		state := common.PendingDownload
+		zeroErrorCode := 0
+		emptyErrorDetails := ""
+		subdoc := common.NewSubDocument(gsubdoc.Payload, &version, &state, &updatedTime, &zeroErrorCode, &emptyErrorDetails)
+		if gsubdoc.Expiry != nil {
+			subdoc.SetExpiry(gsubdoc.Expiry)
+		}
+		subdocs[gsubdoc.SubdocId] = subdoc
+		postedIds = append(postedIds, gsubdoc.SubdocId)
+	}
+
+	subdocIds := []string{}
+	ordered := map[string]bool{}
+	for _, subdocId := range req.Order {
+		if _, ok := subdocs[subdocId]; !ok {
+			return nil, nil, *common.NewHttp400Error("subdoc " + subdocId + " in the order is not posted")
+		}
+		if !ordered[subdocId] {
+			ordered[subdocId] = true
+			subdocIds = append(subdocIds, subdocId)
+		}
+	}
+	for _, subdocId := range postedIds {
+		if !ordered[subdocId] {
+			subdocIds = append(subdocIds, subdocId)
+		}
+	}
+	return subdocIds, subdocs, nil
+}
+
+// WriteDeploymentGroup stores the subdocs of a device as one deployment group. The group is staged
+// first so that the device does not get a partial set while the subdocs are written one by one. The
+// commit releases them together and the root version changes only once. If the group cannot be
+// committed, the prior subdocs are restored. The committed group takes over the order of the older
+// committed groups, which are deleted with the abandoned staged ones, so a device keeps one
+// committed group.
+func (s *WebconfigServer) WriteDeploymentGroup(deviceId string, subdocIds []string, subdocs map[string]*common.SubDocument, metricsAgent string, fields log.Fields) (*common.DeploymentGroup, string, error) {
+	group := &common.DeploymentGroup{
+		CpeMac:       deviceId,
+		DeploymentId: uuid.New().String(),
+		SubdocIds:    subdocIds,
+		State:        common.DeploymentGroupStaged,
+		CreatedTime:  time.Now().UnixMilli(),
+	}
+
+	priors := map[string]*common.SubDocument{}
+	for _, subdocId := range subdocIds {
+		prior, err := s.GetSubDocument(deviceId, subdocId)
+		if err != nil {
+			if s.IsDbNotFound(err) {
+				continue
+			}
+			return nil, "", common.NewError(err)
+		}
+		priors[subdocId] = prior
+	}
+
+	if err := s.SetDeploymentGroup(group); err != nil {
+		return nil, "", common.NewError(err)
+	}
+
+	for _, subdocId := range subdocIds {
+		oldState := 0
+		if prior, ok := priors[subdocId]; ok && prior.State() != nil {
+			oldState = *prior.State()
+		}
+		subdoc := subdocs[subdocId]
+		err := s.cancelSubDocumentOverride(deviceId, subdocId, subdoc)
+		if err == nil {
+			err = s.storeSubDocument(deviceId, subdocId, subdoc, oldState, metricsAgent, fields)
+		}
+		if err != nil {
+			s.abortDeploymentGroup(group, priors, fields)
+			return nil, "", common.NewError(err)
+		}
+	}
+
+	groups, err := s.GetDeploymentGroups(deviceId)
+	if err != nil {
+		s.abortDeploymentGroup(group, priors, fields)
+		return nil, "", common.NewError(err)
+	}
+
+	// a single row write releases all the subdocs of the group
+	nowMs := time.Now().UnixMilli()
+	committed := *group
+	committed.SubdocIds = common.FoldDeploymentGroups(group.SubdocIds, groups)
+	committed.State = common.DeploymentGroupCommitted
+	committed.CommittedTime = nowMs
+	if err := s.SetDeploymentGroup(&committed); err != nil {
+		s.abortDeploymentGroup(group, priors, fields)
+		return nil, "", common.NewError(err)
+	}
+	group.State = committed.State
+	group.CommittedTime = committed.CommittedTime
+
+	for _, g := range groups {
+		if g.DeploymentId == group.DeploymentId || (g.IsStaged() && !g.IsAbandoned(nowMs)) {
+			continue
+		}
+		if err := s.DeleteDeploymentGroup(deviceId, g.DeploymentId); err != nil {
+			tfields := common.FilterLogFields(fields)
+			tfields["logger"] = "deployment"
+			tfields["deployment_id"] = g.DeploymentId
+			log.WithFields(tfields).Warn(common.NewError(err))
+		}
+	}
+
+	fields["src_caller"] = common.GetCaller()
+	doc, err := s.GetDocument(deviceId, fields)
+	if err != nil {
+		return nil, "", common.NewError(err)
+	}
+	rootVersion := db.HashRootVersion(doc.EffectiveVersionMap(int(time.Now().UnixMilli())))
+	if err := s.SetRootDocumentVersion(deviceId, rootVersion); err != nil {
+		return nil, "", common.NewError(err)
+	}
+	return group, rootVersion, nil
+}
+
+// abortDeploymentGroup restores the prior subdocs of a group that cannot be committed
+func (s *WebconfigServer) abortDeploymentGroup(group *common.DeploymentGroup, priors map[string]*common.SubDocument, fields log.Fields) {
+	tfields := common.FilterLogFields(fields)
+	tfields["logger"] = "deployment"
+	tfields["deployment_id"] = group.DeploymentId
+
+	for _, subdocId := range group.SubdocIds {
+		var err error
+		if prior, ok := priors[subdocId]; ok {
+			err = s.SetSubDocument(group.CpeMac, subdocId, prior, fields)
+		} else {
+			err = s.DeleteSubDocument(group.CpeMac, subdocId)
+			if s.IsDbNotFound(err) {
+				err = nil
+			}
+		}
+		if err != nil {
+			tfields["subdoc_id"] = subdocId
+			log.WithFields(tfields).Error(common.NewError(err))
+		}
+	}
+
+	if err := s.DeleteDeploymentGroup(group.CpeMac, group.DeploymentId); err != nil {
+		log.WithFields(tfields).Error(common.NewError(err))
+	}
+}
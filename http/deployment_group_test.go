@@ -0,0 +1,173 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/rdkcentral/webconfig/common"
+	"github.com/rdkcentral/webconfig/util"
+	log "github.com/sirupsen/logrus"
+	"gotest.tools/assert"
+)
+
+func TestDeploymentGroup(t *testing.T) {
+	server := NewWebconfigServer(sc, true)
+	router := server.GetRouter(true)
+	cpeMac := util.GenerateRandomCpeMac()
+	server.SetRootDocument(cpeMac, common.NewRootDocument(0, "fw1", "model1", "comcast", "", "", "", "", ""))
+
+	// ==== post a group as json, portforwarding goes first ====
+	lanBytes := common.RandomBytes(50, 100)
+	pfBytes := common.RandomBytes(50, 100)
+	mbBytes := common.RandomBytes(50, 100)
+	greq := common.DeploymentGroupRequest{
+		SubDocuments: []common.DeploymentGroupSubDocument{
+			{SubdocId: "lan", Payload: lanBytes},
+			{SubdocId: "portforwarding", Payload: pfBytes},
+			{SubdocId: "macbinding", Payload: mbBytes},
+		},
+		Order: []string{"portforwarding"},
+	}
+	bbytes, err := json.Marshal(greq)
+	assert.NilError(t, err)
+	url := fmt.Sprintf("/api/v1/device/%v/deployment", cpeMac)
+	req, err := http.NewRequest("POST", url, bytes.NewReader(bbytes))
+	assert.NilError(t, err)
+	req.Header.Set(common.HeaderContentType, common.HeaderApplicationJson)
+	res := ExecuteRequest(req, router).Result()
+	rbytes, err := io.ReadAll(res.Body)
+	assert.NilError(t, err)
+	res.Body.Close()
+	assert.Equal(t, res.StatusCode, http.StatusOK)
+
+	var resp struct {
+		DeploymentId string   `json:"deployment_id"`
+		SubdocIds    []string `json:"subdoc_ids"`
+		RootVersion  string   `json:"root_version"`
+	}
+	err = json.Unmarshal(rbytes, &resp)
+	assert.NilError(t, err)
+	assert.Assert(t, len(resp.DeploymentId) > 0)
+	assert.DeepEqual(t, resp.SubdocIds, []string{"portforwarding", "lan", "macbinding"})
+
+	rdoc, err := server.GetRootDocument(cpeMac)
+	assert.NilError(t, err)
+	assert.Equal(t, rdoc.Version, resp.RootVersion)
+
+	// ==== the device gets the group together, in the order ====
+	configUrl := fmt.Sprintf("/api/v1/device/%v/config", cpeMac)
+	req, err = http.NewRequest("GET", configUrl, nil)
+	assert.NilError(t, err)
+	res = ExecuteRequest(req, router).Result()
+	rbytes, err = io.ReadAll(res.Body)
+	assert.NilError(t, err)
+	res.Body.Close()
+	assert.Equal(t, res.StatusCode, http.StatusOK)
+	assert.Equal(t, res.Header.Get(common.HeaderEtag), resp.RootVersion)
+
+	mparts, err := util.ParseMultipartAsList(res.Header, rbytes)
+	assert.NilError(t, err)
+	assert.Equal(t, len(mparts), 3)
+	assert.Equal(t, mparts[0].Name, "portforwarding")
+	assert.DeepEqual(t, mparts[0].Bytes, pfBytes)
+	assert.Equal(t, mparts[1].Name, "lan")
+	assert.Equal(t, mparts[2].Name, "macbinding")
+
+	// ==== post a group as multipart ====
+	wanBytes := common.RandomBytes(50, 100)
+	lanBytes2 := common.RandomBytes(50, 100)
+	mbytes, err := common.WriteMultipartBytes([]common.Multipart{
+		{Name: "wan", Bytes: wanBytes, Version: "123"},
+		{Name: "lan", Bytes: lanBytes2, Version: "456"},
+	})
+	assert.NilError(t, err)
+	req, err = http.NewRequest("POST", url+"?order=lan", bytes.NewReader(mbytes))
+	assert.NilError(t, err)
+	req.Header.Set(common.HeaderContentType, common.MultipartContentType)
+	res = ExecuteRequest(req, router).Result()
+	rbytes, err = io.ReadAll(res.Body)
+	assert.NilError(t, err)
+	res.Body.Close()
+	assert.Equal(t, res.StatusCode, http.StatusOK)
+	err = json.Unmarshal(rbytes, &resp)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, resp.SubdocIds, []string{"lan", "wan"})
+
+	subdoc, err := server.GetSubDocument(cpeMac, "lan")
+	assert.NilError(t, err)
+	assert.Equal(t, subdoc.GetVersion(), "456")
+	assert.DeepEqual(t, subdoc.Payload(), lanBytes2)
+
+	// the latest group goes first, and takes over the older one
+	doc, err := server.GetDocument(cpeMac, log.Fields{})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, doc.Order(), []string{"lan", "wan", "portforwarding", "macbinding"})
+	groups, err := server.GetDeploymentGroups(cpeMac)
+	assert.NilError(t, err)
+	assert.Equal(t, len(groups), 1)
+	assert.Equal(t, groups[0].DeploymentId, resp.DeploymentId)
+
+	// ==== a staged group is held back ====
+	staged := &common.DeploymentGroup{
+		CpeMac:       cpeMac,
+		DeploymentId: "staged",
+		SubdocIds:    []string{"wan", "mesh"},
+		State:        common.DeploymentGroupStaged,
+		CreatedTime:  time.Now().UnixMilli(),
+	}
+	err = server.SetDeploymentGroup(staged)
+	assert.NilError(t, err)
+	doc, err = server.GetDocument(cpeMac, log.Fields{})
+	assert.NilError(t, err)
+	assert.Equal(t, doc.Length(), 3)
+	assert.Assert(t, doc.SubDocument("wan") == nil)
+
+	// ==== unless abandoned ====
+	staged.CreatedTime = time.Now().Add(-time.Hour).UnixMilli()
+	err = server.SetDeploymentGroup(staged)
+	assert.NilError(t, err)
+	doc, err = server.GetDocument(cpeMac, log.Fields{})
+	assert.NilError(t, err)
+	assert.Assert(t, doc.SubDocument("wan") != nil)
+	err = server.DeleteDeploymentGroup(cpeMac, staged.DeploymentId)
+	assert.NilError(t, err)
+
+	// ==== bad requests ====
+	badBodies := []string{
+		`{"subdocs":[]}`,
+		`{"subdocs":[{"subdoc_id":"lan","payload":"AQI="},{"subdoc_id":"lan","payload":"AQI="}]}`,
+		`{"subdocs":[{"subdoc_id":"lan","payload":"AQI="}],"order":["wan"]}`,
+	}
+	for _, body := range badBodies {
+		req, err = http.NewRequest("POST", url, bytes.NewReader([]byte(body)))
+		assert.NilError(t, err)
+		req.Header.Set(common.HeaderContentType, common.HeaderApplicationJson)
+		res = ExecuteRequest(req, router).Result()
+		_, err = io.ReadAll(res.Body)
+		assert.NilError(t, err)
+		res.Body.Close()
+		assert.Equal(t, res.StatusCode, http.StatusBadRequest)
+	}
+}
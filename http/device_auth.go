@@ -0,0 +1,198 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package http
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/go-akka/configuration"
+	"github.com/rdkcentral/webconfig/common"
+	"github.com/rdkcentral/webconfig/util"
+)
+
+// the device auth modes of a route
+const (
+	DeviceAuthJwt       = "jwt"
+	DeviceAuthMtls      = "mtls"
+	DeviceAuthMtlsOrJwt = "mtls_or_jwt"
+)
+
+const deviceAuthConfigPath = "webconfig.server.tls.client_auth"
+
+// DeviceAuth decides how the device routes authenticate, by the client certificates of the tls
+// connections, by the cpe tokens or by either, and reads the device identity from the certificates
+type DeviceAuth struct {
+	defaultMode string
+	routeModes  map[string]string
+	partnerOid  asn1.ObjectIdentifier
+}
+
+func NewDeviceAuth(conf *configuration.Config) (*DeviceAuth, error) {
+	a := &DeviceAuth{
+		defaultMode: conf.GetString(deviceAuthConfigPath+".default_mode", DeviceAuthMtlsOrJwt),
+		routeModes:  map[string]string{},
+	}
+	if !isValidDeviceAuthMode(a.defaultMode) {
+		return nil, common.NewError(fmt.Errorf("invalid device auth mode %q", a.defaultMode))
+	}
+
+	// the routes listed under a mode in route_modes, by "METHOD path-template"
+	if conf.HasPath(deviceAuthConfigPath + ".route_modes") {
+		node := conf.GetNode(deviceAuthConfigPath + ".route_modes").GetObject()
+		for _, mode := range node.GetKeys() {
+			if !isValidDeviceAuthMode(mode) {
+				return nil, common.NewError(fmt.Errorf("invalid device auth mode %q", mode))
+			}
+			for _, route := range node.GetKey(mode).GetStringList() {
+				a.routeModes[normalizeDeviceRoute(route)] = mode
+			}
+		}
+	}
+
+	if x := conf.GetString(deviceAuthConfigPath + ".partner_oid"); len(x) > 0 {
+		oid, err := parseOid(x)
+		if err != nil {
+			return nil, common.NewError(err)
+		}
+		a.partnerOid = oid
+	}
+	return a, nil
+}
+
+func isValidDeviceAuthMode(mode string) bool {
+	return mode == DeviceAuthJwt || mode == DeviceAuthMtls || mode == DeviceAuthMtlsOrJwt
+}
+
+// normalizeDeviceRoute upper-cases the method of a "METHOD path-template" route
+func normalizeDeviceRoute(route string) string {
+	elements := strings.Fields(route)
+	if len(elements) != 2 {
+		return route
+	}
+	return strings.ToUpper(elements[0]) + " " + elements[1]
+}
+
+func parseOid(s string) (asn1.ObjectIdentifier, error) {
+	oid := asn1.ObjectIdentifier{}
+	for _, x := range strings.Split(s, ".") {
+		i, err := strconv.Atoi(x)
+		if err != nil || i < 0 {
+			return nil, fmt.Errorf("invalid oid %q", s)
+		}
+		oid = append(oid, i)
+	}
+	if len(oid) < 2 {
+		return nil, fmt.Errorf("invalid oid %q", s)
+	}
+	return oid, nil
+}
+
+// Mode returns the auth mode of a route by "METHOD path-template"
+func (a *DeviceAuth) Mode(method, pathTemplate string) string {
+	if mode, ok := a.routeModes[strings.ToUpper(method)+" "+pathTemplate]; ok {
+		return mode
+	}
+	return a.defaultMode
+}
+
+// CertIdentity reads the mac of a device from the subject common name or the subject alternative
+// names of its certificate, and the partner from the partner extension or the subject OU
+func (a *DeviceAuth) CertIdentity(cert *x509.Certificate) (string, string, error) {
+	candidates := []string{cert.Subject.CommonName}
+	candidates = append(candidates, cert.DNSNames...)
+	for _, u := range cert.URIs {
+		candidates = append(candidates, u.Opaque, u.Host, strings.TrimPrefix(u.Path, "/"))
+	}
+	var mac string
+	for _, c := range candidates {
+		if x := normalizeCertMac(c); util.ValidateMac(x) {
+			mac = x
+			break
+		}
+	}
+	if len(mac) == 0 {
+		return "", "", common.NewError(fmt.Errorf("no mac in client certificate subject=%v", cert.Subject))
+	}
+
+	var partner string
+	if len(a.partnerOid) > 0 {
+		for _, ext := range cert.Extensions {
+			if !ext.Id.Equal(a.partnerOid) {
+				continue
+			}
+			if _, err := asn1.Unmarshal(ext.Value, &partner); err != nil {
+				partner = string(ext.Value)
+			}
+			break
+		}
+	}
+	if len(partner) == 0 && len(cert.Subject.OrganizationalUnit) > 0 {
+		partner = cert.Subject.OrganizationalUnit[0]
+	}
+	return mac, strings.ToLower(partner), nil
+}
+
+// normalizeCertMac accepts the macs in a cert with the common separators, and with a "mac:" prefix
+func normalizeCertMac(s string) string {
+	s = strings.TrimPrefix(strings.ToLower(s), "mac:")
+	s = strings.NewReplacer(":", "", "-", "", ".", "").Replace(s)
+	return strings.ToUpper(s)
+}
+
+// NewServerTlsConfig builds the tls config of the server. With the client auth enabled, the client
+// certificates are verified against the ca bundle when given, and they are required per route by
+// the middleware, so the routes can also accept tokens.
+func NewServerTlsConfig(conf *configuration.Config) (*tls.Config, error) {
+	certFile := conf.GetString("webconfig.server.tls.cert_file")
+	keyFile := conf.GetString("webconfig.server.tls.key_file")
+	if len(certFile) == 0 || len(keyFile) == 0 {
+		err := fmt.Errorf("missing webconfig.server.tls.cert_file or key_file")
+		return nil, common.NewError(err)
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, common.NewError(err)
+	}
+
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if conf.GetBoolean(deviceAuthConfigPath + ".enabled") {
+		caFile := conf.GetString(deviceAuthConfigPath + ".ca_file")
+		cabytes, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, common.NewError(err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(cabytes) {
+			err := fmt.Errorf("no certificates in %v", caFile)
+			return nil, common.NewError(err)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return tlsConfig, nil
+}
@@ -0,0 +1,228 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package http
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-akka/configuration"
+	"github.com/rdkcentral/webconfig/common"
+	"github.com/rdkcentral/webconfig/util"
+	"gotest.tools/assert"
+)
+
+// newTestCert issues a certificate by the parent, or a self-signed ca if parent is nil
+func newTestCert(t *testing.T, template *x509.Certificate, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NilError(t, err)
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	assert.NilError(t, err)
+	template.SerialNumber = serial
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	assert.NilError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.NilError(t, err)
+	return cert, key
+}
+
+func toTlsCert(t *testing.T, cert *x509.Certificate, key *ecdsa.PrivateKey) tls.Certificate {
+	kbytes, err := x509.MarshalECPrivateKey(key)
+	assert.NilError(t, err)
+	tlsCert, err := tls.X509KeyPair(
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: kbytes}),
+	)
+	assert.NilError(t, err)
+	return tlsCert
+}
+
+func TestMutualTlsDeviceAuth(t *testing.T) {
+	server := NewWebconfigServer(sc, true)
+	cpeMac := util.GenerateRandomCpeMac()
+	server.SetRootDocument(cpeMac, common.NewRootDocument(0, "fw1", "model1", "cox", "", "", "", "", ""))
+
+	// add one sub doc
+	lanBytes := common.RandomBytes(100, 150)
+	url := fmt.Sprintf("/api/v1/device/%v/document/lan", cpeMac)
+	req, err := http.NewRequest("POST", url, bytes.NewReader(lanBytes))
+	assert.NilError(t, err)
+	req.Header.Set(common.HeaderContentType, common.HeaderApplicationMsgpack)
+	res := ExecuteRequest(req, server.GetRouter(true)).Result()
+	_, err = io.ReadAll(res.Body)
+	assert.NilError(t, err)
+	res.Body.Close()
+	assert.Equal(t, res.StatusCode, http.StatusOK)
+
+	// ==== the ca, the server cert and the device certs ====
+	caCert, caKey := newTestCert(t, &x509.Certificate{Subject: pkix.Name{CommonName: "test device ca"}}, nil, nil)
+	serverCert, serverKey := newTestCert(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "localhost"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, caCert, caKey)
+	partnerOid := asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 99999, 1}
+	pbytes, err := asn1.Marshal("comcast")
+	assert.NilError(t, err)
+	clientTemplate := func(cn string, ou ...string) *x509.Certificate {
+		return &x509.Certificate{
+			Subject:     pkix.Name{CommonName: cn, OrganizationalUnit: ou},
+			ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}
+	}
+	deviceCert, deviceKey := newTestCert(t, clientTemplate("mac:"+cpeMac, "cox"), caCert, caKey)
+	otherCert, otherKey := newTestCert(t, clientTemplate(util.GenerateRandomCpeMac(), "cox"), caCert, caKey)
+	extTemplate := clientTemplate("device")
+	extTemplate.DNSNames = []string{cpeMac}
+	extTemplate.ExtraExtensions = []pkix.Extension{{Id: partnerOid, Value: pbytes}}
+	extCert, extKey := newTestCert(t, extTemplate, caCert, caKey)
+
+	// a device cert from a ca not in the bundle
+	rogueCaCert, rogueCaKey := newTestCert(t, &x509.Certificate{Subject: pkix.Name{CommonName: "rogue ca"}}, nil, nil)
+	rogueCert, rogueKey := newTestCert(t, clientTemplate(cpeMac, "cox"), rogueCaCert, rogueCaKey)
+
+	dir := t.TempDir()
+	writePem := func(name string, block *pem.Block) string {
+		f := filepath.Join(dir, name)
+		assert.NilError(t, os.WriteFile(f, pem.EncodeToMemory(block), 0600))
+		return f
+	}
+	skbytes, err := x509.MarshalECPrivateKey(serverKey)
+	assert.NilError(t, err)
+	conf := configuration.ParseString(fmt.Sprintf(`
+webconfig.server.tls {
+    enabled = true
+    cert_file = "%v"
+    key_file = "%v"
+    client_auth {
+        enabled = true
+        ca_file = "%v"
+        partner_oid = "1.3.6.1.4.1.99999.1"
+        route_modes {
+            mtls = ["GET /api/v1/device/{mac}/config"]
+        }
+    }
+}`, writePem("server.pem", &pem.Block{Type: "CERTIFICATE", Bytes: serverCert.Raw}),
+		writePem("server_key.pem", &pem.Block{Type: "EC PRIVATE KEY", Bytes: skbytes}),
+		writePem("ca.pem", &pem.Block{Type: "CERTIFICATE", Bytes: caCert.Raw})))
+
+	tlsConfig, err := NewServerTlsConfig(conf)
+	assert.NilError(t, err)
+	deviceAuth, err := NewDeviceAuth(conf)
+	assert.NilError(t, err)
+	assert.Equal(t, deviceAuth.Mode("GET", "/api/v1/device/{mac}/config"), DeviceAuthMtls)
+	assert.Equal(t, deviceAuth.Mode("GET", "/api/v1/device/{mac}/other"), DeviceAuthMtlsOrJwt)
+
+	server.SetDeviceAuth(deviceAuth)
+	defer server.SetDeviceAuth(nil)
+	ts := httptest.NewUnstartedServer(server.GetRouter(false))
+	ts.TLS = tlsConfig
+	ts.StartTLS()
+	defer ts.Close()
+
+	caPool := x509.NewCertPool()
+	caPool.AddCert(caCert)
+	getConfig := func(certs ...tls.Certificate) int {
+		client := &http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{RootCAs: caPool, Certificates: certs},
+			},
+		}
+		configUrl := fmt.Sprintf("%v/api/v1/device/%v/config", ts.URL, cpeMac)
+		res, err := client.Get(configUrl)
+		if err != nil {
+			return 0
+		}
+		_, err = io.ReadAll(res.Body)
+		assert.NilError(t, err)
+		res.Body.Close()
+		return res.StatusCode
+	}
+
+	// ==== the mac of the cert is bound to the mac of the route ====
+	status := getConfig(toTlsCert(t, deviceCert, deviceKey))
+	assert.Equal(t, status, http.StatusOK)
+	status = getConfig(toTlsCert(t, extCert, extKey))
+	assert.Equal(t, status, http.StatusOK)
+	status = getConfig(toTlsCert(t, otherCert, otherKey))
+	assert.Equal(t, status, http.StatusForbidden)
+
+	// ==== a revocation of the mac applies to the certs issued before it ====
+	server.SetTokenRevocationEnabled(true)
+	server.SetTokenRevocationCache(nil)
+	revocation := &common.TokenRevocation{
+		CpeMac:       cpeMac,
+		IssuedBefore: deviceCert.NotBefore.Unix() - 60,
+		CreatedTime:  time.Now().UnixMilli(),
+	}
+	assert.NilError(t, server.SetTokenRevocation(revocation))
+	status = getConfig(toTlsCert(t, deviceCert, deviceKey))
+	assert.Equal(t, status, http.StatusOK)
+	revocation.IssuedBefore = time.Now().Unix()
+	assert.NilError(t, server.SetTokenRevocation(revocation))
+	status = getConfig(toTlsCert(t, deviceCert, deviceKey))
+	assert.Equal(t, status, http.StatusForbidden)
+	status = getConfig(toTlsCert(t, extCert, extKey))
+	assert.Equal(t, status, http.StatusForbidden)
+	server.SetTokenRevocationEnabled(false)
+
+	// ==== no cert is rejected on an mtls only route ====
+	status = getConfig()
+	assert.Equal(t, status, http.StatusForbidden)
+
+	// ==== a cert not from the ca is not accepted, the client does not even offer it ====
+	status = getConfig(toTlsCert(t, rogueCert, rogueKey))
+	assert.Equal(t, status, http.StatusForbidden)
+
+	// ==== the identity of the certs ====
+	mac, partner, err := deviceAuth.CertIdentity(deviceCert)
+	assert.NilError(t, err)
+	assert.Equal(t, mac, cpeMac)
+	assert.Equal(t, partner, "cox")
+	mac, partner, err = deviceAuth.CertIdentity(extCert)
+	assert.NilError(t, err)
+	assert.Equal(t, mac, cpeMac)
+	assert.Equal(t, partner, "comcast")
+	_, _, err = deviceAuth.CertIdentity(caCert)
+	assert.Assert(t, err != nil)
+}
@@ -0,0 +1,59 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package http
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/rdkcentral/webconfig/common"
+	"github.com/rdkcentral/webconfig/util"
+)
+
+const defaultDeviceHistoryLimit = 100
+
+func (s *WebconfigServer) GetDeviceHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	mac := strings.ToUpper(mux.Vars(r)["mac"])
+	if !util.ValidateMac(mac) {
+		err := common.Http400Error{
+			Message: "invalid mac",
+		}
+		Error(w, http.StatusBadRequest, common.NewError(err))
+		return
+	}
+
+	limit := defaultDeviceHistoryLimit
+	if x := r.URL.Query().Get("limit"); len(x) > 0 {
+		i, err := strconv.Atoi(x)
+		if err != nil || i <= 0 {
+			err := *common.NewHttp400Error("invalid limit")
+			Error(w, http.StatusBadRequest, common.NewError(err))
+			return
+		}
+		limit = i
+	}
+
+	events, err := s.GetDeviceHistory(mac, limit)
+	if err != nil {
+		Error(w, http.StatusInternalServerError, common.NewError(err))
+		return
+	}
+	WriteOkResponse(w, events)
+}
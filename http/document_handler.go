@@ -28,6 +28,7 @@ import (
 	"github.com/rdkcentral/webconfig/common"
 	"github.com/rdkcentral/webconfig/db"
 	"github.com/rdkcentral/webconfig/util"
+	log "github.com/sirupsen/logrus"
 )
 
 // TODO
@@ -54,6 +55,12 @@ func writeStateHeaders(w http.ResponseWriter, subdoc *common.SubDocument) {
 	if subdoc.Expiry() != nil {
 		w.Header().Set(common.HeaderSubdocumentExpiry, strconv.Itoa(*subdoc.Expiry()))
 	}
+	if subdoc.EffectiveTime() != nil {
+		w.Header().Set(common.HeaderSubdocumentEffectiveTime, strconv.Itoa(*subdoc.EffectiveTime()))
+	}
+	if subdoc.RetryAttempts() != nil {
+		w.Header().Set(common.HeaderSubdocumentRetryAttempts, strconv.Itoa(*subdoc.RetryAttempts()))
+	}
 }
 
 func (s *WebconfigServer) GetSubDocumentHandler(w http.ResponseWriter, r *http.Request) {
@@ -150,6 +157,36 @@ func (s *WebconfigServer) PostSubDocumentHandler(w http.ResponseWriter, r *http.
 		subdoc.SetExpiry(&expiryTms)
 	}
 
+	// handle override duration header, the prior payload is restored after the duration
+	overrideExpiry := 0
+	if x := r.Header.Get(common.HeaderOverrideDuration); len(x) > 0 {
+		duration, err := strconv.Atoi(x)
+		if err != nil || duration <= 0 {
+			err := *common.NewHttp400Error("invalid " + common.HeaderOverrideDuration)
+			Error(w, http.StatusBadRequest, common.NewError(err))
+			return
+		}
+		overrideExpiry = updatedTime + duration*1000
+	}
+
+	// handle effective time header, the subdoc is held back until then
+	effectiveTmsStr := r.Header.Get(common.HeaderSubdocumentEffectiveTime)
+	if len(effectiveTmsStr) > 0 {
+		// only the delivery scheduler moves the root version when the subdoc becomes effective
+		if s.DeliveryScheduler() == nil {
+			err := *common.NewHttp400Error(common.HeaderSubdocumentEffectiveTime + " requires webconfig.delivery_scheduler.enabled")
+			Error(w, http.StatusBadRequest, common.NewError(err))
+			return
+		}
+		effectiveTms, err := strconv.Atoi(effectiveTmsStr)
+		if err != nil || effectiveTms < 0 {
+			err := *common.NewHttp400Error("invalid " + common.HeaderSubdocumentEffectiveTime)
+			Error(w, http.StatusBadRequest, common.NewError(err))
+			return
+		}
+		subdoc.SetEffectiveTime(&effectiveTms)
+	}
+
 	oldState := 0
 	if x := r.Header.Get(common.HeaderSubdocumentOldState); len(x) > 0 {
 		if i, err := strconv.Atoi(x); err == nil {
@@ -165,36 +202,11 @@ func (s *WebconfigServer) PostSubDocumentHandler(w http.ResponseWriter, r *http.
 	rootVersionMap := make(map[string]string)
 	var newRootVersion string
 	for _, deviceId := range deviceIds {
-		fields["src_caller"] = common.GetCaller()
-
-		labels, err := s.GetRootDocumentLabels(deviceId)
-		if err != nil {
-			Error(w, http.StatusInternalServerError, common.NewError(err))
-			return
-		}
-		labels["client"] = metricsAgent
-
-		err = s.SetSubDocument(deviceId, subdocId, subdoc, oldState, labels, fields)
-		if err != nil {
-			Error(w, http.StatusInternalServerError, common.NewError(err))
-			return
-		}
-
-		// update the root version
-		fields["src_caller"] = common.GetCaller()
-		doc, err := s.GetDocument(deviceId, true, fields)
-		if err != nil {
-			if s.IsDbNotFound(err) {
-				doc = common.NewDocument(nil)
-			} else {
-				Error(w, http.StatusInternalServerError, common.NewError(err))
-				return
-			}
+		if overrideExpiry > 0 {
+			newRootVersion, err = s.WriteTemporarySubDocument(deviceId, subdocId, subdoc, overrideExpiry, oldState, metricsAgent, fields)
+		} else {
+			newRootVersion, err = s.WriteSubDocument(deviceId, subdocId, subdoc, oldState, metricsAgent, fields)
 		}
-
-		doc.SetSubDocument(subdocId, subdoc)
-		newRootVersion = db.HashRootVersion(doc.VersionMap())
-		err = s.SetRootDocumentVersion(deviceId, newRootVersion)
 		if err != nil {
 			Error(w, http.StatusInternalServerError, common.NewError(err))
 			return
@@ -208,6 +220,14 @@ func (s *WebconfigServer) PostSubDocumentHandler(w http.ResponseWriter, r *http.
 		d["root_version"] = rootVersionMap
 	}
 
+	if overrideExpiry > 0 {
+		d["override_expiry"] = overrideExpiry
+	}
+
+	if autoPokeRequested(r) {
+		d["auto_poke"] = s.scheduleAutoPokes(deviceIds, r.Header, fields)
+	}
+
 	WriteByMarshal(w, http.StatusOK, d)
 }
 
@@ -228,7 +248,7 @@ func (s *WebconfigServer) DeleteSubDocumentHandler(w http.ResponseWriter, r *htt
 		return
 	}
 
-	err = s.DeleteSubDocument(mac, subdocId)
+	_, err = s.RemoveSubDocument(mac, subdocId, fields)
 	if err != nil {
 		if s.IsDbNotFound(err) {
 			Error(w, http.StatusNotFound, nil)
@@ -238,30 +258,147 @@ func (s *WebconfigServer) DeleteSubDocumentHandler(w http.ResponseWriter, r *htt
 		return
 	}
 
+	if autoPokeRequested(r) {
+		s.scheduleAutoPokes([]string{mac}, r.Header, fields)
+	}
+
+	WriteOkResponse(w, nil)
+}
+
+// autoPokeRequested tells if the writer opts in a poke after the write, by ?auto_poke=true
+func autoPokeRequested(r *http.Request) bool {
+	x, err := strconv.ParseBool(r.URL.Query().Get("auto_poke"))
+	return err == nil && x
+}
+
+// scheduleAutoPokes returns false if no auto poker is running. Only the credential and the
+// tracing headers of the write are forwarded to the poke.
+func (s *WebconfigServer) scheduleAutoPokes(deviceIds []string, header http.Header, fields log.Fields) bool {
+	if s.autoPoker == nil {
+		tfields := common.FilterLogFields(fields)
+		tfields["logger"] = "autopoke"
+		log.WithFields(tfields).Warn("auto poke requested but no auto poker is running")
+		return false
+	}
+	pokeHeader := make(http.Header)
+	for _, k := range autoPokeForwardedHeaders {
+		if x := header.Get(k); len(x) > 0 {
+			pokeHeader.Set(k, x)
+		}
+	}
+	for _, deviceId := range deviceIds {
+		s.autoPoker.Schedule(deviceId, pokeHeader, fields)
+	}
+	return true
+}
+
+// WriteSubDocument stores the subdoc of a device and updates its root version. It is
+// shared by the http handler and the kafka write ingestion. The new root version is returned.
+func (s *WebconfigServer) WriteSubDocument(deviceId, subdocId string, subdoc *common.SubDocument, oldState int, metricsAgent string, fields log.Fields) (string, error) {
+	// a regular write becomes the new baseline, so a pending revert is cancelled
+	if err := s.cancelSubDocumentOverride(deviceId, subdocId, subdoc); err != nil {
+		return "", common.NewError(err)
+	}
+	return s.writeSubDocument(deviceId, subdocId, subdoc, oldState, metricsAgent, fields)
+}
+
+func (s *WebconfigServer) writeSubDocument(deviceId, subdocId string, subdoc *common.SubDocument, oldState int, metricsAgent string, fields log.Fields) (string, error) {
+	if err := s.storeSubDocument(deviceId, subdocId, subdoc, oldState, metricsAgent, fields); err != nil {
+		return "", common.NewError(err)
+	}
+
 	// update the root version
 	fields["src_caller"] = common.GetCaller()
-	doc, err := s.GetDocument(mac, fields)
+	doc, err := s.GetDocument(deviceId, true, fields)
 	if err != nil {
 		if s.IsDbNotFound(err) {
-			err := s.DeleteRootDocumentVersion(mac)
-			if err != nil {
-				Error(w, http.StatusInternalServerError, common.NewError(err))
-			}
-			WriteOkResponse(w, nil)
+			doc = common.NewDocument(nil)
 		} else {
-			Error(w, http.StatusInternalServerError, common.NewError(err))
+			return "", common.NewError(err)
 		}
-		return
 	}
 
-	newRootVersion := db.HashRootVersion(doc.VersionMap())
-	err = s.SetRootDocumentVersion(mac, newRootVersion)
+	doc.SetSubDocument(subdocId, subdoc)
+	newRootVersion := db.HashRootVersion(doc.EffectiveVersionMap(int(time.Now().UnixMilli())))
+	err = s.SetRootDocumentVersion(deviceId, newRootVersion)
 	if err != nil {
-		Error(w, http.StatusInternalServerError, common.NewError(err))
-		return
+		return "", common.NewError(err)
 	}
+	return newRootVersion, nil
+}
 
-	WriteOkResponse(w, nil)
+// storeSubDocument stores the subdoc of a device without updating its root version
+func (s *WebconfigServer) storeSubDocument(deviceId, subdocId string, subdoc *common.SubDocument, oldState int, metricsAgent string, fields log.Fields) error {
+	fields["src_caller"] = common.GetCaller()
+
+	labels, err := s.GetRootDocumentLabels(deviceId)
+	if err != nil {
+		return common.NewError(err)
+	}
+	labels["client"] = metricsAgent
+
+	// a write without an effective_time clears the one of the previous write, and
+	// a new write starts over the retries of failures
+	tsubdoc := *subdoc
+	zero := 0
+	if tsubdoc.EffectiveTime() == nil {
+		tsubdoc.SetEffectiveTime(&zero)
+	}
+	if tsubdoc.RetryAttempts() == nil {
+		tsubdoc.SetRetryAttempts(&zero)
+	}
+	if tsubdoc.RetryTime() == nil {
+		tsubdoc.SetRetryTime(&zero)
+	}
+	err = s.SetSubDocument(deviceId, subdocId, &tsubdoc, oldState, labels, fields)
+	if err != nil {
+		return common.NewError(err)
+	}
+
+	if !subdoc.IsEffective(int(time.Now().UnixMilli())) {
+		schedule := &common.SubDocumentSchedule{
+			CpeMac:        deviceId,
+			SubdocId:      subdocId,
+			EffectiveTime: int64(subdoc.HeldUntil()),
+		}
+		if err := s.SetSubDocumentSchedule(schedule); err != nil {
+			return common.NewError(err)
+		}
+	}
+	return nil
+}
+
+// RemoveSubDocument deletes the subdoc of a device and updates its root version. A db-not-found
+// error is returned if the subdoc does not exist. The root version is empty when no subdoc is left.
+func (s *WebconfigServer) RemoveSubDocument(mac, subdocId string, fields log.Fields) (string, error) {
+	err := s.DeleteSubDocument(mac, subdocId)
+	if err != nil {
+		return "", common.NewError(err)
+	}
+	// the schedule of the subdoc is dropped by the delivery scheduler once due
+	if err := s.DeleteSubDocumentOverride(mac, subdocId); err != nil {
+		return "", common.NewError(err)
+	}
+
+	// update the root version
+	fields["src_caller"] = common.GetCaller()
+	doc, err := s.GetDocument(mac, fields)
+	if err != nil {
+		if !s.IsDbNotFound(err) {
+			return "", common.NewError(err)
+		}
+		if err := s.DeleteRootDocumentVersion(mac); err != nil {
+			return "", common.NewError(err)
+		}
+		return "", nil
+	}
+
+	newRootVersion := db.HashRootVersion(doc.EffectiveVersionMap(int(time.Now().UnixMilli())))
+	err = s.SetRootDocumentVersion(mac, newRootVersion)
+	if err != nil {
+		return "", common.NewError(err)
+	}
+	return newRootVersion, nil
 }
 
 func (s *WebconfigServer) DeleteDocumentHandler(w http.ResponseWriter, r *http.Request) {
@@ -311,7 +448,7 @@ func (s *WebconfigServer) DeleteDocumentHandler(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	newRootVersion := db.HashRootVersion(doc.VersionMap())
+	newRootVersion := db.HashRootVersion(doc.EffectiveVersionMap(int(time.Now().UnixMilli())))
 	err = s.SetRootDocumentVersion(mac, newRootVersion)
 	if err != nil {
 		Error(w, http.StatusInternalServerError, common.NewError(err))
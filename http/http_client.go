@@ -58,10 +58,11 @@ type StatusHandlerFunc func([]byte) ([]byte, http.Header, bool, error)
 type HttpClient struct {
 	*http.Client
 	retries              int
-	retryInMsecs         int
 	statusHandlerFuncMap map[int]StatusHandlerFunc
 	userAgent            string
 	moracideTagPrefix    string
+	breaker              *CircuitBreaker
+	retryPolicy          *RetryPolicy
 }
 
 func NewHttpClient(conf *configuration.Config, serviceName string, tlsConfig *tls.Config) *HttpClient {
@@ -80,8 +81,6 @@ func NewHttpClient(conf *configuration.Config, serviceName string, tlsConfig *tl
 	confKey = fmt.Sprintf("webconfig.%v.retries", serviceName)
 	retries := int(conf.GetInt32(confKey, defaultRetries))
 
-	confKey = fmt.Sprintf("webconfig.%v.retry_in_msecs", serviceName)
-	retryInMsecs := int(conf.GetInt32(confKey, defaultRetriesInMsecs))
 	userAgent := conf.GetString("webconfig.http_client.user_agent")
 
 	moracideTagPrefix := strings.ToLower(conf.GetString("webconfig.tracing.moracide_tag_prefix", tracing.DefaultMoracideTagPrefix))
@@ -105,14 +104,50 @@ func NewHttpClient(conf *configuration.Config, serviceName string, tlsConfig *tl
 			Timeout:   time.Duration(readTimeout) * time.Second,
 		},
 		retries:              retries,
-		retryInMsecs:         retryInMsecs,
 		statusHandlerFuncMap: map[int]StatusHandlerFunc{},
 		userAgent:            userAgent,
 		moracideTagPrefix:    moracideTagPrefix,
+		breaker:              NewCircuitBreaker(conf, serviceName),
+		retryPolicy:          NewRetryPolicy(conf, serviceName),
 	}
 }
 
+func (c *HttpClient) RetryPolicy() *RetryPolicy {
+	return c.retryPolicy
+}
+
+func (c *HttpClient) SetRetryPolicy(p *RetryPolicy) {
+	c.retryPolicy = p
+}
+
+func (c *HttpClient) CircuitBreaker() *CircuitBreaker {
+	return c.breaker
+}
+
+func (c *HttpClient) SetCircuitBreaker(b *CircuitBreaker) {
+	c.breaker = b
+}
+
+// Do short-circuits with a 503 while the circuit breaker is open. Only the
+// retryable errors count as failures of the remote service.
 func (c *HttpClient) Do(method string, url string, header http.Header, bbytes []byte, auditFields log.Fields, loggerName string, retry int) ([]byte, http.Header, bool, error) {
+	if !c.breaker.Allow() {
+		err := c.breaker.openError()
+		tfields := common.FilterLogFields(auditFields, "status")
+		tfields["logger"] = loggerName
+		tfields[fmt.Sprintf("%v_error", loggerName)] = err.Error()
+		log.WithFields(tfields).Warn(fmt.Sprintf("%v short-circuited", loggerName))
+		return nil, nil, false, common.NewError(err)
+	}
+	if retry == 0 {
+		c.retryPolicy.RecordRequest()
+	}
+	rbytes, respHeader, cont, err := c.do(method, url, header, bbytes, auditFields, loggerName, retry)
+	c.breaker.Record(err == nil || !cont)
+	return rbytes, respHeader, cont, err
+}
+
+func (c *HttpClient) do(method string, url string, header http.Header, bbytes []byte, auditFields log.Fields, loggerName string, retry int) ([]byte, http.Header, bool, error) {
 	fields := common.FilterLogFields(auditFields, "status")
 
 	var respMoracideTagsFound bool
@@ -273,7 +308,7 @@ func (c *HttpClient) Do(method string, url string, header http.Header, bbytes []
 			}
 			// Unknown err still appear as 500
 		}
-		return nil, nil, true, common.NewError(err)
+		return nil, nil, IsRetryableError(err), common.NewError(err)
 	}
 	if res.Body != nil {
 		defer res.Body.Close()
@@ -348,11 +383,7 @@ func (c *HttpClient) Do(method string, url string, header http.Header, bbytes []
 			StatusCode: res.StatusCode,
 		}
 
-		switch res.StatusCode {
-		case http.StatusForbidden, http.StatusBadRequest, http.StatusNotFound:
-			return rbytes, nil, false, common.NewError(err)
-		}
-		return rbytes, nil, true, common.NewError(err)
+		return rbytes, nil, IsRetryableStatus(res.StatusCode), common.NewError(err)
 	} else if res.StatusCode > 200 {
 		var pokeResponse PokeResponse
 		var message string
@@ -384,8 +415,11 @@ func (c *HttpClient) DoWithRetries(method string, url string, rHeader http.Heade
 	for i = 0; i <= c.retries; i++ {
 		cbytes := make([]byte, len(bbytes))
 		copy(cbytes, bbytes)
-		if i > 0 {
-			time.Sleep(time.Duration(c.retryInMsecs) * time.Millisecond)
+		if i > 0 && !c.retryPolicy.Wait(i) {
+			tfields := common.FilterLogFields(fields, "status")
+			tfields["logger"] = loggerName
+			log.WithFields(tfields).Warnf("%v retry budget exhausted, retry=%v skipped", loggerName, i)
+			break
 		}
 		respBytes, respHeader, cont, err = c.Do(method, url, rHeader, cbytes, fields, loggerName, i)
 		if !cont {
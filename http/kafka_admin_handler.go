@@ -0,0 +1,141 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/rdkcentral/webconfig/common"
+)
+
+// KafkaConsumerGroupController is implemented by kafka.KafkaConsumerGroup. It is
+// declared here because the kafka package already depends on this package.
+type KafkaConsumerGroupController interface {
+	ClusterName() string
+	Pause() error
+	Resume() error
+	Status() (*common.KafkaConsumerGroupStatus, error)
+	Seek(*common.KafkaSeekRequest) (map[string]map[int32]int64, error)
+}
+
+func (s *WebconfigServer) KafkaConsumerGroups() []KafkaConsumerGroupController {
+	return s.kafkaConsumerGroups
+}
+
+func (s *WebconfigServer) SetKafkaConsumerGroups(x []KafkaConsumerGroupController) {
+	s.kafkaConsumerGroups = x
+}
+
+func (s *WebconfigServer) getKafkaConsumerGroup(clusterName string) KafkaConsumerGroupController {
+	for _, g := range s.kafkaConsumerGroups {
+		if g.ClusterName() == clusterName {
+			return g
+		}
+	}
+	return nil
+}
+
+func (s *WebconfigServer) GetKafkaConsumerGroupsHandler(w http.ResponseWriter, r *http.Request) {
+	statuses := []common.KafkaConsumerGroupStatus{}
+	for _, g := range s.kafkaConsumerGroups {
+		status, err := g.Status()
+		if err != nil {
+			// one unreachable cluster should not hide the others
+			LogError(w, err)
+			status = &common.KafkaConsumerGroupStatus{
+				ClusterName: g.ClusterName(),
+				Error:       err.Error(),
+			}
+		}
+		statuses = append(statuses, *status)
+	}
+	WriteOkResponse(w, statuses)
+}
+
+func (s *WebconfigServer) PauseKafkaConsumerGroupHandler(w http.ResponseWriter, r *http.Request) {
+	clusterName := mux.Vars(r)["cluster"]
+	g := s.getKafkaConsumerGroup(clusterName)
+	if g == nil {
+		Error(w, http.StatusNotFound, nil)
+		return
+	}
+	if err := g.Pause(); err != nil {
+		Error(w, http.StatusInternalServerError, common.NewError(err))
+		return
+	}
+	SetAuditValue(w, "kafka_cluster", clusterName)
+	WriteOkResponse(w, map[string]interface{}{"cluster_name": clusterName, "paused": true})
+}
+
+func (s *WebconfigServer) ResumeKafkaConsumerGroupHandler(w http.ResponseWriter, r *http.Request) {
+	clusterName := mux.Vars(r)["cluster"]
+	g := s.getKafkaConsumerGroup(clusterName)
+	if g == nil {
+		Error(w, http.StatusNotFound, nil)
+		return
+	}
+	if err := g.Resume(); err != nil {
+		Error(w, http.StatusInternalServerError, common.NewError(err))
+		return
+	}
+	SetAuditValue(w, "kafka_cluster", clusterName)
+	WriteOkResponse(w, map[string]interface{}{"cluster_name": clusterName, "paused": false})
+}
+
+func (s *WebconfigServer) SeekKafkaConsumerGroupHandler(w http.ResponseWriter, r *http.Request) {
+	clusterName := mux.Vars(r)["cluster"]
+	g := s.getKafkaConsumerGroup(clusterName)
+	if g == nil {
+		Error(w, http.StatusNotFound, nil)
+		return
+	}
+
+	xw, ok := w.(*XResponseWriter)
+	if !ok {
+		err := *common.NewHttp500Error("responsewriter cast error")
+		Error(w, http.StatusInternalServerError, common.NewError(err))
+		return
+	}
+	bodyBytes := xw.BodyBytes()
+	if len(bodyBytes) == 0 {
+		err := *common.NewHttp400Error("empty body")
+		Error(w, http.StatusBadRequest, common.NewError(err))
+		return
+	}
+
+	var seekRequest common.KafkaSeekRequest
+	if err := json.Unmarshal(bodyBytes, &seekRequest); err != nil {
+		Error(w, http.StatusBadRequest, common.NewError(err))
+		return
+	}
+
+	offsets, err := g.Seek(&seekRequest)
+	if err != nil {
+		if errors.As(err, common.Http400ErrorType) {
+			Error(w, http.StatusBadRequest, err)
+			return
+		}
+		Error(w, http.StatusInternalServerError, common.NewError(err))
+		return
+	}
+	SetAuditValue(w, "kafka_cluster", clusterName)
+	WriteOkResponse(w, offsets)
+}
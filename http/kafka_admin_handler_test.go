@@ -0,0 +1,147 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/rdkcentral/webconfig/common"
+	"gotest.tools/assert"
+)
+
+type mockKafkaConsumerGroup struct {
+	clusterName string
+	paused      bool
+	seekRequest *common.KafkaSeekRequest
+	statusErr   error
+}
+
+func (g *mockKafkaConsumerGroup) ClusterName() string {
+	return g.clusterName
+}
+
+func (g *mockKafkaConsumerGroup) Pause() error {
+	g.paused = true
+	return nil
+}
+
+func (g *mockKafkaConsumerGroup) Resume() error {
+	g.paused = false
+	return nil
+}
+
+func (g *mockKafkaConsumerGroup) Status() (*common.KafkaConsumerGroupStatus, error) {
+	if g.statusErr != nil {
+		return nil, g.statusErr
+	}
+	return &common.KafkaConsumerGroupStatus{
+		ClusterName: g.clusterName,
+		GroupId:     "webconfig",
+		Topics:      []string{"topic1"},
+		Paused:      g.paused,
+		Partitions: []common.KafkaPartitionStatus{
+			{Topic: "topic1", Partition: 0, CommittedOffset: 10, HighWaterMark: 15, Lag: 5},
+		},
+	}, nil
+}
+
+func (g *mockKafkaConsumerGroup) Seek(req *common.KafkaSeekRequest) (map[string]map[int32]int64, error) {
+	if req.Offset == nil {
+		err := *common.NewHttp400Error("offset required")
+		return nil, common.NewError(err)
+	}
+	g.seekRequest = req
+	return map[string]map[int32]int64{req.Topic: {0: *req.Offset}}, nil
+}
+
+func TestKafkaConsumerGroupsHandler(t *testing.T) {
+	server := NewWebconfigServer(sc, true)
+	router := server.GetRouter(true)
+
+	root := &mockKafkaConsumerGroup{clusterName: "root"}
+	mesh := &mockKafkaConsumerGroup{clusterName: "mesh", statusErr: fmt.Errorf("brokers unreachable")}
+	server.SetKafkaConsumerGroups([]KafkaConsumerGroupController{root, mesh})
+
+	// ==== pause ====
+	req, err := http.NewRequest("POST", "/api/v1/kafka/consumer_groups/root/pause", nil)
+	assert.NilError(t, err)
+	res := ExecuteRequest(req, router).Result()
+	assert.Equal(t, res.StatusCode, http.StatusOK)
+	res.Body.Close()
+	assert.Assert(t, root.paused)
+
+	// ==== list ====
+	req, err = http.NewRequest("GET", "/api/v1/kafka/consumer_groups", nil)
+	assert.NilError(t, err)
+	res = ExecuteRequest(req, router).Result()
+	assert.Equal(t, res.StatusCode, http.StatusOK)
+	rbytes, err := io.ReadAll(res.Body)
+	assert.NilError(t, err)
+	res.Body.Close()
+
+	var statuses []common.KafkaConsumerGroupStatus
+	resp := common.HttpResponse{Data: &statuses}
+	err = json.Unmarshal(rbytes, &resp)
+	assert.NilError(t, err)
+	assert.Equal(t, len(statuses), 2)
+	assert.Equal(t, statuses[0].ClusterName, "root")
+	assert.Assert(t, statuses[0].Paused)
+	assert.Equal(t, statuses[0].Partitions[0].Lag, int64(5))
+	assert.Equal(t, statuses[1].ClusterName, "mesh")
+	assert.Equal(t, statuses[1].Error, "brokers unreachable")
+
+	// ==== resume ====
+	req, err = http.NewRequest("POST", "/api/v1/kafka/consumer_groups/root/resume", nil)
+	assert.NilError(t, err)
+	res = ExecuteRequest(req, router).Result()
+	assert.Equal(t, res.StatusCode, http.StatusOK)
+	res.Body.Close()
+	assert.Assert(t, !root.paused)
+
+	// ==== unknown cluster ====
+	req, err = http.NewRequest("POST", "/api/v1/kafka/consumer_groups/east/pause", nil)
+	assert.NilError(t, err)
+	res = ExecuteRequest(req, router).Result()
+	assert.Equal(t, res.StatusCode, http.StatusNotFound)
+	res.Body.Close()
+
+	// ==== seek ====
+	bbytes := []byte(`{"topic":"topic1","partition":0,"offset":3}`)
+	req, err = http.NewRequest("POST", "/api/v1/kafka/consumer_groups/root/seek", bytes.NewReader(bbytes))
+	assert.NilError(t, err)
+	res = ExecuteRequest(req, router).Result()
+	assert.Equal(t, res.StatusCode, http.StatusOK)
+	res.Body.Close()
+	assert.Equal(t, root.seekRequest.Topic, "topic1")
+	assert.Equal(t, *root.seekRequest.Partition, int32(0))
+	assert.Equal(t, *root.seekRequest.Offset, int64(3))
+
+	// ==== seek bad requests ====
+	for _, body := range []string{`{"topic":"topic1"}`, `not json`, ``} {
+		req, err = http.NewRequest("POST", "/api/v1/kafka/consumer_groups/root/seek", bytes.NewReader([]byte(body)))
+		assert.NilError(t, err)
+		res = ExecuteRequest(req, router).Result()
+		assert.Equal(t, res.StatusCode, http.StatusBadRequest)
+		res.Body.Close()
+	}
+}
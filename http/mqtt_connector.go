@@ -39,6 +39,7 @@ type MqttConnector struct {
 	host        string
 	serviceName string
 	urlTemplate string
+	native      *MqttNativeClient
 }
 
 func NewMqttConnector(conf *configuration.Config, tlsConfig *tls.Config) *MqttConnector {
@@ -70,11 +71,27 @@ func (c *MqttConnector) SetMqttUrlTemplate(x string) {
 	c.urlTemplate = x
 }
 
+func (c *MqttConnector) MqttNativeClient() *MqttNativeClient {
+	return c.native
+}
+
+func (c *MqttConnector) SetMqttNativeClient(x *MqttNativeClient) {
+	c.native = x
+}
+
 func (c *MqttConnector) ServiceName() string {
 	return c.serviceName
 }
 
 func (c *MqttConnector) PostMqtt(cpeMac string, bbytes []byte, fields log.Fields) ([]byte, error) {
+	// in native mode, the response is published to the device topic directly
+	if c.native != nil {
+		if err := c.native.Publish(cpeMac, bbytes); err != nil {
+			return nil, common.NewError(err)
+		}
+		return nil, nil
+	}
+
 	url := fmt.Sprintf(c.MqttUrlTemplate(), c.MqttHost(), cpeMac)
 
 	var traceId, xmTraceId, outTraceparent, outTracestate string
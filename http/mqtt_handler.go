@@ -0,0 +1,237 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rdkcentral/webconfig/common"
+	"github.com/rdkcentral/webconfig/db"
+	"github.com/rdkcentral/webconfig/util"
+	log "github.com/sirupsen/logrus"
+)
+
+// HandleMqttGet serves a GET request received over mqtt, either relayed through
+// kafka or read directly from the broker, and posts the response to the device.
+// NOTE we choose to return an EventMessage object just to pass along the metricsAgent
+func (s *WebconfigServer) HandleMqttGet(inbytes []byte, fields log.Fields) (*common.EventMessage, error) {
+	rHeader, _ := util.ParseHttp(inbytes)
+	params := rHeader.Get(common.HeaderDocName)
+	cpeMac := rHeader.Get(common.HeaderDeviceId)
+	if len(cpeMac) == 0 {
+		cpeMac = rHeader.Get("Mac")
+	}
+	cpeMac = strings.ToUpper(cpeMac)
+	rHeader.Set(common.HeaderDeviceId, cpeMac)
+
+	// TODO parse themis token and extract mac
+	fields["cpemac"] = cpeMac
+	fields["cpe_mac"] = cpeMac
+	if len(params) > 0 {
+		fields["path"] = fmt.Sprintf("/api/v1/device/%v/config?group_id=%v", cpeMac, params)
+	} else {
+		fields["path"] = fmt.Sprintf("/api/v1/device/%v/config", cpeMac)
+	}
+
+	var m common.EventMessage
+	if x := rHeader.Get(common.HeaderMetricsAgent); len(x) > 0 {
+		fields["metrics_agent"] = x
+		m.MetricsAgent = &x
+	}
+	var transactionId string
+	if x := rHeader.Get("Transaction-ID"); len(x) > 0 {
+		fields["transaction_id"] = x
+		fields["trace_id"] = x
+		transactionId = x
+	}
+
+	// a new GET closes any response the device has not acknowledged yet
+	tracker := s.MqttTracker()
+	if tracker != nil {
+		s.observeMqttRoundTrips(tracker.Reget(cpeMac, time.Now()), fields)
+	}
+
+	// remote sensitive headers
+	logHeaders := rHeader.Clone()
+	logHeaders.Del("Authorization")
+	d := make(util.Dict)
+	d.Update(logHeaders)
+	fields["header"] = d
+	log.WithFields(fields).Info("request starts")
+
+	// handle empty schema version header
+	if x := rHeader.Get(common.HeaderSchemaVersion); len(x) == 0 {
+		rHeader.Set(common.HeaderSchemaVersion, "none")
+	}
+
+	status, respHeader, respBytes, err := BuildWebconfigResponse(s, rHeader, common.RouteMqtt, fields)
+	if err != nil && respBytes == nil {
+		respBytes = []byte(err.Error())
+	}
+
+	fields["status"] = status
+	if len(transactionId) > 0 {
+		respHeader.Set("Transaction-ID", transactionId)
+	}
+
+	mqttBytes := common.BuildPayloadAsHttp(status, respHeader, respBytes)
+	_, err = s.PostMqtt(cpeMac, mqttBytes, fields)
+	if err != nil {
+		return &m, common.NewError(err)
+	}
+
+	if tracker != nil && status == http.StatusOK {
+		// the response is already published, a parse failure only skips the tracking
+		mparts, err := util.ParseMultipart(respHeader, respBytes)
+		if err != nil {
+			tfields := common.FilterLogFields(fields)
+			tfields["logger"] = "mqtt"
+			tfields["error"] = err.Error()
+			log.WithFields(tfields).Warn("failed to track mqtt response")
+			return &m, nil
+		}
+		subdocIds := []string{}
+		for subdocId := range mparts {
+			subdocIds = append(subdocIds, subdocId)
+		}
+		s.observeMqttRoundTrips(tracker.Track(transactionId, cpeMac, subdocIds, time.Now()), fields)
+	}
+	return &m, nil
+}
+
+// HandleStateNotification updates the subdoc states from a device report and
+// returns the ids of the subdocs that changed
+func (s *WebconfigServer) HandleStateNotification(bbytes []byte, fields log.Fields) (*common.EventMessage, []string, error) {
+	var m common.EventMessage
+	err := json.Unmarshal(bbytes, &m)
+	if err != nil {
+		return nil, nil, common.NewError(err)
+	}
+
+	fields["body"] = m
+	cpeMac, err := m.Validate(true)
+	if err != nil {
+		return nil, nil, common.NewError(err)
+	}
+
+	if m.ErrorDetails != nil && *m.ErrorDetails == "max_retry_reached" {
+		return &m, nil, nil
+	}
+
+	fields["cpemac"] = cpeMac
+	fields["cpe_mac"] = cpeMac
+	updatedSubdocIds, err := db.UpdateDocumentState(s.DatabaseClient, cpeMac, &m, fields)
+	if err != nil {
+		// NOTE return the *eventMessage
+		return &m, updatedSubdocIds, common.NewError(err)
+	}
+	// a rollback takes precedence over a retry of the failed version
+	if !s.handleLastKnownGood(cpeMac, &m, fields) {
+		s.retryFailedSubDocument(cpeMac, &m, fields)
+	}
+
+	if tracker := s.MqttTracker(); tracker != nil && m.Namespace != nil {
+		var transactionId string
+		if m.TransactionUuid != nil {
+			transactionId = *m.TransactionUuid
+		}
+		if trip := tracker.Complete(transactionId, cpeMac, *m.Namespace, time.Now()); trip != nil {
+			s.observeMqttRoundTrips([]MqttRoundTrip{*trip}, fields)
+		}
+	}
+	return &m, updatedSubdocIds, nil
+}
+
+// StartMqttNativeClient connects to the mqtt broker when webconfig.mqtt.native.enabled
+// is set. Once started, PostMqtt publishes to the broker instead of the http collector.
+func (s *WebconfigServer) StartMqttNativeClient() error {
+	if !s.GetBoolean("webconfig.mqtt.native.enabled") {
+		return nil
+	}
+	c, err := NewMqttNativeClient(s.Config, s.AppName())
+	if err != nil {
+		return common.NewError(err)
+	}
+	if err := c.Start(s.mqttGetMessageHandler, s.mqttStateMessageHandler); err != nil {
+		return common.NewError(err)
+	}
+	s.SetMqttNativeClient(c)
+	return nil
+}
+
+func (s *WebconfigServer) mqttMessageFields(topic string, payload []byte, eventName string) log.Fields {
+	return log.Fields{
+		"logger":         "mqtt",
+		"app_name":       s.AppName(),
+		"topic":          topic,
+		"audit_id":       util.GetAuditId(),
+		"event_name":     eventName,
+		"message_length": len(payload),
+	}
+}
+
+// the native handlers keep the metrics and the forwarding of the kafka consumer,
+// the messages not read from kafka are counted with partition -1
+func (s *WebconfigServer) mqttGetMessageHandler(topic string, payload []byte) {
+	start := time.Now()
+	eventName := "mqtt-get"
+	fields := s.mqttMessageFields(topic, payload, eventName)
+	m, err := s.HandleMqttGet(payload, fields)
+	duration := int(time.Since(start).Nanoseconds() / 1000000)
+	fields["duration"] = duration
+	s.ObserveEventMetrics(eventName, m, duration, -1, err)
+	if err != nil {
+		fields["error"] = err.Error()
+		log.WithFields(fields).Error("errors")
+		return
+	}
+	log.WithFields(fields).Info("Request Finished")
+}
+
+func (s *WebconfigServer) mqttStateMessageHandler(topic string, payload []byte) {
+	start := time.Now()
+	eventName := "mqtt-state"
+	fields := s.mqttMessageFields(topic, payload, eventName)
+	header, bbytes := util.ParseHttp(payload)
+	fields["destination"] = header.Get("Destination")
+	m, updatedSubdocIds, err := s.HandleStateNotification(bbytes, fields)
+	duration := int(time.Since(start).Nanoseconds() / 1000000)
+	fields["duration"] = duration
+	s.ObserveEventMetrics(eventName, m, duration, -1, err)
+	if err != nil {
+		if s.IsDbNotFound(err) {
+			log.WithFields(fields).Trace("db not found")
+		} else if errors.Is(err, common.ErrPending) {
+			log.WithFields(fields).Trace("pending")
+		} else {
+			fields["error"] = err.Error()
+			log.WithFields(fields).Error("errors")
+		}
+		return
+	}
+	log.WithFields(fields).Info("ok")
+
+	if s.KafkaProducerEnabled() && m != nil {
+		s.ForwardStateMessage([]byte(m.DeviceId), m, updatedSubdocIds, fields)
+	}
+}
@@ -0,0 +1,385 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/eclipse/paho.golang/autopaho"
+	"github.com/eclipse/paho.golang/paho"
+	pahov3 "github.com/eclipse/paho.mqtt.golang"
+	"github.com/go-akka/configuration"
+	"github.com/rdkcentral/webconfig/common"
+	"github.com/rdkcentral/webconfig/util"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultMqttNativeBrokerUrl        = "tcp://localhost:1883"
+	defaultMqttNativeGetTopic         = "x/fr/webconfig/get/+"
+	defaultMqttNativeStateTopic       = "x/fr/webconfig/state/+"
+	defaultMqttNativePublishTemplate  = "x/to/%s/webconfig"
+	defaultMqttNativeProtocolVersion  = 4
+	defaultMqttNativeConnectTimeout   = 10
+	defaultMqttNativePublishTimeout   = 5
+	defaultMqttNativeKeepaliveSeconds = 30
+)
+
+// MqttMessageHandler handles a message read from one of the subscribed topics
+type MqttMessageHandler func(topic string, payload []byte)
+
+type mqttSubscription struct {
+	topic   string
+	handler MqttMessageHandler
+}
+
+// mqttTransport hides the client library. paho.mqtt.golang only speaks mqtt 3.1 and
+// 3.1.1, the mqtt 5 connections, required by the shared subscriptions, use paho.golang.
+type mqttTransport interface {
+	Connect(subscriptions []mqttSubscription) error
+	Publish(topic string, payload []byte) error
+	Close()
+}
+
+type mqttNativeOptions struct {
+	brokerUrl      string
+	clientId       string
+	username       string
+	password       string
+	tlsConfig      *tls.Config
+	qos            byte
+	cleanSession   bool
+	keepalive      time.Duration
+	sessionExpiry  time.Duration
+	connectTimeout time.Duration
+	publishTimeout time.Duration
+}
+
+// MqttNativeClient talks to the mqtt broker directly instead of going through
+// the http collector. Device GETs and state reports are read from the broker
+// and responses are published to a per-device topic.
+type MqttNativeClient struct {
+	transport       mqttTransport
+	protocolVersion int
+	getTopic        string
+	stateTopic      string
+	sharedGroup     string
+	publishTemplate string
+}
+
+func NewMqttNativeClient(conf *configuration.Config, appName string) (*MqttNativeClient, error) {
+	prefix := "webconfig.mqtt.native"
+	clientId := conf.GetString(prefix + ".client_id")
+	if len(clientId) == 0 {
+		// each replica needs its own client id, the broker drops duplicates
+		hostname, _ := os.Hostname()
+		clientId = fmt.Sprintf("%s-%s-%s", appName, hostname, util.GenerateRandomCpeMac())
+	}
+	protocolVersion := int(conf.GetInt32(prefix+".protocol_version", defaultMqttNativeProtocolVersion))
+	if protocolVersion < 3 || protocolVersion > 5 {
+		return nil, common.NewError(fmt.Errorf("unsupported mqtt protocol_version %v", protocolVersion))
+	}
+	qos := int(conf.GetInt32(prefix+".qos", 1))
+	if qos < 0 || qos > 2 {
+		return nil, common.NewError(fmt.Errorf("invalid mqtt qos %v", qos))
+	}
+	// $share/ subscriptions are defined by mqtt 5, older brokers treat them as plain topics
+	sharedGroup := conf.GetString(prefix + ".shared_group")
+	if len(sharedGroup) > 0 && protocolVersion != 5 {
+		return nil, common.NewError(fmt.Errorf("mqtt shared_group requires protocol_version 5"))
+	}
+
+	opts := &mqttNativeOptions{
+		brokerUrl:      conf.GetString(prefix+".broker_url", defaultMqttNativeBrokerUrl),
+		clientId:       clientId,
+		username:       conf.GetString(prefix + ".username"),
+		password:       conf.GetString(prefix + ".password"),
+		qos:            byte(qos),
+		cleanSession:   conf.GetBoolean(prefix+".clean_session", true),
+		keepalive:      time.Duration(conf.GetInt32(prefix+".keepalive_in_secs", defaultMqttNativeKeepaliveSeconds)) * time.Second,
+		sessionExpiry:  time.Duration(conf.GetInt32(prefix+".session_expiry_in_secs", 0)) * time.Second,
+		connectTimeout: time.Duration(conf.GetInt32(prefix+".connect_timeout_in_secs", defaultMqttNativeConnectTimeout)) * time.Second,
+		publishTimeout: time.Duration(conf.GetInt32(prefix+".publish_timeout_in_secs", defaultMqttNativePublishTimeout)) * time.Second,
+	}
+	if envName := conf.GetString(prefix + ".password_env"); len(envName) > 0 {
+		if x := os.Getenv(envName); len(x) > 0 {
+			opts.password = x
+		}
+	}
+
+	// the tls_* keys follow the same layout as the kafka sections
+	tlsConfig, err := common.LoadKafkaTLSConfig(conf, prefix)
+	if err != nil {
+		return nil, common.NewError(err)
+	}
+	opts.tlsConfig = tlsConfig
+
+	c := &MqttNativeClient{
+		protocolVersion: protocolVersion,
+		getTopic:        conf.GetString(prefix+".get_topic", defaultMqttNativeGetTopic),
+		stateTopic:      conf.GetString(prefix+".state_topic", defaultMqttNativeStateTopic),
+		sharedGroup:     sharedGroup,
+		publishTemplate: conf.GetString(prefix+".publish_topic_template", defaultMqttNativePublishTemplate),
+	}
+	if protocolVersion == 5 {
+		transport, err := newMqttV5Transport(opts)
+		if err != nil {
+			return nil, common.NewError(err)
+		}
+		c.transport = transport
+	} else {
+		c.transport = newMqttV3Transport(opts, protocolVersion)
+	}
+	return c, nil
+}
+
+func (c *MqttNativeClient) ProtocolVersion() int {
+	return c.protocolVersion
+}
+
+// SubscriptionTopic returns the topic filter actually subscribed. With a shared
+// group, the broker balances the messages across all replicas in the group.
+func (c *MqttNativeClient) SubscriptionTopic(topic string) string {
+	if len(c.sharedGroup) == 0 {
+		return topic
+	}
+	return fmt.Sprintf("$share/%s/%s", c.sharedGroup, topic)
+}
+
+func (c *MqttNativeClient) PublishTopic(cpeMac string) string {
+	return fmt.Sprintf(c.publishTemplate, strings.ToLower(cpeMac))
+}
+
+// Start connects to the broker and subscribes to the device topics
+func (c *MqttNativeClient) Start(getHandler, stateHandler MqttMessageHandler) error {
+	subscriptions := []mqttSubscription{}
+	if getHandler != nil && len(c.getTopic) > 0 {
+		subscriptions = append(subscriptions, mqttSubscription{topic: c.SubscriptionTopic(c.getTopic), handler: getHandler})
+	}
+	if stateHandler != nil && len(c.stateTopic) > 0 {
+		subscriptions = append(subscriptions, mqttSubscription{topic: c.SubscriptionTopic(c.stateTopic), handler: stateHandler})
+	}
+	if err := c.transport.Connect(subscriptions); err != nil {
+		return common.NewError(err)
+	}
+	return nil
+}
+
+func (c *MqttNativeClient) Publish(cpeMac string, bbytes []byte) error {
+	if err := c.transport.Publish(c.PublishTopic(cpeMac), bbytes); err != nil {
+		return common.NewError(err)
+	}
+	return nil
+}
+
+func (c *MqttNativeClient) Close() {
+	c.transport.Close()
+}
+
+// mqttV3Transport speaks mqtt 3.1 and 3.1.1 through paho.mqtt.golang
+type mqttV3Transport struct {
+	opts          *mqttNativeOptions
+	client        pahov3.Client
+	subscriptions []mqttSubscription
+}
+
+func newMqttV3Transport(opts *mqttNativeOptions, protocolVersion int) *mqttV3Transport {
+	t := &mqttV3Transport{
+		opts: opts,
+	}
+
+	copts := pahov3.NewClientOptions()
+	copts.AddBroker(opts.brokerUrl)
+	copts.SetClientID(opts.clientId)
+	copts.SetProtocolVersion(uint(protocolVersion))
+	copts.SetCleanSession(opts.cleanSession)
+	copts.SetKeepAlive(opts.keepalive)
+	copts.SetConnectTimeout(opts.connectTimeout)
+	copts.SetAutoReconnect(true)
+	copts.SetOrderMatters(false)
+	if len(opts.username) > 0 {
+		copts.SetUsername(opts.username)
+		copts.SetPassword(opts.password)
+	}
+	if opts.tlsConfig != nil {
+		copts.SetTLSConfig(opts.tlsConfig)
+	}
+
+	// subscriptions are (re)created on every connect so that they survive
+	// broker restarts even with clean sessions
+	copts.SetOnConnectHandler(func(client pahov3.Client) {
+		if err := t.subscribe(); err != nil {
+			log.WithFields(log.Fields{"logger": "mqtt", "error": err}).Error("mqtt subscribe failed")
+		}
+	})
+	copts.SetConnectionLostHandler(func(client pahov3.Client, err error) {
+		log.WithFields(log.Fields{"logger": "mqtt", "error": err}).Warn("mqtt connection lost")
+	})
+	t.client = pahov3.NewClient(copts)
+	return t
+}
+
+func (t *mqttV3Transport) subscribe() error {
+	for _, sub := range t.subscriptions {
+		handler := sub.handler
+		callback := func(client pahov3.Client, msg pahov3.Message) {
+			handler(msg.Topic(), msg.Payload())
+		}
+		if err := t.waitToken(t.client.Subscribe(sub.topic, t.opts.qos, callback), t.opts.connectTimeout); err != nil {
+			return common.NewError(err)
+		}
+	}
+	return nil
+}
+
+func (t *mqttV3Transport) waitToken(token pahov3.Token, timeout time.Duration) error {
+	if !token.WaitTimeout(timeout) {
+		return fmt.Errorf("mqtt operation timeout after %v", timeout)
+	}
+	return token.Error()
+}
+
+func (t *mqttV3Transport) Connect(subscriptions []mqttSubscription) error {
+	t.subscriptions = subscriptions
+	return t.waitToken(t.client.Connect(), t.opts.connectTimeout)
+}
+
+func (t *mqttV3Transport) Publish(topic string, payload []byte) error {
+	return t.waitToken(t.client.Publish(topic, t.opts.qos, false, payload), t.opts.publishTimeout)
+}
+
+func (t *mqttV3Transport) Close() {
+	t.client.Disconnect(250)
+}
+
+// mqttV5Transport speaks mqtt 5 through paho.golang. autopaho reconnects on its own.
+type mqttV5Transport struct {
+	opts      *mqttNativeOptions
+	serverUrl *url.URL
+	cm        *autopaho.ConnectionManager
+	cancel    context.CancelFunc
+}
+
+func newMqttV5Transport(opts *mqttNativeOptions) (*mqttV5Transport, error) {
+	serverUrl, err := url.Parse(opts.brokerUrl)
+	if err != nil {
+		return nil, common.NewError(err)
+	}
+	return &mqttV5Transport{
+		opts:      opts,
+		serverUrl: serverUrl,
+	}, nil
+}
+
+func (t *mqttV5Transport) Connect(subscriptions []mqttSubscription) error {
+	router := paho.NewStandardRouter()
+	options := []paho.SubscribeOptions{}
+	for _, sub := range subscriptions {
+		handler := sub.handler
+		router.RegisterHandler(sub.topic, func(p *paho.Publish) {
+			handler(p.Topic, p.Payload)
+		})
+		options = append(options, paho.SubscribeOptions{Topic: sub.topic, QoS: t.opts.qos})
+	}
+
+	cfg := autopaho.ClientConfig{
+		ServerUrls:                    []*url.URL{t.serverUrl},
+		TlsCfg:                        t.opts.tlsConfig,
+		KeepAlive:                     uint16(t.opts.keepalive.Seconds()),
+		CleanStartOnInitialConnection: t.opts.cleanSession,
+		SessionExpiryInterval:         uint32(t.opts.sessionExpiry.Seconds()),
+		ConnectTimeout:                t.opts.connectTimeout,
+		// subscriptions are (re)created on every connect so that they survive
+		// broker restarts even with clean sessions
+		OnConnectionUp: func(cm *autopaho.ConnectionManager, connack *paho.Connack) {
+			if len(options) == 0 {
+				return
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), t.opts.connectTimeout)
+			defer cancel()
+			if _, err := cm.Subscribe(ctx, &paho.Subscribe{Subscriptions: options}); err != nil {
+				log.WithFields(log.Fields{"logger": "mqtt", "error": err}).Error("mqtt subscribe failed")
+			}
+		},
+		OnConnectError: func(err error) {
+			log.WithFields(log.Fields{"logger": "mqtt", "error": err}).Warn("mqtt connection failed")
+		},
+		ClientConfig: paho.ClientConfig{
+			ClientID: t.opts.clientId,
+			OnPublishReceived: []func(paho.PublishReceived) (bool, error){
+				func(pr paho.PublishReceived) (bool, error) {
+					router.Route(pr.Packet.Packet())
+					return true, nil
+				},
+			},
+			OnClientError: func(err error) {
+				log.WithFields(log.Fields{"logger": "mqtt", "error": err}).Warn("mqtt connection lost")
+			},
+		},
+	}
+	if len(t.opts.username) > 0 {
+		cfg.ConnectUsername = t.opts.username
+		cfg.ConnectPassword = []byte(t.opts.password)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cm, err := autopaho.NewConnection(ctx, cfg)
+	if err != nil {
+		cancel()
+		return common.NewError(err)
+	}
+	actx, acancel := context.WithTimeout(ctx, t.opts.connectTimeout)
+	defer acancel()
+	if err := cm.AwaitConnection(actx); err != nil {
+		cancel()
+		return common.NewError(err)
+	}
+	t.cm = cm
+	t.cancel = cancel
+	return nil
+}
+
+func (t *mqttV5Transport) Publish(topic string, payload []byte) error {
+	if t.cm == nil {
+		return fmt.Errorf("mqtt client not connected")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), t.opts.publishTimeout)
+	defer cancel()
+	_, err := t.cm.Publish(ctx, &paho.Publish{
+		Topic:   topic,
+		QoS:     t.opts.qos,
+		Payload: payload,
+	})
+	return err
+}
+
+func (t *mqttV5Transport) Close() {
+	if t.cm == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	_ = t.cm.Disconnect(ctx)
+	t.cancel()
+}
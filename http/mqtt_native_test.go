@@ -0,0 +1,182 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package http
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/go-akka/configuration"
+	mqttserver "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"github.com/rdkcentral/webconfig/common"
+	"github.com/rdkcentral/webconfig/util"
+	"gotest.tools/assert"
+)
+
+func startTestMqttBroker(t *testing.T) string {
+	broker := mqttserver.New(&mqttserver.Options{
+		InlineClient: true,
+		Logger:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	err := broker.AddHook(new(auth.AllowHook), nil)
+	assert.NilError(t, err)
+	tcp := listeners.NewTCP(listeners.Config{ID: "t1", Address: "127.0.0.1:0"})
+	err = broker.AddListener(tcp)
+	assert.NilError(t, err)
+	go func() {
+		_ = broker.Serve()
+	}()
+	t.Cleanup(func() {
+		_ = broker.Close()
+	})
+	return "tcp://" + tcp.Address()
+}
+
+func newTestMqttNativeConfig(brokerUrl string, protocolVersion int, sharedGroup string) *configuration.Config {
+	hocon := fmt.Sprintf(`webconfig.mqtt.native {
+	enabled = true
+	broker_url = "%v"
+	protocol_version = %v
+	shared_group = "%v"
+	connect_timeout_in_secs = 5
+}`, brokerUrl, protocolVersion, sharedGroup)
+	return configuration.ParseString(hocon)
+}
+
+func newTestMqttDevice(t *testing.T, brokerUrl string) paho.Client {
+	opts := paho.NewClientOptions()
+	opts.AddBroker(brokerUrl)
+	opts.SetClientID("device-" + util.GenerateRandomCpeMac())
+	device := paho.NewClient(opts)
+	token := device.Connect()
+	assert.Assert(t, token.WaitTimeout(5*time.Second))
+	assert.NilError(t, token.Error())
+	t.Cleanup(func() {
+		device.Disconnect(100)
+	})
+	return device
+}
+
+func TestMqttNativeClientTopics(t *testing.T) {
+	conf := newTestMqttNativeConfig("tcp://localhost:1883", 5, "webconfig")
+	c, err := NewMqttNativeClient(conf, "webconfig")
+	assert.NilError(t, err)
+	assert.Equal(t, c.ProtocolVersion(), 5)
+	assert.Equal(t, c.SubscriptionTopic("x/fr/webconfig/get/+"), "$share/webconfig/x/fr/webconfig/get/+")
+	assert.Equal(t, c.PublishTopic("044E5A22C9BF"), "x/to/044e5a22c9bf/webconfig")
+
+	conf = newTestMqttNativeConfig("tcp://localhost:1883", 4, "")
+	c, err = NewMqttNativeClient(conf, "webconfig")
+	assert.NilError(t, err)
+	assert.Equal(t, c.SubscriptionTopic("x/fr/webconfig/get/+"), "x/fr/webconfig/get/+")
+
+	// shared subscriptions are mqtt 5 only
+	conf = newTestMqttNativeConfig("tcp://localhost:1883", 4, "webconfig")
+	_, err = NewMqttNativeClient(conf, "webconfig")
+	assert.Assert(t, err != nil)
+
+	conf = configuration.ParseString(`webconfig.mqtt.native.protocol_version = 6`)
+	_, err = NewMqttNativeClient(conf, "webconfig")
+	assert.Assert(t, err != nil)
+}
+
+func TestMqttNativeGet(t *testing.T) {
+	brokerUrl := startTestMqttBroker(t)
+	server := NewWebconfigServer(sc, true)
+	router := server.GetRouter(true)
+	cpeMac := util.GenerateRandomCpeMac()
+
+	// ==== setup the documents ====
+	server.SetRootDocument(cpeMac, common.NewRootDocument(0, "fw1", "model1", "comcast", "", "", "", "", ""))
+	subdocId := "lan"
+	lanBytes := common.RandomBytes(50, 100)
+	url := fmt.Sprintf("/api/v1/device/%v/document/%v", cpeMac, subdocId)
+	req, err := http.NewRequest("POST", url, bytes.NewReader(lanBytes))
+	assert.NilError(t, err)
+	req.Header.Set(common.HeaderContentType, common.HeaderApplicationMsgpack)
+	res := ExecuteRequest(req, router).Result()
+	_, err = io.ReadAll(res.Body)
+	assert.NilError(t, err)
+	res.Body.Close()
+	assert.Equal(t, res.StatusCode, http.StatusOK)
+
+	// ==== start 2 replicas in the same shared group ====
+	conf := newTestMqttNativeConfig(brokerUrl, 5, "webconfig")
+	for i := 0; i < 2; i++ {
+		c, err := NewMqttNativeClient(conf, "webconfig")
+		assert.NilError(t, err)
+		err = c.Start(server.mqttGetMessageHandler, server.mqttStateMessageHandler)
+		assert.NilError(t, err)
+		defer c.Close()
+		if i == 0 {
+			server.SetMqttNativeClient(c)
+		}
+	}
+
+	// ==== the device subscribes to its own topic and sends a GET ====
+	device := newTestMqttDevice(t, brokerUrl)
+	responses := make(chan []byte, 4)
+	token := device.Subscribe(fmt.Sprintf("x/to/%v/webconfig", strings.ToLower(cpeMac)), 1, func(client paho.Client, msg paho.Message) {
+		responses <- msg.Payload()
+	})
+	assert.Assert(t, token.WaitTimeout(5*time.Second))
+	assert.NilError(t, token.Error())
+
+	kHeader := make(http.Header)
+	kHeader.Set(common.HeaderDocName, "root,lan")
+	kHeader.Set(common.HeaderDeviceId, cpeMac)
+	kHeader.Set("Transaction-ID", "abcd1234")
+	token = device.Publish(fmt.Sprintf("x/fr/webconfig/get/%v", cpeMac), 1, false, util.BuildHttp(kHeader, nil))
+	assert.Assert(t, token.WaitTimeout(5*time.Second))
+	assert.NilError(t, token.Error())
+
+	var rbytes []byte
+	select {
+	case rbytes = <-responses:
+	case <-time.After(10 * time.Second):
+		t.Fatal("no mqtt response received")
+	}
+	assert.Assert(t, bytes.HasPrefix(rbytes, []byte("HTTP/1.1 200")))
+	// the multipart body itself contains blank lines, split at the first one only
+	index := bytes.Index(rbytes, common.CRLFCRLF)
+	assert.Assert(t, index > 0)
+	respHeader, _ := util.ParseHttp(rbytes[:index])
+	respBytes := rbytes[index+len(common.CRLFCRLF):]
+	assert.Equal(t, respHeader.Get("Transaction-ID"), "abcd1234")
+	mparts, err := util.ParseMultipart(respHeader, respBytes)
+	assert.NilError(t, err)
+	mpart, ok := mparts["lan"]
+	assert.Assert(t, ok)
+	assert.DeepEqual(t, mpart.Bytes, lanBytes)
+
+	// the shared group delivers the GET to only one replica
+	select {
+	case <-responses:
+		t.Fatal("duplicate mqtt response received")
+	case <-time.After(500 * time.Millisecond):
+	}
+}
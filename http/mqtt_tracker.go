@@ -0,0 +1,304 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package http
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-akka/configuration"
+	"github.com/rdkcentral/webconfig/common"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultMqttTrackerTimeoutInSecs       = 300
+	defaultMqttTrackerSweepIntervalInSecs = 30
+
+	MqttOutcomeState   = "state"
+	MqttOutcomeReget   = "reget"
+	MqttOutcomeTimeout = "timeout"
+)
+
+type mqttTransaction struct {
+	transactionId string
+	cpeMac        string
+	sentAt        time.Time
+	subdocIds     map[string]struct{}
+}
+
+// MqttRoundTrip is one subdoc of a tracked mqtt response that has completed,
+// either by a state report, a new GET from the same device, or a timeout
+type MqttRoundTrip struct {
+	TransactionId string
+	CpeMac        string
+	SubdocId      string
+	Outcome       string
+	Duration      time.Duration
+}
+
+// MqttTracker correlates the responses sent on the mqtt route with the
+// subsequent state reports. Transactions are keyed by the Transaction-ID of
+// the GET, with a secondary index by cpe mac since devices do not always echo
+// the transaction id in their reports.
+//
+// The tracker lives in the memory of each replica, so the state report must be
+// read by the replica that sent the response. This holds for the kafka relay,
+// which keys the GETs and the reports by device, and for the native client
+// without a shared_group. The server refuses to start the tracker with shared
+// mqtt subscriptions, where the broker spreads the reports across replicas and
+// every response would end as a false timeout.
+type MqttTracker struct {
+	sync.Mutex
+	timeout       time.Duration
+	sweepInterval time.Duration
+	transactions  map[string]*mqttTransaction
+	macIndex      map[string]string
+}
+
+func NewMqttTracker(conf *configuration.Config) *MqttTracker {
+	timeoutInSecs := conf.GetInt32("webconfig.mqtt.tracker.timeout_in_secs", defaultMqttTrackerTimeoutInSecs)
+	sweepIntervalInSecs := conf.GetInt32("webconfig.mqtt.tracker.sweep_interval_in_secs", defaultMqttTrackerSweepIntervalInSecs)
+	return &MqttTracker{
+		timeout:       time.Duration(timeoutInSecs) * time.Second,
+		sweepInterval: time.Duration(sweepIntervalInSecs) * time.Second,
+		transactions:  make(map[string]*mqttTransaction),
+		macIndex:      make(map[string]string),
+	}
+}
+
+func (t *MqttTracker) Timeout() time.Duration {
+	return t.timeout
+}
+
+func (t *MqttTracker) SetTimeout(x time.Duration) {
+	t.timeout = x
+}
+
+func (t *MqttTracker) Len() int {
+	t.Lock()
+	defer t.Unlock()
+	return len(t.transactions)
+}
+
+// Track records a response carrying subdocIds sent to the device. A previous
+// transaction still open for the same device is closed as a re-request.
+func (t *MqttTracker) Track(transactionId, cpeMac string, subdocIds []string, sentAt time.Time) []MqttRoundTrip {
+	if len(transactionId) == 0 {
+		transactionId = cpeMac
+	}
+	t.Lock()
+	defer t.Unlock()
+
+	trips := t.closeLocked(cpeMac, MqttOutcomeReget, sentAt)
+	if len(subdocIds) == 0 {
+		return trips
+	}
+	tx := &mqttTransaction{
+		transactionId: transactionId,
+		cpeMac:        cpeMac,
+		sentAt:        sentAt,
+		subdocIds:     make(map[string]struct{}),
+	}
+	for _, subdocId := range subdocIds {
+		tx.subdocIds[subdocId] = struct{}{}
+	}
+	t.transactions[transactionId] = tx
+	t.macIndex[cpeMac] = transactionId
+	return trips
+}
+
+// Reget closes the open transaction of the device, if any, because the
+// device has sent a new GET
+func (t *MqttTracker) Reget(cpeMac string, now time.Time) []MqttRoundTrip {
+	t.Lock()
+	defer t.Unlock()
+	return t.closeLocked(cpeMac, MqttOutcomeReget, now)
+}
+
+// Complete matches a state report of a subdoc. It returns nil if there is no
+// open transaction waiting for this subdoc.
+func (t *MqttTracker) Complete(transactionId, cpeMac, subdocId string, now time.Time) *MqttRoundTrip {
+	t.Lock()
+	defer t.Unlock()
+
+	tx, ok := t.transactions[transactionId]
+	if !ok || tx.cpeMac != cpeMac {
+		tx, ok = t.transactions[t.macIndex[cpeMac]]
+		if !ok {
+			return nil
+		}
+	}
+	if _, ok := tx.subdocIds[subdocId]; !ok {
+		return nil
+	}
+	delete(tx.subdocIds, subdocId)
+	if len(tx.subdocIds) == 0 {
+		t.deleteLocked(tx)
+	}
+	return &MqttRoundTrip{
+		TransactionId: tx.transactionId,
+		CpeMac:        cpeMac,
+		SubdocId:      subdocId,
+		Outcome:       MqttOutcomeState,
+		Duration:      now.Sub(tx.sentAt),
+	}
+}
+
+// Expire removes and returns the subdocs of all transactions older than the timeout
+func (t *MqttTracker) Expire(now time.Time) []MqttRoundTrip {
+	t.Lock()
+	defer t.Unlock()
+
+	trips := []MqttRoundTrip{}
+	for _, tx := range t.transactions {
+		if now.Sub(tx.sentAt) < t.timeout {
+			continue
+		}
+		trips = append(trips, t.tripsLocked(tx, MqttOutcomeTimeout, now)...)
+		t.deleteLocked(tx)
+	}
+	return trips
+}
+
+func (t *MqttTracker) closeLocked(cpeMac, outcome string, now time.Time) []MqttRoundTrip {
+	tx, ok := t.transactions[t.macIndex[cpeMac]]
+	if !ok {
+		return nil
+	}
+	trips := t.tripsLocked(tx, outcome, now)
+	t.deleteLocked(tx)
+	return trips
+}
+
+func (t *MqttTracker) tripsLocked(tx *mqttTransaction, outcome string, now time.Time) []MqttRoundTrip {
+	trips := []MqttRoundTrip{}
+	for subdocId := range tx.subdocIds {
+		trips = append(trips, MqttRoundTrip{
+			TransactionId: tx.transactionId,
+			CpeMac:        tx.cpeMac,
+			SubdocId:      subdocId,
+			Outcome:       outcome,
+			Duration:      now.Sub(tx.sentAt),
+		})
+	}
+	return trips
+}
+
+func (t *MqttTracker) deleteLocked(tx *mqttTransaction) {
+	delete(t.transactions, tx.transactionId)
+	if t.macIndex[tx.cpeMac] == tx.transactionId {
+		delete(t.macIndex, tx.cpeMac)
+	}
+}
+
+func (s *WebconfigServer) MqttTracker() *MqttTracker {
+	return s.mqttTracker
+}
+
+func (s *WebconfigServer) SetMqttTracker(x *MqttTracker) {
+	s.mqttTracker = x
+}
+
+func (s *WebconfigServer) observeMqttRoundTrips(trips []MqttRoundTrip, fields log.Fields) {
+	metrics := s.Metrics()
+	for _, trip := range trips {
+		if metrics != nil {
+			if trip.Outcome == MqttOutcomeTimeout {
+				metrics.CountMqttTimeout(trip.SubdocId)
+			} else {
+				metrics.ObserveMqttRoundTrip(trip.SubdocId, trip.Outcome, trip.Duration.Seconds())
+			}
+		}
+		tfields := common.FilterLogFields(fields)
+		tfields["logger"] = "mqtt"
+		tfields["cpe_mac"] = trip.CpeMac
+		tfields["subdoc_id"] = trip.SubdocId
+		tfields["mqtt_transaction_id"] = trip.TransactionId
+		tfields["mqtt_outcome"] = trip.Outcome
+		tfields["mqtt_round_trip"] = int(trip.Duration.Milliseconds())
+		log.WithFields(tfields).Debug("mqtt round trip")
+	}
+}
+
+// flagMqttTimeout marks a subdoc still in deployment as failed, so that the
+// unacknowledged response shows in the device state
+func (s *WebconfigServer) flagMqttTimeout(trip MqttRoundTrip, fields log.Fields) error {
+	subdoc, err := s.GetSubDocument(trip.CpeMac, trip.SubdocId)
+	if err != nil {
+		if s.IsDbNotFound(err) {
+			return nil
+		}
+		return common.NewError(err)
+	}
+	if subdoc.State() == nil || *subdoc.State() != common.InDeployment {
+		return nil
+	}
+	labels, err := s.GetRootDocumentLabels(trip.CpeMac)
+	if err != nil {
+		return common.NewError(err)
+	}
+	labels["client"] = "default"
+
+	newState := common.Failure
+	updatedTime := int(time.Now().UnixMilli())
+	errorCode := common.MqttResponseTimeoutErrorCode
+	errorDetails := common.MqttResponseTimeout
+	newSubdoc := common.NewSubDocument(nil, nil, &newState, &updatedTime, &errorCode, &errorDetails)
+	if err := s.SetSubDocument(trip.CpeMac, trip.SubdocId, newSubdoc, common.InDeployment, labels, fields); err != nil {
+		return common.NewError(err)
+	}
+	return nil
+}
+
+// SweepMqttTransactions expires the tracked transactions until ctx is done
+func (s *WebconfigServer) SweepMqttTransactions(ctx context.Context) {
+	t := s.MqttTracker()
+	if t == nil {
+		return
+	}
+	ticker := time.NewTicker(t.sweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.expireMqttTransactions(now)
+		}
+	}
+}
+
+func (s *WebconfigServer) expireMqttTransactions(now time.Time) {
+	fields := log.Fields{
+		"logger":   "mqtt",
+		"app_name": s.AppName(),
+	}
+	trips := s.MqttTracker().Expire(now)
+	s.observeMqttRoundTrips(trips, fields)
+	for _, trip := range trips {
+		if err := s.flagMqttTimeout(trip, fields); err != nil {
+			tfields := common.FilterLogFields(fields)
+			tfields["cpe_mac"] = trip.CpeMac
+			tfields["subdoc_id"] = trip.SubdocId
+			tfields["error"] = err.Error()
+			log.WithFields(tfields).Error("failed to flag mqtt timeout")
+		}
+	}
+}
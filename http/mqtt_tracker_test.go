@@ -0,0 +1,166 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-akka/configuration"
+	"github.com/rdkcentral/webconfig/common"
+	"github.com/rdkcentral/webconfig/util"
+	log "github.com/sirupsen/logrus"
+	"gotest.tools/assert"
+)
+
+func TestMqttTracker(t *testing.T) {
+	conf := configuration.ParseString(`webconfig.mqtt.tracker.timeout_in_secs = 60`)
+	tracker := NewMqttTracker(conf)
+	assert.Equal(t, tracker.Timeout(), 60*time.Second)
+	cpeMac := util.GenerateRandomCpeMac()
+	start := time.Now()
+
+	// ==== state reports match by transaction id ====
+	trips := tracker.Track("tx1", cpeMac, []string{"lan", "wan"}, start)
+	assert.Equal(t, len(trips), 0)
+	assert.Equal(t, tracker.Len(), 1)
+
+	trip := tracker.Complete("tx1", cpeMac, "lan", start.Add(2*time.Second))
+	assert.Assert(t, trip != nil)
+	assert.Equal(t, trip.Outcome, MqttOutcomeState)
+	assert.Equal(t, trip.Duration, 2*time.Second)
+
+	// a subdoc not in the response is ignored
+	trip = tracker.Complete("tx1", cpeMac, "privatessid", start)
+	assert.Assert(t, trip == nil)
+
+	// ==== fall back to the mac when the report carries another id ====
+	trip = tracker.Complete("poke-tx", cpeMac, "wan", start.Add(3*time.Second))
+	assert.Assert(t, trip != nil)
+	assert.Equal(t, trip.TransactionId, "tx1")
+	assert.Equal(t, tracker.Len(), 0)
+
+	// ==== a new GET closes the open transaction ====
+	tracker.Track("tx2", cpeMac, []string{"lan"}, start)
+	trips = tracker.Reget(cpeMac, start.Add(5*time.Second))
+	assert.Equal(t, len(trips), 1)
+	assert.Equal(t, trips[0].Outcome, MqttOutcomeReget)
+	assert.Equal(t, trips[0].SubdocId, "lan")
+	assert.Equal(t, tracker.Len(), 0)
+
+	tracker.Track("tx3", cpeMac, []string{"lan"}, start)
+	trips = tracker.Track("tx4", cpeMac, []string{"wan"}, start.Add(time.Second))
+	assert.Equal(t, len(trips), 1)
+	assert.Equal(t, trips[0].TransactionId, "tx3")
+	assert.Equal(t, tracker.Len(), 1)
+
+	// ==== expire ====
+	trips = tracker.Expire(start.Add(30 * time.Second))
+	assert.Equal(t, len(trips), 0)
+	trips = tracker.Expire(start.Add(2 * time.Minute))
+	assert.Equal(t, len(trips), 1)
+	assert.Equal(t, trips[0].Outcome, MqttOutcomeTimeout)
+	assert.Equal(t, trips[0].SubdocId, "wan")
+	assert.Equal(t, tracker.Len(), 0)
+}
+
+func TestMqttTrackerRoundTrip(t *testing.T) {
+	server := NewWebconfigServer(sc, true)
+	router := server.GetRouter(true)
+	tracker := NewMqttTracker(server.Config)
+	server.SetMqttTracker(tracker)
+	cpeMac := util.GenerateRandomCpeMac()
+
+	mqttMockServer := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+	defer mqttMockServer.Close()
+	server.SetMqttHost(mqttMockServer.URL)
+
+	// ==== setup the documents ====
+	server.SetRootDocument(cpeMac, common.NewRootDocument(0, "fw1", "model1", "comcast", "", "", "", "", ""))
+	subdocId := "lan"
+	url := fmt.Sprintf("/api/v1/device/%v/document/%v", cpeMac, subdocId)
+	req, err := http.NewRequest("POST", url, bytes.NewReader(common.RandomBytes(50, 100)))
+	assert.NilError(t, err)
+	req.Header.Set(common.HeaderContentType, common.HeaderApplicationMsgpack)
+	res := ExecuteRequest(req, router).Result()
+	_, err = io.ReadAll(res.Body)
+	assert.NilError(t, err)
+	res.Body.Close()
+	assert.Equal(t, res.StatusCode, http.StatusOK)
+
+	getRequest := func(transactionId string) []byte {
+		kHeader := make(http.Header)
+		kHeader.Set(common.HeaderDocName, "root,lan")
+		kHeader.Set(common.HeaderDeviceId, cpeMac)
+		kHeader.Set("Transaction-ID", transactionId)
+		return util.BuildHttp(kHeader, nil)
+	}
+
+	// ==== GET then the state report ====
+	_, err = server.HandleMqttGet(getRequest("tx1"), log.Fields{})
+	assert.NilError(t, err)
+	assert.Equal(t, tracker.Len(), 1)
+
+	applicationStatus := "success"
+	transactionId := "tx1"
+	m := common.EventMessage{
+		DeviceId:          "mac:" + cpeMac,
+		Namespace:         &subdocId,
+		ApplicationStatus: &applicationStatus,
+		TransactionUuid:   &transactionId,
+	}
+	bbytes, err := json.Marshal(m)
+	assert.NilError(t, err)
+	_, _, err = server.HandleStateNotification(bbytes, log.Fields{})
+	assert.NilError(t, err)
+	assert.Equal(t, tracker.Len(), 0)
+
+	// ==== a new version never acknowledged is flagged in the device state ====
+	req, err = http.NewRequest("POST", url, bytes.NewReader(common.RandomBytes(50, 100)))
+	assert.NilError(t, err)
+	req.Header.Set(common.HeaderContentType, common.HeaderApplicationMsgpack)
+	res = ExecuteRequest(req, router).Result()
+	_, err = io.ReadAll(res.Body)
+	assert.NilError(t, err)
+	res.Body.Close()
+	assert.Equal(t, res.StatusCode, http.StatusOK)
+
+	_, err = server.HandleMqttGet(getRequest("tx2"), log.Fields{})
+	assert.NilError(t, err)
+	assert.Equal(t, tracker.Len(), 1)
+	subdoc, err := server.GetSubDocument(cpeMac, subdocId)
+	assert.NilError(t, err)
+	assert.Equal(t, *subdoc.State(), common.InDeployment)
+
+	server.expireMqttTransactions(time.Now().Add(tracker.Timeout() + time.Second))
+	assert.Equal(t, tracker.Len(), 0)
+	subdoc, err = server.GetSubDocument(cpeMac, subdocId)
+	assert.NilError(t, err)
+	assert.Equal(t, *subdoc.State(), common.Failure)
+	assert.Equal(t, *subdoc.ErrorDetails(), common.MqttResponseTimeout)
+	assert.Equal(t, *subdoc.ErrorCode(), common.MqttResponseTimeoutErrorCode)
+}
@@ -175,7 +175,7 @@ func BuildWebconfigResponse(s *WebconfigServer, rHeader http.Header, route strin
 			return http.StatusNotFound, respHeader, nil, nil
 		}
 
-		respBytes, err := document.Bytes()
+		respBytes, err := document.Bytes(s.PartSigner())
 		if err != nil {
 			return http.StatusInternalServerError, respHeader, nil, common.NewError(err)
 		}
@@ -224,7 +224,7 @@ func BuildWebconfigResponse(s *WebconfigServer, rHeader http.Header, route strin
 			document = document.FilterByBitmap(s.BitmapFilterExemptSubdocIds()...)
 		}
 
-		respBytes, err = document.Bytes()
+		respBytes, err = document.Bytes(s.PartSigner())
 		if err != nil {
 			return http.StatusInternalServerError, respHeader, nil, common.NewError(err)
 		}
@@ -325,6 +325,7 @@ func BuildWebconfigResponse(s *WebconfigServer, rHeader http.Header, route strin
 	finalRootDocument := common.NewRootDocument(bitmap, "", "", "", "", upstreamRespEtag, "", "", "")
 	finalDocument := common.NewDocument(finalRootDocument)
 	finalDocument.SetSubDocuments(finalMparts)
+	finalDocument.SetOrder(document.Order())
 
 	// there are special use cases when we do not want to update subdocuments
 	if upstreamRespHeader.Get(common.HeaderUpstreamResponse) != common.SkipDbUpdate {
@@ -353,7 +354,7 @@ func BuildWebconfigResponse(s *WebconfigServer, rHeader http.Header, route strin
 	if err != nil {
 		return http.StatusInternalServerError, upstreamRespHeader, nil, common.NewError(err)
 	}
-	finalFilteredBytes, err := finalFilteredDocument.Bytes()
+	finalFilteredBytes, err := finalFilteredDocument.Bytes(s.PartSigner())
 	if err != nil {
 		return http.StatusInternalServerError, upstreamRespHeader, finalFilteredBytes, common.NewError(err)
 	}
@@ -478,7 +479,7 @@ func BuildFactoryResetResponse(s *WebconfigServer, rHeader http.Header, fields l
 		finalDocument = finalDocument.FilterByBitmap(s.BitmapFilterExemptSubdocIds()...)
 	}
 
-	finalBytes, err := finalDocument.Bytes()
+	finalBytes, err := finalDocument.Bytes(s.PartSigner())
 	if err != nil {
 		return http.StatusInternalServerError, upstreamRespHeader, finalBytes, common.NewError(err)
 	}
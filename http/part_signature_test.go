@@ -0,0 +1,89 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package http
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/rdkcentral/webconfig/common"
+	"github.com/rdkcentral/webconfig/security"
+	"github.com/rdkcentral/webconfig/util"
+	"gotest.tools/assert"
+)
+
+func TestSignedMultipartConfig(t *testing.T) {
+	server := NewWebconfigServer(sc, true)
+	router := server.GetRouter(true)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NilError(t, err)
+	signingKey, err := security.NewSigningKey(key, "")
+	assert.NilError(t, err)
+	verificationKey, err := security.NewVerificationKey(&key.PublicKey, "")
+	assert.NilError(t, err)
+	server.SetPartSigner(security.NewPartSigner("payload-es256", signingKey))
+	keys := map[string]*security.VerificationKey{
+		"payload-es256": verificationKey,
+	}
+
+	cpeMac := util.GenerateRandomCpeMac()
+	server.SetRootDocument(cpeMac, common.NewRootDocument(0, "fw1", "model1", "comcast", "", "", "", "", ""))
+	for _, subdocId := range []string{"lan", "wan"} {
+		url := fmt.Sprintf("/api/v1/device/%v/document/%v", cpeMac, subdocId)
+		req, err := http.NewRequest("POST", url, bytes.NewReader(common.RandomBytes(100, 150)))
+		assert.NilError(t, err)
+		req.Header.Set(common.HeaderContentType, common.HeaderApplicationMsgpack)
+		res := ExecuteRequest(req, router).Result()
+		_, err = io.ReadAll(res.Body)
+		assert.NilError(t, err)
+		res.Body.Close()
+		assert.Equal(t, res.StatusCode, http.StatusOK)
+	}
+
+	configUrl := fmt.Sprintf("/api/v1/device/%v/config", cpeMac)
+	req, err := http.NewRequest("GET", configUrl, nil)
+	assert.NilError(t, err)
+	res := ExecuteRequest(req, router).Result()
+	rbytes, err := io.ReadAll(res.Body)
+	assert.NilError(t, err)
+	res.Body.Close()
+	assert.Equal(t, res.StatusCode, http.StatusOK)
+
+	names, err := security.VerifyMultipartSignatures(res.Header, rbytes, keys)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, names, []string{"lan", "wan"})
+
+	// ==== without a signer the parts are not signed ====
+	server.SetPartSigner(nil)
+	req, err = http.NewRequest("GET", configUrl, nil)
+	assert.NilError(t, err)
+	res = ExecuteRequest(req, router).Result()
+	rbytes, err = io.ReadAll(res.Body)
+	assert.NilError(t, err)
+	res.Body.Close()
+	assert.Equal(t, res.StatusCode, http.StatusOK)
+	_, err = security.VerifyMultipartSignatures(res.Header, rbytes, keys)
+	assert.Assert(t, err != nil)
+}
@@ -0,0 +1,111 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/rdkcentral/webconfig/common"
+	"github.com/rdkcentral/webconfig/security"
+)
+
+// an api token with this partner-id keeps the access to all partners
+const allPartnersId = "*"
+
+const rootDocumentPathTemplate = "/api/v1/device/{mac}/rootdocument"
+
+// authorizePartnerScope checks the devices of a request against the partner-id claim of an api
+// token. It returns 0 if the request is allowed, otherwise the http status to reject it. Tokens
+// without the claim are not scoped. A scoped token can only call the routes of a device, and a
+// device of another partner is reported as 404 so that its existence is not leaked. A root
+// document can be posted only with a partner_id in scope, which onboards a new device.
+func (s *WebconfigServer) authorizePartnerScope(xw *XResponseWriter, r *http.Request, token string) (int, error) {
+	partnerIds, err := security.ParseApiTokenPartnerIds(token)
+	if err != nil {
+		return http.StatusForbidden, common.NewError(err)
+	}
+	if len(partnerIds) == 0 {
+		return 0, nil
+	}
+	for _, partnerId := range partnerIds {
+		if partnerId == allPartnersId {
+			return 0, nil
+		}
+	}
+
+	mac := mux.Vars(r)["mac"]
+	if len(mac) == 0 {
+		return http.StatusForbidden, fmt.Errorf("route not scoped to a device")
+	}
+	var isRootDocumentPost bool
+	if route := mux.CurrentRoute(r); route != nil && r.Method == http.MethodPost {
+		if pathTemplate, err := route.GetPathTemplate(); err == nil {
+			isRootDocumentPost = pathTemplate == rootDocumentPathTemplate
+		}
+	}
+	if isRootDocumentPost {
+		var rootdoc common.RootDocument
+		if err := json.Unmarshal(xw.BodyBytes(), &rootdoc); err != nil {
+			return http.StatusBadRequest, common.NewError(err)
+		}
+		if !containsPartnerId(partnerIds, rootdoc.PartnerId) {
+			return http.StatusForbidden, fmt.Errorf("partner_id %q not of partners %v", rootdoc.PartnerId, partnerIds)
+		}
+	}
+
+	macs := []string{mac}
+	// a subdoc can be written to more devices by ?device_id=
+	if x := r.URL.Query().Get("device_id"); len(x) > 0 {
+		macs = append(macs, strings.Split(x, ",")...)
+	}
+
+	for _, mac := range macs {
+		mac = strings.ToUpper(mac)
+		rdoc, err := s.GetRootDocument(mac)
+		if err != nil {
+			if s.IsDbNotFound(err) {
+				// the partner of the new device was checked in the body
+				if isRootDocumentPost {
+					continue
+				}
+				return http.StatusNotFound, fmt.Errorf("no root document of %v", mac)
+			}
+			return http.StatusInternalServerError, common.NewError(err)
+		}
+		if !containsPartnerId(partnerIds, rdoc.PartnerId) {
+			return http.StatusNotFound, fmt.Errorf("%v not of partners %v", mac, partnerIds)
+		}
+	}
+	return 0, nil
+}
+
+func containsPartnerId(partnerIds []string, partnerId string) bool {
+	if len(partnerId) == 0 {
+		return false
+	}
+	for _, x := range partnerIds {
+		if strings.EqualFold(x, partnerId) {
+			return true
+		}
+	}
+	return false
+}
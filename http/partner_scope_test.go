@@ -0,0 +1,116 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/rdkcentral/webconfig/common"
+	"github.com/rdkcentral/webconfig/security"
+	"github.com/rdkcentral/webconfig/util"
+	"gotest.tools/assert"
+)
+
+func TestPartnerScopedApiToken(t *testing.T) {
+	server := NewWebconfigServer(sc, true)
+	signToken := setupApiTokenAuth(t, server)
+	router := server.GetRouter(false)
+	call := func(method, url string, body []byte, token string) int {
+		return callWithApiToken(t, router, method, url, body, token)
+	}
+
+	comcastMac := util.GenerateRandomCpeMac()
+	server.SetRootDocument(comcastMac, common.NewRootDocument(0, "fw1", "model1", "comcast", "", "", "", "", ""))
+	coxMac := util.GenerateRandomCpeMac()
+	server.SetRootDocument(coxMac, common.NewRootDocument(0, "fw1", "model1", "cox", "", "", "", "", ""))
+	unknownMac := util.GenerateRandomCpeMac()
+
+	capabilities := []string{"webconfig:all"}
+	comcastToken := signToken(jwt.MapClaims{"capabilities": capabilities, "partner-id": "comcast"})
+	multiToken := signToken(jwt.MapClaims{"capabilities": capabilities, "partner-id": []string{"Comcast", "cox"}})
+	adminToken := signToken(jwt.MapClaims{"capabilities": capabilities})
+	wildcardToken := signToken(jwt.MapClaims{"capabilities": capabilities, "partner-id": "*"})
+
+	comcastUrl := fmt.Sprintf("/api/v1/device/%v/document/lan", comcastMac)
+	coxUrl := fmt.Sprintf("/api/v1/device/%v/document/lan", coxMac)
+	unknownUrl := fmt.Sprintf("/api/v1/device/%v/document/lan", unknownMac)
+	bbytes := common.RandomBytes(50, 100)
+
+	// ==== a partner token reaches its own devices only ====
+	assert.Equal(t, call("POST", comcastUrl, bbytes, comcastToken), http.StatusOK)
+	assert.Equal(t, call("GET", comcastUrl, nil, comcastToken), http.StatusOK)
+	assert.Equal(t, call("POST", coxUrl, bbytes, comcastToken), http.StatusNotFound)
+	assert.Equal(t, call("GET", coxUrl, nil, comcastToken), http.StatusNotFound)
+	assert.Equal(t, call("GET", unknownUrl, nil, comcastToken), http.StatusNotFound)
+	assert.Equal(t, call("GET", fmt.Sprintf("/api/v1/device/%v/rootdocument", coxMac), nil, comcastToken), http.StatusNotFound)
+
+	// the devices by ?device_id= are checked too
+	assert.Equal(t, call("POST", comcastUrl+"?device_id="+coxMac, bbytes, comcastToken), http.StatusNotFound)
+
+	// ==== a partner token onboards a device of its partner only ====
+	rootdocUrl := func(mac string) string {
+		return fmt.Sprintf("/api/v1/device/%v/rootdocument", mac)
+	}
+	rootdocBytes := func(partnerId string) []byte {
+		return []byte(fmt.Sprintf(`{"firmware_version": "fw1", "model_name": "model1", "partner_id": "%v"}`, partnerId))
+	}
+	newMac := util.GenerateRandomCpeMac()
+	assert.Equal(t, call("POST", rootdocUrl(newMac), rootdocBytes("cox"), comcastToken), http.StatusForbidden)
+	assert.Equal(t, call("POST", rootdocUrl(newMac), rootdocBytes(""), comcastToken), http.StatusForbidden)
+	assert.Equal(t, call("POST", rootdocUrl(newMac), rootdocBytes("comcast"), comcastToken), http.StatusOK)
+	assert.Equal(t, call("POST", fmt.Sprintf("/api/v1/device/%v/document/lan", newMac), bbytes, comcastToken), http.StatusOK)
+
+	// a device cannot be moved to another partner, nor taken from one
+	assert.Equal(t, call("POST", rootdocUrl(comcastMac), rootdocBytes("cox"), comcastToken), http.StatusForbidden)
+	assert.Equal(t, call("POST", rootdocUrl(coxMac), rootdocBytes("comcast"), comcastToken), http.StatusNotFound)
+	rdoc, err := server.GetRootDocument(coxMac)
+	assert.NilError(t, err)
+	assert.Equal(t, rdoc.PartnerId, "cox")
+
+	// the routes not of a device are not for partner tokens
+	assert.Equal(t, call("GET", "/api/v1/pokes", nil, comcastToken), http.StatusForbidden)
+
+	// ==== a token of more partners ====
+	assert.Equal(t, call("POST", coxUrl, bbytes, multiToken), http.StatusOK)
+	assert.Equal(t, call("GET", comcastUrl, nil, multiToken), http.StatusOK)
+
+	// ==== admin tokens keep the cross partner access ====
+	assert.Equal(t, call("GET", coxUrl, nil, adminToken), http.StatusOK)
+	assert.Equal(t, call("GET", coxUrl, nil, wildcardToken), http.StatusOK)
+	assert.Equal(t, call("GET", "/api/v1/pokes", nil, adminToken), http.StatusOK)
+}
+
+func TestParseApiTokenPartnerIds(t *testing.T) {
+	server := NewWebconfigServer(sc, true)
+	signToken := setupApiTokenAuth(t, server)
+
+	partnerIds, err := security.ParseApiTokenPartnerIds(signToken(jwt.MapClaims{"partner-id": "comcast"}))
+	assert.NilError(t, err)
+	assert.DeepEqual(t, partnerIds, []string{"comcast"})
+
+	partnerIds, err = security.ParseApiTokenPartnerIds(signToken(jwt.MapClaims{"partner-id": []string{"comcast", "cox"}}))
+	assert.NilError(t, err)
+	assert.DeepEqual(t, partnerIds, []string{"comcast", "cox"})
+
+	partnerIds, err = security.ParseApiTokenPartnerIds(signToken(jwt.MapClaims{}))
+	assert.NilError(t, err)
+	assert.Equal(t, len(partnerIds), 0)
+}
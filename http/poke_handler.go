@@ -29,8 +29,17 @@ import (
 	"github.com/rdkcentral/webconfig/common"
 	"github.com/rdkcentral/webconfig/db"
 	"github.com/rdkcentral/webconfig/util"
+	log "github.com/sirupsen/logrus"
 )
 
+// PokeInProgressResponse is the 524 body of a poke that webpa could not deliver yet.
+// The transaction id tracks the poke until it is delivered by the retries.
+type PokeInProgressResponse struct {
+	Status        int    `json:"status"`
+	Errors        string `json:"errors,omitempty"`
+	TransactionId string `json:"transaction_id"`
+}
+
 func (s *WebconfigServer) PokeHandler(w http.ResponseWriter, r *http.Request) {
 	// handler
 	params := mux.Vars(r)
@@ -83,30 +92,12 @@ func (s *WebconfigServer) PokeHandler(w http.ResponseWriter, r *http.Request) {
 
 	if pokeStr == "mqtt" {
 		for _, deviceId := range deviceIds {
-			document, err := db.BuildMqttSendDocument(s.DatabaseClient, deviceId, fields)
+			sent, err := s.PokeMqtt(deviceId, metricsAgent, fields)
 			if err != nil {
 				if s.IsDbNotFound(err) {
 					Error(w, http.StatusNotFound, nil)
 					return
 				}
-				Error(w, http.StatusInternalServerError, common.NewError(err))
-				return
-			}
-			if document.Length() == 0 {
-				WriteResponseBytes(w, nil, http.StatusNoContent)
-				return
-			}
-
-			// TODO, we can build/filter it again for blocked subdocs if needed
-
-			mbytes, err := document.HttpBytes(fields)
-			if err != nil {
-				Error(w, http.StatusInternalServerError, common.NewError(err))
-				return
-			}
-
-			_, err = s.PostMqtt(deviceId, mbytes, fields)
-			if err != nil {
 				var rherr common.RemoteHttpError
 				if errors.As(err, &rherr) {
 					Error(w, rherr.StatusCode, common.NewError(err))
@@ -115,10 +106,8 @@ func (s *WebconfigServer) PokeHandler(w http.ResponseWriter, r *http.Request) {
 				Error(w, http.StatusInternalServerError, common.NewError(err))
 				return
 			}
-
-			err = db.UpdateStatesInBatch(s.DatabaseClient, deviceId, metricsAgent, fields, document.StateMap())
-			if err != nil {
-				Error(w, http.StatusInternalServerError, common.NewError(err))
+			if !sent {
+				WriteResponseBytes(w, nil, http.StatusNoContent)
 				return
 			}
 		}
@@ -175,7 +164,19 @@ func (s *WebconfigServer) PokeHandler(w http.ResponseWriter, r *http.Request) {
 					tr181Message = tr181Res.Parameters[0].Message
 				}
 			}
-			if len(tr181Message) > 0 {
+			if rherr.StatusCode == webpa520NewStatusCode && len(transactionId) > 0 {
+				// the poke is queued or retried, its status is at /api/v1/pokes/{transaction_id}
+				if len(tr181Message) == 0 {
+					tr181Message = rherr.Message
+				}
+				resp := PokeInProgressResponse{
+					Status:        rherr.StatusCode,
+					Errors:        tr181Message,
+					TransactionId: transactionId,
+				}
+				SetAuditValue(w, "response", resp)
+				WriteByMarshal(w, rherr.StatusCode, resp)
+			} else if len(tr181Message) > 0 {
 				resp := common.HttpErrorResponse{
 					Status: rherr.StatusCode,
 					Errors: tr181Message,
@@ -195,3 +196,32 @@ func (s *WebconfigServer) PokeHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	WriteOkResponse(w, data)
 }
+
+// PokeMqtt sends the pending subdocs of the device through mqtt and moves them to
+// in-deployment. It returns false if there is nothing to send.
+func (s *WebconfigServer) PokeMqtt(deviceId string, metricsAgent string, fields log.Fields) (bool, error) {
+	document, err := db.BuildMqttSendDocument(s.DatabaseClient, deviceId, fields)
+	if err != nil {
+		return false, common.NewError(err)
+	}
+	if document.Length() == 0 {
+		return false, nil
+	}
+
+	// TODO, we can build/filter it again for blocked subdocs if needed
+
+	mbytes, err := document.HttpBytes(fields, s.PartSigner())
+	if err != nil {
+		return false, common.NewError(err)
+	}
+
+	if _, err = s.PostMqtt(deviceId, mbytes, fields); err != nil {
+		return false, common.NewError(err)
+	}
+
+	err = db.UpdateStatesInBatch(s.DatabaseClient, deviceId, metricsAgent, fields, document.StateMap())
+	if err != nil {
+		return false, common.NewError(err)
+	}
+	return true, nil
+}
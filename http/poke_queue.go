@@ -0,0 +1,446 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-akka/configuration"
+	"github.com/google/uuid"
+	"github.com/rdkcentral/webconfig/common"
+	"github.com/rdkcentral/webconfig/db"
+	"github.com/rdkcentral/webconfig/security"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultPokeQueueWorkers        = 4
+	defaultPokeQueueMaxDepth       = 10000
+	defaultPokeQueuePollIntervalMs = 1000
+	defaultPokeQueueLeaseInSecs    = 60
+	defaultPokeQueueMaxAttempts    = 3
+
+	pokeQueueLeaseTemplate = "poke_queue_bucket_%v"
+
+	// the first byte of the stored header tells how the rest is encoded
+	pokeHeaderPlain     byte = 0
+	pokeHeaderEncrypted byte = 1
+)
+
+// PokeQueue persists the async webpa pokes in the database so that they survive
+// restarts and can be shared by all instances. Only the latest poke per cpe_mac
+// is kept, an older queued poke is marked "superseded" when a new one arrives.
+// The status of each poke is tracked by its transaction_id.
+//
+// The queue is partitioned into buckets by cpe_mac. A replica polls only the
+// buckets whose lease it holds, and the depth is the depth of those buckets.
+type PokeQueue struct {
+	dbclient     db.DatabaseClient
+	connector    *WebpaConnector
+	codec        *security.AesCodec
+	workers      int
+	maxDepth     int
+	maxAttempts  int
+	pollInterval time.Duration
+	lease        time.Duration
+	buckets      int
+	maxOwned     int
+	owner        string
+	owned        map[int]bool
+	renewedAt    time.Time
+	depth        atomic.Int64
+	metrics      *common.AppMetrics
+	nowFn        func() time.Time
+}
+
+func NewPokeQueue(conf *configuration.Config, dbclient db.DatabaseClient, connector *WebpaConnector) *PokeQueue {
+	workers := int(conf.GetInt32("webconfig.webpa.async_poke_concurrent_calls", defaultPokeQueueWorkers))
+	if workers <= 0 {
+		workers = defaultPokeQueueWorkers
+	}
+	maxDepth := int(conf.GetInt32("webconfig.webpa.async_poke_queue_max_depth", defaultPokeQueueMaxDepth))
+	maxAttempts := int(conf.GetInt32("webconfig.webpa.async_poke_max_attempts", defaultPokeQueueMaxAttempts))
+	pollIntervalMs := conf.GetInt32("webconfig.webpa.async_poke_poll_interval_in_msecs", defaultPokeQueuePollIntervalMs)
+	leaseInSecs := conf.GetInt32("webconfig.webpa.async_poke_lease_in_secs", defaultPokeQueueLeaseInSecs)
+	buckets := int(conf.GetInt32("webconfig.webpa.async_poke_queue_buckets", common.DefaultPokeQueueBuckets))
+	if buckets <= 0 {
+		buckets = common.DefaultPokeQueueBuckets
+	}
+	maxOwned := int(conf.GetInt32("webconfig.webpa.async_poke_queue_max_owned_buckets", 0))
+	if maxOwned <= 0 || maxOwned > buckets {
+		maxOwned = buckets
+	}
+
+	// the forwarded Authorization header is encrypted at rest when a key is available
+	codec, err := security.NewAesCodec(conf)
+	if err != nil {
+		codec = nil
+	}
+
+	return &PokeQueue{
+		dbclient:     dbclient,
+		connector:    connector,
+		codec:        codec,
+		workers:      workers,
+		maxDepth:     maxDepth,
+		maxAttempts:  maxAttempts,
+		pollInterval: time.Duration(pollIntervalMs) * time.Millisecond,
+		lease:        time.Duration(leaseInSecs) * time.Second,
+		buckets:      buckets,
+		maxOwned:     maxOwned,
+		owner:        uuid.New().String(),
+		owned:        map[int]bool{},
+		nowFn:        time.Now,
+	}
+}
+
+func (q *PokeQueue) Workers() int {
+	return q.workers
+}
+
+func (q *PokeQueue) MaxDepth() int {
+	return q.maxDepth
+}
+
+func (q *PokeQueue) SetMaxDepth(x int) {
+	q.maxDepth = x
+}
+
+func (q *PokeQueue) Buckets() int {
+	return q.buckets
+}
+
+func (q *PokeQueue) Bucket(cpeMac string) int {
+	return common.PokeQueueBucket(cpeMac, q.buckets)
+}
+
+func (q *PokeQueue) Owner() string {
+	return q.owner
+}
+
+func (q *PokeQueue) SetOwner(x string) {
+	q.owner = x
+}
+
+func (q *PokeQueue) Depth() int {
+	return int(q.depth.Load())
+}
+
+func (q *PokeQueue) SetMetrics(m *common.AppMetrics) {
+	q.metrics = m
+}
+
+func (q *PokeQueue) encodeHeader(header http.Header) ([]byte, error) {
+	hbytes, err := json.Marshal(header)
+	if err != nil {
+		return nil, common.NewError(err)
+	}
+	if q.codec == nil {
+		return append([]byte{pokeHeaderPlain}, hbytes...), nil
+	}
+	ebytes, err := q.codec.EncryptBytes(hbytes)
+	if err != nil {
+		return nil, common.NewError(err)
+	}
+	return append([]byte{pokeHeaderEncrypted}, ebytes...), nil
+}
+
+func (q *PokeQueue) decodeHeader(bbytes []byte) (http.Header, error) {
+	header := make(http.Header)
+	if len(bbytes) == 0 {
+		return header, nil
+	}
+	hbytes := bbytes[1:]
+	switch bbytes[0] {
+	case pokeHeaderPlain:
+	case pokeHeaderEncrypted:
+		if q.codec == nil {
+			err := fmt.Errorf("no codec to decrypt the poke header")
+			return nil, common.NewError(err)
+		}
+		var err error
+		hbytes, err = q.codec.DecryptBytes(hbytes)
+		if err != nil {
+			return nil, common.NewError(err)
+		}
+	default:
+		err := fmt.Errorf("unknown poke header encoding %v", bbytes[0])
+		return nil, common.NewError(err)
+	}
+	if err := json.Unmarshal(hbytes, &header); err != nil {
+		return nil, common.NewError(err)
+	}
+	return header, nil
+}
+
+// Enqueue stores the poke as the latest one for the cpe. It never blocks the
+// caller, a 503 error is returned if the queue is full.
+func (q *PokeQueue) Enqueue(cpeMac string, transactionId string, url string, header http.Header, payload []byte) error {
+	bucket := q.Bucket(cpeMac)
+	existing, err := q.dbclient.GetPokeTask(bucket, cpeMac)
+	if err != nil {
+		if !q.dbclient.IsDbNotFound(err) {
+			return common.NewError(err)
+		}
+		existing = nil
+	}
+
+	if existing == nil && q.Depth() >= q.maxDepth {
+		err := common.RemoteHttpError{
+			Message:    fmt.Sprintf("poke queue is full, depth=%v", q.Depth()),
+			StatusCode: http.StatusServiceUnavailable,
+		}
+		return common.NewError(err)
+	}
+
+	hbytes, err := q.encodeHeader(header)
+	if err != nil {
+		return common.NewError(err)
+	}
+
+	now := q.nowFn().UnixMilli()
+	task := &common.PokeTask{
+		Bucket:        bucket,
+		CpeMac:        cpeMac,
+		TransactionId: transactionId,
+		Url:           url,
+		Header:        hbytes,
+		Payload:       payload,
+		Status:        common.PokeTaskQueued,
+		CreatedTime:   now,
+		UpdatedTime:   now,
+	}
+	if err := q.dbclient.SetPokeTask(task); err != nil {
+		return common.NewError(err)
+	}
+	if err := q.dbclient.SetPokeStatus(task); err != nil {
+		return common.NewError(err)
+	}
+
+	if existing == nil {
+		q.depth.Add(1)
+		return nil
+	}
+
+	// an in-progress poke is left to its worker, only a queued one is replaced
+	if existing.Status == common.PokeTaskQueued && existing.TransactionId != transactionId {
+		existing.Status = common.PokeTaskSuperseded
+		existing.ErrorDetails = fmt.Sprintf("superseded by %v", transactionId)
+		existing.UpdatedTime = now
+		if err := q.dbclient.SetPokeStatus(existing); err != nil {
+			return common.NewError(err)
+		}
+	}
+	return nil
+}
+
+// OwnedBuckets renews the leases of the buckets owned by this replica and takes
+// free ones up to maxOwned. The leases are renewed every third of their ttl,
+// the buckets are tried in random order so that the replicas spread over them.
+func (q *PokeQueue) OwnedBuckets() ([]int, error) {
+	now := q.nowFn()
+	if now.Sub(q.renewedAt) >= q.lease/3 {
+		leaseSecs := int(q.lease.Seconds())
+		owned := map[int]bool{}
+		for _, bucket := range rand.Perm(q.buckets) {
+			if !q.owned[bucket] && len(owned) >= q.maxOwned {
+				continue
+			}
+			ok, err := q.dbclient.AcquireLease(fmt.Sprintf(pokeQueueLeaseTemplate, bucket), q.owner, leaseSecs)
+			if err != nil {
+				return nil, common.NewError(err)
+			}
+			if ok {
+				owned[bucket] = true
+			}
+		}
+		q.owned = owned
+		q.renewedAt = now
+	}
+
+	buckets := []int{}
+	for bucket := range q.owned {
+		buckets = append(buckets, bucket)
+	}
+	return buckets, nil
+}
+
+// Poll reads the owned buckets of the queue, refreshes the depth and returns
+// the tasks which are queued or whose lease has expired
+func (q *PokeQueue) Poll() ([]*common.PokeTask, error) {
+	buckets, err := q.OwnedBuckets()
+	if err != nil {
+		return nil, common.NewError(err)
+	}
+	tasks := []*common.PokeTask{}
+	for _, bucket := range buckets {
+		btasks, err := q.dbclient.GetPokeTasks(bucket)
+		if err != nil {
+			return nil, common.NewError(err)
+		}
+		tasks = append(tasks, btasks...)
+	}
+
+	now := q.nowFn().UnixMilli()
+	var queued, inProgress int
+	ready := []*common.PokeTask{}
+	for _, task := range tasks {
+		switch task.Status {
+		case common.PokeTaskQueued:
+			queued++
+			ready = append(ready, task)
+		case common.PokeTaskInProgress:
+			inProgress++
+			if now-task.UpdatedTime > q.lease.Milliseconds() {
+				ready = append(ready, task)
+			}
+		}
+	}
+
+	q.depth.Store(int64(len(tasks)))
+	if q.metrics != nil {
+		q.metrics.SetPokeQueueDepth(common.PokeTaskQueued, queued)
+		q.metrics.SetPokeQueueDepth(common.PokeTaskInProgress, inProgress)
+	}
+	return ready, nil
+}
+
+// Run starts the workers and dispatches the ready tasks to them until ctx is done
+func (q *PokeQueue) Run(ctx context.Context) {
+	ch := make(chan *common.PokeTask)
+	var wg sync.WaitGroup
+	for i := 0; i < q.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for task := range ch {
+				q.Process(task)
+			}
+		}()
+	}
+
+	ticker := time.NewTicker(q.pollInterval)
+	defer func() {
+		ticker.Stop()
+		close(ch)
+		wg.Wait()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			tasks, err := q.Poll()
+			if err != nil {
+				log.WithFields(log.Fields{"logger": asyncWebpaServiceName}).Errorf("poke queue poll error: %v", err)
+				continue
+			}
+			for _, task := range tasks {
+				select {
+				case ch <- task:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}
+}
+
+// Process claims the task and sends the poke. A task claimed by another worker
+// or replaced by a newer poke in the meantime is skipped.
+func (q *PokeQueue) Process(task *common.PokeTask) {
+	fields := log.Fields{
+		"logger":         asyncWebpaServiceName,
+		"cpe_mac":        task.CpeMac,
+		"transaction_id": task.TransactionId,
+	}
+
+	claimed, err := q.dbclient.ClaimPokeTask(task)
+	if err != nil {
+		log.WithFields(fields).Errorf("poke queue claim error: %v", err)
+		return
+	}
+	if !claimed {
+		return
+	}
+
+	var sendErr error
+	if task.Attempts > q.maxAttempts {
+		sendErr = fmt.Errorf("abandoned after %v attempts", task.Attempts-1)
+	} else {
+		if err := q.dbclient.SetPokeStatus(task); err != nil {
+			log.WithFields(fields).Errorf("poke queue status error: %v", err)
+		}
+		sendErr = q.send(task, fields)
+	}
+
+	task.Status = common.PokeTaskDone
+	task.ErrorDetails = ""
+	if sendErr != nil {
+		task.Status = common.PokeTaskFailed
+		task.ErrorDetails = sendErr.Error()
+	}
+	task.UpdatedTime = q.nowFn().UnixMilli()
+
+	// the row is kept if a newer poke has replaced it
+	if err := q.dbclient.DeletePokeTask(task.Bucket, task.CpeMac, task.TransactionId); err != nil {
+		log.WithFields(fields).Errorf("poke queue delete error: %v", err)
+	}
+	if err := q.dbclient.SetPokeStatus(task); err != nil {
+		log.WithFields(fields).Errorf("poke queue status error: %v", err)
+	}
+	if q.depth.Add(-1) < 0 {
+		q.depth.Store(0)
+	}
+}
+
+func (q *PokeQueue) send(task *common.PokeTask, fields log.Fields) error {
+	header, err := q.decodeHeader(task.Header)
+	if err != nil {
+		return common.NewError(err)
+	}
+
+	c := q.connector
+	err = fmt.Errorf("no retries configured")
+	for i := 1; i <= c.retries; i++ {
+		if !c.asyncClient.RetryPolicy().Wait(i) {
+			log.WithFields(fields).Warnf("retry budget exhausted after %v retries", i-1)
+			return fmt.Errorf("retry budget exhausted after %v retries", i-1)
+		}
+		cbytes := make([]byte, len(task.Payload))
+		copy(cbytes, task.Payload)
+		var cont bool
+		_, _, cont, err = c.asyncClient.Do("PATCH", task.Url, header, cbytes, fields, asyncWebpaServiceName, i)
+		if !cont {
+			if err == nil {
+				log.WithFields(fields).Infof("finished success after %v retries", i)
+			}
+			return err
+		}
+	}
+	log.WithFields(fields).Infof("finished failure after %v retries", c.retries)
+	return err
+}
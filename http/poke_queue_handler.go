@@ -0,0 +1,90 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/rdkcentral/webconfig/common"
+)
+
+// PokeQueueResponse is the admin listing of the async poke queue
+type PokeQueueResponse struct {
+	Depth    int                `json:"depth"`
+	MaxDepth int                `json:"max_depth"`
+	Tasks    []*common.PokeTask `json:"tasks"`
+}
+
+// GetPokeQueueHandler lists the queue bucket by bucket, or only the bucket given
+// by the query param "bucket"
+func (s *WebconfigServer) GetPokeQueueHandler(w http.ResponseWriter, r *http.Request) {
+	q := s.PokeQueue()
+	if q == nil {
+		WriteOkResponse(w, PokeQueueResponse{Tasks: []*common.PokeTask{}})
+		return
+	}
+
+	buckets := []int{}
+	if x := r.URL.Query().Get("bucket"); len(x) > 0 {
+		bucket, err := strconv.Atoi(x)
+		if err != nil || bucket < 0 || bucket >= q.Buckets() {
+			Error(w, http.StatusBadRequest, common.NewError(fmt.Errorf("invalid bucket %v", x)))
+			return
+		}
+		buckets = append(buckets, bucket)
+	} else {
+		for bucket := 0; bucket < q.Buckets(); bucket++ {
+			buckets = append(buckets, bucket)
+		}
+	}
+
+	tasks := []*common.PokeTask{}
+	for _, bucket := range buckets {
+		btasks, err := s.GetPokeTasks(bucket)
+		if err != nil {
+			Error(w, http.StatusInternalServerError, common.NewError(err))
+			return
+		}
+		tasks = append(tasks, btasks...)
+	}
+
+	// headers and payloads are never exposed by the json tags of PokeTask
+	resp := PokeQueueResponse{
+		Depth:    len(tasks),
+		MaxDepth: q.MaxDepth(),
+		Tasks:    tasks,
+	}
+	WriteOkResponse(w, resp)
+}
+
+func (s *WebconfigServer) GetPokeStatusHandler(w http.ResponseWriter, r *http.Request) {
+	transactionId := mux.Vars(r)["transaction_id"]
+	task, err := s.GetPokeStatus(transactionId)
+	if err != nil {
+		if s.IsDbNotFound(err) {
+			Error(w, http.StatusNotFound, nil)
+			return
+		}
+		Error(w, http.StatusInternalServerError, common.NewError(err))
+		return
+	}
+	WriteOkResponse(w, task)
+}
@@ -0,0 +1,243 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/rdkcentral/webconfig/common"
+	"github.com/rdkcentral/webconfig/util"
+	log "github.com/sirupsen/logrus"
+	"gotest.tools/assert"
+)
+
+var (
+	mockWebpaPoke520Response = []byte(`{"parameters":[{"name":"Device.X_RDK_WebConfig.ForceSync","message":"Previous request is in progress"}],"statusCode":520}`)
+)
+
+func TestPokeQueue(t *testing.T) {
+	server := NewWebconfigServer(sc, true)
+	router := server.GetRouter(true)
+	q := NewPokeQueue(server.Config, server.DatabaseClient, server.WebpaConnector)
+	// a fixed owner renews the bucket leases left by the previous runs
+	q.SetOwner("poke-queue-test")
+	server.SetPokeQueue(q)
+	server.SetAsyncPokeEnabled(true)
+	cpeMac := util.GenerateRandomCpeMac()
+
+	// webpa mock server, it returns 520 until the device becomes available
+	var available atomic.Bool
+	var asyncAuthorization atomic.Value
+	webpaMockServer := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !available.Load() {
+				w.WriteHeader(520)
+				_, _ = w.Write(mockWebpaPoke520Response)
+				return
+			}
+			asyncAuthorization.Store(r.Header.Get("Authorization"))
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write(mockWebpaPokeResponse)
+		}))
+	defer webpaMockServer.Close()
+	server.SetWebpaHost(webpaMockServer.URL)
+
+	header := make(http.Header)
+	header.Set("Authorization", "Bearer foobar")
+
+	// ==== 2 pokes to the same cpe, only the latest one is kept ====
+	transactionIds := []string{}
+	for i := 0; i < 2; i++ {
+		transactionId, err := server.Patch(header, cpeMac, "foobar", PokeBody, log.Fields{})
+		var rherr common.RemoteHttpError
+		assert.Assert(t, errors.As(err, &rherr))
+		assert.Equal(t, rherr.StatusCode, webpa520NewStatusCode)
+		transactionIds = append(transactionIds, transactionId)
+	}
+	assert.Assert(t, transactionIds[0] != transactionIds[1])
+
+	task, err := server.GetPokeTask(q.Bucket(cpeMac), cpeMac)
+	assert.NilError(t, err)
+	assert.Equal(t, task.TransactionId, transactionIds[1])
+	assert.Equal(t, task.Status, common.PokeTaskQueued)
+
+	status, err := server.GetPokeStatus(transactionIds[0])
+	assert.NilError(t, err)
+	assert.Equal(t, status.Status, common.PokeTaskSuperseded)
+
+	// ==== the worker delivers the poke ====
+	tasks, err := q.Poll()
+	assert.NilError(t, err)
+	var ready *common.PokeTask
+	for _, x := range tasks {
+		if x.CpeMac == cpeMac {
+			ready = x
+		}
+	}
+	assert.Assert(t, ready != nil)
+
+	available.Store(true)
+	q.Process(ready)
+	assert.Equal(t, asyncAuthorization.Load(), "Bearer foobar")
+
+	_, err = server.GetPokeTask(q.Bucket(cpeMac), cpeMac)
+	assert.Assert(t, server.IsDbNotFound(err))
+
+	// a task already processed cannot be claimed again
+	claimed, err := server.ClaimPokeTask(task)
+	assert.NilError(t, err)
+	assert.Assert(t, !claimed)
+
+	// ==== status api ====
+	url := fmt.Sprintf("/api/v1/pokes/%v", transactionIds[1])
+	req, err := http.NewRequest("GET", url, nil)
+	assert.NilError(t, err)
+	req.Header.Set("Authorization", "Bearer foobar")
+	res := ExecuteRequest(req, router).Result()
+	rbytes, err := io.ReadAll(res.Body)
+	assert.NilError(t, err)
+	res.Body.Close()
+	assert.Equal(t, res.StatusCode, http.StatusOK)
+
+	var statusResp struct {
+		Data common.PokeTask `json:"data"`
+	}
+	err = json.Unmarshal(rbytes, &statusResp)
+	assert.NilError(t, err)
+	assert.Equal(t, statusResp.Data.Status, common.PokeTaskDone)
+	assert.Equal(t, statusResp.Data.CpeMac, cpeMac)
+	assert.Equal(t, statusResp.Data.Attempts, 1)
+
+	req, err = http.NewRequest("GET", "/api/v1/pokes/unknown", nil)
+	assert.NilError(t, err)
+	req.Header.Set("Authorization", "Bearer foobar")
+	res = ExecuteRequest(req, router).Result()
+	_, _ = io.ReadAll(res.Body)
+	res.Body.Close()
+	assert.Equal(t, res.StatusCode, http.StatusNotFound)
+
+	// ==== the 524 of the poke api returns the transaction id ====
+	available.Store(false)
+	url = fmt.Sprintf("/api/v1/device/%v/poke?doc=telemetry", cpeMac)
+	req, err = http.NewRequest("POST", url, nil)
+	assert.NilError(t, err)
+	req.Header.Set("Authorization", "Bearer foobar")
+	res = ExecuteRequest(req, router).Result()
+	rbytes, err = io.ReadAll(res.Body)
+	assert.NilError(t, err)
+	res.Body.Close()
+	assert.Equal(t, res.StatusCode, webpa520NewStatusCode)
+
+	var inProgressResp PokeInProgressResponse
+	err = json.Unmarshal(rbytes, &inProgressResp)
+	assert.NilError(t, err)
+	assert.Assert(t, len(inProgressResp.TransactionId) > 0)
+	status, err = server.GetPokeStatus(inProgressResp.TransactionId)
+	assert.NilError(t, err)
+	assert.Equal(t, status.Status, common.PokeTaskQueued)
+
+	// ==== listing api ====
+	req, err = http.NewRequest("GET", "/api/v1/pokes", nil)
+	assert.NilError(t, err)
+	req.Header.Set("Authorization", "Bearer foobar")
+	res = ExecuteRequest(req, router).Result()
+	rbytes, err = io.ReadAll(res.Body)
+	assert.NilError(t, err)
+	res.Body.Close()
+	assert.Equal(t, res.StatusCode, http.StatusOK)
+
+	var listResp struct {
+		Data PokeQueueResponse `json:"data"`
+	}
+	err = json.Unmarshal(rbytes, &listResp)
+	assert.NilError(t, err)
+	found := false
+	for _, x := range listResp.Data.Tasks {
+		if x.CpeMac == cpeMac {
+			found = true
+			assert.Equal(t, x.Status, common.PokeTaskQueued)
+			assert.Assert(t, len(x.Header) == 0)
+		}
+	}
+	assert.Assert(t, found)
+
+	// ==== listing of a single bucket ====
+	req, err = http.NewRequest("GET", fmt.Sprintf("/api/v1/pokes?bucket=%v", q.Bucket(cpeMac)), nil)
+	assert.NilError(t, err)
+	req.Header.Set("Authorization", "Bearer foobar")
+	res = ExecuteRequest(req, router).Result()
+	rbytes, err = io.ReadAll(res.Body)
+	assert.NilError(t, err)
+	res.Body.Close()
+	assert.Equal(t, res.StatusCode, http.StatusOK)
+	err = json.Unmarshal(rbytes, &listResp)
+	assert.NilError(t, err)
+	for _, x := range listResp.Data.Tasks {
+		assert.Equal(t, x.Bucket, q.Bucket(cpeMac))
+	}
+
+	req, err = http.NewRequest("GET", fmt.Sprintf("/api/v1/pokes?bucket=%v", q.Buckets()), nil)
+	assert.NilError(t, err)
+	req.Header.Set("Authorization", "Bearer foobar")
+	res = ExecuteRequest(req, router).Result()
+	_, _ = io.ReadAll(res.Body)
+	res.Body.Close()
+	assert.Equal(t, res.StatusCode, http.StatusBadRequest)
+}
+
+func TestPokeQueueBuckets(t *testing.T) {
+	server := NewWebconfigServer(sc, true)
+	q1 := NewPokeQueue(server.Config, server.DatabaseClient, server.WebpaConnector)
+	q1.SetOwner("poke-queue-test-1")
+	q2 := NewPokeQueue(server.Config, server.DatabaseClient, server.WebpaConnector)
+	q2.SetOwner("poke-queue-test-2")
+
+	// a bucket is owned by one replica only
+	buckets1, err := q1.OwnedBuckets()
+	assert.NilError(t, err)
+	buckets2, err := q2.OwnedBuckets()
+	assert.NilError(t, err)
+	owned := map[int]bool{}
+	for _, bucket := range append(buckets1, buckets2...) {
+		assert.Assert(t, !owned[bucket])
+		owned[bucket] = true
+	}
+
+	cpeMac := util.GenerateRandomCpeMac()
+	assert.Equal(t, q1.Bucket(cpeMac), common.PokeQueueBucket(cpeMac, q1.Buckets()))
+	assert.Equal(t, q1.Bucket(cpeMac), q1.Bucket(strings.ToLower(cpeMac)))
+}
+
+func TestPokeQueueFull(t *testing.T) {
+	server := NewWebconfigServer(sc, true)
+	q := NewPokeQueue(server.Config, server.DatabaseClient, server.WebpaConnector)
+	q.SetMaxDepth(0)
+
+	err := q.Enqueue(util.GenerateRandomCpeMac(), "txid", "http://localhost/api", make(http.Header), PokeBody)
+	var rherr common.RemoteHttpError
+	assert.Assert(t, errors.As(err, &rherr))
+	assert.Equal(t, rherr.StatusCode, http.StatusServiceUnavailable)
+}
@@ -0,0 +1,224 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package http
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	neturl "net/url"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/go-akka/configuration"
+)
+
+const (
+	defaultRetryBackoffMultiplier  = 2.0
+	defaultRetryMaxInMsecs         = 10000
+	defaultRetryJitterEnabled      = true
+	defaultRetryBudgetWindowInSecs = 10
+	defaultRetryBudgetMinRetries   = 10
+)
+
+// RetryBudget caps the retries to a ratio of the requests in a window, so that
+// a degraded remote is not hit by a multiple of the normal traffic. Retries up
+// to minRetries per window are always allowed to keep low traffic services retrying.
+type RetryBudget struct {
+	sync.Mutex
+	ratio       float64
+	minRetries  int
+	window      time.Duration
+	windowStart time.Time
+	requests    int
+	retries     int
+	nowFn       func() time.Time
+}
+
+func NewRetryBudget(ratio float64, minRetries int, window time.Duration) *RetryBudget {
+	b := &RetryBudget{
+		ratio:      ratio,
+		minRetries: minRetries,
+		window:     window,
+		nowFn:      time.Now,
+	}
+	b.windowStart = b.nowFn()
+	return b
+}
+
+func (b *RetryBudget) rollLocked() {
+	now := b.nowFn()
+	if now.Sub(b.windowStart) >= b.window {
+		b.windowStart = now
+		b.requests = 0
+		b.retries = 0
+	}
+}
+
+func (b *RetryBudget) RecordRequest() {
+	if b == nil {
+		return
+	}
+	b.Lock()
+	defer b.Unlock()
+	b.rollLocked()
+	b.requests++
+}
+
+// TryRetry takes one retry from the budget if there is any left
+func (b *RetryBudget) TryRetry() bool {
+	if b == nil {
+		return true
+	}
+	b.Lock()
+	defer b.Unlock()
+	b.rollLocked()
+	if b.retries >= b.minRetries && float64(b.retries+1) > b.ratio*float64(b.requests) {
+		return false
+	}
+	b.retries++
+	return true
+}
+
+// RetryPolicy computes the delay before each retry, an exponential backoff
+// from retry_in_msecs capped at retry_max_in_msecs, with full jitter.
+type RetryPolicy struct {
+	retries       int
+	initialDelay  time.Duration
+	maxDelay      time.Duration
+	multiplier    float64
+	jitterEnabled bool
+	budget        *RetryBudget
+	randFn        func(int64) int64
+	sleepFn       func(time.Duration)
+}
+
+// NewRetryPolicy reads the retry_* keys of webconfig.<serviceName>. The retry
+// budget is off unless retry_budget_ratio is set.
+func NewRetryPolicy(conf *configuration.Config, serviceName string) *RetryPolicy {
+	prefix := fmt.Sprintf("webconfig.%v.", serviceName)
+	var budget *RetryBudget
+	if ratio := conf.GetFloat64(prefix+"retry_budget_ratio", 0); ratio > 0 {
+		window := time.Duration(conf.GetInt32(prefix+"retry_budget_window_in_secs", defaultRetryBudgetWindowInSecs)) * time.Second
+		minRetries := int(conf.GetInt32(prefix+"retry_budget_min_retries", defaultRetryBudgetMinRetries))
+		budget = NewRetryBudget(ratio, minRetries, window)
+	}
+	return &RetryPolicy{
+		retries:       int(conf.GetInt32(prefix+"retries", defaultRetries)),
+		initialDelay:  time.Duration(conf.GetInt32(prefix+"retry_in_msecs", defaultRetriesInMsecs)) * time.Millisecond,
+		maxDelay:      time.Duration(conf.GetInt32(prefix+"retry_max_in_msecs", defaultRetryMaxInMsecs)) * time.Millisecond,
+		multiplier:    conf.GetFloat64(prefix+"retry_backoff_multiplier", defaultRetryBackoffMultiplier),
+		jitterEnabled: conf.GetBoolean(prefix+"retry_jitter_enabled", defaultRetryJitterEnabled),
+		budget:        budget,
+		randFn:        rand.Int63n,
+		sleepFn:       time.Sleep,
+	}
+}
+
+func (p *RetryPolicy) Retries() int {
+	return p.retries
+}
+
+func (p *RetryPolicy) Budget() *RetryBudget {
+	return p.budget
+}
+
+// Backoff returns the delay before the n-th retry, n starting from 1
+func (p *RetryPolicy) Backoff(retry int) time.Duration {
+	if retry < 1 {
+		return 0
+	}
+	delay := float64(p.initialDelay) * math.Pow(p.multiplier, float64(retry-1))
+	if delay > float64(p.maxDelay) {
+		delay = float64(p.maxDelay)
+	}
+	d := time.Duration(delay)
+	if p.jitterEnabled && d > 0 {
+		// full jitter, uniformly in [0, d]
+		d = time.Duration(p.randFn(int64(d) + 1))
+	}
+	return d
+}
+
+func (p *RetryPolicy) RecordRequest() {
+	p.budget.RecordRequest()
+}
+
+// Wait sleeps before the n-th retry. It returns false without sleeping when
+// the retry budget is exhausted.
+func (p *RetryPolicy) Wait(retry int) bool {
+	if !p.budget.TryRetry() {
+		return false
+	}
+	p.sleepFn(p.Backoff(retry))
+	return true
+}
+
+// IsRetryableStatus classifies the http status codes worth another attempt.
+// Other 4xx are the caller's problem and 501/505 will not change on a retry.
+func IsRetryableStatus(statusCode int) bool {
+	switch statusCode {
+	case http.StatusRequestTimeout, http.StatusTooEarly, http.StatusTooManyRequests:
+		return true
+	case http.StatusNotImplemented, http.StatusHTTPVersionNotSupported:
+		return false
+	}
+	return statusCode >= 500
+}
+
+// IsRetryableError classifies the errors returned by http.Client.Do. Timeouts
+// and connection level failures are retryable, certificate errors and
+// malformed urls are not.
+func IsRetryableError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var certErr x509.CertificateInvalidError
+	var unknownAuthErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	if errors.As(err, &certErr) || errors.As(err, &unknownAuthErr) || errors.As(err, &hostnameErr) {
+		return false
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return dnsErr.IsTemporary || dnsErr.IsTimeout
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return true
+	}
+	// ex: unsupported protocol scheme
+	var ue *neturl.Error
+	if errors.As(err, &ue) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,160 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package http
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	neturl "net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-akka/configuration"
+	log "github.com/sirupsen/logrus"
+	"gotest.tools/assert"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	conf := configuration.ParseString(`webconfig.xconf {
+	retries = 5
+	retry_in_msecs = 100
+	retry_max_in_msecs = 500
+	retry_backoff_multiplier = 2.0
+	retry_jitter_enabled = false
+}`)
+	p := NewRetryPolicy(conf, "xconf")
+	assert.Equal(t, p.Retries(), 5)
+	assert.Assert(t, p.Budget() == nil)
+	assert.Equal(t, p.Backoff(0), time.Duration(0))
+	assert.Equal(t, p.Backoff(1), 100*time.Millisecond)
+	assert.Equal(t, p.Backoff(2), 200*time.Millisecond)
+	assert.Equal(t, p.Backoff(3), 400*time.Millisecond)
+	assert.Equal(t, p.Backoff(4), 500*time.Millisecond)
+	assert.Equal(t, p.Backoff(10), 500*time.Millisecond)
+
+	// full jitter picks in [0, backoff]
+	p.jitterEnabled = true
+	var ceiling int64
+	p.randFn = func(n int64) int64 {
+		ceiling = n
+		return n / 2
+	}
+	assert.Equal(t, p.Backoff(2), 100*time.Millisecond)
+	assert.Equal(t, ceiling, int64(200*time.Millisecond)+1)
+}
+
+func TestRetryBudget(t *testing.T) {
+	b := NewRetryBudget(0.5, 2, 10*time.Second)
+	now := time.Now()
+	b.nowFn = func() time.Time { return now }
+
+	// min_retries are allowed even without requests
+	assert.Assert(t, b.TryRetry())
+	assert.Assert(t, b.TryRetry())
+	assert.Assert(t, !b.TryRetry())
+
+	// 10 requests at 0.5 allow 5 retries
+	for i := 0; i < 10; i++ {
+		b.RecordRequest()
+	}
+	for i := 0; i < 3; i++ {
+		assert.Assert(t, b.TryRetry())
+	}
+	assert.Assert(t, !b.TryRetry())
+
+	// a new window resets the counts
+	now = now.Add(11 * time.Second)
+	assert.Assert(t, b.TryRetry())
+
+	// nil is unlimited
+	var nb *RetryBudget
+	nb.RecordRequest()
+	assert.Assert(t, nb.TryRetry())
+}
+
+func TestRetryClassification(t *testing.T) {
+	assert.Assert(t, IsRetryableStatus(http.StatusServiceUnavailable))
+	assert.Assert(t, IsRetryableStatus(http.StatusGatewayTimeout))
+	assert.Assert(t, IsRetryableStatus(http.StatusTooManyRequests))
+	assert.Assert(t, IsRetryableStatus(http.StatusRequestTimeout))
+	assert.Assert(t, !IsRetryableStatus(http.StatusNotImplemented))
+	assert.Assert(t, !IsRetryableStatus(http.StatusConflict))
+	assert.Assert(t, !IsRetryableStatus(http.StatusUnauthorized))
+	assert.Assert(t, !IsRetryableStatus(http.StatusNotFound))
+
+	assert.Assert(t, !IsRetryableError(nil))
+	assert.Assert(t, IsRetryableError(&neturl.Error{Op: "Get", URL: "http://foo", Err: io.EOF}))
+	assert.Assert(t, IsRetryableError(&neturl.Error{Op: "Get", URL: "http://foo", Err: context.DeadlineExceeded}))
+	assert.Assert(t, IsRetryableError(&neturl.Error{Op: "Get", URL: "http://foo", Err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}}))
+	assert.Assert(t, !IsRetryableError(&neturl.Error{Op: "Get", URL: "foo://bar", Err: errors.New("unsupported protocol scheme")}))
+	assert.Assert(t, !IsRetryableError(&neturl.Error{Op: "Get", URL: "https://foo", Err: x509.UnknownAuthorityError{}}))
+	dnsErr := &net.DNSError{Err: "no such host", Name: "foo", IsNotFound: true}
+	assert.Assert(t, !IsRetryableError(&neturl.Error{Op: "Get", URL: "http://foo", Err: &net.OpError{Op: "dial", Err: dnsErr}}))
+}
+
+func TestDoWithRetriesBackoff(t *testing.T) {
+	var calls int32
+	status := http.StatusServiceUnavailable
+	mockServer := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			w.WriteHeader(status)
+		}))
+	defer mockServer.Close()
+
+	conf := configuration.ParseString(`webconfig.xconf {
+	retries = 3
+	retry_in_msecs = 100
+	retry_budget_ratio = 0.1
+	retry_budget_min_retries = 4
+}`)
+	c := NewHttpClient(conf, "xconf", nil)
+	sleeps := []time.Duration{}
+	c.RetryPolicy().sleepFn = func(d time.Duration) {
+		sleeps = append(sleeps, d)
+	}
+
+	// ==== 503 is retried with increasing delays ====
+	_, _, err := c.DoWithRetries("GET", mockServer.URL, nil, nil, log.Fields{}, "xconf")
+	assert.Assert(t, err != nil)
+	assert.Equal(t, atomic.LoadInt32(&calls), int32(4))
+	assert.Equal(t, len(sleeps), 3)
+	for i, d := range sleeps {
+		assert.Assert(t, d <= (100*time.Millisecond)<<i)
+	}
+
+	// ==== 409 is not retried ====
+	status = http.StatusConflict
+	atomic.StoreInt32(&calls, 0)
+	_, _, err = c.DoWithRetries("GET", mockServer.URL, nil, nil, log.Fields{}, "xconf")
+	assert.Assert(t, err != nil)
+	assert.Equal(t, atomic.LoadInt32(&calls), int32(1))
+
+	// ==== the budget has only 1 retry left ====
+	status = http.StatusServiceUnavailable
+	atomic.StoreInt32(&calls, 0)
+	_, _, err = c.DoWithRetries("GET", mockServer.URL, nil, nil, log.Fields{}, "xconf")
+	assert.Assert(t, err != nil)
+	assert.Equal(t, atomic.LoadInt32(&calls), int32(2))
+}
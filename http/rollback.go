@@ -0,0 +1,251 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/go-akka/configuration"
+	"github.com/rdkcentral/webconfig/common"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultRollbackFailureThreshold = 3
+	rollbackMetricsAgent            = "rollback"
+)
+
+// RollbackPolicy tells after how many failures of a new version the subdoc is
+// rolled back to its last known good version
+type RollbackPolicy struct {
+	threshold  int
+	thresholds map[string]int
+}
+
+func NewRollbackPolicy(conf *configuration.Config) *RollbackPolicy {
+	threshold := int(conf.GetInt32("webconfig.rollback.failure_threshold", defaultRollbackFailureThreshold))
+	thresholds := map[string]int{}
+	path := "webconfig.rollback.subdoc_failure_thresholds"
+	if node := conf.GetNode(path); node != nil && node.IsObject() {
+		for _, subdocId := range node.GetObject().GetKeys() {
+			thresholds[subdocId] = int(conf.GetInt32(path+"."+subdocId, int32(threshold)))
+		}
+	}
+	return &RollbackPolicy{
+		threshold:  threshold,
+		thresholds: thresholds,
+	}
+}
+
+func (p *RollbackPolicy) Threshold(subdocId string) int {
+	if x, ok := p.thresholds[subdocId]; ok {
+		return x
+	}
+	return p.threshold
+}
+
+func (s *WebconfigServer) RollbackPolicy() *RollbackPolicy {
+	return s.rollbackPolicy
+}
+
+func (s *WebconfigServer) SetRollbackPolicy(p *RollbackPolicy) {
+	s.rollbackPolicy = p
+}
+
+// handleLastKnownGood records the deployed versions and rolls back the failed
+// ones. It returns true if the subdoc is rolled back. Errors are only logged so
+// that the notification itself is not failed.
+func (s *WebconfigServer) handleLastKnownGood(cpeMac string, m *common.EventMessage, fields log.Fields) bool {
+	if s.rollbackPolicy == nil || m.Namespace == nil || m.ApplicationStatus == nil {
+		return false
+	}
+	var version string
+	if m.Version != nil {
+		version = *m.Version
+	}
+
+	var rolledBack bool
+	var err error
+	switch *m.ApplicationStatus {
+	case "success":
+		err = s.RecordLastKnownGood(cpeMac, *m.Namespace)
+	case "pending":
+	default:
+		rolledBack, err = s.RollbackFailedSubDocument(cpeMac, *m.Namespace, version, fields)
+	}
+	if err != nil {
+		log.WithFields(common.FilterLogFields(fields)).Warn(err)
+	}
+	return rolledBack
+}
+
+// RecordLastKnownGood keeps the payload of the subdoc just deployed. The payload is
+// kept as stored, a reference to a refsubdocument is restored as a reference.
+func (s *WebconfigServer) RecordLastKnownGood(cpeMac, subdocId string) error {
+	subdoc, err := s.GetRawSubDocument(cpeMac, subdocId)
+	if err != nil {
+		return common.NewError(err)
+	}
+	if subdoc.State() == nil || *subdoc.State() != common.Deployed || !subdoc.HasPayload() {
+		return nil
+	}
+
+	// skip the write if nothing changes
+	lkg, err := s.GetLastKnownGood(cpeMac, subdocId)
+	if err != nil && !s.IsDbNotFound(err) {
+		return common.NewError(err)
+	}
+	if lkg != nil && lkg.Version == subdoc.GetVersion() && lkg.FailureCount == 0 {
+		return nil
+	}
+
+	lkg = &common.LastKnownGood{
+		CpeMac:       cpeMac,
+		SubdocId:     subdocId,
+		Payload:      subdoc.Payload(),
+		Version:      subdoc.GetVersion(),
+		DeployedTime: time.Now().UnixMilli(),
+	}
+	if err := s.SetLastKnownGood(lkg); err != nil {
+		return common.NewError(err)
+	}
+	return nil
+}
+
+// RollbackFailedSubDocument counts the failures of the current version and
+// restores the last known good one as pending download once the threshold is
+// reached. The rollback is recorded in the device history, reported on the kafka
+// producer and the device is poked.
+func (s *WebconfigServer) RollbackFailedSubDocument(cpeMac, subdocId, version string, fields log.Fields) (bool, error) {
+	subdoc, err := s.GetSubDocument(cpeMac, subdocId)
+	if err != nil {
+		return false, common.NewError(err)
+	}
+	if subdoc.State() == nil || *subdoc.State() != common.Failure {
+		return false, nil
+	}
+	failedVersion := subdoc.GetVersion()
+	if len(version) > 0 && version != failedVersion {
+		return false, nil
+	}
+
+	lkg, err := s.GetLastKnownGood(cpeMac, subdocId)
+	if err != nil {
+		if s.IsDbNotFound(err) {
+			// nothing to roll back to
+			return false, nil
+		}
+		return false, common.NewError(err)
+	}
+	if lkg.Version == failedVersion {
+		return false, nil
+	}
+
+	if lkg.FailedVersion != failedVersion {
+		lkg.FailedVersion = failedVersion
+		lkg.FailureCount = 0
+	}
+	lkg.FailureCount++
+	failureCount := lkg.FailureCount
+	if failureCount < s.rollbackPolicy.Threshold(subdocId) {
+		if err := s.SetLastKnownGood(lkg); err != nil {
+			return false, common.NewError(err)
+		}
+		return false, nil
+	}
+
+	now := time.Now()
+	state := common.PendingDownload
+	updatedTime := int(now.UnixMilli())
+	errorCode := 0
+	errorDetails := ""
+	restored := common.NewSubDocument(lkg.Payload, &lkg.Version, &state, &updatedTime, &errorCode, &errorDetails)
+	if _, err := s.WriteSubDocument(cpeMac, subdocId, restored, common.Failure, rollbackMetricsAgent, fields); err != nil {
+		return false, common.NewError(err)
+	}
+
+	lkg.FailedVersion = ""
+	lkg.FailureCount = 0
+	if err := s.SetLastKnownGood(lkg); err != nil {
+		return true, common.NewError(err)
+	}
+
+	tfields := common.FilterLogFields(fields)
+	tfields["subdoc_id"] = subdocId
+	tfields["from_version"] = failedVersion
+	tfields["to_version"] = lkg.Version
+	tfields["failure_count"] = failureCount
+	log.WithFields(tfields).Info("subdoc rolled back to the last known good version")
+
+	event := &common.DeviceEvent{
+		CpeMac:    cpeMac,
+		EventTime: now.UnixMilli(),
+		Event:     common.DeviceEventRollback,
+		SubdocId:  subdocId,
+		Details:   fmt.Sprintf("rolled back from %v to %v after %v failures", failedVersion, lkg.Version, failureCount),
+	}
+	if err := s.AppendDeviceHistory(event); err != nil {
+		log.WithFields(tfields).Warn(err)
+	}
+
+	if s.KafkaProducerEnabled() {
+		s.ForwardRollbackEvent(&common.RollbackEvent{
+			EventName:    common.DeviceEventRollback,
+			DeviceId:     "mac:" + cpeMac,
+			Namespace:    subdocId,
+			FromVersion:  failedVersion,
+			ToVersion:    lkg.Version,
+			FailureCount: failureCount,
+			Timestamp:    now.UnixMilli(),
+		}, fields)
+	}
+
+	if err := s.AutoPoke(cpeMac, make(http.Header), fields); err != nil {
+		return true, common.NewError(err)
+	}
+	return true, nil
+}
+
+func (s *WebconfigServer) ForwardRollbackEvent(event *common.RollbackEvent, fields log.Fields) {
+	tfields := common.CopyCoreLogFields(fields)
+
+	bbytes, err := json.Marshal(event)
+	if err != nil {
+		tfields["logger"] = "error"
+		log.WithFields(tfields).Error(common.NewError(err))
+		return
+	}
+	key := strings.ToLower(event.DeviceId)
+	outMessage := &sarama.ProducerMessage{
+		Topic: s.KafkaProducerTopic(),
+		Key:   sarama.StringEncoder(key),
+		Value: sarama.ByteEncoder(bbytes),
+	}
+	s.Input() <- outMessage
+
+	tfields["logger"] = "kafkaproducer"
+	tfields["output_topic"] = outMessage.Topic
+	tfields["output_key"] = key
+	tfields["output_body"] = event
+	log.WithFields(tfields).Info("send")
+}
@@ -0,0 +1,195 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama/mocks"
+	"github.com/go-akka/configuration"
+	"github.com/google/uuid"
+	"github.com/rdkcentral/webconfig/common"
+	"github.com/rdkcentral/webconfig/util"
+	log "github.com/sirupsen/logrus"
+	"gotest.tools/assert"
+)
+
+func TestRollbackPolicy(t *testing.T) {
+	conf := configuration.ParseString(`
+webconfig.rollback {
+    failure_threshold = 3
+    subdoc_failure_thresholds {
+        wan = 1
+    }
+}`)
+	p := NewRollbackPolicy(conf)
+	assert.Equal(t, p.Threshold("lan"), 3)
+	assert.Equal(t, p.Threshold("wan"), 1)
+}
+
+func TestRollbackFailedSubDocument(t *testing.T) {
+	server := NewWebconfigServer(sc, true)
+	router := server.GetRouter(true)
+	server.SetRollbackPolicy(NewRollbackPolicy(configuration.ParseString(`webconfig.rollback.failure_threshold = 2`)))
+	server.SetSubdocRetryPolicies(nil)
+	cpeMac := util.GenerateRandomCpeMac()
+
+	pconfig := mocks.NewTestConfig()
+	pconfig.Producer.Return.Successes = true
+	producer := mocks.NewAsyncProducer(t, pconfig)
+	defer producer.Close()
+	server.AsyncProducer = producer
+	server.SetKafkaProducerEnabled(true)
+
+	var webpaCount atomic.Int32
+	webpaMockServer := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			webpaCount.Add(1)
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write(mockWebpaPokeResponse)
+		}))
+	defer webpaMockServer.Close()
+	server.SetWebpaHost(webpaMockServer.URL)
+
+	server.SetRootDocument(cpeMac, common.NewRootDocument(0, "fw1", "model1", "comcast", "", "", "", "", ""))
+	subdocId := "lan"
+	url := fmt.Sprintf("/api/v1/device/%v/document/%v", cpeMac, subdocId)
+	postSubdoc := func(bbytes []byte) {
+		req, err := http.NewRequest("POST", url, bytes.NewReader(bbytes))
+		assert.NilError(t, err)
+		req.Header.Set(common.HeaderContentType, common.HeaderApplicationMsgpack)
+		res := ExecuteRequest(req, router).Result()
+		_, err = io.ReadAll(res.Body)
+		assert.NilError(t, err)
+		res.Body.Close()
+		assert.Equal(t, res.StatusCode, http.StatusOK)
+	}
+	notify := func(applicationStatus string) {
+		m := common.EventMessage{
+			DeviceId:          "mac:" + cpeMac,
+			Namespace:         &subdocId,
+			ApplicationStatus: &applicationStatus,
+		}
+		bbytes, err := json.Marshal(m)
+		assert.NilError(t, err)
+		_, _, err = server.HandleStateNotification(bbytes, log.Fields{})
+		assert.NilError(t, err)
+	}
+
+	// ==== v1 deployed becomes the last known good ====
+	v1 := common.RandomBytes(50, 100)
+	postSubdoc(v1)
+	notify("success")
+	lkg, err := server.GetLastKnownGood(cpeMac, subdocId)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, lkg.Payload, v1)
+	assert.Equal(t, lkg.Version, util.GetMurmur3Hash(v1))
+
+	// ==== v2 fails below the threshold ====
+	v2 := common.RandomBytes(50, 100)
+	postSubdoc(v2)
+	notify("failure")
+	lkg, err = server.GetLastKnownGood(cpeMac, subdocId)
+	assert.NilError(t, err)
+	assert.Equal(t, lkg.FailedVersion, util.GetMurmur3Hash(v2))
+	assert.Equal(t, lkg.FailureCount, 1)
+	assert.Equal(t, webpaCount.Load(), int32(0))
+
+	// ==== rolled back at the threshold ====
+	subdoc, err := server.GetSubDocument(cpeMac, subdocId)
+	assert.NilError(t, err)
+	state := common.PendingDownload
+	subdoc.SetState(&state)
+	err = server.SetSubDocument(cpeMac, subdocId, subdoc)
+	assert.NilError(t, err)
+
+	producer.ExpectInputAndSucceed()
+	notify("failure")
+	subdoc, err = server.GetSubDocument(cpeMac, subdocId)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, subdoc.Payload(), v1)
+	assert.Equal(t, subdoc.GetVersion(), util.GetMurmur3Hash(v1))
+	assert.Equal(t, *subdoc.State(), common.PendingDownload)
+	assert.Equal(t, webpaCount.Load(), int32(1))
+
+	msg := <-producer.Successes()
+	vbytes, err := msg.Value.Encode()
+	assert.NilError(t, err)
+	var event common.RollbackEvent
+	err = json.Unmarshal(vbytes, &event)
+	assert.NilError(t, err)
+	assert.Equal(t, event.EventName, common.DeviceEventRollback)
+	assert.Equal(t, event.Namespace, subdocId)
+	assert.Equal(t, event.FromVersion, util.GetMurmur3Hash(v2))
+	assert.Equal(t, event.ToVersion, util.GetMurmur3Hash(v1))
+	assert.Equal(t, event.FailureCount, 2)
+
+	// ==== recorded in the device history ====
+	req, err := http.NewRequest("GET", fmt.Sprintf("/api/v1/device/%v/history", cpeMac), nil)
+	assert.NilError(t, err)
+	res := ExecuteRequest(req, router).Result()
+	rbytes, err := io.ReadAll(res.Body)
+	assert.NilError(t, err)
+	res.Body.Close()
+	assert.Equal(t, res.StatusCode, http.StatusOK)
+	var resp struct {
+		Data []*common.DeviceEvent `json:"data"`
+	}
+	err = json.Unmarshal(rbytes, &resp)
+	assert.NilError(t, err)
+	assert.Equal(t, len(resp.Data), 1)
+	assert.Equal(t, resp.Data[0].Event, common.DeviceEventRollback)
+	assert.Equal(t, resp.Data[0].SubdocId, subdocId)
+
+	lkg, err = server.GetLastKnownGood(cpeMac, subdocId)
+	assert.NilError(t, err)
+	assert.Equal(t, lkg.FailureCount, 0)
+}
+
+func TestRecordLastKnownGoodRefSubDocument(t *testing.T) {
+	server := NewWebconfigServer(sc, true)
+	cpeMac := util.GenerateRandomCpeMac()
+	subdocId := "defaultrfc"
+
+	// the reference is kept, not the payload it resolves to
+	refId := uuid.New().String()
+	version := util.GenerateRandomCpeMac()
+	err := server.SetRefSubDocument(refId, common.NewRefSubDocument(common.RandomBytes(100, 150), &version))
+	assert.NilError(t, err)
+	refPayload := append(make([]byte, 4), []byte(refId)...)
+
+	state := common.Deployed
+	updatedTime := int(time.Now().UnixMilli())
+	subdoc := common.NewSubDocument(refPayload, &version, &state, &updatedTime, nil, nil)
+	err = server.SetSubDocument(cpeMac, subdocId, subdoc)
+	assert.NilError(t, err)
+
+	err = server.RecordLastKnownGood(cpeMac, subdocId)
+	assert.NilError(t, err)
+	lkg, err := server.GetLastKnownGood(cpeMac, subdocId)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, lkg.Payload, refPayload)
+}
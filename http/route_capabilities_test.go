@@ -0,0 +1,125 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package http
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-akka/configuration"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/rdkcentral/webconfig/common"
+	"github.com/rdkcentral/webconfig/security"
+	"github.com/rdkcentral/webconfig/util"
+	"gotest.tools/assert"
+)
+
+// setupApiTokenAuth enables the api token auth of the server with a generated key, and
+// returns a func to sign api tokens
+func setupApiTokenAuth(t *testing.T, server *WebconfigServer) func(jwt.MapClaims) string {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NilError(t, err)
+	dir := t.TempDir()
+	privateKeyFile := filepath.Join(dir, "key.pem")
+	publicKeyFile := filepath.Join(dir, "key_pub.pem")
+	pbytes, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	assert.NilError(t, err)
+	err = os.WriteFile(privateKeyFile, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}), 0600)
+	assert.NilError(t, err)
+	err = os.WriteFile(publicKeyFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pbytes}), 0600)
+	assert.NilError(t, err)
+
+	conf := configuration.ParseString(fmt.Sprintf(`
+webconfig.jwt {
+    api_token {
+        kids = ["webconfig_key"]
+        capabilities = ["webconfig:all"]
+    }
+    kid.webconfig_key {
+        public_key_file = "%v"
+        private_key_file = "%v"
+    }
+}`, publicKeyFile, privateKeyFile))
+	server.TokenManager = security.NewTokenManager(conf)
+	server.SetServerApiTokenAuthEnabled(true)
+
+	return func(claims jwt.MapClaims) string {
+		claims["exp"] = time.Now().Add(time.Hour).Unix()
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "webconfig_key"
+		tokenStr, err := token.SignedString(key)
+		assert.NilError(t, err)
+		return tokenStr
+	}
+}
+
+// callWithApiToken returns the status of an api call with a token
+func callWithApiToken(t *testing.T, router http.Handler, method, url string, body []byte, token string) int {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	assert.NilError(t, err)
+	req.Header.Set(common.HeaderContentType, common.HeaderApplicationMsgpack)
+	req.Header.Set("Authorization", "Bearer "+token)
+	res := ExecuteRequest(req, router).Result()
+	_, err = io.ReadAll(res.Body)
+	assert.NilError(t, err)
+	res.Body.Close()
+	return res.StatusCode
+}
+
+func TestApiMiddlewareRouteCapabilities(t *testing.T) {
+	server := NewWebconfigServer(sc, true)
+	signToken := setupApiTokenAuth(t, server)
+	router := server.GetRouter(false)
+
+	newToken := func(capabilities ...string) string {
+		return signToken(jwt.MapClaims{"capabilities": capabilities})
+	}
+	call := func(method, url string, body []byte, token string) int {
+		return callWithApiToken(t, router, method, url, body, token)
+	}
+
+	cpeMac := util.GenerateRandomCpeMac()
+	server.SetRootDocument(cpeMac, common.NewRootDocument(0, "fw1", "model1", "comcast", "", "", "", "", ""))
+	url := fmt.Sprintf("/api/v1/device/%v/document/lan", cpeMac)
+	bbytes := common.RandomBytes(50, 100)
+	readToken := newToken(security.CapabilityDocumentRead)
+	writeToken := newToken(security.CapabilityDocumentRead, security.CapabilityDocumentWrite)
+	fullToken := newToken("webconfig:all")
+
+	// ==== a read only token cannot write or delete ====
+	assert.Equal(t, call("POST", url, bbytes, readToken), http.StatusForbidden)
+	assert.Equal(t, call("POST", url, bbytes, writeToken), http.StatusOK)
+	assert.Equal(t, call("GET", url, nil, readToken), http.StatusOK)
+	assert.Equal(t, call("DELETE", url, nil, writeToken), http.StatusForbidden)
+
+	// ==== the unmapped routes need the full access ====
+	assert.Equal(t, call("GET", "/api/v1/stuck_deployments", nil, writeToken), http.StatusForbidden)
+
+	// ==== the full access token is good for all ====
+	assert.Equal(t, call("DELETE", url, nil, fullToken), http.StatusOK)
+}
@@ -31,9 +31,31 @@ func (s *WebconfigServer) AddBaseRoutes(testOnly bool, router *mux.Router) {
 	r2 := router.Path("/version").Subrouter()
 	r2.HandleFunc("", s.VersionHandler).Methods("GET")
 
+	// the config is redacted, and still only for the api callers
 	r3 := router.Path("/config").Subrouter()
+	if testOnly {
+		r3.Use(s.TestingMiddleware)
+	} else {
+		if s.ServerApiTokenAuthEnabled() {
+			r3.Use(s.ApiMiddleware)
+		} else {
+			r3.Use(s.NoAuthMiddleware)
+		}
+	}
 	r3.HandleFunc("", s.ServerConfigHandler).Methods("GET")
 
+	r7 := router.Path("/config/sample_diff").Subrouter()
+	if testOnly {
+		r7.Use(s.TestingMiddleware)
+	} else {
+		if s.ServerApiTokenAuthEnabled() {
+			r7.Use(s.ApiMiddleware)
+		} else {
+			r7.Use(s.NoAuthMiddleware)
+		}
+	}
+	r7.HandleFunc("", s.ServerConfigSampleDiffHandler).Methods("GET")
+
 	if s.TokenApiEnabled() {
 		r4 := router.Path("/api/v1/token").Subrouter()
 		r4.Use(s.NoAuthMiddleware)
@@ -44,12 +66,25 @@ func (s *WebconfigServer) AddBaseRoutes(testOnly bool, router *mux.Router) {
 	r5 := router.Path("/notif").Subrouter()
 	r5.HandleFunc("", s.NotificationHandler).Methods("GET")
 
+	// the breaker states reveal the upstream health, so the same api auth as /config
+	r6 := router.Path("/healthz/circuit_breakers").Subrouter()
+	if testOnly {
+		r6.Use(s.TestingMiddleware)
+	} else {
+		if s.ServerApiTokenAuthEnabled() {
+			r6.Use(s.ApiMiddleware)
+		} else {
+			r6.Use(s.NoAuthMiddleware)
+		}
+	}
+	r6.HandleFunc("", s.CircuitBreakersHandler).Methods("GET")
+
 	// msgpack multipart
 	sub2 := router.Path("/api/v1/device/{mac}/config").Subrouter()
 	if testOnly {
 		sub2.Use(s.TestingMiddleware)
 	} else {
-		if s.DeviceApiTokenAuthEnabled() {
+		if s.DeviceApiTokenAuthEnabled() || s.DeviceAuth() != nil {
 			sub2.Use(s.CpeMiddleware)
 		} else {
 			sub2.Use(s.NoAuthMiddleware)
@@ -86,6 +121,7 @@ func (s *WebconfigServer) GetRouter(testOnly bool) *mux.Router {
 			sub1.Use(s.NoAuthMiddleware)
 		}
 	}
+	sub1.Use(s.AuditMiddleware)
 	sub1.HandleFunc("", s.GetSubDocumentHandler).Methods("GET")
 	sub1.HandleFunc("", s.PostSubDocumentHandler).Methods("POST")
 	sub1.HandleFunc("", s.DeleteSubDocumentHandler).Methods("DELETE")
@@ -100,6 +136,7 @@ func (s *WebconfigServer) GetRouter(testOnly bool) *mux.Router {
 			sub2.Use(s.SpanMiddleware, s.NoAuthMiddleware)
 		}
 	}
+	sub2.Use(s.AuditMiddleware)
 	sub2.HandleFunc("", s.PokeHandler).Methods("POST")
 
 	sub3 := router.Path("/api/v1/device/{mac}/rootdocument").Subrouter()
@@ -112,6 +149,7 @@ func (s *WebconfigServer) GetRouter(testOnly bool) *mux.Router {
 			sub3.Use(s.NoAuthMiddleware)
 		}
 	}
+	sub3.Use(s.AuditMiddleware)
 	sub3.HandleFunc("", s.GetRootDocumentHandler).Methods("GET")
 	sub3.HandleFunc("", s.PostRootDocumentHandler).Methods("POST")
 
@@ -125,6 +163,7 @@ func (s *WebconfigServer) GetRouter(testOnly bool) *mux.Router {
 			sub4.Use(s.NoAuthMiddleware)
 		}
 	}
+	sub4.Use(s.AuditMiddleware)
 	sub4.HandleFunc("", s.DeleteDocumentHandler).Methods("DELETE")
 
 	sub5 := router.Path("/api/v1/reference/{ref}/document").Subrouter()
@@ -137,9 +176,135 @@ func (s *WebconfigServer) GetRouter(testOnly bool) *mux.Router {
 			sub5.Use(s.NoAuthMiddleware)
 		}
 	}
+	sub5.Use(s.AuditMiddleware)
 	sub5.HandleFunc("", s.GetRefSubDocumentHandler).Methods("GET")
 	sub5.HandleFunc("", s.PostRefSubDocumentHandler).Methods("POST")
 	sub5.HandleFunc("", s.DeleteRefSubDocumentHandler).Methods("DELETE")
 
+	sub6 := router.Path("/api/v1/kafka/consumer_groups").Subrouter()
+	if testOnly {
+		sub6.Use(s.TestingMiddleware)
+	} else {
+		if s.ServerApiTokenAuthEnabled() {
+			sub6.Use(s.ApiMiddleware)
+		} else {
+			sub6.Use(s.NoAuthMiddleware)
+		}
+	}
+	sub6.HandleFunc("", s.GetKafkaConsumerGroupsHandler).Methods("GET")
+
+	sub7 := router.PathPrefix("/api/v1/kafka/consumer_groups/{cluster}").Subrouter()
+	if testOnly {
+		sub7.Use(s.TestingMiddleware)
+	} else {
+		if s.ServerApiTokenAuthEnabled() {
+			sub7.Use(s.ApiMiddleware)
+		} else {
+			sub7.Use(s.NoAuthMiddleware)
+		}
+	}
+	sub7.Use(s.AuditMiddleware)
+	sub7.HandleFunc("/pause", s.PauseKafkaConsumerGroupHandler).Methods("POST")
+	sub7.HandleFunc("/resume", s.ResumeKafkaConsumerGroupHandler).Methods("POST")
+	sub7.HandleFunc("/seek", s.SeekKafkaConsumerGroupHandler).Methods("POST")
+
+	sub8 := router.Path("/api/v1/pokes").Subrouter()
+	if testOnly {
+		sub8.Use(s.TestingMiddleware)
+	} else {
+		if s.ServerApiTokenAuthEnabled() {
+			sub8.Use(s.ApiMiddleware)
+		} else {
+			sub8.Use(s.NoAuthMiddleware)
+		}
+	}
+	sub8.HandleFunc("", s.GetPokeQueueHandler).Methods("GET")
+
+	sub9 := router.Path("/api/v1/pokes/{transaction_id}").Subrouter()
+	if testOnly {
+		sub9.Use(s.TestingMiddleware)
+	} else {
+		if s.ServerApiTokenAuthEnabled() {
+			sub9.Use(s.ApiMiddleware)
+		} else {
+			sub9.Use(s.NoAuthMiddleware)
+		}
+	}
+	sub9.HandleFunc("", s.GetPokeStatusHandler).Methods("GET")
+
+	sub10 := router.Path("/api/v1/stuck_deployments").Subrouter()
+	if testOnly {
+		sub10.Use(s.TestingMiddleware)
+	} else {
+		if s.ServerApiTokenAuthEnabled() {
+			sub10.Use(s.ApiMiddleware)
+		} else {
+			sub10.Use(s.NoAuthMiddleware)
+		}
+	}
+	sub10.HandleFunc("", s.GetStuckDeploymentsHandler).Methods("GET")
+
+	sub11 := router.Path("/api/v1/device/{mac}/history").Subrouter()
+	if testOnly {
+		sub11.Use(s.TestingMiddleware)
+	} else {
+		if s.ServerApiTokenAuthEnabled() {
+			sub11.Use(s.ApiMiddleware)
+		} else {
+			sub11.Use(s.NoAuthMiddleware)
+		}
+	}
+	sub11.HandleFunc("", s.GetDeviceHistoryHandler).Methods("GET")
+
+	sub12 := router.Path("/api/v1/device/{mac}/deployment").Subrouter()
+	if testOnly {
+		sub12.Use(s.TestingMiddleware)
+	} else {
+		if s.ServerApiTokenAuthEnabled() {
+			sub12.Use(s.ApiMiddleware)
+		} else {
+			sub12.Use(s.NoAuthMiddleware)
+		}
+	}
+	sub12.Use(s.AuditMiddleware)
+	sub12.HandleFunc("", s.PostDeploymentGroupHandler).Methods("POST")
+
+	sub13 := router.Path("/api/v1/audit").Subrouter()
+	if testOnly {
+		sub13.Use(s.TestingMiddleware)
+	} else {
+		if s.ServerApiTokenAuthEnabled() {
+			sub13.Use(s.ApiMiddleware)
+		} else {
+			sub13.Use(s.NoAuthMiddleware)
+		}
+	}
+	sub13.HandleFunc("", s.GetAuditRecordsHandler).Methods("GET")
+
+	sub14 := router.Path("/api/v1/token/revocations").Subrouter()
+	if testOnly {
+		sub14.Use(s.TestingMiddleware)
+	} else {
+		if s.ServerApiTokenAuthEnabled() {
+			sub14.Use(s.ApiMiddleware)
+		} else {
+			sub14.Use(s.NoAuthMiddleware)
+		}
+	}
+	sub14.Use(s.AuditMiddleware)
+	sub14.HandleFunc("", s.PostTokenRevocationHandler).Methods("POST")
+
+	sub15 := router.Path("/api/v1/token/introspect").Subrouter()
+	if testOnly {
+		sub15.Use(s.TestingMiddleware)
+	} else {
+		if s.ServerApiTokenAuthEnabled() {
+			sub15.Use(s.ApiMiddleware)
+		} else {
+			sub15.Use(s.NoAuthMiddleware)
+		}
+	}
+	sub15.HandleFunc("", s.IntrospectTokenHandler).Methods("POST")
+
 	return router
 }
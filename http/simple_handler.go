@@ -21,7 +21,9 @@ import (
 	"fmt"
 	"net/http"
 
+	"github.com/go-akka/configuration"
 	"github.com/rdkcentral/webconfig/common"
+	"github.com/rdkcentral/webconfig/config"
 )
 
 func (s *WebconfigServer) VersionHandler(w http.ResponseWriter, r *http.Request) {
@@ -40,6 +42,26 @@ func (s *WebconfigServer) MonitorHandler(w http.ResponseWriter, r *http.Request)
 	w.Header().Set("Content-length", "0")
 }
 
+// CircuitBreakersHandler reports the state of the connector circuit breakers.
+// It returns 503 when any of them is not closed.
+func (s *WebconfigServer) CircuitBreakersHandler(w http.ResponseWriter, r *http.Request) {
+	statuses := []CircuitBreakerStatus{}
+	status := http.StatusOK
+	for _, b := range s.CircuitBreakers() {
+		x := b.Status()
+		if x.State != CircuitBreakerClosed.String() {
+			status = http.StatusServiceUnavailable
+		}
+		statuses = append(statuses, x)
+	}
+	resp := common.HttpResponse{
+		Status:  status,
+		Message: http.StatusText(status),
+		Data:    statuses,
+	}
+	WriteByMarshal(w, status, resp)
+}
+
 func (s *WebconfigServer) NotificationHandler(w http.ResponseWriter, r *http.Request) {
 	_, err := getValue()
 	if err != nil {
@@ -49,9 +71,18 @@ func (s *WebconfigServer) NotificationHandler(w http.ResponseWriter, r *http.Req
 	WriteOkResponse(w, nil)
 }
 
+// ServerConfigHandler returns the config as a structured view with the secrets, the files and the
+// hosts masked
 func (s *WebconfigServer) ServerConfigHandler(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusOK)
-	w.Write(s.ConfigBytes())
+	WriteOkResponse(w, common.RedactedConfig(s.ServerConfig.Config))
+}
+
+// ServerConfigSampleDiffHandler lists the settings that differ from the sample config, redacted
+// the same way. It is a diff against the sample config, not the defaults in the code, a setting
+// missing from both is not listed.
+func (s *WebconfigServer) ServerConfigSampleDiffHandler(w http.ResponseWriter, r *http.Request) {
+	sample := configuration.ParseString(string(config.SampleConfig))
+	WriteOkResponse(w, common.DiffConfig(s.ServerConfig.Config, sample))
 }
 
 func getValue() (string, error) {
@@ -18,11 +18,17 @@
 package http
 
 import (
+	"bytes"
+	"encoding/json"
 	"io"
 	"net/http"
+	"os"
 	"testing"
 
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/rdkcentral/webconfig/common"
+	"github.com/rdkcentral/webconfig/config"
+	"github.com/rdkcentral/webconfig/security"
 	"gotest.tools/assert"
 )
 
@@ -76,3 +82,98 @@ func TestNotifHandler(t *testing.T) {
 	res.Body.Close()
 	assert.Equal(t, res.StatusCode, http.StatusInternalServerError)
 }
+
+func TestServerConfigHandler(t *testing.T) {
+	server := NewWebconfigServer(sc, true)
+	router := server.GetRouter(true)
+
+	req, err := http.NewRequest("GET", "/config", nil)
+	assert.NilError(t, err)
+	res := ExecuteRequest(req, router).Result()
+	assert.Equal(t, res.StatusCode, http.StatusOK)
+	rbytes, err := io.ReadAll(res.Body)
+	assert.NilError(t, err)
+	res.Body.Close()
+
+	var resp struct {
+		Data struct {
+			Webconfig struct {
+				Database struct {
+					Cassandra map[string]interface{} `json:"cassandra"`
+				} `json:"database"`
+				Server map[string]interface{} `json:"server"`
+			} `json:"webconfig"`
+		} `json:"data"`
+	}
+	err = json.Unmarshal(rbytes, &resp)
+	assert.NilError(t, err)
+	cassandra := resp.Data.Webconfig.Database.Cassandra
+	assert.Equal(t, cassandra["encrypted_password"], "****")
+	assert.Equal(t, cassandra["hosts"], "****")
+	assert.Equal(t, resp.Data.Webconfig.Server["port"], float64(9007))
+	assert.Assert(t, !bytes.Contains(rbytes, []byte("/tmp/server_key.pem")))
+}
+
+func TestServerConfigSampleDiffHandler(t *testing.T) {
+	// the sample config with a changed, an added and two sensitive settings
+	overrides := `
+webconfig.server.port = 9999
+webconfig.server.extra_enabled = true
+webconfig.server.extra_key_file = "/tmp/extra_key.pem"
+webconfig.database.cassandra.encrypted_password = "changed_secret"
+`
+	f, err := os.CreateTemp(t.TempDir(), "webconfig_*.conf")
+	assert.NilError(t, err)
+	_, err = f.Write(append(config.SampleConfig, []byte(overrides)...))
+	assert.NilError(t, err)
+	f.Close()
+	tsc, err := common.NewServerConfig(f.Name())
+	assert.NilError(t, err)
+
+	server := NewWebconfigServer(sc, true)
+	server.ServerConfig = tsc
+	router := server.GetRouter(true)
+
+	req, err := http.NewRequest("GET", "/config/sample_diff", nil)
+	assert.NilError(t, err)
+	res := ExecuteRequest(req, router).Result()
+	assert.Equal(t, res.StatusCode, http.StatusOK)
+	rbytes, err := io.ReadAll(res.Body)
+	assert.NilError(t, err)
+	res.Body.Close()
+	var diffs struct {
+		Data []common.ConfigDiff `json:"data"`
+	}
+	err = json.Unmarshal(rbytes, &diffs)
+	assert.NilError(t, err)
+
+	// a sensitive setting is masked when added, and not listed when changed since both
+	// sides are masked
+	expected := []common.ConfigDiff{
+		{Path: "webconfig.server.extra_enabled", Value: true},
+		{Path: "webconfig.server.extra_key_file", Value: "****"},
+		{Path: "webconfig.server.port", Value: float64(9999), Sample: float64(9007)},
+	}
+	assert.DeepEqual(t, diffs.Data, expected)
+	assert.Assert(t, !bytes.Contains(rbytes, []byte("/tmp/extra_key.pem")))
+	assert.Assert(t, !bytes.Contains(rbytes, []byte("changed_secret")))
+}
+
+func TestServerConfigHandlerApiAuth(t *testing.T) {
+	server := NewWebconfigServer(sc, true)
+	signToken := setupApiTokenAuth(t, server)
+	router := server.GetRouter(false)
+
+	req, err := http.NewRequest("GET", "/config", nil)
+	assert.NilError(t, err)
+	res := ExecuteRequest(req, router).Result()
+	res.Body.Close()
+	assert.Equal(t, res.StatusCode, http.StatusForbidden)
+
+	token := signToken(jwt.MapClaims{"capabilities": []string{security.CapabilityConfigRead}})
+	assert.Equal(t, callWithApiToken(t, router, "GET", "/config", nil, token), http.StatusOK)
+	assert.Equal(t, callWithApiToken(t, router, "GET", "/config/sample_diff", nil, token), http.StatusOK)
+
+	token = signToken(jwt.MapClaims{"capabilities": []string{security.CapabilityDocumentRead}})
+	assert.Equal(t, callWithApiToken(t, router, "GET", "/config", nil, token), http.StatusForbidden)
+}
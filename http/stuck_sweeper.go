@@ -0,0 +1,464 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package http
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-akka/configuration"
+	"github.com/google/uuid"
+	"github.com/rdkcentral/webconfig/common"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultStuckSweeperIntervalInSecs  = 300
+	defaultStuckSweeperThresholdInSecs = 3600
+	defaultStuckSweeperMaxPokes        = 3
+	defaultStuckSweeperLeaseInSecs     = 600
+	stuckSweeperLeaseName              = "stuck_sweeper"
+	stuckSweeperMetricsAgent           = "stuck_sweeper"
+	stuckSweeperPageSize               = 500
+	defaultStuckDeploymentsLimit       = 100
+)
+
+var stuckStates = common.StaleIndexStates
+
+// StuckDeployment is a stuck subdoc and the remediation planned for it
+type StuckDeployment struct {
+	CpeMac        string `json:"cpe_mac"`
+	SubdocId      string `json:"subdoc_id"`
+	State         int    `json:"state"`
+	UpdatedTime   int64  `json:"updated_time"`
+	EffectiveTime int64  `json:"effective_time,omitempty"`
+	StuckSecs     int64  `json:"stuck_secs"`
+	Attempts      int    `json:"attempts"`
+	Action        string `json:"action"`
+}
+
+// StuckDeploymentsPage is a page of the dry-run report. NextCursor is empty on
+// the last page.
+type StuckDeploymentsPage struct {
+	StuckDeployments []*StuckDeployment `json:"stuck_deployments"`
+	NextCursor       string             `json:"next_cursor,omitempty"`
+}
+
+// stuckCursor is the position of a scan of the stale subdoc index, the
+// (state, bucket) partition and the db page in it
+type stuckCursor struct {
+	StateIndex int    `json:"state_index"`
+	Bucket     int64  `json:"bucket"`
+	PageState  []byte `json:"page_state,omitempty"`
+}
+
+func (c *stuckCursor) String() string {
+	bbytes, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(bbytes)
+}
+
+func parseStuckCursor(s string) (*stuckCursor, error) {
+	bbytes, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, common.NewError(err)
+	}
+	var cursor stuckCursor
+	if err := json.Unmarshal(bbytes, &cursor); err != nil {
+		return nil, common.NewError(err)
+	}
+	if cursor.StateIndex < 0 || cursor.StateIndex >= len(stuckStates) {
+		return nil, fmt.Errorf("invalid state_index %v", cursor.StateIndex)
+	}
+	return &cursor, nil
+}
+
+// StuckSweeper finds the subdocs left in PendingDownload or InDeployment longer
+// than their threshold, counted from the later of updated_time, effective_time and
+// retry_time. The subdocs not effective yet are skipped. They are poked up to
+// maxPokes times, one threshold apart, and then marked as failure. Only the
+// replica holding the lease sweeps.
+type StuckSweeper struct {
+	interval   time.Duration
+	threshold  time.Duration
+	thresholds map[string]time.Duration
+	maxPokes   int
+	leaseSecs  int
+	owner      string
+}
+
+func NewStuckSweeper(conf *configuration.Config) *StuckSweeper {
+	intervalInSecs := conf.GetInt32("webconfig.stuck_sweeper.interval_in_secs", defaultStuckSweeperIntervalInSecs)
+	thresholdInSecs := conf.GetInt32("webconfig.stuck_sweeper.threshold_in_secs", defaultStuckSweeperThresholdInSecs)
+	maxPokes := conf.GetInt32("webconfig.stuck_sweeper.max_pokes", defaultStuckSweeperMaxPokes)
+	leaseInSecs := conf.GetInt32("webconfig.stuck_sweeper.lease_in_secs", defaultStuckSweeperLeaseInSecs)
+
+	thresholds := map[string]time.Duration{}
+	path := "webconfig.stuck_sweeper.subdoc_thresholds_in_secs"
+	if node := conf.GetNode(path); node != nil && node.IsObject() {
+		for _, subdocId := range node.GetObject().GetKeys() {
+			secs := conf.GetInt32(path+"."+subdocId, thresholdInSecs)
+			thresholds[subdocId] = time.Duration(secs) * time.Second
+		}
+	}
+
+	return &StuckSweeper{
+		interval:   time.Duration(intervalInSecs) * time.Second,
+		threshold:  time.Duration(thresholdInSecs) * time.Second,
+		thresholds: thresholds,
+		maxPokes:   int(maxPokes),
+		leaseSecs:  int(leaseInSecs),
+		owner:      uuid.New().String(),
+	}
+}
+
+func (w *StuckSweeper) Interval() time.Duration {
+	return w.interval
+}
+
+func (w *StuckSweeper) MaxPokes() int {
+	return w.maxPokes
+}
+
+func (w *StuckSweeper) SetMaxPokes(maxPokes int) {
+	w.maxPokes = maxPokes
+}
+
+func (w *StuckSweeper) Owner() string {
+	return w.owner
+}
+
+// Threshold returns the threshold of the subdoc or the default one
+func (w *StuckSweeper) Threshold(subdocId string) time.Duration {
+	if x, ok := w.thresholds[subdocId]; ok {
+		return x
+	}
+	return w.threshold
+}
+
+func (w *StuckSweeper) SetThreshold(subdocId string, threshold time.Duration) {
+	w.thresholds[subdocId] = threshold
+}
+
+// minThreshold bounds the buckets of the index to scan
+func (w *StuckSweeper) minThreshold() time.Duration {
+	threshold := w.threshold
+	for _, x := range w.thresholds {
+		if x < threshold {
+			threshold = x
+		}
+	}
+	return threshold
+}
+
+func (s *WebconfigServer) StuckSweeper() *StuckSweeper {
+	return s.stuckSweeper
+}
+
+func (s *WebconfigServer) SetStuckSweeper(w *StuckSweeper) {
+	s.stuckSweeper = w
+}
+
+// RunStuckSweeper sweeps periodically until ctx is done. A round is skipped if
+// another replica holds the lease.
+func (s *WebconfigServer) RunStuckSweeper(ctx context.Context) {
+	fields := log.Fields{
+		"logger": "stuck_sweeper",
+		"owner":  s.stuckSweeper.Owner(),
+	}
+	ticker := time.NewTicker(s.stuckSweeper.Interval())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case t := <-ticker.C:
+			ok, err := s.AcquireLease(stuckSweeperLeaseName, s.stuckSweeper.Owner(), s.stuckSweeper.leaseSecs)
+			if err != nil {
+				log.WithFields(fields).Error(err)
+				continue
+			}
+			if !ok {
+				continue
+			}
+			if _, err := s.SweepStuckDeployments(t, false); err != nil {
+				log.WithFields(fields).Error(err)
+			}
+		}
+	}
+}
+
+// scanStuckSubDocuments reads up to limit entries of the stale subdoc index from
+// cursor, or from the start if it is nil. The buckets scanned are those of the
+// index TTL up to the smallest threshold before now. The returned cursor is nil
+// after the last entry.
+func (s *WebconfigServer) scanStuckSubDocuments(now time.Time, cursor *stuckCursor, limit int) ([]*common.StuckSubDocument, *stuckCursor, error) {
+	firstBucket := common.StaleIndexBucket(now.Add(-common.StaleIndexTTLSecs * time.Second).UnixMilli())
+	lastBucket := common.StaleIndexBucket(now.Add(-s.stuckSweeper.minThreshold()).UnixMilli())
+
+	c := stuckCursor{Bucket: firstBucket}
+	if cursor != nil {
+		c = *cursor
+	}
+	if c.Bucket < firstBucket {
+		c.Bucket = firstBucket
+		c.PageState = nil
+	}
+
+	subdocs := []*common.StuckSubDocument{}
+	for c.StateIndex < len(stuckStates) {
+		if c.Bucket > lastBucket {
+			c = stuckCursor{StateIndex: c.StateIndex + 1, Bucket: firstBucket}
+			continue
+		}
+		if len(subdocs) >= limit {
+			return subdocs, &c, nil
+		}
+		page, pageState, err := s.GetStaleSubDocuments(stuckStates[c.StateIndex], c.Bucket, c.PageState, limit-len(subdocs))
+		if err != nil {
+			return nil, nil, common.NewError(err)
+		}
+		subdocs = append(subdocs, page...)
+		if len(pageState) > 0 {
+			c.PageState = pageState
+		} else {
+			c.Bucket++
+			c.PageState = nil
+		}
+	}
+	return subdocs, nil, nil
+}
+
+// SweepStuckDeployments plans the remediation of the stuck subdocs at now and
+// applies it unless dryRun is set
+func (s *WebconfigServer) SweepStuckDeployments(now time.Time, dryRun bool) ([]*StuckDeployment, error) {
+	stucks := []*StuckDeployment{}
+	var cursor *stuckCursor
+	for {
+		candidates, next, err := s.scanStuckSubDocuments(now, cursor, stuckSweeperPageSize)
+		if err != nil {
+			return nil, common.NewError(err)
+		}
+		page, err := s.planStuckDeployments(now, candidates, dryRun)
+		if err != nil {
+			return nil, common.NewError(err)
+		}
+		stucks = append(stucks, page...)
+		if next == nil {
+			break
+		}
+		cursor = next
+	}
+
+	if dryRun {
+		return stucks, nil
+	}
+
+	// one poke per device delivers all its subdocs
+	poked := map[string]bool{}
+	for _, stuck := range stucks {
+		if stuck.Action != common.RemediationPoke || poked[stuck.CpeMac] {
+			continue
+		}
+		poked[stuck.CpeMac] = true
+		fields := log.Fields{
+			"logger":  "stuck_sweeper",
+			"cpe_mac": stuck.CpeMac,
+		}
+		if err := s.AutoPoke(stuck.CpeMac, make(http.Header), fields); err != nil {
+			log.WithFields(fields).Warn(err)
+		}
+	}
+	return stucks, nil
+}
+
+// planStuckDeployments checks the index entries against the subdocs, plans the
+// remediation of the stuck ones and applies it unless dryRun is set. The pokes
+// are left to the caller.
+func (s *WebconfigServer) planStuckDeployments(now time.Time, candidates []*common.StuckSubDocument, dryRun bool) ([]*StuckDeployment, error) {
+	sweeper := s.stuckSweeper
+	nowMs := now.UnixMilli()
+
+	stucks := []*StuckDeployment{}
+	for _, candidate := range candidates {
+		// the entries of the subdocs written again since are outdated
+		subdoc, err := s.GetSubDocument(candidate.CpeMac, candidate.SubdocId)
+		if err != nil {
+			if s.IsDbNotFound(err) {
+				continue
+			}
+			return nil, common.NewError(err)
+		}
+		if subdoc.State() == nil || *subdoc.State() != candidate.State || subdoc.UpdatedTime() == nil || int64(*subdoc.UpdatedTime()) != candidate.UpdatedTime {
+			continue
+		}
+		if !subdoc.IsEffective(int(nowMs)) {
+			continue
+		}
+		var effectiveTime int64
+		if subdoc.EffectiveTime() != nil {
+			effectiveTime = int64(*subdoc.EffectiveTime())
+		}
+		since := max(candidate.UpdatedTime, int64(subdoc.HeldUntil()))
+		threshold := sweeper.Threshold(candidate.SubdocId).Milliseconds()
+		if nowMs-since < threshold {
+			continue
+		}
+
+		// the attempts are reset if the subdoc was written again since
+		remediation, err := s.GetRemediation(candidate.CpeMac, candidate.SubdocId)
+		if err != nil && !s.IsDbNotFound(err) {
+			return nil, common.NewError(err)
+		}
+		if remediation == nil || remediation.UpdatedTime != candidate.UpdatedTime {
+			remediation = &common.Remediation{
+				CpeMac:      candidate.CpeMac,
+				SubdocId:    candidate.SubdocId,
+				UpdatedTime: candidate.UpdatedTime,
+			}
+		}
+
+		action := common.RemediationWait
+		if nowMs-remediation.LastPokeTime >= threshold {
+			if remediation.Attempts < sweeper.MaxPokes() {
+				action = common.RemediationPoke
+			} else {
+				action = common.RemediationFail
+			}
+		}
+		stucks = append(stucks, &StuckDeployment{
+			CpeMac:        candidate.CpeMac,
+			SubdocId:      candidate.SubdocId,
+			State:         candidate.State,
+			UpdatedTime:   candidate.UpdatedTime,
+			EffectiveTime: effectiveTime,
+			StuckSecs:     (nowMs - since) / 1000,
+			Attempts:      remediation.Attempts,
+			Action:        action,
+		})
+		if dryRun {
+			continue
+		}
+
+		fields := log.Fields{
+			"logger":    "stuck_sweeper",
+			"cpe_mac":   candidate.CpeMac,
+			"subdoc_id": candidate.SubdocId,
+			"attempts":  remediation.Attempts,
+		}
+		switch action {
+		case common.RemediationPoke:
+			remediation.Attempts++
+			remediation.LastPokeTime = nowMs
+			if err := s.SetRemediation(remediation); err != nil {
+				log.WithFields(fields).Warn(err)
+			}
+		case common.RemediationFail:
+			if err := s.failStuckSubDocument(candidate, now, fields); err != nil {
+				log.WithFields(fields).Warn(err)
+			}
+		}
+	}
+	return stucks, nil
+}
+
+// failStuckSubDocument marks the subdoc as failure if it is still the one found stuck
+func (s *WebconfigServer) failStuckSubDocument(stuck *common.StuckSubDocument, now time.Time, fields log.Fields) error {
+	subdoc, err := s.GetSubDocument(stuck.CpeMac, stuck.SubdocId)
+	if err != nil {
+		if s.IsDbNotFound(err) {
+			return s.DeleteRemediation(stuck.CpeMac, stuck.SubdocId)
+		}
+		return common.NewError(err)
+	}
+	if subdoc.State() == nil || *subdoc.State() != stuck.State || subdoc.UpdatedTime() == nil || int64(*subdoc.UpdatedTime()) != stuck.UpdatedTime {
+		return s.DeleteRemediation(stuck.CpeMac, stuck.SubdocId)
+	}
+
+	labels, err := s.GetRootDocumentLabels(stuck.CpeMac)
+	if err != nil {
+		return common.NewError(err)
+	}
+	labels["client"] = stuckSweeperMetricsAgent
+
+	state := common.Failure
+	updatedTime := int(now.UnixMilli())
+	errorCode := common.StuckDeploymentErrorCode
+	errorDetails := fmt.Sprintf("%v in state %v for %v", common.StuckDeploymentErrorDetails, stuck.State, now.Sub(time.UnixMilli(stuck.UpdatedTime)).Round(time.Second))
+	failed := common.NewSubDocument(nil, nil, &state, &updatedTime, &errorCode, &errorDetails)
+	if err := s.SetSubDocument(stuck.CpeMac, stuck.SubdocId, failed, stuck.State, labels, fields); err != nil {
+		return common.NewError(err)
+	}
+	log.WithFields(fields).Info("stuck subdoc marked as failure")
+	return s.DeleteRemediation(stuck.CpeMac, stuck.SubdocId)
+}
+
+// GetStuckDeploymentsHandler is the dry-run report of the sweeper. It reads up to
+// ?limit= entries of the index from ?cursor=, the next_cursor of the previous page.
+// A page may hold fewer stuck deployments than the limit.
+func (s *WebconfigServer) GetStuckDeploymentsHandler(w http.ResponseWriter, r *http.Request) {
+	if s.stuckSweeper == nil {
+		err := *common.NewHttp404Error("stuck sweeper is not enabled")
+		Error(w, http.StatusNotFound, common.NewError(err))
+		return
+	}
+
+	limit := defaultStuckDeploymentsLimit
+	if x := r.URL.Query().Get("limit"); len(x) > 0 {
+		i, err := strconv.Atoi(x)
+		if err != nil || i <= 0 {
+			err := *common.NewHttp400Error("invalid limit")
+			Error(w, http.StatusBadRequest, common.NewError(err))
+			return
+		}
+		limit = i
+	}
+	var cursor *stuckCursor
+	if x := r.URL.Query().Get("cursor"); len(x) > 0 {
+		c, err := parseStuckCursor(x)
+		if err != nil {
+			err := *common.NewHttp400Error("invalid cursor")
+			Error(w, http.StatusBadRequest, common.NewError(err))
+			return
+		}
+		cursor = c
+	}
+
+	now := time.Now()
+	candidates, next, err := s.scanStuckSubDocuments(now, cursor, limit)
+	if err != nil {
+		Error(w, http.StatusInternalServerError, common.NewError(err))
+		return
+	}
+	stucks, err := s.planStuckDeployments(now, candidates, true)
+	if err != nil {
+		Error(w, http.StatusInternalServerError, common.NewError(err))
+		return
+	}
+	page := StuckDeploymentsPage{
+		StuckDeployments: stucks,
+	}
+	if next != nil {
+		page.NextCursor = next.String()
+	}
+	WriteOkResponse(w, page)
+}
@@ -0,0 +1,210 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package http
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-akka/configuration"
+	"github.com/rdkcentral/webconfig/common"
+	"github.com/rdkcentral/webconfig/util"
+	"gotest.tools/assert"
+)
+
+func TestAcquireLease(t *testing.T) {
+	server := NewWebconfigServer(sc, true)
+	name := "test_lease_" + util.GenerateRandomCpeMac()
+
+	ok, err := server.AcquireLease(name, "foo", 60)
+	assert.NilError(t, err)
+	assert.Assert(t, ok)
+	ok, err = server.AcquireLease(name, "bar", 60)
+	assert.NilError(t, err)
+	assert.Assert(t, !ok)
+
+	// renewal by the owner, and an expired lease is taken over
+	ok, err = server.AcquireLease(name, "foo", -1)
+	assert.NilError(t, err)
+	assert.Assert(t, ok)
+	ok, err = server.AcquireLease(name, "bar", 60)
+	assert.NilError(t, err)
+	assert.Assert(t, ok)
+}
+
+func TestStuckSweeper(t *testing.T) {
+	server := NewWebconfigServer(sc, true)
+	router := server.GetRouter(true)
+	conf := configuration.ParseString(`
+webconfig.stuck_sweeper {
+    threshold_in_secs = 60
+    subdoc_thresholds_in_secs {
+        mesh = 10800
+    }
+    max_pokes = 2
+}`)
+	sweeper := NewStuckSweeper(conf)
+	assert.Equal(t, sweeper.Threshold("lan"), time.Minute)
+	assert.Equal(t, sweeper.Threshold("mesh"), 3*time.Hour)
+	server.SetStuckSweeper(sweeper)
+	cpeMac := util.GenerateRandomCpeMac()
+
+	var webpaCount atomic.Int32
+	webpaMockServer := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.Contains(r.URL.Path, cpeMac) {
+				webpaCount.Add(1)
+			}
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write(mockWebpaPokeResponse)
+		}))
+	defer webpaMockServer.Close()
+	server.SetWebpaHost(webpaMockServer.URL)
+
+	server.SetRootDocument(cpeMac, common.NewRootDocument(0, "fw1", "model1", "comcast", "", "", "", "", ""))
+
+	now := time.Now()
+	setSubdoc := func(mac string, subdocId string, state int, effectiveTime *int) {
+		version := util.GenerateRandomCpeMac()
+		updatedTime := int(now.Add(-2 * time.Hour).UnixMilli())
+		subdoc := common.NewSubDocument(common.RandomBytes(50, 100), &version, &state, &updatedTime, nil, nil)
+		subdoc.SetEffectiveTime(effectiveTime)
+		err := server.SetSubDocument(mac, subdocId, subdoc)
+		assert.NilError(t, err)
+	}
+	setSubdoc(cpeMac, "lan", common.InDeployment, nil)
+	setSubdoc(cpeMac, "wan", common.Deployed, nil)
+	setSubdoc(cpeMac, "mesh", common.PendingDownload, nil)
+
+	// not effective yet, or counted from the effective_time
+	futureTime := int(now.Add(time.Hour).UnixMilli())
+	setSubdoc(cpeMac, "moca", common.PendingDownload, &futureTime)
+	cpeMac2 := util.GenerateRandomCpeMac()
+	pastTime := int(now.Add(-30 * time.Second).UnixMilli())
+	setSubdoc(cpeMac2, "lan", common.PendingDownload, &pastTime)
+
+	sweep := func(at time.Time) *StuckDeployment {
+		stucks, err := server.SweepStuckDeployments(at, false)
+		assert.NilError(t, err)
+		var found *StuckDeployment
+		for _, stuck := range stucks {
+			if stuck.CpeMac == cpeMac {
+				assert.Equal(t, stuck.SubdocId, "lan")
+				found = stuck
+			}
+		}
+		assert.Assert(t, found != nil)
+		return found
+	}
+
+	// ==== the dry run report, paged through the index ====
+	found := false
+	cursor := ""
+	for pages := 0; ; pages++ {
+		assert.Assert(t, pages < 1000)
+		req, err := http.NewRequest("GET", "/api/v1/stuck_deployments?limit=2&cursor="+cursor, nil)
+		assert.NilError(t, err)
+		res := ExecuteRequest(req, router).Result()
+		rbytes, err := io.ReadAll(res.Body)
+		assert.NilError(t, err)
+		res.Body.Close()
+		assert.Equal(t, res.StatusCode, http.StatusOK)
+
+		var resp struct {
+			Data StuckDeploymentsPage `json:"data"`
+		}
+		err = json.Unmarshal(rbytes, &resp)
+		assert.NilError(t, err)
+		for _, stuck := range resp.Data.StuckDeployments {
+			if stuck.CpeMac == cpeMac {
+				assert.Equal(t, stuck.SubdocId, "lan")
+				assert.Equal(t, stuck.Action, common.RemediationPoke)
+				found = true
+			}
+		}
+		if len(resp.Data.NextCursor) == 0 {
+			break
+		}
+		cursor = resp.Data.NextCursor
+	}
+	assert.Assert(t, found)
+	assert.Equal(t, webpaCount.Load(), int32(0))
+
+	req, err := http.NewRequest("GET", "/api/v1/stuck_deployments?cursor=foo", nil)
+	assert.NilError(t, err)
+	res := ExecuteRequest(req, router).Result()
+	res.Body.Close()
+	assert.Equal(t, res.StatusCode, http.StatusBadRequest)
+
+	// ==== stuck from its effective_time ====
+	stucks, err := server.SweepStuckDeployments(now, true)
+	assert.NilError(t, err)
+	for _, stuck := range stucks {
+		assert.Assert(t, stuck.CpeMac != cpeMac2)
+	}
+	stucks, err = server.SweepStuckDeployments(now.Add(31*time.Second), true)
+	assert.NilError(t, err)
+	found = false
+	for _, stuck := range stucks {
+		if stuck.CpeMac == cpeMac2 {
+			assert.Equal(t, stuck.EffectiveTime, int64(pastTime))
+			assert.Assert(t, stuck.StuckSecs < 62)
+			found = true
+		}
+	}
+	assert.Assert(t, found)
+
+	// ==== poked up to max_pokes, one threshold apart ====
+	stuck := sweep(now)
+	assert.Equal(t, stuck.Action, common.RemediationPoke)
+	assert.Equal(t, webpaCount.Load(), int32(1))
+
+	stuck = sweep(now.Add(30 * time.Second))
+	assert.Equal(t, stuck.Action, common.RemediationWait)
+	assert.Equal(t, stuck.Attempts, 1)
+	assert.Equal(t, webpaCount.Load(), int32(1))
+
+	stuck = sweep(now.Add(61 * time.Second))
+	assert.Equal(t, stuck.Action, common.RemediationPoke)
+	assert.Equal(t, webpaCount.Load(), int32(2))
+
+	// ==== then marked as failure ====
+	stuck = sweep(now.Add(122 * time.Second))
+	assert.Equal(t, stuck.Action, common.RemediationFail)
+	assert.Equal(t, webpaCount.Load(), int32(2))
+
+	subdoc, err := server.GetSubDocument(cpeMac, "lan")
+	assert.NilError(t, err)
+	assert.Equal(t, *subdoc.State(), common.Failure)
+	assert.Equal(t, *subdoc.ErrorCode(), common.StuckDeploymentErrorCode)
+	_, err = server.GetRemediation(cpeMac, "lan")
+	assert.Assert(t, server.IsDbNotFound(err))
+
+	subdoc, err = server.GetSubDocument(cpeMac, "mesh")
+	assert.NilError(t, err)
+	assert.Equal(t, *subdoc.State(), common.PendingDownload)
+	subdoc, err = server.GetSubDocument(cpeMac, "moca")
+	assert.NilError(t, err)
+	assert.Equal(t, *subdoc.State(), common.PendingDownload)
+}
@@ -0,0 +1,326 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package http
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/go-akka/configuration"
+	"github.com/google/uuid"
+	"github.com/rdkcentral/webconfig/common"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultOverrideReverterIntervalInSecs = 30
+	defaultOverrideReverterLeaseInSecs    = 90
+	overrideReverterLeaseName             = "override_reverter"
+	overrideReverterMetricsAgent          = "override_reverter"
+	overrideReverterPageSize              = 500
+)
+
+// OverrideReverter restores the subdocs replaced by temporary writes once the
+// temporary ones expire. Only the replica holding the lease reverts.
+type OverrideReverter struct {
+	interval  time.Duration
+	autoPoke  bool
+	leaseSecs int
+	owner     string
+	// the oldest bucket left with entries in the last round, 0 to read them all
+	firstBucket int64
+}
+
+func NewOverrideReverter(conf *configuration.Config) *OverrideReverter {
+	intervalInSecs := conf.GetInt32("webconfig.override_reverter.interval_in_secs", defaultOverrideReverterIntervalInSecs)
+	leaseInSecs := conf.GetInt32("webconfig.override_reverter.lease_in_secs", defaultOverrideReverterLeaseInSecs)
+	return &OverrideReverter{
+		interval:  time.Duration(intervalInSecs) * time.Second,
+		autoPoke:  conf.GetBoolean("webconfig.override_reverter.auto_poke"),
+		leaseSecs: int(leaseInSecs),
+		owner:     uuid.New().String(),
+	}
+}
+
+func (r *OverrideReverter) Interval() time.Duration {
+	return r.interval
+}
+
+func (r *OverrideReverter) Owner() string {
+	return r.owner
+}
+
+func (r *OverrideReverter) AutoPoke() bool {
+	return r.autoPoke
+}
+
+func (r *OverrideReverter) SetAutoPoke(enabled bool) {
+	r.autoPoke = enabled
+}
+
+func (s *WebconfigServer) OverrideReverter() *OverrideReverter {
+	return s.overrideReverter
+}
+
+func (s *WebconfigServer) SetOverrideReverter(r *OverrideReverter) {
+	s.overrideReverter = r
+}
+
+// WriteTemporarySubDocument writes a subdoc that is reverted to the prior one at
+// expiry (epoch in msecs). Overriding an active override extends it and keeps the
+// original prior subdoc.
+func (s *WebconfigServer) WriteTemporarySubDocument(deviceId, subdocId string, subdoc *common.SubDocument, expiry int, oldState int, metricsAgent string, fields log.Fields) (string, error) {
+	override, err := s.GetSubDocumentOverride(deviceId, subdocId)
+	if err != nil {
+		if !s.IsDbNotFound(err) {
+			return "", common.NewError(err)
+		}
+		override = &common.SubDocumentOverride{
+			CpeMac:      deviceId,
+			SubdocId:    subdocId,
+			CreatedTime: time.Now().UnixMilli(),
+		}
+		prior, err := s.GetSubDocument(deviceId, subdocId)
+		if err != nil {
+			if !s.IsDbNotFound(err) {
+				return "", common.NewError(err)
+			}
+		} else {
+			override.PriorPayload = prior.Payload()
+			override.PriorVersion = prior.GetVersion()
+		}
+	}
+	override.Expiry = int64(expiry)
+	if err := s.SetSubDocumentOverride(override); err != nil {
+		return "", common.NewError(err)
+	}
+
+	tsubdoc := *subdoc
+	tsubdoc.SetExpiry(&expiry)
+	return s.writeSubDocument(deviceId, subdocId, &tsubdoc, oldState, metricsAgent, fields)
+}
+
+// cancelSubDocumentOverride drops the pending revert when a subdoc is rewritten
+// and clears the expiry left by the temporary subdoc
+func (s *WebconfigServer) cancelSubDocumentOverride(deviceId, subdocId string, subdoc *common.SubDocument) error {
+	if _, err := s.GetSubDocumentOverride(deviceId, subdocId); err != nil {
+		if s.IsDbNotFound(err) {
+			return nil
+		}
+		return common.NewError(err)
+	}
+	if err := s.DeleteSubDocumentOverride(deviceId, subdocId); err != nil {
+		return common.NewError(err)
+	}
+	if subdoc.Expiry() == nil {
+		if err := s.DeleteSubDocumentColumns(deviceId, subdocId, "expiry"); err != nil {
+			return common.NewError(err)
+		}
+	}
+	return nil
+}
+
+// RunOverrideReverter reverts the expired overrides periodically until ctx is done.
+// A round is skipped if another replica holds the lease.
+func (s *WebconfigServer) RunOverrideReverter(ctx context.Context) {
+	fields := log.Fields{
+		"logger": "override",
+		"owner":  s.overrideReverter.Owner(),
+	}
+	ticker := time.NewTicker(s.overrideReverter.Interval())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case t := <-ticker.C:
+			ok, err := s.AcquireLease(overrideReverterLeaseName, s.overrideReverter.Owner(), s.overrideReverter.leaseSecs)
+			if err != nil {
+				log.WithFields(fields).Error(err)
+				continue
+			}
+			if !ok {
+				continue
+			}
+			if err := s.RevertExpiredOverrides(t); err != nil {
+				log.WithFields(fields).Error(err)
+			}
+		}
+	}
+}
+
+// RevertExpiredOverrides restores the prior subdocs of the overrides expired at now.
+// The restored subdocs are set to pending download and the devices are poked if
+// auto_poke is enabled. It reads the buckets of the expiry index up to now, from
+// the oldest one that still had entries in the previous round, or from the TTL of
+// the index after a restart.
+func (s *WebconfigServer) RevertExpiredOverrides(now time.Time) error {
+	nowMs := now.UnixMilli()
+	lastBucket := common.SubDocumentOverrideBucket(nowMs)
+	firstBucket := common.SubDocumentOverrideBucket(now.Add(-common.SubDocumentOverrideTTLSecs * time.Second).UnixMilli())
+	if s.overrideReverter != nil {
+		firstBucket = max(firstBucket, s.overrideReverter.firstBucket)
+	}
+
+	// the previous bucket is read again so that an entry written by a replica with
+	// a late clock is not skipped
+	nextFirstBucket := lastBucket - 1
+	revertedMacs := []string{}
+	reverted := map[string]bool{}
+	for bucket := firstBucket; bucket <= lastBucket; bucket++ {
+		left, err := s.revertExpiredBucket(bucket, now, func(cpeMac string) {
+			if !reverted[cpeMac] {
+				reverted[cpeMac] = true
+				revertedMacs = append(revertedMacs, cpeMac)
+			}
+		})
+		if err != nil {
+			return common.NewError(err)
+		}
+		if left {
+			nextFirstBucket = min(nextFirstBucket, bucket)
+		}
+	}
+
+	if s.overrideReverter == nil {
+		return nil
+	}
+	s.overrideReverter.firstBucket = nextFirstBucket
+	if !s.overrideReverter.AutoPoke() {
+		return nil
+	}
+	for _, cpeMac := range revertedMacs {
+		fields := log.Fields{
+			"logger":  "override",
+			"cpe_mac": cpeMac,
+		}
+		if err := s.AutoPoke(cpeMac, make(http.Header), fields); err != nil {
+			log.WithFields(fields).Warn(err)
+		}
+	}
+	return nil
+}
+
+// revertExpiredBucket reverts the expired entries of one bucket page by page and
+// calls onReverted with the mac of each reverted override. The prior payload is
+// read only for the entries that are still current. It returns true if some
+// entries are left in the bucket.
+func (s *WebconfigServer) revertExpiredBucket(bucket int64, now time.Time, onReverted func(string)) (bool, error) {
+	nowMs := now.UnixMilli()
+	left := false
+	var pageState []byte
+	for {
+		entries, nextPageState, err := s.GetSubDocumentOverrideExpiries(bucket, pageState, overrideReverterPageSize)
+		if err != nil {
+			return false, common.NewError(err)
+		}
+		for _, entry := range entries {
+			if entry.Expiry > nowMs {
+				left = true
+				continue
+			}
+			fields := log.Fields{
+				"logger":    "override",
+				"cpe_mac":   entry.CpeMac,
+				"subdoc_id": entry.SubdocId,
+			}
+			ok, err := s.revertExpiredEntry(entry, now, fields)
+			if err != nil {
+				// retried in the next round
+				log.WithFields(fields).Warn(err)
+				left = true
+				continue
+			}
+			if ok {
+				onReverted(entry.CpeMac)
+			}
+		}
+		if len(nextPageState) == 0 {
+			return left, nil
+		}
+		pageState = nextPageState
+	}
+}
+
+// revertExpiredEntry reverts the override of the entry unless it was extended or
+// cancelled since, and drops the entry
+func (s *WebconfigServer) revertExpiredEntry(entry *common.SubDocumentOverrideExpiry, now time.Time, fields log.Fields) (bool, error) {
+	ok := false
+	override, err := s.GetSubDocumentOverride(entry.CpeMac, entry.SubdocId)
+	if err != nil {
+		if !s.IsDbNotFound(err) {
+			return false, common.NewError(err)
+		}
+	} else if override.Expiry == entry.Expiry {
+		ok, err = s.revertSubDocumentOverride(override, now, fields)
+		if err != nil {
+			return false, common.NewError(err)
+		}
+	}
+	if err := s.DeleteSubDocumentOverrideExpiry(entry); err != nil {
+		return false, common.NewError(err)
+	}
+	return ok, nil
+}
+
+func (s *WebconfigServer) revertSubDocumentOverride(override *common.SubDocumentOverride, now time.Time, fields log.Fields) (bool, error) {
+	cpeMac, subdocId := override.CpeMac, override.SubdocId
+
+	// the override is stale if the temporary subdoc is gone or replaced
+	subdoc, err := s.GetSubDocument(cpeMac, subdocId)
+	if err != nil {
+		if !s.IsDbNotFound(err) {
+			return false, common.NewError(err)
+		}
+		return false, s.DeleteSubDocumentOverride(cpeMac, subdocId)
+	}
+	if subdoc.Expiry() == nil || int64(*subdoc.Expiry()) != override.Expiry {
+		return false, s.DeleteSubDocumentOverride(cpeMac, subdocId)
+	}
+
+	if !override.HasPrior() {
+		if _, err := s.RemoveSubDocument(cpeMac, subdocId, fields); err != nil {
+			return false, common.NewError(err)
+		}
+		log.WithFields(fields).Info("temporary subdoc removed")
+		return true, nil
+	}
+
+	oldState := 0
+	if subdoc.State() != nil {
+		oldState = *subdoc.State()
+	}
+	version := override.PriorVersion
+	state := common.PendingDownload
+	updatedTime := int(now.UnixMilli())
+	errorCode := 0
+	errorDetails := ""
+	prior := common.NewSubDocument(override.PriorPayload, &version, &state, &updatedTime, &errorCode, &errorDetails)
+	if _, err := s.writeSubDocument(cpeMac, subdocId, prior, oldState, overrideReverterMetricsAgent, fields); err != nil {
+		return false, common.NewError(err)
+	}
+	if err := s.DeleteSubDocumentOverride(cpeMac, subdocId); err != nil {
+		return false, common.NewError(err)
+	}
+	if err := s.DeleteSubDocumentColumns(cpeMac, subdocId, "expiry"); err != nil {
+		return false, common.NewError(err)
+	}
+	log.WithFields(fields).Info("temporary subdoc reverted")
+	return true, nil
+}
@@ -0,0 +1,151 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rdkcentral/webconfig/common"
+	"github.com/rdkcentral/webconfig/util"
+	"gotest.tools/assert"
+)
+
+func TestSubDocumentOverride(t *testing.T) {
+	server := NewWebconfigServer(sc, true)
+	router := server.GetRouter(true)
+	server.SetOverrideReverter(&OverrideReverter{interval: time.Second, autoPoke: true})
+	cpeMac := util.GenerateRandomCpeMac()
+
+	var webpaCount atomic.Int32
+	webpaMockServer := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			webpaCount.Add(1)
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write(mockWebpaPokeResponse)
+		}))
+	defer webpaMockServer.Close()
+	server.SetWebpaHost(webpaMockServer.URL)
+
+	server.SetRootDocument(cpeMac, common.NewRootDocument(0, "fw1", "model1", "comcast", "", "", "", "", ""))
+
+	postSubdoc := func(subdocId string, bbytes []byte, duration string) (int, util.Dict) {
+		url := fmt.Sprintf("/api/v1/device/%v/document/%v", cpeMac, subdocId)
+		req, err := http.NewRequest("POST", url, bytes.NewReader(bbytes))
+		assert.NilError(t, err)
+		req.Header.Set(common.HeaderContentType, common.HeaderApplicationMsgpack)
+		if len(duration) > 0 {
+			req.Header.Set(common.HeaderOverrideDuration, duration)
+		}
+		res := ExecuteRequest(req, router).Result()
+		rbytes, err := io.ReadAll(res.Body)
+		assert.NilError(t, err)
+		res.Body.Close()
+		data := util.Dict{}
+		if res.StatusCode == http.StatusOK {
+			err = json.Unmarshal(rbytes, &data)
+			assert.NilError(t, err)
+		}
+		return res.StatusCode, data
+	}
+
+	// ==== an invalid duration is rejected ====
+	status, _ := postSubdoc("lan", common.RandomBytes(50, 100), "-1")
+	assert.Equal(t, status, http.StatusBadRequest)
+
+	// ==== a temporary write keeps the prior subdoc ====
+	lanBytes := common.RandomBytes(50, 100)
+	status, _ = postSubdoc("lan", lanBytes, "")
+	assert.Equal(t, status, http.StatusOK)
+	lanSubdoc, err := server.GetSubDocument(cpeMac, "lan")
+	assert.NilError(t, err)
+
+	status, data := postSubdoc("lan", common.RandomBytes(50, 100), "60")
+	assert.Equal(t, status, http.StatusOK)
+	expiry := int64(data["override_expiry"].(float64))
+
+	override, err := server.GetSubDocumentOverride(cpeMac, "lan")
+	assert.NilError(t, err)
+	assert.Equal(t, override.Expiry, expiry)
+	assert.Equal(t, override.PriorVersion, lanSubdoc.GetVersion())
+	assert.DeepEqual(t, override.PriorPayload, lanBytes)
+
+	// overriding again extends the expiry but keeps the original prior subdoc
+	status, data = postSubdoc("lan", common.RandomBytes(50, 100), "120")
+	assert.Equal(t, status, http.StatusOK)
+	expiry = int64(data["override_expiry"].(float64))
+	override, err = server.GetSubDocumentOverride(cpeMac, "lan")
+	assert.NilError(t, err)
+	assert.Equal(t, override.Expiry, expiry)
+	assert.DeepEqual(t, override.PriorPayload, lanBytes)
+	subdoc, err := server.GetSubDocument(cpeMac, "lan")
+	assert.NilError(t, err)
+	assert.Equal(t, int64(*subdoc.Expiry()), expiry)
+
+	// a temporary subdoc without prior
+	status, _ = postSubdoc("wan", common.RandomBytes(50, 100), "60")
+	assert.Equal(t, status, http.StatusOK)
+
+	// ==== nothing is reverted before the expiry ====
+	err = server.RevertExpiredOverrides(time.Now())
+	assert.NilError(t, err)
+	assert.Equal(t, webpaCount.Load(), int32(0))
+
+	// ==== the prior subdoc is restored after the expiry ====
+	err = server.RevertExpiredOverrides(time.UnixMilli(expiry).Add(time.Second))
+	assert.NilError(t, err)
+	assert.Equal(t, webpaCount.Load(), int32(1))
+
+	subdoc, err = server.GetSubDocument(cpeMac, "lan")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, subdoc.Payload(), lanBytes)
+	assert.Equal(t, subdoc.GetVersion(), lanSubdoc.GetVersion())
+	assert.Equal(t, *subdoc.State(), common.PendingDownload)
+	assert.Assert(t, subdoc.Expiry() == nil)
+	_, err = server.GetSubDocumentOverride(cpeMac, "lan")
+	assert.Assert(t, server.IsDbNotFound(err))
+
+	_, err = server.GetSubDocument(cpeMac, "wan")
+	assert.Assert(t, server.IsDbNotFound(err))
+
+	// the expiry entries of the reverted and of the extended overrides are dropped
+	entries, _, err := server.GetSubDocumentOverrideExpiries(common.SubDocumentOverrideBucket(expiry), nil, 10000)
+	assert.NilError(t, err)
+	for _, entry := range entries {
+		assert.Assert(t, entry.CpeMac != cpeMac)
+	}
+
+	// ==== a regular write cancels the override ====
+	status, _ = postSubdoc("lan", common.RandomBytes(50, 100), strconv.Itoa(60))
+	assert.Equal(t, status, http.StatusOK)
+	status, _ = postSubdoc("lan", common.RandomBytes(50, 100), "")
+	assert.Equal(t, status, http.StatusOK)
+	_, err = server.GetSubDocumentOverride(cpeMac, "lan")
+	assert.Assert(t, server.IsDbNotFound(err))
+	subdoc, err = server.GetSubDocument(cpeMac, "lan")
+	assert.NilError(t, err)
+	assert.Assert(t, subdoc.Expiry() == nil)
+}
@@ -0,0 +1,271 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package http
+
+import (
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-akka/configuration"
+	"github.com/rdkcentral/webconfig/common"
+	"github.com/rdkcentral/webconfig/db"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultSubdocRetryMaxAttempts      = 3
+	defaultSubdocRetryBackoffInSecs    = 60
+	defaultSubdocRetryMaxBackoffInSecs = 3600
+	subdocRetryMetricsAgent            = "subdoc_retry"
+	subdocRetryOutcomeScheduled        = "scheduled"
+	subdocRetryOutcomeExhausted        = "exhausted"
+	subdocRetryOutcomeNotRetryable     = "not_retryable"
+)
+
+// SubdocRetryPolicy decides if a failure reported by the device is retried. A
+// failure is retryable if its error_code is listed or its error_details contains
+// one of the listed patterns, case-insensitively.
+type SubdocRetryPolicy struct {
+	maxAttempts           int
+	backoff               time.Duration
+	maxBackoff            time.Duration
+	retryableErrorCodes   map[int]bool
+	retryableErrorDetails []string
+}
+
+func newSubdocRetryPolicy(conf *configuration.Config, path string, fallback *SubdocRetryPolicy) *SubdocRetryPolicy {
+	p := &SubdocRetryPolicy{
+		maxAttempts:         defaultSubdocRetryMaxAttempts,
+		backoff:             defaultSubdocRetryBackoffInSecs * time.Second,
+		maxBackoff:          defaultSubdocRetryMaxBackoffInSecs * time.Second,
+		retryableErrorCodes: map[int]bool{},
+	}
+	if fallback != nil {
+		*p = *fallback
+	}
+	if conf.HasPath(path + ".max_attempts") {
+		p.maxAttempts = int(conf.GetInt32(path + ".max_attempts"))
+	}
+	if conf.HasPath(path + ".backoff_in_secs") {
+		p.backoff = time.Duration(conf.GetInt32(path+".backoff_in_secs")) * time.Second
+	}
+	if conf.HasPath(path + ".max_backoff_in_secs") {
+		p.maxBackoff = time.Duration(conf.GetInt32(path+".max_backoff_in_secs")) * time.Second
+	}
+	if conf.HasPath(path + ".retryable_error_codes") {
+		p.retryableErrorCodes = map[int]bool{}
+		for _, x := range conf.GetInt32List(path + ".retryable_error_codes") {
+			p.retryableErrorCodes[int(x)] = true
+		}
+	}
+	if conf.HasPath(path + ".retryable_error_details") {
+		p.retryableErrorDetails = []string{}
+		for _, x := range conf.GetStringList(path + ".retryable_error_details") {
+			p.retryableErrorDetails = append(p.retryableErrorDetails, strings.ToLower(x))
+		}
+	}
+	return p
+}
+
+func (p *SubdocRetryPolicy) MaxAttempts() int {
+	return p.maxAttempts
+}
+
+func (p *SubdocRetryPolicy) Retryable(errorCode int, errorDetails string) bool {
+	if p.retryableErrorCodes[errorCode] {
+		return true
+	}
+	errorDetails = strings.ToLower(errorDetails)
+	for _, x := range p.retryableErrorDetails {
+		if len(x) > 0 && strings.Contains(errorDetails, x) {
+			return true
+		}
+	}
+	return false
+}
+
+// Backoff returns the delay before the n-th retry, n starting from 1, doubled
+// on each attempt and capped at max_backoff_in_secs
+func (p *SubdocRetryPolicy) Backoff(retry int) time.Duration {
+	if retry < 1 {
+		return 0
+	}
+	delay := float64(p.backoff) * math.Pow(2, float64(retry-1))
+	if delay > float64(p.maxBackoff) {
+		delay = float64(p.maxBackoff)
+	}
+	return time.Duration(delay)
+}
+
+// SubdocRetryPolicies holds the default policy and the per subdoc ones
+type SubdocRetryPolicies struct {
+	defaultPolicy *SubdocRetryPolicy
+	policies      map[string]*SubdocRetryPolicy
+}
+
+func NewSubdocRetryPolicies(conf *configuration.Config) *SubdocRetryPolicies {
+	defaultPolicy := newSubdocRetryPolicy(conf, "webconfig.subdoc_retry.default", nil)
+	policies := map[string]*SubdocRetryPolicy{}
+	path := "webconfig.subdoc_retry.subdocs"
+	if node := conf.GetNode(path); node != nil && node.IsObject() {
+		for _, subdocId := range node.GetObject().GetKeys() {
+			policies[subdocId] = newSubdocRetryPolicy(conf, path+"."+subdocId, defaultPolicy)
+		}
+	}
+	return &SubdocRetryPolicies{
+		defaultPolicy: defaultPolicy,
+		policies:      policies,
+	}
+}
+
+func (p *SubdocRetryPolicies) Policy(subdocId string) *SubdocRetryPolicy {
+	if x, ok := p.policies[subdocId]; ok {
+		return x
+	}
+	return p.defaultPolicy
+}
+
+func (s *WebconfigServer) SubdocRetryPolicies() *SubdocRetryPolicies {
+	return s.subdocRetryPolicies
+}
+
+func (s *WebconfigServer) SetSubdocRetryPolicies(p *SubdocRetryPolicies) {
+	s.subdocRetryPolicies = p
+}
+
+// RetryFailedSubDocument flips a failed subdoc back to PendingDownload if its
+// policy allows it. The first retry is poked right away. The later ones are held
+// back by retry_time for the backoff, and poked by the delivery scheduler. The
+// effective_time of the writer is left alone.
+// It returns whether a retry is scheduled.
+func (s *WebconfigServer) RetryFailedSubDocument(cpeMac, subdocId string, version string, errorCode int, errorDetails string, fields log.Fields) (bool, error) {
+	if s.subdocRetryPolicies == nil {
+		return false, nil
+	}
+	policy := s.subdocRetryPolicies.Policy(subdocId)
+
+	subdoc, err := s.GetSubDocument(cpeMac, subdocId)
+	if err != nil {
+		return false, common.NewError(err)
+	}
+	// only the failure just reported for the current version
+	if subdoc.State() == nil || *subdoc.State() != common.Failure {
+		return false, nil
+	}
+	if len(version) > 0 && subdoc.GetVersion() != version {
+		return false, nil
+	}
+
+	if !policy.Retryable(errorCode, errorDetails) {
+		s.countSubdocRetry(subdocId, subdocRetryOutcomeNotRetryable)
+		return false, nil
+	}
+	attempts := 0
+	if subdoc.RetryAttempts() != nil {
+		attempts = *subdoc.RetryAttempts()
+	}
+	if attempts >= policy.MaxAttempts() {
+		s.countSubdocRetry(subdocId, subdocRetryOutcomeExhausted)
+		log.WithFields(fields).Infof("retries of %v exhausted after %v attempts", subdocId, attempts)
+		return false, nil
+	}
+
+	labels, err := s.GetRootDocumentLabels(cpeMac)
+	if err != nil {
+		return false, common.NewError(err)
+	}
+	labels["client"] = subdocRetryMetricsAgent
+
+	// the error of the last failure is kept for the GET responses
+	now := time.Now()
+	attempts++
+	state := common.PendingDownload
+	updatedTime := int(now.UnixMilli())
+	retryTime := updatedTime + int(policy.Backoff(attempts-1).Milliseconds())
+	retry := common.NewSubDocument(nil, nil, &state, &updatedTime, nil, nil)
+	retry.SetRetryAttempts(&attempts)
+	retry.SetRetryTime(&retryTime)
+	if err := s.SetSubDocument(cpeMac, subdocId, retry, common.Failure, labels, fields); err != nil {
+		return false, common.NewError(err)
+	}
+	s.countSubdocRetry(subdocId, subdocRetryOutcomeScheduled)
+
+	tfields := common.FilterLogFields(fields)
+	tfields["subdoc_id"] = subdocId
+	tfields["retry_attempts"] = attempts
+	tfields["retry_time"] = retryTime
+	log.WithFields(tfields).Info("failed subdoc retried")
+
+	if retryTime <= updatedTime {
+		if err := s.AutoPoke(cpeMac, make(http.Header), fields); err != nil {
+			return true, common.NewError(err)
+		}
+		return true, nil
+	}
+
+	schedule := &common.SubDocumentSchedule{
+		CpeMac:        cpeMac,
+		SubdocId:      subdocId,
+		EffectiveTime: int64(retryTime),
+	}
+	if err := s.SetSubDocumentSchedule(schedule); err != nil {
+		return true, common.NewError(err)
+	}
+	doc, err := s.GetDocument(cpeMac, fields)
+	if err != nil {
+		return true, common.NewError(err)
+	}
+	rootVersion := db.HashRootVersion(doc.EffectiveVersionMap(updatedTime))
+	if err := s.SetRootDocumentVersion(cpeMac, rootVersion); err != nil {
+		return true, common.NewError(err)
+	}
+	return true, nil
+}
+
+// retryFailedSubDocument handles the failures of the state notifications. Errors
+// are only logged so that the notification itself is not failed.
+func (s *WebconfigServer) retryFailedSubDocument(cpeMac string, m *common.EventMessage, fields log.Fields) {
+	if s.subdocRetryPolicies == nil || m.Namespace == nil || m.ApplicationStatus == nil {
+		return
+	}
+	if *m.ApplicationStatus == "success" || *m.ApplicationStatus == "pending" {
+		return
+	}
+	var version, errorDetails string
+	var errorCode int
+	if m.Version != nil {
+		version = *m.Version
+	}
+	if m.ErrorCode != nil {
+		errorCode = *m.ErrorCode
+	}
+	if m.ErrorDetails != nil {
+		errorDetails = *m.ErrorDetails
+	}
+	if _, err := s.RetryFailedSubDocument(cpeMac, *m.Namespace, version, errorCode, errorDetails, fields); err != nil {
+		log.WithFields(common.FilterLogFields(fields)).Warn(err)
+	}
+}
+
+func (s *WebconfigServer) countSubdocRetry(subdocId, outcome string) {
+	if m := s.Metrics(); m != nil {
+		m.CountSubdocRetry(subdocId, outcome)
+	}
+}
@@ -0,0 +1,177 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-akka/configuration"
+	"github.com/rdkcentral/webconfig/common"
+	"github.com/rdkcentral/webconfig/util"
+	log "github.com/sirupsen/logrus"
+	"gotest.tools/assert"
+)
+
+var testSubdocRetryConfig = `
+webconfig.subdoc_retry {
+    default {
+        max_attempts = 2
+        backoff_in_secs = 60
+        max_backoff_in_secs = 90
+        retryable_error_codes = [204]
+        retryable_error_details = ["Busy"]
+    }
+    subdocs {
+        wan {
+            max_attempts = 5
+        }
+    }
+}`
+
+func TestSubdocRetryPolicies(t *testing.T) {
+	policies := NewSubdocRetryPolicies(configuration.ParseString(testSubdocRetryConfig))
+
+	lan := policies.Policy("lan")
+	assert.Equal(t, lan.MaxAttempts(), 2)
+	assert.Assert(t, lan.Retryable(204, ""))
+	assert.Assert(t, lan.Retryable(0, "device busy"))
+	assert.Assert(t, !lan.Retryable(300, "invalid payload"))
+	assert.Equal(t, lan.Backoff(0), time.Duration(0))
+	assert.Equal(t, lan.Backoff(1), time.Minute)
+	assert.Equal(t, lan.Backoff(2), 90*time.Second)
+
+	// unset keys fall back to the default policy
+	wan := policies.Policy("wan")
+	assert.Equal(t, wan.MaxAttempts(), 5)
+	assert.Assert(t, wan.Retryable(0, "busy"))
+	assert.Equal(t, wan.Backoff(1), time.Minute)
+}
+
+func TestRetryFailedSubDocument(t *testing.T) {
+	server := NewWebconfigServer(sc, true)
+	router := server.GetRouter(true)
+	server.SetSubdocRetryPolicies(NewSubdocRetryPolicies(configuration.ParseString(testSubdocRetryConfig)))
+	cpeMac := util.GenerateRandomCpeMac()
+
+	var webpaCount atomic.Int32
+	webpaMockServer := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			webpaCount.Add(1)
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write(mockWebpaPokeResponse)
+		}))
+	defer webpaMockServer.Close()
+	server.SetWebpaHost(webpaMockServer.URL)
+
+	server.SetRootDocument(cpeMac, common.NewRootDocument(0, "fw1", "model1", "comcast", "", "", "", "", ""))
+	subdocId := "lan"
+	url := fmt.Sprintf("/api/v1/device/%v/document/%v", cpeMac, subdocId)
+	postSubdoc := func() {
+		req, err := http.NewRequest("POST", url, bytes.NewReader(common.RandomBytes(50, 100)))
+		assert.NilError(t, err)
+		req.Header.Set(common.HeaderContentType, common.HeaderApplicationMsgpack)
+		res := ExecuteRequest(req, router).Result()
+		_, err = io.ReadAll(res.Body)
+		assert.NilError(t, err)
+		res.Body.Close()
+		assert.Equal(t, res.StatusCode, http.StatusOK)
+	}
+	notifyFailure := func(errorDetails string) {
+		applicationStatus := "failure"
+		errorCode := 300
+		m := common.EventMessage{
+			DeviceId:          "mac:" + cpeMac,
+			Namespace:         &subdocId,
+			ApplicationStatus: &applicationStatus,
+			ErrorCode:         &errorCode,
+			ErrorDetails:      &errorDetails,
+		}
+		bbytes, err := json.Marshal(m)
+		assert.NilError(t, err)
+		_, _, err = server.HandleStateNotification(bbytes, log.Fields{})
+		assert.NilError(t, err)
+	}
+
+	// ==== the first retry is poked right away ====
+	postSubdoc()
+	notifyFailure("device busy")
+	subdoc, err := server.GetSubDocument(cpeMac, subdocId)
+	assert.NilError(t, err)
+	assert.Equal(t, *subdoc.State(), common.PendingDownload)
+	assert.Equal(t, *subdoc.RetryAttempts(), 1)
+	assert.Equal(t, *subdoc.ErrorDetails(), "device busy")
+	assert.Equal(t, webpaCount.Load(), int32(1))
+
+	req, err := http.NewRequest("GET", url, nil)
+	assert.NilError(t, err)
+	res := ExecuteRequest(req, router).Result()
+	_, err = io.ReadAll(res.Body)
+	assert.NilError(t, err)
+	res.Body.Close()
+	assert.Equal(t, res.StatusCode, http.StatusOK)
+	assert.Equal(t, res.Header.Get(common.HeaderSubdocumentRetryAttempts), "1")
+
+	// ==== the second one is held back for the backoff ====
+	notifyFailure("device busy")
+	subdoc, err = server.GetSubDocument(cpeMac, subdocId)
+	assert.NilError(t, err)
+	assert.Equal(t, *subdoc.State(), common.PendingDownload)
+	assert.Equal(t, *subdoc.RetryAttempts(), 2)
+	assert.Assert(t, !subdoc.IsEffective(int(time.Now().UnixMilli())))
+	assert.Assert(t, subdoc.EffectiveTime() == nil)
+	assert.Assert(t, subdoc.RetryTime() != nil)
+	assert.Equal(t, webpaCount.Load(), int32(1))
+
+	schedules := getSubDocumentSchedules(t, server, int64(*subdoc.RetryTime()))
+	found := false
+	for _, schedule := range schedules {
+		if schedule.CpeMac == cpeMac && schedule.SubdocId == subdocId {
+			assert.Equal(t, schedule.EffectiveTime, int64(*subdoc.RetryTime()))
+			found = true
+		}
+	}
+	assert.Assert(t, found)
+
+	// ==== exhausted ====
+	notifyFailure("device busy")
+	subdoc, err = server.GetSubDocument(cpeMac, subdocId)
+	assert.NilError(t, err)
+	assert.Equal(t, *subdoc.State(), common.Failure)
+	assert.Equal(t, *subdoc.RetryAttempts(), 2)
+
+	// ==== a new write starts over, and a non-retryable failure stays ====
+	postSubdoc()
+	subdoc, err = server.GetSubDocument(cpeMac, subdocId)
+	assert.NilError(t, err)
+	assert.Assert(t, subdoc.RetryAttempts() == nil)
+	assert.Assert(t, subdoc.RetryTime() == nil)
+
+	notifyFailure("invalid payload")
+	subdoc, err = server.GetSubDocument(cpeMac, subdocId)
+	assert.NilError(t, err)
+	assert.Equal(t, *subdoc.State(), common.Failure)
+	assert.Equal(t, webpaCount.Load(), int32(1))
+}
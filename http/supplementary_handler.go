@@ -128,7 +128,7 @@ func (s *WebconfigServer) MultipartSupplementaryHandler(w http.ResponseWriter, r
 					}
 					mparts := []common.Multipart{mpart}
 					fields["telemetry_version"] = version
-					respBytes, err := common.WriteMultipartBytes(mparts)
+					respBytes, err := common.WriteMultipartBytes(mparts, s.PartSigner())
 					if err != nil {
 						w.WriteHeader(http.StatusInternalServerError)
 						_, _ = w.Write([]byte(err.Error()))
@@ -255,7 +255,7 @@ func (s *WebconfigServer) MultipartSupplementaryHandler(w http.ResponseWriter, r
 	}
 	fields["telemetry_version"] = mpart.Version
 
-	respBytes, err := common.WriteMultipartBytes(mparts)
+	respBytes, err := common.WriteMultipartBytes(mparts, s.PartSigner())
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		_, _ = w.Write([]byte(err.Error()))
@@ -24,12 +24,15 @@ import (
 	"strings"
 
 	"github.com/rdkcentral/webconfig/common"
+	"github.com/rdkcentral/webconfig/security"
+	"github.com/rdkcentral/webconfig/util"
 )
 
 type TokenRequest struct {
 	Mac       string `json:"mac"`
 	Ttl       int64  `json:"ttl"`
 	PartnerId string `json:"partner_id"`
+	Kid       string `json:"kid,omitempty"`
 }
 
 func (s *WebconfigServer) CreateTokenHandler(w http.ResponseWriter, r *http.Request) {
@@ -50,11 +53,27 @@ func (s *WebconfigServer) CreateTokenHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	// the signing kid decides the algorithm of the token
+	kid := tokenRequest.Kid
+	if len(kid) == 0 {
+		kid = security.EncodingKeyId
+	}
+	if !util.Contains(m.SigningKids(), kid) {
+		err := *common.NewHttp400Error(fmt.Sprintf("invalid kid %v, not in %v", kid, m.SigningKids()))
+		Error(w, http.StatusBadRequest, common.NewError(err))
+		return
+	}
+
 	var token string
+	var err error
 	if len(tokenRequest.PartnerId) > 0 {
-		token = m.Generate(strings.ToLower(tokenRequest.Mac), tokenRequest.Ttl, tokenRequest.PartnerId)
+		token, err = m.GenerateWithKid(kid, strings.ToLower(tokenRequest.Mac), tokenRequest.Ttl, tokenRequest.PartnerId)
 	} else {
-		token = m.Generate(strings.ToLower(tokenRequest.Mac), tokenRequest.Ttl)
+		token, err = m.GenerateWithKid(kid, strings.ToLower(tokenRequest.Mac), tokenRequest.Ttl)
+	}
+	if err != nil {
+		Error(w, http.StatusInternalServerError, common.NewError(err))
+		return
 	}
 
 	WriteOkResponse(w, token)
@@ -0,0 +1,103 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package http
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-akka/configuration"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/rdkcentral/webconfig/common"
+	"github.com/rdkcentral/webconfig/security"
+	"github.com/rdkcentral/webconfig/util"
+	"gotest.tools/assert"
+)
+
+func TestCreateTokenHandlerKid(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NilError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NilError(t, err)
+
+	dir := t.TempDir()
+	rsaKeyFile := filepath.Join(dir, "webconfig_key.pem")
+	err = os.WriteFile(rsaKeyFile, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}), 0600)
+	assert.NilError(t, err)
+	ecbytes, err := x509.MarshalECPrivateKey(ecKey)
+	assert.NilError(t, err)
+	ecKeyFile := filepath.Join(dir, "device-es256.pem")
+	err = os.WriteFile(ecKeyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: ecbytes}), 0600)
+	assert.NilError(t, err)
+
+	conf := configuration.ParseString(fmt.Sprintf(`
+webconfig.jwt.kid {
+    webconfig_key.private_key_file = "%v"
+    device-es256.private_key_file = "%v"
+}`, rsaKeyFile, ecKeyFile))
+
+	server := NewWebconfigServer(sc, true)
+	server.TokenManager = security.NewTokenManager(conf)
+	server.SetTokenApiEnabled(true)
+	defer server.SetTokenApiEnabled(false)
+	router := server.GetRouter(true)
+	cpeMac := util.GenerateRandomCpeMac()
+
+	createToken := func(kid string) (int, string) {
+		treq := TokenRequest{Mac: cpeMac, Ttl: 86400, Kid: kid}
+		bbytes, err := json.Marshal(treq)
+		assert.NilError(t, err)
+		req, err := http.NewRequest("POST", "/api/v1/token", bytes.NewReader(bbytes))
+		assert.NilError(t, err)
+		req.Header.Set(common.HeaderContentType, common.HeaderApplicationJson)
+		res := ExecuteRequest(req, router).Result()
+		rbytes, err := io.ReadAll(res.Body)
+		assert.NilError(t, err)
+		res.Body.Close()
+
+		var resp struct {
+			Data string `json:"data"`
+		}
+		_ = json.Unmarshal(rbytes, &resp)
+		return res.StatusCode, resp.Data
+	}
+
+	// the default kid signs by RS256, the ec kid by ES256
+	for kid, alg := range map[string]string{"": "RS256", "device-es256": "ES256"} {
+		status, token := createToken(kid)
+		assert.Equal(t, status, http.StatusOK)
+		parsed, _, err := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{})
+		assert.NilError(t, err)
+		assert.Equal(t, parsed.Method.Alg(), alg)
+	}
+
+	status, _ := createToken("no-such-kid")
+	assert.Equal(t, status, http.StatusBadRequest)
+}
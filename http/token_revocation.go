@@ -0,0 +1,295 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package http
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-akka/configuration"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/rdkcentral/webconfig/common"
+	"github.com/rdkcentral/webconfig/security"
+	"github.com/rdkcentral/webconfig/util"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultTokenRevocationCacheTtlSecs     = 60
+	defaultTokenRevocationMissCacheTtlSecs = 2
+	defaultTokenRevocationCacheMaxEntries  = 100000
+)
+
+// TokenRevocationCache keeps the revocation lookups for a short ttl so the middlewares do not
+// read the db for every call. Only the replica serving a revocation updates its cache, so the
+// misses are kept for a much shorter ttl: a new revocation applies on the other replicas after
+// the miss ttl, and after the ttl if it replaces a cached revocation of the same mac.
+type TokenRevocationCache struct {
+	sync.Mutex
+	ttl        time.Duration
+	missTtl    time.Duration
+	maxEntries int
+	entries    map[string]tokenRevocationCacheEntry
+}
+
+type tokenRevocationCacheEntry struct {
+	revocation *common.TokenRevocation
+	expiry     time.Time
+}
+
+func NewTokenRevocationCache(conf *configuration.Config) *TokenRevocationCache {
+	ttl := conf.GetInt32("webconfig.token_revocation.cache_ttl_in_secs", defaultTokenRevocationCacheTtlSecs)
+	missTtl := conf.GetInt32("webconfig.token_revocation.miss_cache_ttl_in_secs", defaultTokenRevocationMissCacheTtlSecs)
+	maxEntries := conf.GetInt32("webconfig.token_revocation.cache_max_entries", defaultTokenRevocationCacheMaxEntries)
+	return &TokenRevocationCache{
+		ttl:        time.Duration(ttl) * time.Second,
+		missTtl:    time.Duration(missTtl) * time.Second,
+		maxEntries: int(maxEntries),
+		entries:    map[string]tokenRevocationCacheEntry{},
+	}
+}
+
+// Get returns the cached revocation of a key, nil if the key is known not revoked
+func (c *TokenRevocationCache) Get(key string) (*common.TokenRevocation, bool) {
+	c.Lock()
+	defer c.Unlock()
+	entry, ok := c.entries[key]
+	if !ok || time.Now().After(entry.expiry) {
+		return nil, false
+	}
+	return entry.revocation, true
+}
+
+func (c *TokenRevocationCache) Set(key string, revocation *common.TokenRevocation) {
+	c.Lock()
+	defer c.Unlock()
+	now := time.Now()
+	if len(c.entries) >= c.maxEntries {
+		for k, entry := range c.entries {
+			if now.After(entry.expiry) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= c.maxEntries {
+			c.entries = map[string]tokenRevocationCacheEntry{}
+		}
+	}
+	ttl := c.ttl
+	if revocation == nil {
+		ttl = c.missTtl
+	}
+	c.entries[key] = tokenRevocationCacheEntry{
+		revocation: revocation,
+		expiry:     now.Add(ttl),
+	}
+}
+
+func tokenRevocationCacheKey(r *common.TokenRevocation) string {
+	if len(r.Jti) > 0 {
+		return "jti/" + r.Jti
+	}
+	return "mac/" + r.CpeMac
+}
+
+// getTokenRevocation looks up a revocation by the cache and then the db, nil if not revoked
+func (s *WebconfigServer) getTokenRevocation(key string, fn func(string) (*common.TokenRevocation, error), id string) (*common.TokenRevocation, error) {
+	cache := s.TokenRevocationCache()
+	if cache != nil {
+		if revocation, ok := cache.Get(key); ok {
+			return revocation, nil
+		}
+	}
+	revocation, err := fn(id)
+	if err != nil {
+		if !s.IsDbNotFound(err) {
+			return nil, common.NewError(err)
+		}
+		revocation = nil
+	}
+	if cache != nil {
+		cache.Set(key, revocation)
+	}
+	return revocation, nil
+}
+
+// IsTokenRevoked checks a verified token against the revocations of its jti and of its mac. A
+// lookup error is logged and the token is not treated as revoked.
+func (s *WebconfigServer) IsTokenRevoked(token string, fields log.Fields) bool {
+	if !s.TokenRevocationEnabled() {
+		return false
+	}
+	jti, mac, iat, err := security.ParseTokenRevocationClaims(token)
+	if err != nil {
+		return false
+	}
+	return s.isRevoked(jti, mac, iat, fields)
+}
+
+// IsCertRevoked checks a verified client certificate against the revocations of its mac, taking its
+// NotBefore as the issue time. A certificate has no jti, only a mac revocation applies.
+func (s *WebconfigServer) IsCertRevoked(cert *x509.Certificate, mac string, fields log.Fields) bool {
+	if !s.TokenRevocationEnabled() {
+		return false
+	}
+	return s.isRevoked("", mac, cert.NotBefore.Unix(), fields)
+}
+
+func (s *WebconfigServer) isRevoked(jti, mac string, iat int64, fields log.Fields) bool {
+	lookups := []*common.TokenRevocation{}
+	if len(jti) > 0 {
+		lookups = append(lookups, &common.TokenRevocation{Jti: jti})
+	}
+	if len(mac) > 0 {
+		lookups = append(lookups, &common.TokenRevocation{CpeMac: strings.ToUpper(mac)})
+	}
+	for _, lookup := range lookups {
+		fn, id := s.GetDeviceTokenRevocation, lookup.CpeMac
+		if len(lookup.Jti) > 0 {
+			fn, id = s.GetTokenRevocation, lookup.Jti
+		}
+		revocation, err := s.getTokenRevocation(tokenRevocationCacheKey(lookup), fn, id)
+		if err != nil {
+			tfields := common.FilterLogFields(fields)
+			tfields["logger"] = "token"
+			log.WithFields(tfields).Error(common.NewError(err))
+			continue
+		}
+		if revocation != nil && revocation.Revokes(jti, iat) {
+			return true
+		}
+	}
+	return false
+}
+
+// PostTokenRevocationHandler revokes a token by {"jti": ...}, or the tokens of a mac issued before
+// {"cpe_mac": ..., "issued_before": ...}, now by default
+func (s *WebconfigServer) PostTokenRevocationHandler(w http.ResponseWriter, r *http.Request) {
+	xw, ok := w.(*XResponseWriter)
+	if !ok {
+		err := *common.NewHttp500Error("responsewriter cast error")
+		Error(w, http.StatusInternalServerError, common.NewError(err))
+		return
+	}
+
+	var revocation common.TokenRevocation
+	if err := json.Unmarshal(xw.BodyBytes(), &revocation); err != nil {
+		err := *common.NewHttp400Error("invalid token revocation")
+		Error(w, http.StatusBadRequest, common.NewError(err))
+		return
+	}
+	revocation.CpeMac = strings.ToUpper(revocation.CpeMac)
+	if len(revocation.Jti) > 0 {
+		revocation.CpeMac = ""
+		revocation.IssuedBefore = 0
+	} else if util.ValidateMac(revocation.CpeMac) {
+		revocation.Expiry = 0
+		if revocation.IssuedBefore <= 0 {
+			revocation.IssuedBefore = time.Now().Unix()
+		}
+	} else {
+		err := *common.NewHttp400Error("jti or a valid cpe_mac is required")
+		Error(w, http.StatusBadRequest, common.NewError(err))
+		return
+	}
+	revocation.CreatedTime = time.Now().UnixMilli()
+
+	if err := s.SetTokenRevocation(&revocation); err != nil {
+		Error(w, http.StatusInternalServerError, common.NewError(err))
+		return
+	}
+	if cache := s.TokenRevocationCache(); cache != nil {
+		cache.Set(tokenRevocationCacheKey(&revocation), &revocation)
+	}
+	WriteOkResponse(w, revocation)
+}
+
+// TokenIntrospection is the decoded token, if it is verified by any of the configured keys
+type TokenIntrospection struct {
+	Active  bool                   `json:"active"`
+	Source  string                 `json:"source,omitempty"`
+	Header  map[string]interface{} `json:"header,omitempty"`
+	Claims  map[string]interface{} `json:"claims,omitempty"`
+	Revoked bool                   `json:"revoked"`
+	Errors  []string               `json:"errors,omitempty"`
+}
+
+// IntrospectTokenHandler verifies a token supplied by {"token": ...} against the key files and
+// the jwks of the server, and returns the header, the claims and the errors of each key source
+func (s *WebconfigServer) IntrospectTokenHandler(w http.ResponseWriter, r *http.Request) {
+	xw, ok := w.(*XResponseWriter)
+	if !ok {
+		err := *common.NewHttp500Error("responsewriter cast error")
+		Error(w, http.StatusInternalServerError, common.NewError(err))
+		return
+	}
+
+	var req struct {
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal(xw.BodyBytes(), &req); err != nil || len(req.Token) == 0 {
+		err := *common.NewHttp400Error("token is required")
+		Error(w, http.StatusBadRequest, common.NewError(err))
+		return
+	}
+
+	token, _, err := jwt.NewParser().ParseUnverified(req.Token, jwt.MapClaims{})
+	if err != nil {
+		err := *common.NewHttp400Error("malformed token")
+		Error(w, http.StatusBadRequest, common.NewError(err))
+		return
+	}
+	introspection := TokenIntrospection{
+		Header: token.Header,
+	}
+
+	sources := []string{}
+	verifyFns := []func(string) (jwt.MapClaims, error){}
+	if s.TokenManager != nil {
+		sources = append(sources, "key_file")
+		verifyFns = append(verifyFns, s.TokenManager.VerifiedClaims)
+	}
+	if s.JwksEnabled() && s.JwksManager != nil {
+		sources = append(sources, "api_jwks")
+		verifyFns = append(verifyFns, s.JwksManager.VerifiedClaims)
+	}
+	if s.CpeJwksEnabled() && s.CpeJwksManager() != nil {
+		sources = append(sources, "cpe_jwks")
+		verifyFns = append(verifyFns, s.CpeJwksManager().VerifiedClaims)
+	}
+	for i, fn := range verifyFns {
+		claims, err := fn(req.Token)
+		if err != nil {
+			introspection.Errors = append(introspection.Errors, sources[i]+": "+err.Error())
+			continue
+		}
+		introspection.Active = true
+		introspection.Source = sources[i]
+		introspection.Claims = claims
+		break
+	}
+
+	if introspection.Active && s.IsTokenRevoked(req.Token, xw.Audit()) {
+		introspection.Active = false
+		introspection.Revoked = true
+	}
+	WriteOkResponse(w, introspection)
+}
@@ -0,0 +1,183 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-akka/configuration"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/rdkcentral/webconfig/common"
+	"github.com/rdkcentral/webconfig/security"
+	"github.com/rdkcentral/webconfig/util"
+	"gotest.tools/assert"
+)
+
+func TestTokenRevocation(t *testing.T) {
+	server := NewWebconfigServer(sc, true)
+	signToken := setupApiTokenAuth(t, server)
+	server.SetTokenRevocationEnabled(true)
+	server.SetTokenRevocationCache(NewTokenRevocationCache(configuration.ParseString(`webconfig.token_revocation.cache_ttl_in_secs = 60`)))
+	router := server.GetRouter(false)
+	cpeMac := util.GenerateRandomCpeMac()
+	server.SetRootDocument(cpeMac, common.NewRootDocument(0, "fw1", "model1", "comcast", "", "", "", "", ""))
+
+	newToken := func(jti string) string {
+		return signToken(jwt.MapClaims{"jti": jti, "capabilities": []string{"webconfig:all"}})
+	}
+	adminToken := newToken(uuid.New().String())
+	leakedJti := uuid.New().String()
+	leakedToken := newToken(leakedJti)
+
+	url := fmt.Sprintf("/api/v1/device/%v/rootdocument", cpeMac)
+	status := callWithApiToken(t, router, "GET", url, nil, leakedToken)
+	assert.Equal(t, status, http.StatusOK)
+
+	// ==== revoke by jti, the cached miss is replaced right away ====
+	bbytes := []byte(fmt.Sprintf(`{"jti": "%v", "reason": "leaked"}`, leakedJti))
+	status = callWithApiToken(t, router, "POST", "/api/v1/token/revocations", bbytes, adminToken)
+	assert.Equal(t, status, http.StatusOK)
+
+	status = callWithApiToken(t, router, "GET", url, nil, leakedToken)
+	assert.Equal(t, status, http.StatusForbidden)
+	status = callWithApiToken(t, router, "GET", url, nil, adminToken)
+	assert.Equal(t, status, http.StatusOK)
+
+	revocation, err := server.GetTokenRevocation(leakedJti)
+	assert.NilError(t, err)
+	assert.Equal(t, revocation.Reason, "leaked")
+
+	// ==== another instance reads the revocation from the db ====
+	server2 := NewWebconfigServer(sc, true)
+	server2.SetTokenRevocationEnabled(true)
+	assert.Assert(t, server2.IsTokenRevoked(leakedToken, nil))
+	assert.Assert(t, !server2.IsTokenRevoked(adminToken, nil))
+
+	// ==== revoke the tokens of a mac issued before a time ====
+	cpeToken := server.Generate(strings.ToLower(cpeMac), 86400)
+	assert.Assert(t, !server.IsTokenRevoked(cpeToken, nil))
+	bbytes = []byte(fmt.Sprintf(`{"cpe_mac": "%v", "issued_before": %v}`, strings.ToLower(cpeMac), time.Now().Unix()-60))
+	status = callWithApiToken(t, router, "POST", "/api/v1/token/revocations", bbytes, adminToken)
+	assert.Equal(t, status, http.StatusOK)
+	assert.Assert(t, !server.IsTokenRevoked(cpeToken, nil))
+
+	time.Sleep(time.Second)
+	bbytes = []byte(fmt.Sprintf(`{"cpe_mac": "%v"}`, cpeMac))
+	status = callWithApiToken(t, router, "POST", "/api/v1/token/revocations", bbytes, adminToken)
+	assert.Equal(t, status, http.StatusOK)
+	revocation, err = server.GetDeviceTokenRevocation(cpeMac)
+	assert.NilError(t, err)
+	assert.Assert(t, revocation.IssuedBefore > 0)
+	assert.Assert(t, server.IsTokenRevoked(cpeToken, nil))
+	assert.Assert(t, server2.IsTokenRevoked(cpeToken, nil))
+	assert.Assert(t, !server.IsTokenRevoked(server.Generate(strings.ToLower(cpeMac), 86400), nil))
+
+	// ==== jti or mac is required ====
+	status = callWithApiToken(t, router, "POST", "/api/v1/token/revocations", []byte(`{"reason": "x"}`), adminToken)
+	assert.Equal(t, status, http.StatusBadRequest)
+
+	// ==== nothing is checked when disabled ====
+	server.SetTokenRevocationEnabled(false)
+	status = callWithApiToken(t, router, "GET", url, nil, leakedToken)
+	assert.Equal(t, status, http.StatusOK)
+}
+
+func TestTokenRevocationCacheMissTtl(t *testing.T) {
+	cache := NewTokenRevocationCache(configuration.ParseString(`webconfig.token_revocation.cache_ttl_in_secs = 60`))
+	assert.Equal(t, cache.missTtl, defaultTokenRevocationMissCacheTtlSecs*time.Second)
+	cache.missTtl = 10 * time.Millisecond
+
+	revocation := &common.TokenRevocation{Jti: uuid.New().String()}
+	cache.Set("jti/revoked", revocation)
+	cache.Set("jti/unknown", nil)
+	x, ok := cache.Get("jti/unknown")
+	assert.Assert(t, ok)
+	assert.Assert(t, x == nil)
+
+	// the miss expires first, so a revocation from another replica is read from the db
+	time.Sleep(20 * time.Millisecond)
+	_, ok = cache.Get("jti/unknown")
+	assert.Assert(t, !ok)
+	x, ok = cache.Get("jti/revoked")
+	assert.Assert(t, ok)
+	assert.Equal(t, x, revocation)
+}
+
+func TestIntrospectToken(t *testing.T) {
+	server := NewWebconfigServer(sc, true)
+	signToken := setupApiTokenAuth(t, server)
+	server.SetTokenRevocationEnabled(true)
+	router := server.GetRouter(false)
+	adminToken := signToken(jwt.MapClaims{"capabilities": []string{"webconfig:all"}})
+
+	introspect := func(token string) (int, TokenIntrospection) {
+		body := []byte(fmt.Sprintf(`{"token": "%v"}`, token))
+		req, err := http.NewRequest("POST", "/api/v1/token/introspect", strings.NewReader(string(body)))
+		assert.NilError(t, err)
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+		res := ExecuteRequest(req, router).Result()
+		rbytes, err := io.ReadAll(res.Body)
+		assert.NilError(t, err)
+		res.Body.Close()
+
+		var resp struct {
+			Data TokenIntrospection `json:"data"`
+		}
+		_ = json.Unmarshal(rbytes, &resp)
+		return res.StatusCode, resp.Data
+	}
+
+	jti := uuid.New().String()
+	token := signToken(jwt.MapClaims{"jti": jti, "sub": "orchestrator", "capabilities": []string{security.CapabilityPoke}})
+	status, ti := introspect(token)
+	assert.Equal(t, status, http.StatusOK)
+	assert.Assert(t, ti.Active)
+	assert.Equal(t, ti.Source, "key_file")
+	assert.Equal(t, ti.Header["kid"], "webconfig_key")
+	assert.Equal(t, ti.Claims["sub"], "orchestrator")
+	assert.Assert(t, !ti.Revoked)
+
+	// a revoked token
+	err := server.SetTokenRevocation(&common.TokenRevocation{Jti: jti})
+	assert.NilError(t, err)
+	status, ti = introspect(token)
+	assert.Equal(t, status, http.StatusOK)
+	assert.Assert(t, !ti.Active)
+	assert.Assert(t, ti.Revoked)
+
+	// an expired token keeps its header and errors for debugging
+	expired := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"exp": time.Now().Add(-time.Hour).Unix()})
+	expired.Header["kid"] = "webconfig_key"
+	expiredStr, err := expired.SignedString([]byte("secret"))
+	assert.NilError(t, err)
+	status, ti = introspect(expiredStr)
+	assert.Equal(t, status, http.StatusOK)
+	assert.Assert(t, !ti.Active)
+	assert.Equal(t, len(ti.Errors), 1)
+	assert.Equal(t, ti.Header["alg"], "HS256")
+
+	status, _ = introspect("not-a-token")
+	assert.Equal(t, status, http.StatusBadRequest)
+}
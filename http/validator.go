@@ -19,6 +19,7 @@ package http
 
 import (
 	"net/http"
+	"regexp"
 	"strings"
 
 	"github.com/gorilla/mux"
@@ -27,6 +28,23 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+// the subdoc ids are path segments and group_id elements, "root" is reserved for the root version
+var validSubdocIdRegexp = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// ValidateSubDocumentWrite checks the mac and the subdoc id of a kafka write. The http
+// document handlers get the subdoc id from the path and do not apply it.
+func (s *WebconfigServer) ValidateSubDocumentWrite(mac string, subdocId string) error {
+	if s.ValidateMacEnabled() && !util.ValidateMac(mac) {
+		err := *common.NewHttp400Error("invalid mac")
+		return common.NewError(err)
+	}
+	if !validSubdocIdRegexp.MatchString(subdocId) || subdocId == "root" {
+		err := *common.NewHttp400Error("invalid subdoc_id")
+		return common.NewError(err)
+	}
+	return nil
+}
+
 func (s *WebconfigServer) Validate(w http.ResponseWriter, r *http.Request, validateContent bool) (string, string, []byte, log.Fields, error) {
 	var fields log.Fields
 
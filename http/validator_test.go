@@ -351,3 +351,16 @@ func TestValidatorWithLowerCase(t *testing.T) {
 	assert.Assert(t, ok)
 	assert.DeepEqual(t, mpart.Bytes, wanBytes)
 }
+
+func TestValidateSubDocumentWrite(t *testing.T) {
+	server := NewWebconfigServer(sc, true)
+	server.SetValidateMacEnabled(true)
+	defer server.SetValidateMacEnabled(false)
+
+	cpeMac := util.GenerateRandomCpeMac()
+	assert.NilError(t, server.ValidateSubDocumentWrite(cpeMac, "privatessid"))
+	for _, subdocId := range []string{"", "root", "lan wan", "lan,wan"} {
+		assert.Assert(t, server.ValidateSubDocumentWrite(cpeMac, subdocId) != nil)
+	}
+	assert.Assert(t, server.ValidateSubDocumentWrite("foobar", "lan") != nil)
+}
@@ -20,6 +20,7 @@ package http
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
@@ -109,11 +110,14 @@ type WebconfigServer struct {
 	validateMacEnabled            bool
 	validPartners                 []string
 	jwksEnabled                   bool
+	cpeJwksEnabled                bool
+	cpeJwksManager                *security.CpeJwksManager
 	traceparentParentID           string
 	tracestateVendorID            string
 	supplementaryAppendingEnabled bool
 	kafkaProducerEnabled          bool
 	kafkaProducerTopic            string
+	kafkaReplyTopic               string
 	upstreamProfilesEnabled       bool
 	queryParamsValidationEnabled  bool
 	minTrust                      int
@@ -121,6 +125,21 @@ type WebconfigServer struct {
 	filterOutputByBitmapEnabled   bool
 	defaultEmptyProfileEnabled    bool
 	bitmapFilterExemptSubdocIds   []string
+	kafkaConsumerGroups           []KafkaConsumerGroupController
+	mqttTracker                   *MqttTracker
+	autoPoker                     *AutoPoker
+	deliveryScheduler             *DeliveryScheduler
+	overrideReverter              *OverrideReverter
+	stuckSweeper                  *StuckSweeper
+	subdocRetryPolicies           *SubdocRetryPolicies
+	rollbackPolicy                *RollbackPolicy
+	routeCapabilities             *security.RouteCapabilities
+	auditEnabled                  bool
+	tokenRevocationEnabled        bool
+	tokenRevocationCache          *TokenRevocationCache
+	serverTlsEnabled              bool
+	deviceAuth                    *DeviceAuth
+	partSigner                    common.PartSigner
 }
 
 func NewTlsConfig(conf *configuration.Config) (*tls.Config, error) {
@@ -225,6 +244,16 @@ func NewWebconfigServer(sc *common.ServerConfig, testOnly bool) *WebconfigServer
 		}
 	}
 
+	// setup jwks manager for the cpe tokens
+	cpeJwksEnabled := conf.GetBoolean("webconfig.jwt.cpe_token.jwks_enabled", defaultJwksEnabled)
+	var cpeJwksManager *security.CpeJwksManager
+	if cpeJwksEnabled {
+		cpeJwksManager, err = security.NewCpeJwksManager(conf, context.Background())
+		if err != nil {
+			panic(err)
+		}
+	}
+
 	metricsEnabled := conf.GetBoolean("webconfig.server.metrics_enabled", MetricsEnabledDefault)
 	factoryResetEnabled := conf.GetBoolean("webconfig.factory_reset_enabled", FactoryResetEnabledDefault)
 
@@ -266,7 +295,7 @@ func NewWebconfigServer(sc *common.ServerConfig, testOnly bool) *WebconfigServer
 	// kafka producer
 	var kafkaProducer sarama.AsyncProducer
 	kafkaProducerEnabled := conf.GetBoolean("webconfig.kafka_producer.enabled")
-	var kafkaProducerTopic string
+	var kafkaProducerTopic, kafkaReplyTopic string
 	if kafkaProducerEnabled {
 		brokersStr := conf.GetString("webconfig.kafka_producer.brokers")
 		if len(brokersStr) == 0 {
@@ -274,18 +303,19 @@ func NewWebconfigServer(sc *common.ServerConfig, testOnly bool) *WebconfigServer
 		}
 		brokers := strings.Split(brokersStr, ",")
 		kafkaProducerTopic = conf.GetString("webconfig.kafka_producer.topic")
+		kafkaReplyTopic = conf.GetString("webconfig.kafka_producer.reply_topic")
 
 		saramaConfig := sarama.NewConfig()
 		saramaConfig.Producer.Return.Errors = true
 
-		// Load TLS configuration for producer
-		tlsConfig, err := common.LoadKafkaTLSConfig(conf, "webconfig.kafka_producer")
-		if err != nil {
-			panic(fmt.Errorf("failed to load TLS configuration for Kafka producer: %v", err))
+		// Load TLS and SASL configuration for producer, an encrypted sasl password is decrypted
+		// by the codec of the encryption key when one is available
+		var decrypter common.Decrypter
+		if kcodec, err := security.NewAesCodec(conf); err == nil {
+			decrypter = kcodec
 		}
-		if tlsConfig != nil {
-			saramaConfig.Net.TLS.Enable = true
-			saramaConfig.Net.TLS.Config = tlsConfig
+		if err := common.ConfigureKafkaSecurity(conf, "webconfig.kafka_producer", saramaConfig, decrypter); err != nil {
+			panic(fmt.Errorf("failed to load security configuration for Kafka producer: %v", err))
 		}
 
 		kafkaProducer, err = sarama.NewAsyncProducer(brokers, saramaConfig)
@@ -307,17 +337,97 @@ func NewWebconfigServer(sc *common.ServerConfig, testOnly bool) *WebconfigServer
 	defaultEmptyProfileEnabled := conf.GetBoolean("webconfig.default_empty_profile_enabled")
 	bitmapFilterExemptSubdocIds := conf.GetStringList("webconfig.bitmap_filter_exempt_subdoc_ids")
 
+	webpaConnector := NewWebpaConnector(conf, tlsConfig)
+	if webpaConnector.AsyncPokeEnabled() {
+		webpaConnector.SetPokeQueue(NewPokeQueue(conf, dbclient, webpaConnector))
+	}
+
+	var deliveryScheduler *DeliveryScheduler
+	if conf.GetBoolean("webconfig.delivery_scheduler.enabled") {
+		deliveryScheduler, err = NewDeliveryScheduler(conf)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	var overrideReverter *OverrideReverter
+	if conf.GetBoolean("webconfig.override_reverter.enabled") {
+		overrideReverter = NewOverrideReverter(conf)
+	}
+
+	var stuckSweeper *StuckSweeper
+	if conf.GetBoolean("webconfig.stuck_sweeper.enabled") {
+		stuckSweeper = NewStuckSweeper(conf)
+	}
+
+	var subdocRetryPolicies *SubdocRetryPolicies
+	if conf.GetBoolean("webconfig.subdoc_retry.enabled") {
+		// the retries after the first one are poked by the delivery scheduler
+		if !conf.GetBoolean("webconfig.delivery_scheduler.enabled") {
+			panic(fmt.Errorf("webconfig.subdoc_retry requires webconfig.delivery_scheduler.enabled"))
+		}
+		subdocRetryPolicies = NewSubdocRetryPolicies(conf)
+	}
+
+	var rollbackPolicy *RollbackPolicy
+	if conf.GetBoolean("webconfig.rollback.enabled") {
+		rollbackPolicy = NewRollbackPolicy(conf)
+	}
+
+	// in-process tls, optionally with the client certificates of the devices
+	serverTlsEnabled := conf.GetBoolean("webconfig.server.tls.enabled")
+	var serverTlsConfig *tls.Config
+	var deviceAuth *DeviceAuth
+	if serverTlsEnabled {
+		serverTlsConfig, err = NewServerTlsConfig(conf)
+		if err != nil {
+			panic(err)
+		}
+		if conf.GetBoolean(deviceAuthConfigPath + ".enabled") {
+			deviceAuth, err = NewDeviceAuth(conf)
+			if err != nil {
+				panic(err)
+			}
+		}
+	}
+
+	// the parts sent to the devices are signed by the current private key of the kid
+	var partSigner common.PartSigner
+	if conf.GetBoolean("webconfig.payload_signing.enabled") && tokenManager != nil {
+		signer, err := tokenManager.PartSigner(conf.GetString("webconfig.payload_signing.kid", security.EncodingKeyId))
+		if err != nil {
+			panic(err)
+		}
+		partSigner = signer
+	}
+
+	tokenRevocationEnabled := conf.GetBoolean("webconfig.token_revocation.enabled")
+	var tokenRevocationCache *TokenRevocationCache
+	if tokenRevocationEnabled {
+		tokenRevocationCache = NewTokenRevocationCache(conf)
+	}
+
+	var mqttTracker *MqttTracker
+	if conf.GetBoolean("webconfig.mqtt.tracker.enabled") {
+		// the tracker is per replica, it cannot follow the reports of a shared subscription
+		if conf.GetBoolean("webconfig.mqtt.native.enabled") && len(conf.GetString("webconfig.mqtt.native.shared_group")) > 0 {
+			panic(fmt.Errorf("webconfig.mqtt.tracker requires webconfig.mqtt.native.shared_group to be empty"))
+		}
+		mqttTracker = NewMqttTracker(conf)
+	}
+
 	ws := &WebconfigServer{
 		Server: &http.Server{
 			Addr:         fmt.Sprintf("%v:%v", listenHost, port),
 			ReadTimeout:  time.Duration(conf.GetInt32("webconfig.server.read_timeout_in_secs", 3)) * time.Second,
 			WriteTimeout: time.Duration(conf.GetInt32("webconfig.server.write_timeout_in_secs", 3)) * time.Second,
+			TLSConfig:    serverTlsConfig,
 		},
 		DatabaseClient:                dbclient,
 		TokenManager:                  tokenManager,
 		JwksManager:                   jwksManager,
 		ServerConfig:                  sc,
-		WebpaConnector:                NewWebpaConnector(conf, tlsConfig),
+		WebpaConnector:                webpaConnector,
 		XconfConnector:                NewXconfConnector(conf, tlsConfig),
 		MqttConnector:                 NewMqttConnector(conf, tlsConfig),
 		UpstreamConnector:             NewUpstreamConnector(conf, tlsConfig),
@@ -335,24 +445,47 @@ func NewWebconfigServer(sc *common.ServerConfig, testOnly bool) *WebconfigServer
 		validateMacEnabled:            validateMacEnabled,
 		validPartners:                 validPartners,
 		jwksEnabled:                   jwksEnabled,
+		cpeJwksEnabled:                cpeJwksEnabled,
+		cpeJwksManager:                cpeJwksManager,
 		supplementaryAppendingEnabled: supplementaryAppendingEnabled,
 		kafkaProducerEnabled:          kafkaProducerEnabled,
 		kafkaProducerTopic:            kafkaProducerTopic,
+		kafkaReplyTopic:               kafkaReplyTopic,
 		upstreamProfilesEnabled:       upstreamProfilesEnabled,
 		queryParamsValidationEnabled:  queryParamsValidationEnabled,
 		minTrust:                      minTrust,
 		validSubdocIdMap:              validSubdocIdMap,
 		XpcTracer:                     xpcTracer,
 		filterOutputByBitmapEnabled:   filterOutputByBitmapEnabled,
+		mqttTracker:                   mqttTracker,
+		deliveryScheduler:             deliveryScheduler,
+		overrideReverter:              overrideReverter,
+		stuckSweeper:                  stuckSweeper,
+		subdocRetryPolicies:           subdocRetryPolicies,
+		rollbackPolicy:                rollbackPolicy,
+		routeCapabilities:             security.NewRouteCapabilities(conf),
+		auditEnabled:                  conf.GetBoolean("webconfig.audit.enabled"),
+		tokenRevocationEnabled:        tokenRevocationEnabled,
+		tokenRevocationCache:          tokenRevocationCache,
+		serverTlsEnabled:              serverTlsEnabled,
+		deviceAuth:                    deviceAuth,
+		partSigner:                    partSigner,
 		defaultEmptyProfileEnabled:    defaultEmptyProfileEnabled,
 		bitmapFilterExemptSubdocIds:   bitmapFilterExemptSubdocIds,
 	}
+	ws.autoPoker = NewAutoPoker(conf, ws.AutoPoke)
 
 	return ws
 }
 
 func (s *WebconfigServer) Stop() {
 	s.StopXpcTracer()
+	if p := s.AutoPoker(); p != nil {
+		p.Stop()
+	}
+	if c := s.MqttNativeClient(); c != nil {
+		c.Close()
+	}
 }
 
 func (s *WebconfigServer) TestingMiddleware(next http.Handler) http.Handler {
@@ -420,6 +553,32 @@ func (s *WebconfigServer) CpeMiddleware(next http.Handler) http.Handler {
 			}
 		}
 
+		// a verified client certificate of the device, if the route accepts it
+		if a := s.DeviceAuth(); a != nil {
+			mode := DeviceAuthJwt
+			if route := mux.CurrentRoute(r); route != nil {
+				if pathTemplate, err := route.GetPathTemplate(); err == nil {
+					mode = a.Mode(r.Method, pathTemplate)
+				}
+			}
+			if mode != DeviceAuthJwt {
+				if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+					if err := s.authorizeClientCert(xw, r.TLS.VerifiedChains[0][0], mac); err != nil {
+						fields["error"] = common.NewError(err)
+						Error(xw, http.StatusForbidden, nil)
+						return
+					}
+					next.ServeHTTP(xw, r)
+					return
+				}
+				if mode == DeviceAuthMtls {
+					fields["error"] = common.NewError(errors.New("CpeMiddleware() error no client certificate"))
+					Error(xw, http.StatusForbidden, nil)
+					return
+				}
+			}
+		}
+
 		authorization := r.Header.Get("Authorization")
 		var tokenErr error
 		if len(token) > 0 {
@@ -437,6 +596,10 @@ func (s *WebconfigServer) CpeMiddleware(next http.Handler) http.Handler {
 					isValid = false
 					tokenErr = common.NewError(common.ErrLowTrust)
 				}
+				if s.IsTokenRevoked(token, fields) {
+					isValid = false
+					tokenErr = common.NewError(errors.New("CpeMiddleware() error token revoked"))
+				}
 				xw.SetPartnerId(partnerId)
 			} else {
 				tokenErr = common.NewError(err)
@@ -466,6 +629,7 @@ func (s *WebconfigServer) ApiMiddleware(next http.Handler) http.Handler {
 		defer s.logRequestEnds(xw, r)
 
 		isValid := false
+		status := http.StatusForbidden
 		token := xw.Token()
 		if len(token) > 0 {
 			var kid string
@@ -477,13 +641,38 @@ func (s *WebconfigServer) ApiMiddleware(next http.Handler) http.Handler {
 			tfields["logger"] = "token"
 			tfields["kid"] = kid
 
-			if ok, err := s.VerifyApiToken(token); ok {
+			// the capability required by the route
+			var capability string
+			if route := mux.CurrentRoute(r); route != nil {
+				if pathTemplate, err := route.GetPathTemplate(); err == nil {
+					capability = s.RouteCapabilities().Required(r.Method, pathTemplate)
+				}
+			}
+			tfields["capability"] = capability
+
+			if ok, err := s.VerifyApiToken(token, capability); ok {
 				isValid = true
 				log.WithFields(tfields).Debug("valid")
 			} else {
 				tfields["error"] = fmt.Sprintf("ApiMiddleware::VerifyApiToken() %v", err)
 				log.WithFields(tfields).Debug("rejected")
 			}
+
+			// a partner scoped token only reaches the devices of its partners
+			if isValid {
+				if x, err := s.authorizePartnerScope(xw, r, token); x > 0 {
+					isValid = false
+					status = x
+					tfields["error"] = fmt.Sprintf("ApiMiddleware::authorizePartnerScope() %v", err)
+					log.WithFields(tfields).Debug("rejected")
+				}
+			}
+
+			if isValid && s.IsTokenRevoked(token, fields) {
+				isValid = false
+				tfields["error"] = "ApiMiddleware() error token revoked"
+				log.WithFields(tfields).Debug("rejected")
+			}
 		} else {
 			xw.LogDebug(r, "token", "ApiMiddleware() error no token")
 		}
@@ -491,12 +680,36 @@ func (s *WebconfigServer) ApiMiddleware(next http.Handler) http.Handler {
 		if isValid {
 			next.ServeHTTP(xw, r)
 		} else {
-			Error(xw, http.StatusForbidden, nil)
+			Error(xw, status, nil)
 		}
 	}
 	return http.HandlerFunc(fn)
 }
 
+// authorizeClientCert binds the mac of a verified client certificate to the mac of the route, and
+// takes the partner of the certificate like the partner of a cpe token
+func (s *WebconfigServer) authorizeClientCert(xw *XResponseWriter, cert *x509.Certificate, mac string) error {
+	certMac, partnerId, err := s.DeviceAuth().CertIdentity(cert)
+	if err != nil {
+		return common.NewError(err)
+	}
+	if certMac != mac {
+		return common.NewError(fmt.Errorf("mac in client certificate(%v) does not match mac(%v)", certMac, mac))
+	}
+
+	fields := xw.Audit()
+	fields["auth"] = DeviceAuthMtls
+	fields["src_partner"] = partnerId
+	if err := s.ValidatePartner(partnerId); err != nil {
+		partnerId = "unknown"
+	}
+	xw.SetPartnerId(partnerId)
+	if s.IsCertRevoked(cert, mac, fields) {
+		return common.NewError(errors.New("client certificate revoked"))
+	}
+	return nil
+}
+
 func (s *WebconfigServer) TestingCpeMiddleware(next http.Handler) http.Handler {
 	fn := func(w http.ResponseWriter, r *http.Request) {
 		xw := NewXResponseWriter(w)
@@ -532,19 +745,87 @@ func (s *WebconfigServer) TestingCpeMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(fn)
 }
 
-func (s *WebconfigServer) VerifyApiToken(tokenStr string) (bool, error) {
+// VerifyApiToken verifies an api token for a route. An empty capability means the route is not
+// mapped and the token needs one of the full access capabilities.
+func (s *WebconfigServer) VerifyApiToken(tokenStr string, capability string) (bool, error) {
 	if s.JwksEnabled() {
-		if _, err := s.JwksManager.VerifyApiToken(tokenStr); err != nil {
+		if _, err := s.JwksManager.VerifyApiTokenCapability(tokenStr, capability); err != nil {
 			return false, common.NewError(err)
 		}
 	} else {
-		if _, err := s.TokenManager.VerifyApiToken(tokenStr); err != nil {
+		if _, err := s.TokenManager.VerifyApiTokenCapability(tokenStr, capability); err != nil {
 			return false, common.NewError(err)
 		}
 	}
 	return true, nil
 }
 
+// VerifyCpeToken verifies a cpe token by the jwks keys if enabled, otherwise by the public key files
+func (s *WebconfigServer) VerifyCpeToken(token string, mac string) (bool, string, int, error) {
+	if s.CpeJwksEnabled() {
+		return s.CpeJwksManager().VerifyCpeToken(token, mac)
+	}
+	return s.TokenManager.VerifyCpeToken(token, mac)
+}
+
+func (s *WebconfigServer) RouteCapabilities() *security.RouteCapabilities {
+	return s.routeCapabilities
+}
+
+func (s *WebconfigServer) SetRouteCapabilities(c *security.RouteCapabilities) {
+	s.routeCapabilities = c
+}
+
+func (s *WebconfigServer) AuditEnabled() bool {
+	return s.auditEnabled
+}
+
+func (s *WebconfigServer) SetAuditEnabled(enabled bool) {
+	s.auditEnabled = enabled
+}
+
+func (s *WebconfigServer) ServerTlsEnabled() bool {
+	return s.serverTlsEnabled
+}
+
+func (s *WebconfigServer) SetServerTlsEnabled(enabled bool) {
+	s.serverTlsEnabled = enabled
+}
+
+// DeviceAuth is nil unless the client certificates of the devices are verified
+func (s *WebconfigServer) DeviceAuth() *DeviceAuth {
+	return s.deviceAuth
+}
+
+func (s *WebconfigServer) SetDeviceAuth(a *DeviceAuth) {
+	s.deviceAuth = a
+}
+
+// PartSigner is nil unless the payloads to the devices are signed
+func (s *WebconfigServer) PartSigner() common.PartSigner {
+	return s.partSigner
+}
+
+func (s *WebconfigServer) SetPartSigner(signer common.PartSigner) {
+	s.partSigner = signer
+}
+
+func (s *WebconfigServer) TokenRevocationEnabled() bool {
+	return s.tokenRevocationEnabled
+}
+
+func (s *WebconfigServer) SetTokenRevocationEnabled(enabled bool) {
+	s.tokenRevocationEnabled = enabled
+}
+
+func (s *WebconfigServer) TokenRevocationCache() *TokenRevocationCache {
+	return s.tokenRevocationCache
+}
+
+func (s *WebconfigServer) SetTokenRevocationCache(c *TokenRevocationCache) {
+	s.tokenRevocationCache = c
+}
+
 func (s *WebconfigServer) MetricsEnabled() bool {
 	return s.metricsEnabled
 }
@@ -644,6 +925,22 @@ func (s *WebconfigServer) SetJwksEnabled(enabled bool) {
 	s.jwksEnabled = enabled
 }
 
+func (s *WebconfigServer) CpeJwksEnabled() bool {
+	return s.cpeJwksEnabled
+}
+
+func (s *WebconfigServer) SetCpeJwksEnabled(enabled bool) {
+	s.cpeJwksEnabled = enabled
+}
+
+func (s *WebconfigServer) CpeJwksManager() *security.CpeJwksManager {
+	return s.cpeJwksManager
+}
+
+func (s *WebconfigServer) SetCpeJwksManager(m *security.CpeJwksManager) {
+	s.cpeJwksManager = m
+}
+
 func (s *WebconfigServer) TraceparentParentID() string {
 	return s.traceparentParentID
 }
@@ -684,6 +981,14 @@ func (s *WebconfigServer) SetKafkaProducerTopic(x string) {
 	s.kafkaProducerTopic = x
 }
 
+func (s *WebconfigServer) KafkaReplyTopic() string {
+	return s.kafkaReplyTopic
+}
+
+func (s *WebconfigServer) SetKafkaReplyTopic(x string) {
+	s.kafkaReplyTopic = x
+}
+
 func (s *WebconfigServer) UpstreamProfilesEnabled() bool {
 	return s.upstreamProfilesEnabled
 }
@@ -759,7 +1064,8 @@ func (c *WebconfigServer) Poke(rHeader http.Header, cpeMac string, token string,
 	body := fmt.Sprintf(common.PokeBodyTemplate, pokeStr)
 	transactionId, err := c.Patch(rHeader, cpeMac, token, []byte(body), fields)
 	if err != nil {
-		return "", common.NewError(err)
+		// the transaction id still tracks a poke queued or retried after a 524
+		return transactionId, common.NewError(err)
 	}
 	return transactionId, nil
 }
@@ -1056,6 +1362,77 @@ func (s *WebconfigServer) ForwardKafkaMessage(kbytes []byte, m *common.EventMess
 	log.WithFields(tfields).Info("send")
 }
 
+// ForwardStateMessage forwards a device state report to the kafka producer. A 304 without
+// subdoc reports also forwards a root/success message for each subdoc it updated.
+func (s *WebconfigServer) ForwardStateMessage(kbytes []byte, m *common.EventMessage, updatedSubdocIds []string, fields log.Fields) {
+	s.ForwardKafkaMessage(kbytes, m, fields)
+	if len(m.Reports) > 0 || m.HttpStatusCode == nil || *m.HttpStatusCode != http.StatusNotModified {
+		return
+	}
+	// build a root/success message
+	applicationStatus := "success"
+	for _, subdocId := range updatedSubdocIds {
+		subdocId := subdocId
+		em := &common.EventMessage{
+			Namespace:         &subdocId,
+			ApplicationStatus: &applicationStatus,
+			DeviceId:          m.DeviceId,
+			TransactionUuid:   m.TransactionUuid,
+			Version:           m.Version,
+		}
+		s.ForwardKafkaMessage(kbytes, em, fields)
+	}
+}
+
+// ObserveEventMetrics updates the duration and count metrics of a device event, read either
+// from kafka or from the mqtt broker. The events not read from kafka use partition -1.
+func (s *WebconfigServer) ObserveEventMetrics(eventName string, m *common.EventMessage, duration int, partition int32, err error) {
+	metrics := s.Metrics()
+	if metrics == nil || m == nil {
+		return
+	}
+	metrics.ObserveKafkaDuration(eventName, eventMetricsAgent(m), duration)
+	status := "success"
+	if err != nil {
+		status = "fail"
+	}
+	metrics.CountKafkaEvents(eventName, status, partition)
+}
+
+func eventMetricsAgent(m *common.EventMessage) string {
+	if m.MetricsAgent != nil {
+		return *m.MetricsAgent
+	}
+	return "default"
+}
+
+// ForwardWriteResult publishes the result of a kafka subdoc write to the reply topic, keyed by the correlation id
+func (s *WebconfigServer) ForwardWriteResult(result *common.SubDocumentWriteResult, fields log.Fields) {
+	if !s.KafkaProducerEnabled() || len(s.KafkaReplyTopic()) == 0 {
+		return
+	}
+	tfields := common.CopyCoreLogFields(fields)
+
+	bbytes, err := json.Marshal(result)
+	if err != nil {
+		tfields["logger"] = "error"
+		log.WithFields(tfields).Error(common.NewError(err))
+		return
+	}
+	outMessage := &sarama.ProducerMessage{
+		Topic: s.KafkaReplyTopic(),
+		Key:   sarama.StringEncoder(result.CorrelationId),
+		Value: sarama.ByteEncoder(bbytes),
+	}
+	s.Input() <- outMessage
+
+	tfields["logger"] = "kafkaproducer"
+	tfields["output_topic"] = outMessage.Topic
+	tfields["output_key"] = result.CorrelationId
+	tfields["output_body"] = result
+	log.WithFields(tfields).Info("send")
+}
+
 func (s *WebconfigServer) ForwardSuccessKafkaMessages(messages []common.EventMessage, fields log.Fields) {
 	tfields := common.CopyCoreLogFields(fields)
 	tfields["logger"] = "kafkaproducer"
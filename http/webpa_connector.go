@@ -23,6 +23,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/go-akka/configuration"
@@ -66,11 +67,12 @@ type WebpaConnector struct {
 	asyncClient      *HttpClient
 	host             string
 	urlTemplate      string
-	queue            chan struct{}
+	pokeQueue        *PokeQueue
 	retries          int
-	retryInMsecs     int
 	asyncPokeEnabled bool
 	apiVersion       string
+	conf             *configuration.Config
+	authToken        string
 }
 
 func syncHandle520(rbytes []byte) ([]byte, http.Header, bool, error) {
@@ -114,14 +116,8 @@ func asyncHandle520(rbytes []byte) ([]byte, http.Header, bool, error) {
 func NewWebpaConnector(conf *configuration.Config, tlsConfig *tls.Config) *WebpaConnector {
 	host := conf.GetString("webconfig.webpa.host", defaultWebpaHost)
 	asyncPokeEnabled := conf.GetBoolean("webconfig.webpa.async_poke_enabled", false)
-	concurrentCalls := int(conf.GetInt32("webconfig.webpa.async_poke_concurrent_calls", 0))
-	var queue chan struct{}
-	if concurrentCalls > 0 {
-		queue = make(chan struct{}, concurrentCalls)
-	}
 
 	retries := int(conf.GetInt32("webconfig.webpa.retries", defaultRetries))
-	retryInMsecs := int(conf.GetInt32("webconfig.webpa.retry_in_msecs", defaultRetriesInMsecs))
 	apiVersion := conf.GetString("webconfig.webpa.api_version", defaultApiVersion)
 	urlTemplate := conf.GetString("webconfig.webpa.url_template", defaultWebpaUrlTemplate)
 
@@ -129,17 +125,18 @@ func NewWebpaConnector(conf *configuration.Config, tlsConfig *tls.Config) *Webpa
 	syncClient.SetStatusHandler(520, syncHandle520)
 	asyncClient := NewHttpClient(conf, asyncWebpaServiceName, tlsConfig)
 	asyncClient.SetStatusHandler(520, asyncHandle520)
+	// both clients retry by the webpa settings and share one retry budget
+	asyncClient.SetRetryPolicy(syncClient.RetryPolicy())
 
 	connector := WebpaConnector{
 		syncClient:       syncClient,
 		asyncClient:      asyncClient,
 		host:             host,
-		queue:            queue,
 		retries:          retries,
-		retryInMsecs:     retryInMsecs,
 		asyncPokeEnabled: asyncPokeEnabled,
 		apiVersion:       apiVersion,
 		urlTemplate:      urlTemplate,
+		conf:             conf,
 	}
 
 	return &connector
@@ -169,13 +166,12 @@ func (c *WebpaConnector) SetApiVersion(apiVersion string) {
 	c.apiVersion = apiVersion
 }
 
-func (c *WebpaConnector) NewQueue(capacity int) error {
-	if c.queue != nil {
-		err := fmt.Errorf("queue is already initialized")
-		return common.NewError(err)
-	}
-	c.queue = make(chan struct{}, capacity)
-	return nil
+func (c *WebpaConnector) PokeQueue() *PokeQueue {
+	return c.pokeQueue
+}
+
+func (c *WebpaConnector) SetPokeQueue(q *PokeQueue) {
+	c.pokeQueue = q
 }
 
 func (c *WebpaConnector) AsyncPokeEnabled() bool {
@@ -186,6 +182,33 @@ func (c *WebpaConnector) SetAsyncPokeEnabled(enabled bool) {
 	c.asyncPokeEnabled = enabled
 }
 
+// SetAuthToken sets a fixed credential, which takes precedence over webconfig.webpa.auth_token_secret
+func (c *WebpaConnector) SetAuthToken(x string) {
+	c.authToken = x
+}
+
+// authorization returns the Authorization header of a call without one, like the pokes of the
+// background jobs. The token of the caller comes first, then the credential of the connector.
+// The secret is read on every call, the secret providers cache it and pick up its rotation.
+func (c *WebpaConnector) authorization(token string) (string, error) {
+	if len(token) == 0 {
+		token = c.authToken
+	}
+	if len(token) == 0 && c.conf != nil {
+		tbytes, ok, err := common.ReadConfigSecret(c.conf, "webconfig.webpa.auth_token")
+		if err != nil {
+			return "", common.NewError(err)
+		}
+		if ok {
+			token = strings.TrimSpace(string(tbytes))
+		}
+	}
+	if len(token) == 0 {
+		return "", nil
+	}
+	return "Bearer " + token, nil
+}
+
 func (c *WebpaConnector) Patch(rHeader http.Header, cpeMac string, token string, bbytes []byte, fields log.Fields) (string, error) {
 	url := fmt.Sprintf(c.WebpaUrlTemplate(), c.WebpaHost(), c.ApiVersion(), cpeMac)
 
@@ -209,6 +232,15 @@ func (c *WebpaConnector) Patch(rHeader http.Header, cpeMac string, token string,
 	transactionId := fmt.Sprintf("%s_____%015x", xmTraceId, t)
 	header := rHeader.Clone()
 	header.Set("X-Webpa-Transaction-Id", transactionId)
+	if len(header.Get(common.HeaderAuthorization)) == 0 {
+		authorization, err := c.authorization(token)
+		if err != nil {
+			return "", common.NewError(err)
+		}
+		if len(authorization) > 0 {
+			header.Set(common.HeaderAuthorization, authorization)
+		}
+	}
 
 	method := "PATCH"
 	_, _, cont, err := c.syncClient.Do(method, url, header, bbytes, fields, webpaServiceName, 0)
@@ -216,9 +248,10 @@ func (c *WebpaConnector) Patch(rHeader http.Header, cpeMac string, token string,
 		var rherr common.RemoteHttpError
 		if errors.As(err, &rherr) {
 			if rherr.StatusCode == 524 {
-				if c.asyncPokeEnabled {
-					c.queue <- struct{}{}
-					go c.AsyncDoWithRetries(method, url, header, bbytes, fields, asyncWebpaServiceName)
+				if c.asyncPokeEnabled && c.pokeQueue != nil {
+					if qerr := c.pokeQueue.Enqueue(cpeMac, transactionId, url, header, bbytes); qerr != nil {
+						return transactionId, common.NewError(qerr)
+					}
 				} else {
 					_, err := c.SyncDoWithRetries(method, url, header, bbytes, fields, webpaServiceName)
 					if err != nil {
@@ -240,31 +273,6 @@ func (c *WebpaConnector) Patch(rHeader http.Header, cpeMac string, token string,
 	return transactionId, nil
 }
 
-func (c *WebpaConnector) AsyncDoWithRetries(method string, url string, header http.Header, bbytes []byte, fields log.Fields, loggerName string) {
-	tfields := common.FilterLogFields(fields, "status")
-	tfields["logger"] = "asyncwebpa"
-	for i := 1; i <= c.retries; i++ {
-		cbytes := make([]byte, len(bbytes))
-		copy(cbytes, bbytes)
-		if i > 0 {
-			time.Sleep(time.Duration(c.retryInMsecs) * time.Millisecond)
-		}
-		_, _, cont, _ := c.asyncClient.Do(method, url, header, cbytes, fields, loggerName, i)
-		if !cont {
-			msg := fmt.Sprintf("finished success after 1 retry")
-			if i > 1 {
-				fmt.Sprintf("finished success after %v retries", i)
-			}
-			log.WithFields(tfields).Info(msg)
-			break
-		}
-		if i == c.retries {
-			log.WithFields(tfields).Infof("finished failure after %v retries", i)
-		}
-	}
-	<-c.queue
-}
-
 // this has 1 less retries compared to the standard DoWithRetries()
 func (c *WebpaConnector) SyncDoWithRetries(method string, url string, header http.Header, bbytes []byte, fields log.Fields, loggerName string) ([]byte, error) {
 	var rbytes []byte
@@ -274,8 +282,11 @@ func (c *WebpaConnector) SyncDoWithRetries(method string, url string, header htt
 	for i := 1; i <= c.retries; i++ {
 		cbytes := make([]byte, len(bbytes))
 		copy(cbytes, bbytes)
-		if i > 0 {
-			time.Sleep(time.Duration(c.retryInMsecs) * time.Millisecond)
+		if !c.syncClient.RetryPolicy().Wait(i) {
+			tfields := common.FilterLogFields(fields, "status")
+			tfields["logger"] = loggerName
+			log.WithFields(tfields).Warnf("%v retry budget exhausted, retry=%v skipped", loggerName, i)
+			break
 		}
 		rbytes, _, cont, err = c.syncClient.Do(method, url, header, cbytes, fields, loggerName, i)
 		if !cont {
@@ -19,16 +19,11 @@ package kafka
 
 import (
 	"encoding/base64"
-	"encoding/json"
 	"errors"
-	"fmt"
-	"net/http"
-	"strings"
 	"time"
 
 	"github.com/IBM/sarama"
 	"github.com/rdkcentral/webconfig/common"
-	"github.com/rdkcentral/webconfig/db"
 	wchttp "github.com/rdkcentral/webconfig/http"
 	"github.com/rdkcentral/webconfig/util"
 	log "github.com/sirupsen/logrus"
@@ -44,6 +39,7 @@ type Consumer struct {
 	clusterName                string
 	offsetEnum                 int64
 	topicPartitionsMap         map[string][]int32
+	control                    *consumerControl
 }
 
 func NewConsumer(s *wchttp.WebconfigServer, ratelimitMessagesPerSecond int, m *common.AppMetrics, clusterName string, offsetEnum int64, topicPartitionsMap map[string][]int32) *Consumer {
@@ -55,6 +51,7 @@ func NewConsumer(s *wchttp.WebconfigServer, ratelimitMessagesPerSecond int, m *c
 		clusterName:                clusterName,
 		offsetEnum:                 offsetEnum,
 		topicPartitionsMap:         topicPartitionsMap,
+		control:                    newConsumerControl(),
 	}
 }
 
@@ -68,6 +65,8 @@ func (c *Consumer) Setup(session sarama.ConsumerGroupSession) error {
 			}
 		}
 	}
+	// offsets requested through the admin api
+	c.control.applyPendingOffsets(session)
 	close(c.Ready)
 	return nil
 }
@@ -78,93 +77,12 @@ func (c *Consumer) Cleanup(sarama.ConsumerGroupSession) error {
 }
 
 func (c *Consumer) handleNotification(bbytes []byte, fields log.Fields) (*common.EventMessage, []string, error) {
-	var m common.EventMessage
-	err := json.Unmarshal(bbytes, &m)
-	if err != nil {
-		return nil, nil, common.NewError(err)
-	}
-
-	fields["body"] = m
-	cpeMac, err := m.Validate(true)
-	if err != nil {
-		return nil, nil, common.NewError(err)
-	}
-
-	if m.ErrorDetails != nil && *m.ErrorDetails == "max_retry_reached" {
-		return &m, nil, nil
-	}
-
-	fields["cpemac"] = cpeMac
-	fields["cpe_mac"] = cpeMac
-	updatedSubdocIds, err := db.UpdateDocumentState(c.DatabaseClient, cpeMac, &m, fields)
-	if err != nil {
-		// NOTE return the *eventMessage
-		return &m, updatedSubdocIds, common.NewError(err)
-	}
-	return &m, updatedSubdocIds, nil
+	return c.HandleStateNotification(bbytes, fields)
 }
 
 // NOTE we choose to return an EventMessage object just to pass along the metricsAgent
 func (c *Consumer) handleGetMessage(inbytes []byte, fields log.Fields) (*common.EventMessage, error) {
-	rHeader, _ := util.ParseHttp(inbytes)
-	params := rHeader.Get(common.HeaderDocName)
-	cpeMac := rHeader.Get(common.HeaderDeviceId)
-	if len(cpeMac) == 0 {
-		cpeMac = rHeader.Get("Mac")
-	}
-	cpeMac = strings.ToUpper(cpeMac)
-	rHeader.Set(common.HeaderDeviceId, cpeMac)
-
-	// TODO parse themis token and extract mac
-	fields["cpemac"] = cpeMac
-	fields["cpe_mac"] = cpeMac
-	if len(params) > 0 {
-		fields["path"] = fmt.Sprintf("/api/v1/device/%v/config?group_id=%v", cpeMac, params)
-	} else {
-		fields["path"] = fmt.Sprintf("/api/v1/device/%v/config", cpeMac)
-	}
-
-	var m common.EventMessage
-	if x := rHeader.Get(common.HeaderMetricsAgent); len(x) > 0 {
-		fields["metrics_agent"] = x
-		m.MetricsAgent = &x
-	}
-	var transactionId string
-	if x := rHeader.Get("Transaction-ID"); len(x) > 0 {
-		fields["transaction_id"] = x
-		fields["trace_id"] = x
-		transactionId = x
-	}
-
-	// remote sensitive headers
-	logHeaders := rHeader.Clone()
-	logHeaders.Del("Authorization")
-	d := make(util.Dict)
-	d.Update(logHeaders)
-	fields["header"] = d
-	log.WithFields(fields).Info("request starts")
-
-	// handle empty schema version header
-	if x := rHeader.Get(common.HeaderSchemaVersion); len(x) == 0 {
-		rHeader.Set(common.HeaderSchemaVersion, "none")
-	}
-
-	status, respHeader, respBytes, err := wchttp.BuildWebconfigResponse(c.WebconfigServer, rHeader, common.RouteMqtt, fields)
-	if err != nil && respBytes == nil {
-		respBytes = []byte(err.Error())
-	}
-
-	fields["status"] = status
-	if len(transactionId) > 0 {
-		respHeader.Set("Transaction-ID", transactionId)
-	}
-
-	mqttBytes := common.BuildPayloadAsHttp(status, respHeader, respBytes)
-	_, err = c.PostMqtt(cpeMac, mqttBytes, fields)
-	if err != nil {
-		return &m, common.NewError(err)
-	}
-	return &m, nil
+	return c.HandleMqttGet(inbytes, fields)
 }
 
 // ConsumeClaim must start a consumer loop of ConsumerGroupClaim's Messages().
@@ -176,6 +94,9 @@ func (c *Consumer) ConsumeClaim(session sarama.ConsumerGroupSession, claim saram
 	rl := ratelimit.New(c.ratelimitMessagesPerSecond, ratelimit.WithoutSlack) // per second, no slack.
 
 	for {
+		if !c.control.waitIfPaused(session.Context()) {
+			return nil
+		}
 		rl.Take()
 		select {
 		case message := <-claim.Messages():
@@ -220,6 +141,9 @@ func (c *Consumer) ConsumeClaim(session sarama.ConsumerGroupSession, claim saram
 			case "webpa-state":
 				m, updatedSubdocIds, err = c.handleNotification(message.Value, fields)
 				logMessage = "ok"
+			case "subdoc-upsert", "subdoc-delete":
+				m, err = c.handleWriteMessage(eventName, message, fields)
+				logMessage = "ok"
 			}
 
 			session.MarkMessage(message, "")
@@ -240,51 +164,29 @@ func (c *Consumer) ConsumeClaim(session sarama.ConsumerGroupSession, claim saram
 					log.WithFields(fields).Error("errors")
 				}
 			} else {
-				forwardMessage = true
+				// write results go to the reply topic instead
+				forwardMessage = !isWriteEvent(eventName)
 				log.WithFields(fields).Info(logMessage)
 			}
 
 			// build metrics dimensions and update metrics
-			metrics := c.WebconfigServer.Metrics()
-			if metrics != nil && m != nil {
+			if metrics := c.WebconfigServer.Metrics(); metrics != nil && m != nil {
+				// TODO try to read metricsAgent from fields["metrics_agent"]
 				metricsAgent := "default"
 				if m.MetricsAgent != nil {
 					metricsAgent = *m.MetricsAgent
 				}
-				// TODO try to read metricsAgent from fields["metrics_agent"]
 				metrics.ObserveKafkaLag(eventName, metricsAgent, lag, message.Partition)
-				metrics.ObserveKafkaDuration(eventName, metricsAgent, duration)
-				status := "success"
-				if err != nil {
-					status = "fail"
-				}
-				metrics.CountKafkaEvents(eventName, status, message.Partition)
 			}
+			c.ObserveEventMetrics(eventName, m, duration, message.Partition, err)
 
 			if c.KafkaProducerEnabled() && m != nil && forwardMessage {
-				c.ForwardKafkaMessage(message.Key, m, fields)
-				if len(m.Reports) == 0 {
-					if m.HttpStatusCode != nil && *m.HttpStatusCode == http.StatusNotModified && len(updatedSubdocIds) > 0 {
-						// build a root/success message
-						applicationStatus := "success"
-						for _, subdocId := range updatedSubdocIds {
-							em := &common.EventMessage{
-								Namespace:         &subdocId,
-								ApplicationStatus: &applicationStatus,
-								DeviceId:          m.DeviceId,
-								TransactionUuid:   m.TransactionUuid,
-								Version:           m.Version,
-							}
-							c.ForwardKafkaMessage(message.Key, em, fields)
-						}
-					}
-				}
+				c.ForwardStateMessage(message.Key, m, updatedSubdocIds, fields)
 			}
 		case <-session.Context().Done():
 			return nil
 		}
 	}
-	return nil
 }
 
 func (c *Consumer) AppName() string {
@@ -0,0 +1,211 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package kafka
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/rdkcentral/webconfig/common"
+)
+
+// a seek is applied by the session that starts after the restart. If the rebalance gives the
+// partition to another replica, the seek expires instead of rewinding whenever it comes back.
+const defaultPendingOffsetTtl = 60 * time.Second
+
+// consumerControl holds the runtime state changed by the admin api. It is shared
+// by pointer because main.go runs the consumer group with a copy of the Consumer.
+// The state of each replica follows the control in the db, see KafkaConsumerGroup.PollControl().
+type consumerControl struct {
+	sync.Mutex
+	paused           bool
+	appliedSeekId    string
+	resumed          chan struct{}
+	pendingOffsets   map[string]map[int32]pendingOffset
+	pendingOffsetTtl time.Duration
+	cancelSession    context.CancelFunc
+}
+
+type pendingOffset struct {
+	offset    int64
+	expiresAt time.Time
+}
+
+func newConsumerControl() *consumerControl {
+	return &consumerControl{
+		resumed:          make(chan struct{}),
+		pendingOffsets:   make(map[string]map[int32]pendingOffset),
+		pendingOffsetTtl: defaultPendingOffsetTtl,
+	}
+}
+
+func (c *consumerControl) Pause() {
+	c.Lock()
+	defer c.Unlock()
+	if !c.paused {
+		c.paused = true
+		c.resumed = make(chan struct{})
+	}
+}
+
+func (c *consumerControl) Resume() {
+	c.Lock()
+	defer c.Unlock()
+	if c.paused {
+		c.paused = false
+		close(c.resumed)
+	}
+}
+
+func (c *consumerControl) Paused() bool {
+	c.Lock()
+	defer c.Unlock()
+	return c.paused
+}
+
+// waitIfPaused blocks while the consumer is paused. It returns false if the ctx is done first.
+func (c *consumerControl) waitIfPaused(ctx context.Context) bool {
+	c.Lock()
+	paused, resumed := c.paused, c.resumed
+	c.Unlock()
+	if !paused {
+		return true
+	}
+	select {
+	case <-resumed:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// addPendingOffsets replaces the pending offsets of the partitions, they expire the pending ttl
+// after the seek
+func (c *consumerControl) addPendingOffsets(offsets map[string]map[int32]int64, seekTime time.Time) {
+	c.Lock()
+	defer c.Unlock()
+	expiresAt := seekTime.Add(c.pendingOffsetTtl)
+	for topic, partitionOffsets := range offsets {
+		if _, ok := c.pendingOffsets[topic]; !ok {
+			c.pendingOffsets[topic] = make(map[int32]pendingOffset)
+		}
+		for p, offset := range partitionOffsets {
+			c.pendingOffsets[topic][p] = pendingOffset{
+				offset:    offset,
+				expiresAt: expiresAt,
+			}
+		}
+	}
+}
+
+func (c *consumerControl) PendingOffsets() map[string]map[int32]int64 {
+	c.Lock()
+	defer c.Unlock()
+	c.expirePendingOffsets(time.Now())
+	if len(c.pendingOffsets) == 0 {
+		return nil
+	}
+	ret := make(map[string]map[int32]int64)
+	for topic, partitionOffsets := range c.pendingOffsets {
+		ret[topic] = make(map[int32]int64)
+		for p, po := range partitionOffsets {
+			ret[topic][p] = po.offset
+		}
+	}
+	return ret
+}
+
+// expirePendingOffsets drops the seeks not applied in time, the caller holds the lock
+func (c *consumerControl) expirePendingOffsets(now time.Time) {
+	for topic, partitionOffsets := range c.pendingOffsets {
+		for p, po := range partitionOffsets {
+			if now.After(po.expiresAt) {
+				delete(partitionOffsets, p)
+			}
+		}
+		if len(partitionOffsets) == 0 {
+			delete(c.pendingOffsets, topic)
+		}
+	}
+}
+
+// applyPendingOffsets moves the session offsets of the claimed partitions. ResetOffset
+// only rewinds and MarkOffset only moves forward, so calling both covers either direction.
+// Partitions not claimed by this session are kept for a later session until they expire.
+func (c *consumerControl) applyPendingOffsets(session sarama.ConsumerGroupSession) {
+	c.Lock()
+	defer c.Unlock()
+	c.expirePendingOffsets(time.Now())
+	for topic, partitions := range session.Claims() {
+		partitionOffsets, ok := c.pendingOffsets[topic]
+		if !ok {
+			continue
+		}
+		for _, p := range partitions {
+			po, ok := partitionOffsets[p]
+			if !ok {
+				continue
+			}
+			session.ResetOffset(topic, p, po.offset, "")
+			session.MarkOffset(topic, p, po.offset, "")
+			delete(partitionOffsets, p)
+		}
+		if len(partitionOffsets) == 0 {
+			delete(c.pendingOffsets, topic)
+		}
+	}
+}
+
+// applySeek adds the offsets of a seek that this replica has not applied yet and restarts the
+// session. The offsets of a seek older than the pending ttl expire right away, so a replica
+// started after the seek does not rewind its partitions.
+func (c *consumerControl) applySeek(control *common.KafkaConsumerControl) bool {
+	c.Lock()
+	if len(control.SeekId) == 0 || control.SeekId == c.appliedSeekId {
+		c.Unlock()
+		return false
+	}
+	c.appliedSeekId = control.SeekId
+	c.Unlock()
+
+	seekTime := time.UnixMilli(control.SeekTime)
+	c.addPendingOffsets(control.SeekOffsets, seekTime)
+	if time.Since(seekTime) > c.pendingOffsetTtl {
+		return false
+	}
+	c.restartSession()
+	return true
+}
+
+func (c *consumerControl) setCancelSession(cancel context.CancelFunc) {
+	c.Lock()
+	defer c.Unlock()
+	c.cancelSession = cancel
+}
+
+// restartSession ends the current session so that the next Setup() picks up the pending offsets
+func (c *consumerControl) restartSession() {
+	c.Lock()
+	cancel := c.cancelSession
+	c.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+}
@@ -0,0 +1,255 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/google/uuid"
+	"github.com/rdkcentral/webconfig/common"
+	log "github.com/sirupsen/logrus"
+)
+
+// the subsets of sarama.Client and sarama.ClusterAdmin used by the admin api
+type offsetClient interface {
+	Partitions(topic string) ([]int32, error)
+	GetOffset(topic string, partitionID int32, time int64) (int64, error)
+}
+
+type offsetAdmin interface {
+	ListConsumerGroupOffsets(group string, topicPartitions map[string][]int32) (*sarama.OffsetFetchResponse, error)
+	Close() error
+}
+
+// Pause stops handing messages to the handler on every replica. The pause is stored in the db,
+// this replica applies it right away and the others at their next poll. The session stays alive
+// and the pause survives rebalances until Resume() is called.
+func (g *KafkaConsumerGroup) Pause() error {
+	if err := g.SetKafkaConsumerPaused(g.clusterName, true); err != nil {
+		return common.NewError(err)
+	}
+	g.consumer.control.Pause()
+	return nil
+}
+
+func (g *KafkaConsumerGroup) Resume() error {
+	if err := g.SetKafkaConsumerPaused(g.clusterName, false); err != nil {
+		return common.NewError(err)
+	}
+	g.consumer.control.Resume()
+	return nil
+}
+
+func (g *KafkaConsumerGroup) Paused() bool {
+	return g.consumer.control.Paused()
+}
+
+func (g *KafkaConsumerGroup) Status() (*common.KafkaConsumerGroupStatus, error) {
+	topicPartitions := make(map[string][]int32)
+	for _, topic := range g.topics {
+		partitions, err := g.client.Partitions(topic)
+		if err != nil {
+			return nil, common.NewError(err)
+		}
+		topicPartitions[topic] = partitions
+	}
+
+	resp, err := g.admin.ListConsumerGroupOffsets(g.groupId, topicPartitions)
+	if err != nil {
+		return nil, common.NewError(err)
+	}
+
+	partitionStatuses := []common.KafkaPartitionStatus{}
+	for _, topic := range g.topics {
+		for _, p := range topicPartitions[topic] {
+			hwm, err := g.client.GetOffset(topic, p, sarama.OffsetNewest)
+			if err != nil {
+				return nil, common.NewError(err)
+			}
+
+			committed := int64(-1)
+			if block := resp.GetBlock(topic, p); block != nil {
+				committed = block.Offset
+			}
+
+			// nothing committed yet, everything retained is lag
+			lagBase := committed
+			if committed < 0 {
+				lagBase, err = g.client.GetOffset(topic, p, sarama.OffsetOldest)
+				if err != nil {
+					return nil, common.NewError(err)
+				}
+			}
+
+			partitionStatuses = append(partitionStatuses, common.KafkaPartitionStatus{
+				Topic:           topic,
+				Partition:       p,
+				CommittedOffset: committed,
+				HighWaterMark:   hwm,
+				Lag:             hwm - lagBase,
+			})
+		}
+	}
+
+	return &common.KafkaConsumerGroupStatus{
+		ClusterName:  g.clusterName,
+		GroupId:      g.groupId,
+		Topics:       g.topics,
+		Paused:       g.Paused(),
+		Partitions:   partitionStatuses,
+		PendingSeeks: g.consumer.control.PendingOffsets(),
+	}, nil
+}
+
+// Seek resolves the requested offsets, stores them in the db for the other replicas and restarts
+// the session to apply them. Each replica moves the partitions it claims. The rest stay pending
+// until claimed and expire if not claimed shortly, so a seek never rewinds a partition at an
+// arbitrary time.
+func (g *KafkaConsumerGroup) Seek(req *common.KafkaSeekRequest) (map[string]map[int32]int64, error) {
+	if !g.hasTopic(req.Topic) {
+		err := *common.NewHttp400Error(fmt.Sprintf("topic %q is not consumed by cluster %s", req.Topic, g.clusterName))
+		return nil, common.NewError(err)
+	}
+	if (req.Offset == nil) == (req.Timestamp == nil) {
+		err := *common.NewHttp400Error("exactly one of offset or timestamp is required")
+		return nil, common.NewError(err)
+	}
+
+	allPartitions, err := g.client.Partitions(req.Topic)
+	if err != nil {
+		return nil, common.NewError(err)
+	}
+	partitions := allPartitions
+	if req.Partition != nil {
+		found := false
+		for _, p := range allPartitions {
+			if p == *req.Partition {
+				found = true
+				break
+			}
+		}
+		if !found {
+			err := *common.NewHttp400Error(fmt.Sprintf("partition %v not found in topic %q", *req.Partition, req.Topic))
+			return nil, common.NewError(err)
+		}
+		partitions = []int32{*req.Partition}
+	}
+
+	offsets := make(map[int32]int64)
+	for _, p := range partitions {
+		oldest, err := g.client.GetOffset(req.Topic, p, sarama.OffsetOldest)
+		if err != nil {
+			return nil, common.NewError(err)
+		}
+		newest, err := g.client.GetOffset(req.Topic, p, sarama.OffsetNewest)
+		if err != nil {
+			return nil, common.NewError(err)
+		}
+
+		var offset int64
+		if req.Timestamp != nil {
+			offset, err = g.client.GetOffset(req.Topic, p, *req.Timestamp)
+			if err != nil {
+				return nil, common.NewError(err)
+			}
+			// no message at or after the timestamp
+			if offset < 0 {
+				offset = newest
+			}
+		} else {
+			offset = *req.Offset
+			switch offset {
+			case sarama.OffsetOldest:
+				offset = oldest
+			case sarama.OffsetNewest:
+				offset = newest
+			}
+		}
+
+		if offset < oldest || offset > newest {
+			err := *common.NewHttp400Error(fmt.Sprintf("offset %v out of range [%v, %v] for %s/%v", offset, oldest, newest, req.Topic, p))
+			return nil, common.NewError(err)
+		}
+		offsets[p] = offset
+	}
+
+	resolved := map[string]map[int32]int64{
+		req.Topic: offsets,
+	}
+	control := &common.KafkaConsumerControl{
+		ClusterName: g.clusterName,
+		SeekId:      uuid.New().String(),
+		SeekOffsets: resolved,
+		SeekTime:    time.Now().UnixMilli(),
+	}
+	if err := g.SetKafkaConsumerSeek(control); err != nil {
+		return nil, common.NewError(err)
+	}
+	g.consumer.control.applySeek(control)
+	return resolved, nil
+}
+
+// PollControl applies the pause and the last seek stored in the db by the admin api of any replica
+func (g *KafkaConsumerGroup) PollControl() error {
+	control, err := g.GetKafkaConsumerControl(g.clusterName)
+	if err != nil {
+		if g.IsDbNotFound(err) {
+			return nil
+		}
+		return common.NewError(err)
+	}
+	if control.Paused {
+		g.consumer.control.Pause()
+	} else {
+		g.consumer.control.Resume()
+	}
+	g.consumer.control.applySeek(control)
+	return nil
+}
+
+// RunControlPoller polls the control of the cluster periodically until ctx is done
+func (g *KafkaConsumerGroup) RunControlPoller(ctx context.Context) {
+	fields := log.Fields{
+		"logger":       "kafka",
+		"cluster_name": g.clusterName,
+	}
+	ticker := time.NewTicker(g.controlPollInterval)
+	defer ticker.Stop()
+	for {
+		if err := g.PollControl(); err != nil {
+			log.WithFields(fields).Error(err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (g *KafkaConsumerGroup) hasTopic(topic string) bool {
+	for _, t := range g.topics {
+		if t == topic {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,307 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/google/uuid"
+	"github.com/rdkcentral/webconfig/common"
+	wchttp "github.com/rdkcentral/webconfig/http"
+	"gotest.tools/assert"
+)
+
+type mockOffsetClient struct {
+	partitions map[string][]int32
+	oldest     int64
+	newest     int64
+	byTime     map[int64]int64
+}
+
+func (c *mockOffsetClient) Partitions(topic string) ([]int32, error) {
+	return c.partitions[topic], nil
+}
+
+func (c *mockOffsetClient) GetOffset(topic string, partitionID int32, t int64) (int64, error) {
+	switch t {
+	case sarama.OffsetOldest:
+		return c.oldest, nil
+	case sarama.OffsetNewest:
+		return c.newest, nil
+	}
+	if offset, ok := c.byTime[t]; ok {
+		return offset, nil
+	}
+	return -1, nil
+}
+
+type mockOffsetAdmin struct {
+	committed map[int32]int64
+}
+
+func (a *mockOffsetAdmin) ListConsumerGroupOffsets(group string, topicPartitions map[string][]int32) (*sarama.OffsetFetchResponse, error) {
+	resp := &sarama.OffsetFetchResponse{}
+	for topic, partitions := range topicPartitions {
+		for _, p := range partitions {
+			offset := int64(-1)
+			if x, ok := a.committed[p]; ok {
+				offset = x
+			}
+			resp.AddBlock(topic, p, &sarama.OffsetFetchResponseBlock{Offset: offset})
+		}
+	}
+	return resp, nil
+}
+
+func (a *mockOffsetAdmin) Close() error {
+	return nil
+}
+
+type mockSession struct {
+	ctx     context.Context
+	claims  map[string][]int32
+	resets  map[int32]int64
+	markeds map[int32]int64
+}
+
+func (s *mockSession) Claims() map[string][]int32 { return s.claims }
+func (s *mockSession) MemberID() string           { return "member" }
+func (s *mockSession) GenerationID() int32        { return 1 }
+func (s *mockSession) Commit()                    {}
+func (s *mockSession) Context() context.Context   { return s.ctx }
+func (s *mockSession) MarkMessage(msg *sarama.ConsumerMessage, metadata string) {
+}
+func (s *mockSession) MarkOffset(topic string, partition int32, offset int64, metadata string) {
+	s.markeds[partition] = offset
+}
+func (s *mockSession) ResetOffset(topic string, partition int32, offset int64, metadata string) {
+	s.resets[partition] = offset
+}
+
+// newTestKafkaConsumerGroup makes a group of a random cluster name, the control rows in the test db
+// are kept across the runs
+func newTestKafkaConsumerGroup(t *testing.T) *KafkaConsumerGroup {
+	sc, err := common.GetTestServerConfig()
+	assert.NilError(t, err)
+	server := wchttp.NewWebconfigServer(sc, true)
+	return &KafkaConsumerGroup{
+		DatabaseClient: server.DatabaseClient,
+		consumer:       &Consumer{control: newConsumerControl()},
+		topics:         []string{"topic1"},
+		clusterName:    "mesh_" + uuid.New().String(),
+		groupId:        "webconfig",
+		client: &mockOffsetClient{
+			partitions: map[string][]int32{"topic1": {0, 1}},
+			oldest:     100,
+			newest:     500,
+			byTime:     map[int64]int64{1700000000000: 250},
+		},
+		admin: &mockOffsetAdmin{
+			committed: map[int32]int64{0: 400},
+		},
+	}
+}
+
+func TestConsumerGroupStatus(t *testing.T) {
+	g := newTestKafkaConsumerGroup(t)
+	err := g.Pause()
+	assert.NilError(t, err)
+
+	status, err := g.Status()
+	assert.NilError(t, err)
+	assert.Equal(t, status.ClusterName, g.clusterName)
+	assert.Equal(t, status.GroupId, "webconfig")
+	assert.Assert(t, status.Paused)
+	assert.Equal(t, len(status.Partitions), 2)
+
+	// committed
+	assert.Equal(t, status.Partitions[0].CommittedOffset, int64(400))
+	assert.Equal(t, status.Partitions[0].HighWaterMark, int64(500))
+	assert.Equal(t, status.Partitions[0].Lag, int64(100))
+
+	// nothing committed
+	assert.Equal(t, status.Partitions[1].CommittedOffset, int64(-1))
+	assert.Equal(t, status.Partitions[1].Lag, int64(400))
+}
+
+func TestConsumerGroupSeek(t *testing.T) {
+	g := newTestKafkaConsumerGroup(t)
+
+	// restarting the session should cancel the running one
+	sessionCtx, cancel := context.WithCancel(context.Background())
+	g.consumer.control.setCancelSession(cancel)
+
+	// ==== bad requests ====
+	offset := int64(200)
+	_, err := g.Seek(&common.KafkaSeekRequest{Topic: "unknown", Offset: &offset})
+	assert.Assert(t, errors.As(err, common.Http400ErrorType))
+
+	_, err = g.Seek(&common.KafkaSeekRequest{Topic: "topic1"})
+	assert.Assert(t, errors.As(err, common.Http400ErrorType))
+
+	partition := int32(5)
+	_, err = g.Seek(&common.KafkaSeekRequest{Topic: "topic1", Partition: &partition, Offset: &offset})
+	assert.Assert(t, errors.As(err, common.Http400ErrorType))
+
+	outOfRange := int64(9999)
+	_, err = g.Seek(&common.KafkaSeekRequest{Topic: "topic1", Offset: &outOfRange})
+	assert.Assert(t, errors.As(err, common.Http400ErrorType))
+	assert.Assert(t, g.consumer.control.PendingOffsets() == nil)
+	assert.NilError(t, sessionCtx.Err())
+
+	// ==== seek partition 1 by offset ====
+	partition = int32(1)
+	offsets, err := g.Seek(&common.KafkaSeekRequest{Topic: "topic1", Partition: &partition, Offset: &offset})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, offsets, map[string]map[int32]int64{"topic1": {1: 200}})
+	assert.Assert(t, errors.Is(sessionCtx.Err(), context.Canceled))
+
+	// ==== seek all partitions by timestamp ====
+	ts := int64(1700000000000)
+	offsets, err = g.Seek(&common.KafkaSeekRequest{Topic: "topic1", Timestamp: &ts})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, offsets, map[string]map[int32]int64{"topic1": {0: 250, 1: 250}})
+
+	// a timestamp after the last message goes to the newest
+	ts = int64(1800000000000)
+	offsets, err = g.Seek(&common.KafkaSeekRequest{Topic: "topic1", Timestamp: &ts})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, offsets, map[string]map[int32]int64{"topic1": {0: 500, 1: 500}})
+
+	status, err := g.Status()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, status.PendingSeeks, map[string]map[int32]int64{"topic1": {0: 500, 1: 500}})
+
+	// ==== the next session applies the claimed partitions only ====
+	session := &mockSession{
+		ctx:     context.Background(),
+		claims:  map[string][]int32{"topic1": {1}},
+		resets:  make(map[int32]int64),
+		markeds: make(map[int32]int64),
+	}
+	g.consumer.control.applyPendingOffsets(session)
+	assert.Equal(t, session.resets[1], int64(500))
+	assert.Equal(t, session.markeds[1], int64(500))
+	_, ok := session.resets[0]
+	assert.Assert(t, !ok)
+	assert.DeepEqual(t, g.consumer.control.PendingOffsets(), map[string]map[int32]int64{"topic1": {0: 500}})
+
+	// ==== a seek not claimed in time expires instead of applying at a later rebalance ====
+	g.consumer.control.pendingOffsetTtl = -time.Second
+	partition = int32(0)
+	_, err = g.Seek(&common.KafkaSeekRequest{Topic: "topic1", Partition: &partition, Offset: &offset})
+	assert.NilError(t, err)
+	session = &mockSession{
+		ctx:     context.Background(),
+		claims:  map[string][]int32{"topic1": {0}},
+		resets:  make(map[int32]int64),
+		markeds: make(map[int32]int64),
+	}
+	g.consumer.control.applyPendingOffsets(session)
+	assert.Equal(t, len(session.resets), 0)
+	assert.Assert(t, g.consumer.control.PendingOffsets() == nil)
+}
+
+func TestConsumerControlPauseResume(t *testing.T) {
+	control := newConsumerControl()
+	ctx := context.Background()
+	assert.Assert(t, control.waitIfPaused(ctx))
+
+	control.Pause()
+	control.Pause()
+	assert.Assert(t, control.Paused())
+
+	done := make(chan bool)
+	go func() {
+		done <- control.waitIfPaused(ctx)
+	}()
+	select {
+	case <-done:
+		t.Fatal("waitIfPaused() returned while paused")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	control.Resume()
+	control.Resume()
+	assert.Assert(t, <-done)
+	assert.Assert(t, !control.Paused())
+
+	// a session ending while paused
+	control.Pause()
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.Assert(t, !control.waitIfPaused(cctx))
+}
+
+func TestConsumerGroupControlAcrossReplicas(t *testing.T) {
+	g1 := newTestKafkaConsumerGroup(t)
+	g2 := newTestKafkaConsumerGroup(t)
+	g2.clusterName = g1.clusterName
+
+	// nothing stored yet
+	assert.NilError(t, g2.PollControl())
+	assert.Assert(t, !g2.Paused())
+
+	// ==== a pause served by one replica reaches the others at their poll ====
+	assert.NilError(t, g1.Pause())
+	assert.Assert(t, !g2.Paused())
+	assert.NilError(t, g2.PollControl())
+	assert.Assert(t, g2.Paused())
+
+	assert.NilError(t, g1.Resume())
+	assert.NilError(t, g2.PollControl())
+	assert.Assert(t, !g2.Paused())
+
+	// ==== a seek is applied once by each replica ====
+	sessionCtx, cancel := context.WithCancel(context.Background())
+	g2.consumer.control.setCancelSession(cancel)
+	offset := int64(200)
+	_, err := g1.Seek(&common.KafkaSeekRequest{Topic: "topic1", Offset: &offset})
+	assert.NilError(t, err)
+	assert.NilError(t, g2.PollControl())
+	assert.Assert(t, errors.Is(sessionCtx.Err(), context.Canceled))
+	expected := map[string]map[int32]int64{"topic1": {0: 200, 1: 200}}
+	assert.DeepEqual(t, g2.consumer.control.PendingOffsets(), expected)
+
+	session := &mockSession{
+		ctx:     context.Background(),
+		claims:  map[string][]int32{"topic1": {0, 1}},
+		resets:  make(map[int32]int64),
+		markeds: make(map[int32]int64),
+	}
+	g2.consumer.control.applyPendingOffsets(session)
+	assert.NilError(t, g2.PollControl())
+	assert.Assert(t, g2.consumer.control.PendingOffsets() == nil)
+
+	// ==== a replica started after the seek expired does not rewind ====
+	control := &common.KafkaConsumerControl{
+		ClusterName: g1.clusterName,
+		SeekId:      uuid.New().String(),
+		SeekOffsets: expected,
+		SeekTime:    time.Now().Add(-2 * defaultPendingOffsetTtl).UnixMilli(),
+	}
+	assert.NilError(t, g1.SetKafkaConsumerSeek(control))
+	g3 := newTestKafkaConsumerGroup(t)
+	g3.clusterName = g1.clusterName
+	assert.NilError(t, g3.PollControl())
+	assert.Assert(t, g3.consumer.control.PendingOffsets() == nil)
+}
@@ -127,4 +127,25 @@ func TestGetEventName(t *testing.T) {
 	eventName, rptHeaderValue = getEventName(m)
 	assert.Equal(t, eventName, "unknown-rpt")
 	assert.Equal(t, rptHeaderValue, "indigo")
+
+	// ==== subdoc-delete ====
+	headers = []*sarama.RecordHeader{
+		rheader1,
+		{
+			Key:   []byte("event"),
+			Value: []byte("subdoc-delete"),
+		},
+	}
+	m = &sarama.ConsumerMessage{
+		Topic:     "topic5",
+		Partition: int32(5),
+		Key:       []byte("violet"),
+		Value:     []byte("{}"),
+		Offset:    int64(5),
+		Timestamp: time.Now(),
+		Headers:   headers,
+	}
+	eventName, rptHeaderValue = getEventName(m)
+	assert.Equal(t, eventName, "subdoc-delete")
+	assert.Equal(t, rptHeaderValue, "")
 }
@@ -18,6 +18,7 @@
 package kafka
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"time"
@@ -27,13 +28,24 @@ import (
 	"github.com/rdkcentral/webconfig/common"
 	"github.com/rdkcentral/webconfig/db"
 	wchttp "github.com/rdkcentral/webconfig/http"
+	"github.com/rdkcentral/webconfig/security"
+)
+
+const (
+	defaultControlPollIntervalInSecs = 5
 )
 
 type KafkaConsumerGroup struct {
 	sarama.ConsumerGroup
 	db.DatabaseClient
-	consumer *Consumer
-	topics   []string
+	consumer    *Consumer
+	topics      []string
+	clusterName string
+	groupId     string
+	client      offsetClient
+	admin       offsetAdmin
+
+	controlPollInterval time.Duration
 }
 
 func NewKafkaConsumerGroup(conf *configuration.Config, s *wchttp.WebconfigServer, m *common.AppMetrics, clusterName string) (*KafkaConsumerGroup, error) {
@@ -94,6 +106,16 @@ func NewKafkaConsumerGroup(conf *configuration.Config, s *wchttp.WebconfigServer
 		return nil, common.NewError(fmt.Errorf("Unrecognized consumer group partition assignor: %s", assignor))
 	}
 
+	// Load TLS and SASL configuration, before any connection to the brokers. An encrypted sasl
+	// password is decrypted by the codec of the encryption key when one is available.
+	var decrypter common.Decrypter
+	if codec, err := security.NewAesCodec(conf); err == nil {
+		decrypter = codec
+	}
+	if err := common.ConfigureKafkaSecurity(conf, prefix, sconfig, decrypter); err != nil {
+		return nil, common.NewError(err)
+	}
+
 	var topicPartitionsMap map[string][]int32
 	var err error
 	if newest {
@@ -103,16 +125,6 @@ func NewKafkaConsumerGroup(conf *configuration.Config, s *wchttp.WebconfigServer
 		}
 	}
 
-	// Load TLS configuration
-	tlsConfig, err := common.LoadKafkaTLSConfig(conf, prefix)
-	if err != nil {
-		return nil, common.NewError(fmt.Errorf("failed to load TLS configuration for %s: %v", prefix, err))
-	}
-	if tlsConfig != nil {
-		sconfig.Net.TLS.Enable = true
-		sconfig.Net.TLS.Config = tlsConfig
-	}
-
 	consumer := NewConsumer(s, ratelimitMessagesPerSecond, m, clusterName, offsetEnum, topicPartitionsMap)
 
 	client, err := sarama.NewConsumerGroup(brokers, group, sconfig)
@@ -120,11 +132,27 @@ func NewKafkaConsumerGroup(conf *configuration.Config, s *wchttp.WebconfigServer
 		return nil, fmt.Errorf("Error creating consumer group client: %v", err)
 	}
 
+	// a separate client for the admin api, consumer groups cannot share their client
+	adminClient, err := sarama.NewClient(brokers, sconfig)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating admin client: %v", err)
+	}
+	admin, err := sarama.NewClusterAdminFromClient(adminClient)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating cluster admin: %v", err)
+	}
+
 	return &KafkaConsumerGroup{
 		ConsumerGroup:  client,
 		DatabaseClient: s.DatabaseClient,
 		consumer:       consumer,
 		topics:         topics,
+		clusterName:    clusterName,
+		groupId:        group,
+		client:         adminClient,
+		admin:          admin,
+
+		controlPollInterval: time.Duration(conf.GetInt32("webconfig.kafka.control_poll_interval_in_secs", defaultControlPollIntervalInSecs)) * time.Second,
 	}, nil
 }
 
@@ -136,6 +164,36 @@ func (g *KafkaConsumerGroup) Consumer() *Consumer {
 	return g.consumer
 }
 
+func (g *KafkaConsumerGroup) ClusterName() string {
+	return g.clusterName
+}
+
+func (g *KafkaConsumerGroup) GroupId() string {
+	return g.groupId
+}
+
+// Consume runs one session with a context that the admin api can cancel, it returns
+// when the session ends, the caller is expected to call Consume() again in a loop
+func (g *KafkaConsumerGroup) Consume(ctx context.Context, topics []string, handler sarama.ConsumerGroupHandler) error {
+	sessionCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	g.consumer.control.setCancelSession(cancel)
+	return g.ConsumerGroup.Consume(sessionCtx, topics, handler)
+}
+
+func (g *KafkaConsumerGroup) Close() error {
+	err := g.ConsumerGroup.Close()
+	if g.admin != nil {
+		if err1 := g.admin.Close(); err1 != nil && err == nil {
+			err = err1
+		}
+	}
+	if err != nil {
+		return common.NewError(err)
+	}
+	return nil
+}
+
 func NewKafkaConsumerGroups(sc *common.ServerConfig, s *wchttp.WebconfigServer, m *common.AppMetrics) ([]*KafkaConsumerGroup, error) {
 	kcgroups := []*KafkaConsumerGroup{}
 
@@ -165,6 +223,15 @@ func NewKafkaConsumerGroups(sc *common.ServerConfig, s *wchttp.WebconfigServer,
 func getEventName(message *sarama.ConsumerMessage) (string, string) {
 	var rptHeaderValue string
 	if len(message.Headers) > 0 {
+		// northbound writes are tagged by an "event" header
+		for _, h := range message.Headers {
+			if string(h.Key) == "event" {
+				switch string(h.Value) {
+				case "subdoc-upsert", "subdoc-delete":
+					return string(h.Value), rptHeaderValue
+				}
+			}
+		}
 		for _, h := range message.Headers {
 			if string(h.Key) == "rpt" {
 				rptHeaderValue = string(h.Value)
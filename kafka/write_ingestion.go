@@ -0,0 +1,152 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package kafka
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/rdkcentral/webconfig/common"
+	"github.com/rdkcentral/webconfig/util"
+	log "github.com/sirupsen/logrus"
+)
+
+func isWriteEvent(eventName string) bool {
+	return eventName == "subdoc-upsert" || eventName == "subdoc-delete"
+}
+
+// handleWriteMessage applies a subdoc write with the same semantics as the http
+// document handlers and publishes the result to the reply topic. The correlation
+// id in the body takes precedence over the kafka key.
+func (c *Consumer) handleWriteMessage(eventName string, message *sarama.ConsumerMessage, fields log.Fields) (*common.EventMessage, error) {
+	result := &common.SubDocumentWriteResult{
+		CorrelationId: string(message.Key),
+		EventName:     eventName,
+	}
+	m := &common.EventMessage{}
+
+	err := c.applyWriteMessage(eventName, message.Value, m, result, fields)
+	if err != nil {
+		result.Message = err.Error()
+	} else {
+		result.Message = http.StatusText(result.Status)
+	}
+	fields["correlation_id"] = result.CorrelationId
+	fields["write_status"] = result.Status
+	c.ForwardWriteResult(result, fields)
+
+	if err != nil {
+		return m, common.NewError(err)
+	}
+	return m, nil
+}
+
+func (c *Consumer) applyWriteMessage(eventName string, bbytes []byte, m *common.EventMessage, result *common.SubDocumentWriteResult, fields log.Fields) error {
+	result.Status = http.StatusBadRequest
+
+	var wm common.SubDocumentWriteMessage
+	if err := json.Unmarshal(bbytes, &wm); err != nil {
+		return common.NewError(err)
+	}
+	if len(wm.CorrelationId) > 0 {
+		result.CorrelationId = wm.CorrelationId
+	}
+
+	mac := strings.ToUpper(wm.Mac)
+	result.Mac = mac
+	result.SubdocId = wm.SubdocId
+	fields["cpemac"] = mac
+	fields["cpe_mac"] = mac
+	fields["subdoc_id"] = wm.SubdocId
+
+	metricsAgent := "default"
+	if wm.MetricsAgent != nil && len(*wm.MetricsAgent) > 0 {
+		metricsAgent = *wm.MetricsAgent
+	}
+	m.MetricsAgent = &metricsAgent
+	fields["metrics_agent"] = metricsAgent
+
+	// no path routes the kafka writes, so the mac is always checked
+	if !util.ValidateMac(mac) {
+		return fmt.Errorf("invalid mac")
+	}
+	if err := c.ValidateSubDocumentWrite(mac, wm.SubdocId); err != nil {
+		return common.NewError(err)
+	}
+
+	if eventName == "subdoc-delete" {
+		rootVersion, err := c.RemoveSubDocument(mac, wm.SubdocId, fields)
+		if err != nil {
+			if c.IsDbNotFound(err) {
+				result.Status = http.StatusNotFound
+				return common.NewError(err)
+			}
+			result.Status = http.StatusInternalServerError
+			return common.NewError(err)
+		}
+		result.RootVersion = rootVersion
+	} else {
+		if len(wm.Payload) == 0 {
+			return fmt.Errorf("empty payload")
+		}
+
+		var version string
+		if wm.Version != nil && len(*wm.Version) > 0 {
+			version = *wm.Version
+		} else {
+			version = util.GetMurmur3Hash(wm.Payload)
+		}
+		state := common.PendingDownload
+		if wm.State != nil {
+			state = *wm.State
+		}
+		updatedTime := int(time.Now().UnixNano() / 1000000)
+		zeroErrorCode := 0
+		emptyErrorDetails := ""
+		subdoc := common.NewSubDocument(wm.Payload, &version, &state, &updatedTime, &zeroErrorCode, &emptyErrorDetails)
+		if wm.Expiry != nil {
+			subdoc.SetExpiry(wm.Expiry)
+		}
+		if wm.EffectiveTime != nil {
+			// only the delivery scheduler moves the root version when the subdoc becomes effective
+			if c.DeliveryScheduler() == nil {
+				return fmt.Errorf("effective_time requires webconfig.delivery_scheduler.enabled")
+			}
+			subdoc.SetEffectiveTime(wm.EffectiveTime)
+		}
+
+		rootVersion, err := c.WriteSubDocument(mac, wm.SubdocId, subdoc, 0, metricsAgent, fields)
+		if err != nil {
+			result.Status = http.StatusInternalServerError
+			return common.NewError(err)
+		}
+		result.RootVersion = rootVersion
+	}
+	result.Status = http.StatusOK
+
+	// the poke is debounced with the http writes and routed by the root document
+	if wm.AutoPoke && c.AutoPoker() != nil {
+		c.AutoPoker().Schedule(mac, make(http.Header), fields)
+		result.AutoPoke = true
+	}
+	return nil
+}
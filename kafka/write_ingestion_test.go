@@ -0,0 +1,162 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package kafka
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	"github.com/rdkcentral/webconfig/common"
+	wchttp "github.com/rdkcentral/webconfig/http"
+	"github.com/rdkcentral/webconfig/util"
+	log "github.com/sirupsen/logrus"
+	"gotest.tools/assert"
+)
+
+func readWriteResult(t *testing.T, producer *mocks.AsyncProducer) (string, *common.SubDocumentWriteResult) {
+	msg := <-producer.Successes()
+	assert.Equal(t, msg.Topic, "webconfig_write_results")
+	kbytes, err := msg.Key.Encode()
+	assert.NilError(t, err)
+	vbytes, err := msg.Value.Encode()
+	assert.NilError(t, err)
+	var result common.SubDocumentWriteResult
+	err = json.Unmarshal(vbytes, &result)
+	assert.NilError(t, err)
+	return string(kbytes), &result
+}
+
+func TestHandleWriteMessage(t *testing.T) {
+	sc, err := common.GetTestServerConfig()
+	assert.NilError(t, err)
+	server := wchttp.NewWebconfigServer(sc, true)
+
+	pconfig := mocks.NewTestConfig()
+	pconfig.Producer.Return.Successes = true
+	producer := mocks.NewAsyncProducer(t, pconfig)
+	defer producer.Close()
+	server.AsyncProducer = producer
+	server.SetKafkaProducerEnabled(true)
+	server.SetKafkaReplyTopic("webconfig_write_results")
+	consumer := NewConsumer(server, 100, nil, "root", 0, nil)
+
+	cpeMac := util.GenerateRandomCpeMac()
+	subdocId := "gwrestore"
+	rootdoc := common.NewRootDocument(0, "fw1", "model1", "comcast", "", "", "", "", "")
+	err = server.SetRootDocument(cpeMac, rootdoc)
+	assert.NilError(t, err)
+
+	// ==== upsert ====
+	payload := common.RandomBytes(100, 150)
+	wm := common.SubDocumentWriteMessage{
+		CorrelationId: "corr-1",
+		Mac:           cpeMac,
+		SubdocId:      subdocId,
+		Payload:       payload,
+		AutoPoke:      true,
+	}
+	bbytes, err := json.Marshal(wm)
+	assert.NilError(t, err)
+	producer.ExpectInputAndSucceed()
+	message := &sarama.ConsumerMessage{
+		Topic: "northbound",
+		Key:   []byte("key-1"),
+		Value: bbytes,
+		Headers: []*sarama.RecordHeader{
+			{Key: []byte("event"), Value: []byte("subdoc-upsert")},
+		},
+	}
+	eventName, _ := getEventName(message)
+	assert.Equal(t, eventName, "subdoc-upsert")
+	m, err := consumer.handleWriteMessage(eventName, message, make(log.Fields))
+	assert.NilError(t, err)
+	assert.Equal(t, *m.MetricsAgent, "default")
+
+	key, result := readWriteResult(t, producer)
+	assert.Equal(t, key, "corr-1")
+	assert.Equal(t, result.Status, http.StatusOK)
+	assert.Equal(t, result.Mac, cpeMac)
+	assert.Assert(t, len(result.RootVersion) > 0)
+	assert.Assert(t, result.AutoPoke)
+	assert.Equal(t, server.AutoPoker().Pending(), 1)
+	server.AutoPoker().Stop()
+
+	// same semantics as the http api, the subdoc is pending with a hashed version
+	subdoc, err := server.GetSubDocument(cpeMac, subdocId)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, subdoc.Payload(), payload)
+	assert.Equal(t, *subdoc.State(), common.PendingDownload)
+	assert.Equal(t, *subdoc.Version(), util.GetMurmur3Hash(payload))
+
+	rdoc, err := server.GetRootDocument(cpeMac)
+	assert.NilError(t, err)
+	assert.Equal(t, rdoc.Version, result.RootVersion)
+
+	// ==== bad message, the kafka key is used without a correlation_id ====
+	bbytes, err = json.Marshal(common.SubDocumentWriteMessage{Mac: "not-a-mac", SubdocId: subdocId, Payload: payload})
+	assert.NilError(t, err)
+	producer.ExpectInputAndSucceed()
+	message = &sarama.ConsumerMessage{Key: []byte("key-2"), Value: bbytes}
+	_, err = consumer.handleWriteMessage("subdoc-upsert", message, make(log.Fields))
+	assert.Assert(t, err != nil)
+	key, result = readWriteResult(t, producer)
+	assert.Equal(t, key, "key-2")
+	assert.Equal(t, result.Status, http.StatusBadRequest)
+
+	// the subdoc ids are checked like the http api does
+	for _, badSubdocId := range []string{"", "root", "lan/wan", "lan wan"} {
+		bbytes, err = json.Marshal(common.SubDocumentWriteMessage{Mac: cpeMac, SubdocId: badSubdocId, Payload: payload})
+		assert.NilError(t, err)
+		producer.ExpectInputAndSucceed()
+		message = &sarama.ConsumerMessage{Key: []byte("key-bad"), Value: bbytes}
+		_, err = consumer.handleWriteMessage("subdoc-upsert", message, make(log.Fields))
+		assert.Assert(t, err != nil)
+		_, result = readWriteResult(t, producer)
+		assert.Equal(t, result.Status, http.StatusBadRequest)
+	}
+
+	// an effective_time needs the delivery scheduler
+	assert.Assert(t, server.DeliveryScheduler() == nil)
+	effectiveTime := int(time.Now().Add(time.Hour).UnixMilli())
+	bbytes, err = json.Marshal(common.SubDocumentWriteMessage{Mac: cpeMac, SubdocId: subdocId, Payload: payload, EffectiveTime: &effectiveTime})
+	assert.NilError(t, err)
+	producer.ExpectInputAndSucceed()
+	message = &sarama.ConsumerMessage{Key: []byte("key-effective"), Value: bbytes}
+	_, err = consumer.handleWriteMessage("subdoc-upsert", message, make(log.Fields))
+	assert.Assert(t, err != nil)
+	_, result = readWriteResult(t, producer)
+	assert.Equal(t, result.Status, http.StatusBadRequest)
+
+	// ==== delete ====
+	bbytes, err = json.Marshal(common.SubDocumentWriteMessage{CorrelationId: "corr-3", Mac: cpeMac, SubdocId: subdocId})
+	assert.NilError(t, err)
+	producer.ExpectInputAndSucceed()
+	message = &sarama.ConsumerMessage{Value: bbytes}
+	_, err = consumer.handleWriteMessage("subdoc-delete", message, make(log.Fields))
+	assert.NilError(t, err)
+	_, result = readWriteResult(t, producer)
+	assert.Equal(t, result.Status, http.StatusOK)
+
+	_, err = server.GetSubDocument(cpeMac, subdocId)
+	assert.Assert(t, server.IsDbNotFound(err))
+
+}
@@ -116,12 +116,34 @@ func main() {
 		server.Handler = router
 	}
 
+	// setup kafka consumer, if config kafka.enabled=false, then kcgroup=nil, err=nil
+	kcgroups, err := kafka.NewKafkaConsumerGroups(sc, server, metrics)
+	if err != nil {
+		panic(err)
+	}
+
+	// register the groups for the admin api
+	controllers := []wchttp.KafkaConsumerGroupController{}
+	for _, kcgroup := range kcgroups {
+		controllers = append(controllers, kcgroup)
+	}
+	server.SetKafkaConsumerGroups(controllers)
+
+	// setup native mqtt client, if config mqtt.native.enabled=false, this is a no-op
+	if err := server.StartMqttNativeClient(); err != nil {
+		panic(err)
+	}
+
 	// setup contexts groups
 	g, gCtx := errgroup.WithContext(mainCtx)
 
 	// setup http server
 	g.Go(
 		func() error {
+			if server.ServerTlsEnabled() {
+				// the certificates are in the tls config of the server
+				return server.ListenAndServeTLS("", "")
+			}
 			return server.ListenAndServe()
 		},
 	)
@@ -139,10 +161,74 @@ func main() {
 		},
 	)
 
-	// setup kafka consumer, if config kafka.enabled=false, then kcgroup=nil, err=nil
-	kcgroups, err := kafka.NewKafkaConsumerGroups(sc, server, metrics)
-	if err != nil {
-		panic(err)
+	// expire the mqtt responses never acknowledged by the devices
+	if server.MqttTracker() != nil {
+		g.Go(
+			func() error {
+				server.SweepMqttTransactions(gCtx)
+				return nil
+			},
+		)
+	}
+
+	// reload the jwt keys rotated in their files or secrets
+	if server.TokenManager != nil {
+		g.Go(
+			func() error {
+				server.RunKeysReloader(gCtx)
+				return nil
+			},
+		)
+	}
+
+	// poke the devices when their scheduled subdocs become effective
+	if server.DeliveryScheduler() != nil {
+		g.Go(
+			func() error {
+				server.RunDeliveryScheduler(gCtx)
+				return nil
+			},
+		)
+	}
+
+	// restore the subdocs replaced by temporary writes once they expire
+	if server.OverrideReverter() != nil {
+		g.Go(
+			func() error {
+				server.RunOverrideReverter(gCtx)
+				return nil
+			},
+		)
+	}
+
+	// remediate the subdocs stuck in deployment, only one replica sweeps at a time
+	if server.StuckSweeper() != nil {
+		g.Go(
+			func() error {
+				server.RunStuckSweeper(gCtx)
+				return nil
+			},
+		)
+	}
+
+	// deliver the async webpa pokes persisted in the database
+	if q := server.PokeQueue(); q != nil {
+		g.Go(
+			func() error {
+				q.Run(gCtx)
+				return nil
+			},
+		)
+	}
+
+	// every replica follows the pause and the seeks of the admin api from the db
+	for _, kcgroup := range kcgroups {
+		g.Go(
+			func() error {
+				kcgroup.RunControlPoller(gCtx)
+				return nil
+			},
+		)
 	}
 
 	for _, kcgroup := range kcgroups {
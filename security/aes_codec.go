@@ -81,9 +81,15 @@ func NewAesCodec(conf *configuration.Config, args ...string) (*AesCodec, error)
 
 	var defaultCodec AesCodec
 
+	// the key named by encryption_key_secret takes precedence over the env
 	var enckeyB64 string
 	if len(args) > 0 {
 		enckeyB64 = args[0]
+	} else if secret, ok, err := common.ReadConfigSecret(conf, "webconfig.security.encryption_key"); ok {
+		if err != nil {
+			return &defaultCodec, common.NewError(err)
+		}
+		enckeyB64 = string(secret)
 	} else {
 		enckeyB64 = os.Getenv(envName)
 	}
@@ -19,9 +19,12 @@ package security
 
 import (
 	"encoding/base64"
+	"fmt"
 	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/go-akka/configuration"
 	"github.com/rdkcentral/webconfig/common"
 	"gotest.tools/assert"
 )
@@ -79,3 +82,33 @@ func TestNoKeyCodec(t *testing.T) {
 	assert.NilError(t, err)
 	assert.Equal(t, srcText, decrypted)
 }
+
+func TestSecretKeyCodec(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "webconfig_key"), []byte(GetRandomEncryptionKey()+"\n"), 0600)
+	assert.NilError(t, err)
+
+	conf := configuration.ParseString(fmt.Sprintf(`
+webconfig {
+    security.encryption_key_secret = "webconfig_key"
+    secret_provider {
+        type = "file"
+        file.base_dir = "%v"
+    }
+}`, dir))
+	codec, err := NewAesCodec(conf)
+	assert.NilError(t, err)
+	assert.Equal(t, len(codec.key), 16)
+
+	srcText := "helloworld"
+	encrypted, err := codec.Encrypt(srcText)
+	assert.NilError(t, err)
+	assert.Assert(t, encrypted != srcText)
+	decrypted, err := codec.Decrypt(encrypted)
+	assert.NilError(t, err)
+	assert.Equal(t, srcText, decrypted)
+
+	conf = configuration.ParseString(`webconfig.security.encryption_key_secret = "NO_SUCH_ENV"`)
+	_, err = NewAesCodec(conf)
+	assert.Assert(t, err != nil)
+}
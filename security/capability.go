@@ -0,0 +1,132 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package security
+
+import (
+	"strings"
+
+	"github.com/go-akka/configuration"
+)
+
+const (
+	CapabilityDocumentRead      = "webconfig:document:read"
+	CapabilityDocumentWrite     = "webconfig:document:write"
+	CapabilityDocumentDelete    = "webconfig:document:delete"
+	CapabilityPoke              = "webconfig:poke"
+	CapabilityRootDocumentRead  = "webconfig:rootdoc:read"
+	CapabilityRootDocumentWrite = "webconfig:rootdoc:write"
+	CapabilityReferenceRead     = "webconfig:reference:read"
+	CapabilityReferenceWrite    = "webconfig:reference:write"
+	CapabilityReferenceDelete   = "webconfig:reference:delete"
+	CapabilityConfigRead        = "webconfig:config:read"
+)
+
+const routeCapabilitiesConfigPath = "webconfig.jwt.api_token.route_capabilities"
+
+// defaultRouteCapabilities lists the api routes, by "METHOD path-template", of each capability.
+// The routes not listed require one of webconfig.jwt.api_token.capabilities.
+var defaultRouteCapabilities = map[string][]string{
+	CapabilityDocumentRead: {
+		"GET /api/v1/device/{mac}/document/{subdoc_id}",
+		"GET /api/v1/device/{mac}/supported_groups",
+		"GET /api/v1/device/{mac}/history",
+	},
+	CapabilityDocumentWrite: {
+		"POST /api/v1/device/{mac}/document/{subdoc_id}",
+		"POST /api/v1/device/{mac}/deployment",
+	},
+	CapabilityDocumentDelete: {
+		"DELETE /api/v1/device/{mac}/document/{subdoc_id}",
+		"DELETE /api/v1/device/{mac}/document",
+	},
+	CapabilityPoke: {
+		"POST /api/v1/device/{mac}/poke",
+		"GET /api/v1/pokes",
+		"GET /api/v1/pokes/{transaction_id}",
+	},
+	CapabilityRootDocumentRead: {
+		"GET /api/v1/device/{mac}/rootdocument",
+	},
+	CapabilityRootDocumentWrite: {
+		"POST /api/v1/device/{mac}/rootdocument",
+	},
+	CapabilityReferenceRead: {
+		"GET /api/v1/reference/{ref}/document",
+	},
+	CapabilityReferenceWrite: {
+		"POST /api/v1/reference/{ref}/document",
+	},
+	CapabilityReferenceDelete: {
+		"DELETE /api/v1/reference/{ref}/document",
+	},
+	CapabilityConfigRead: {
+		"GET /config",
+		"GET /config/sample_diff",
+		"GET /healthz/circuit_breakers",
+	},
+}
+
+// RouteCapabilities maps the api routes to the capability an api token needs to call them
+type RouteCapabilities struct {
+	routeMap map[string]string
+}
+
+// NewRouteCapabilities starts with the default mapping. A route listed under a capability in
+// webconfig.jwt.api_token.route_capabilities is moved to that capability.
+func NewRouteCapabilities(conf *configuration.Config) *RouteCapabilities {
+	routeMap := map[string]string{}
+	for capability, routes := range defaultRouteCapabilities {
+		for _, route := range routes {
+			routeMap[route] = capability
+		}
+	}
+
+	if conf != nil && conf.HasPath(routeCapabilitiesConfigPath) {
+		node := conf.GetNode(routeCapabilitiesConfigPath).GetObject()
+		for _, capability := range node.GetKeys() {
+			for _, route := range node.GetKey(capability).GetStringList() {
+				routeMap[normalizeRoute(route)] = capability
+			}
+		}
+	}
+	return &RouteCapabilities{
+		routeMap: routeMap,
+	}
+}
+
+func normalizeRoute(route string) string {
+	elements := strings.Fields(route)
+	if len(elements) != 2 {
+		return route
+	}
+	return strings.ToUpper(elements[0]) + " " + elements[1]
+}
+
+// Required returns the capability of a route, or "" if the route is not mapped
+func (c *RouteCapabilities) Required(method, pathTemplate string) string {
+	return c.routeMap[strings.ToUpper(method)+" "+pathTemplate]
+}
+
+// requiredApiCapabilities returns the capabilities of which an api token needs one. The full
+// access capabilities always qualify.
+func requiredApiCapabilities(capability string, fullCapabilities []string) []string {
+	if len(capability) == 0 {
+		return fullCapabilities
+	}
+	return append([]string{capability}, fullCapabilities...)
+}
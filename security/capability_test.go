@@ -0,0 +1,129 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package security
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+	"time"
+
+	"github.com/MicahParks/keyfunc/v2"
+	"github.com/go-akka/configuration"
+	"github.com/golang-jwt/jwt/v5"
+	"gotest.tools/assert"
+)
+
+func newTestApiToken(t *testing.T, key *rsa.PrivateKey, kid string, capabilities ...string) string {
+	claims := jwt.MapClaims{
+		"capabilities": capabilities,
+		"exp":          time.Now().Add(time.Hour).Unix(),
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	tokenStr, err := token.SignedString(key)
+	assert.NilError(t, err)
+	return tokenStr
+}
+
+func TestRouteCapabilities(t *testing.T) {
+	c := NewRouteCapabilities(configuration.ParseString(`webconfig.jwt.enabled = false`))
+	assert.Equal(t, c.Required("GET", "/api/v1/device/{mac}/document/{subdoc_id}"), CapabilityDocumentRead)
+	assert.Equal(t, c.Required("post", "/api/v1/device/{mac}/document/{subdoc_id}"), CapabilityDocumentWrite)
+	assert.Equal(t, c.Required("DELETE", "/api/v1/device/{mac}/document"), CapabilityDocumentDelete)
+	assert.Equal(t, c.Required("POST", "/api/v1/device/{mac}/poke"), CapabilityPoke)
+	assert.Equal(t, c.Required("POST", "/api/v1/device/{mac}/rootdocument"), CapabilityRootDocumentWrite)
+	assert.Equal(t, c.Required("POST", "/api/v1/reference/{ref}/document"), CapabilityReferenceWrite)
+	assert.Equal(t, c.Required("GET", "/config/sample_diff"), CapabilityConfigRead)
+	assert.Equal(t, c.Required("GET", "/healthz/circuit_breakers"), CapabilityConfigRead)
+	assert.Equal(t, c.Required("GET", "/api/v1/stuck_deployments"), "")
+
+	conf := configuration.ParseString(`
+webconfig.jwt.api_token.route_capabilities {
+    "webconfig:poke" = [
+        "post /api/v1/device/{mac}/document/{subdoc_id}",
+    ]
+    "webconfig:admin" = [
+        "GET /api/v1/stuck_deployments",
+    ]
+}`)
+	c = NewRouteCapabilities(conf)
+	assert.Equal(t, c.Required("POST", "/api/v1/device/{mac}/document/{subdoc_id}"), CapabilityPoke)
+	assert.Equal(t, c.Required("GET", "/api/v1/device/{mac}/document/{subdoc_id}"), CapabilityDocumentRead)
+	assert.Equal(t, c.Required("GET", "/api/v1/stuck_deployments"), "webconfig:admin")
+}
+
+func TestVerifyApiTokenCapability(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NilError(t, err)
+	kid := "test_key"
+
+	m := &TokenManager{
+		decodeKeys:      map[string]*VerificationKey{kid: {Key: &key.PublicKey, Algorithm: "RS256"}},
+		apiKids:         []string{kid},
+		apiCapabilities: []string{"webconfig:all"},
+		verifyFn:        VerifyToken,
+	}
+	jm := &JwksManager{
+		jwks: keyfunc.NewGiven(map[string]keyfunc.GivenKey{
+			kid: keyfunc.NewGivenRSA(&key.PublicKey, keyfunc.GivenKeyOptions{Algorithm: "RS256"}),
+		}),
+		apiCapabilities: []string{"webconfig:all"},
+	}
+	verifyFns := []func(string, string) (bool, error){
+		m.VerifyApiTokenCapability,
+		jm.VerifyApiTokenCapability,
+	}
+
+	fullToken := newTestApiToken(t, key, kid, "webconfig:all")
+	readToken := newTestApiToken(t, key, kid, CapabilityDocumentRead)
+	pokeToken := newTestApiToken(t, key, kid, CapabilityPoke, CapabilityDocumentRead)
+
+	for _, fn := range verifyFns {
+		// the full access token is good for all routes
+		ok, err := fn(fullToken, CapabilityDocumentWrite)
+		assert.NilError(t, err)
+		assert.Assert(t, ok)
+		ok, err = fn(fullToken, "")
+		assert.NilError(t, err)
+		assert.Assert(t, ok)
+
+		// a read only token
+		ok, err = fn(readToken, CapabilityDocumentRead)
+		assert.NilError(t, err)
+		assert.Assert(t, ok)
+		ok, _ = fn(readToken, CapabilityDocumentWrite)
+		assert.Assert(t, !ok)
+		ok, _ = fn(readToken, CapabilityDocumentDelete)
+		assert.Assert(t, !ok)
+
+		// the unmapped routes need the full access
+		ok, _ = fn(readToken, "")
+		assert.Assert(t, !ok)
+
+		ok, err = fn(pokeToken, CapabilityPoke)
+		assert.NilError(t, err)
+		assert.Assert(t, ok)
+	}
+
+	// no capability is checked by the token manager if none is configured
+	m.apiCapabilities = nil
+	ok, err := m.VerifyApiTokenCapability(readToken, CapabilityDocumentWrite)
+	assert.NilError(t, err)
+	assert.Assert(t, ok)
+}
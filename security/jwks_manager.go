@@ -31,7 +31,8 @@ import (
 )
 
 const (
-	defaultRefreshInterval = 86400
+	defaultRefreshInterval  = 86400
+	defaultRefreshRateLimit = 300
 )
 
 type JwksManager struct {
@@ -39,20 +40,56 @@ type JwksManager struct {
 	apiCapabilities []string
 }
 
+// CpeJwksManager verifies cpe tokens by the keys of the device token issuer, refreshed from its
+// jwks endpoint as the keys rotate
+type CpeJwksManager struct {
+	jwks            *keyfunc.JWKS
+	cpeKids         []string
+	cpeCapabilities []string
+}
+
 func NewJwksManager(conf *configuration.Config, ctx context.Context) (*JwksManager, error) {
-	jwksUrl := conf.GetString("webconfig.jwt.api_token.jwks_url")
+	jwks, err := getJwks(conf, ctx, "webconfig.jwt.api_token")
+	if err != nil {
+		return nil, common.NewError(err)
+	}
+
+	return &JwksManager{
+		jwks:            jwks,
+		apiCapabilities: conf.GetStringList("webconfig.jwt.api_token.capabilities"),
+	}, nil
+}
+
+func NewCpeJwksManager(conf *configuration.Config, ctx context.Context) (*CpeJwksManager, error) {
+	jwks, err := getJwks(conf, ctx, "webconfig.jwt.cpe_token")
+	if err != nil {
+		return nil, common.NewError(err)
+	}
+
+	return &CpeJwksManager{
+		jwks:            jwks,
+		cpeKids:         conf.GetStringList("webconfig.jwt.cpe_token.kids"),
+		cpeCapabilities: conf.GetStringList("webconfig.jwt.cpe_token.capabilities"),
+	}, nil
+}
+
+// getJwks fetches the jwks configured under the prefix. The keys are refreshed periodically and
+// when a token of an unknown kid is seen, no more often than the rate limit.
+func getJwks(conf *configuration.Config, ctx context.Context, prefix string) (*keyfunc.JWKS, error) {
+	jwksUrl := conf.GetString(prefix + ".jwks_url")
 	if len(jwksUrl) == 0 {
-		err := fmt.Errorf("empty webconfig.jwt.api_token.jwks_url")
+		err := fmt.Errorf("empty %v.jwks_url", prefix)
 		return nil, common.NewError(err)
 	}
 
-	refreshInterval := conf.GetInt32("webconfig.jwt.api_token.jwks_refresh_in_secs", defaultRefreshInterval)
+	refreshInterval := conf.GetInt32(prefix+".jwks_refresh_in_secs", defaultRefreshInterval)
+	refreshRateLimit := conf.GetInt32(prefix+".jwks_refresh_rate_limit_in_secs", defaultRefreshRateLimit)
 
 	options := keyfunc.Options{
 		Ctx:                 ctx,
 		RefreshErrorHandler: LogRefreshError,
 		RefreshInterval:     time.Duration(refreshInterval) * time.Second,
-		RefreshRateLimit:    time.Minute * 5,
+		RefreshRateLimit:    time.Duration(refreshRateLimit) * time.Second,
 		RefreshTimeout:      time.Second * 10,
 		RefreshUnknownKID:   true,
 	}
@@ -61,27 +98,30 @@ func NewJwksManager(conf *configuration.Config, ctx context.Context) (*JwksManag
 	if err != nil {
 		return nil, common.NewError(err)
 	}
-
-	return &JwksManager{
-		jwks:            jwks,
-		apiCapabilities: conf.GetStringList("webconfig.jwt.api_token.capabilities"),
-	}, nil
+	return jwks, nil
 }
 
 func (m *JwksManager) VerifyApiToken(tokenStr string) (bool, error) {
+	return m.VerifyApiTokenCapability(tokenStr, "")
+}
+
+// VerifyApiTokenCapability verifies an api token that holds the capability of a route or one of
+// the full access capabilities
+func (m *JwksManager) VerifyApiTokenCapability(tokenStr string, capability string) (bool, error) {
 	token, err := jwt.Parse(tokenStr, m.jwks.Keyfunc)
 	if err != nil {
 		return false, common.NewError(err)
 	}
 
 	// validate against capabilities
+	requiredCapabilities := requiredApiCapabilities(capability, m.apiCapabilities)
 	claims := token.Claims
 	if mclaims, ok := claims.(jwt.MapClaims); ok {
 		if itf, ok := mclaims["capabilities"]; ok {
 			if iitfs, ok := itf.([]interface{}); ok {
 				for _, iitf := range iitfs {
-					ss := iitf.(string)
-					if util.Contains(m.apiCapabilities, ss) {
+					ss, _ := iitf.(string)
+					if util.Contains(requiredCapabilities, ss) {
 						return true, nil
 					}
 				}
@@ -91,6 +131,41 @@ func (m *JwksManager) VerifyApiToken(tokenStr string) (bool, error) {
 	return false, common.NoCapabilitiesError{}
 }
 
+// VerifyCpeToken verifies a cpe token like TokenManager.VerifyCpeToken, with the keys from the
+// jwks. The kids are not restricted if webconfig.jwt.cpe_token.kids is empty, so the rotated keys
+// are accepted once the jwks serves them.
+func (m *CpeJwksManager) VerifyCpeToken(token string, mac string) (bool, string, int, error) {
+	isValidKid := func(kid string) bool {
+		return len(m.cpeKids) == 0 || util.Contains(m.cpeKids, kid)
+	}
+	if _, err := parseTokenKid(token, isValidKid, m.cpeCapabilities); err != nil {
+		return false, "", 0, common.NewError(err)
+	}
+	ok, partner, trust, err := verifyTokenClaims(token, m.jwks.Keyfunc, nil, mac)
+	if err != nil {
+		return ok, "", trust, common.NewError(err)
+	}
+	return ok, partner, trust, nil
+}
+
+// VerifiedClaims verifies a token by the keys from the jwks and returns its claims
+func (m *JwksManager) VerifiedClaims(tokenStr string) (jwt.MapClaims, error) {
+	return verifiedJwksClaims(m.jwks, tokenStr)
+}
+
+// VerifiedClaims verifies a token by the keys from the jwks and returns its claims
+func (m *CpeJwksManager) VerifiedClaims(tokenStr string) (jwt.MapClaims, error) {
+	return verifiedJwksClaims(m.jwks, tokenStr)
+}
+
+func verifiedJwksClaims(jwks *keyfunc.JWKS, tokenStr string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	if _, err := jwt.ParseWithClaims(tokenStr, claims, jwks.Keyfunc); err != nil {
+		return nil, common.NewError(err)
+	}
+	return claims, nil
+}
+
 func LogRefreshError(err error) {
 	fields := log.Fields{
 		"logger": "codebig",
@@ -0,0 +1,159 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package security
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-akka/configuration"
+	"github.com/golang-jwt/jwt/v5"
+	"gotest.tools/assert"
+)
+
+// testJwksServer serves the public keys of its current signing keys as a jwks
+type testJwksServer struct {
+	sync.Mutex
+	keys     map[string]*rsa.PrivateKey
+	requests int32
+}
+
+func (s *testJwksServer) setKey(kid string, key *rsa.PrivateKey) {
+	s.Lock()
+	defer s.Unlock()
+	s.keys[kid] = key
+}
+
+func (s *testJwksServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	atomic.AddInt32(&s.requests, 1)
+	s.Lock()
+	defer s.Unlock()
+
+	keys := []map[string]string{}
+	for kid, key := range s.keys {
+		keys = append(keys, map[string]string{
+			"kty": "RSA",
+			"kid": kid,
+			"alg": "RS256",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.PublicKey.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.PublicKey.E)).Bytes()),
+		})
+	}
+	bbytes, _ := json.Marshal(map[string]interface{}{"keys": keys})
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(bbytes)
+}
+
+func newTestCpeToken(t *testing.T, key *rsa.PrivateKey, kid string, mac string) string {
+	claims := jwt.MapClaims{
+		"mac":        mac,
+		"partner-id": "cox",
+		"trust":      1000,
+		"exp":        time.Now().Add(time.Hour).Unix(),
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	tokenStr, err := token.SignedString(key)
+	assert.NilError(t, err)
+	return tokenStr
+}
+
+func TestCpeJwksManager(t *testing.T) {
+	key1, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NilError(t, err)
+	key2, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NilError(t, err)
+	key3, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NilError(t, err)
+
+	js := &testJwksServer{keys: map[string]*rsa.PrivateKey{"device-k1": key1}}
+	ts := httptest.NewServer(js)
+	defer ts.Close()
+
+	conf := configuration.ParseString(fmt.Sprintf(`
+webconfig.jwt.cpe_token {
+    jwks_enabled = true
+    jwks_url = "%v"
+    jwks_refresh_rate_limit_in_secs = 3600
+}`, ts.URL))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m, err := NewCpeJwksManager(conf, ctx)
+	assert.NilError(t, err)
+	assert.Equal(t, atomic.LoadInt32(&js.requests), int32(1))
+
+	mac := "112233445566"
+
+	// ==== mac, partner and trust are verified like the key files ====
+	ok, partner, trust, err := m.VerifyCpeToken(newTestCpeToken(t, key1, "device-k1", mac), mac)
+	assert.NilError(t, err)
+	assert.Assert(t, ok)
+	assert.Equal(t, partner, "cox")
+	assert.Equal(t, trust, 1000)
+
+	ok, _, _, err = m.VerifyCpeToken(newTestCpeToken(t, key1, "device-k1", mac), "aabbccddeeff")
+	assert.Assert(t, !ok)
+	assert.Assert(t, err != nil)
+
+	// a token signed by another key under a known kid
+	ok, _, _, _ = m.VerifyCpeToken(newTestCpeToken(t, key2, "device-k1", mac), mac)
+	assert.Assert(t, !ok)
+
+	// ==== a rotated key is fetched by its unknown kid ====
+	js.setKey("device-k2", key2)
+	ok, _, _, err = m.VerifyCpeToken(newTestCpeToken(t, key2, "device-k2", mac), mac)
+	assert.NilError(t, err)
+	assert.Assert(t, ok)
+	assert.Equal(t, atomic.LoadInt32(&js.requests), int32(2))
+
+	// ==== unknown kids do not refresh again within the rate limit ====
+	js.setKey("device-k3", key3)
+	ok, _, _, _ = m.VerifyCpeToken(newTestCpeToken(t, key3, "device-k3", mac), mac)
+	assert.Assert(t, !ok)
+	assert.Equal(t, atomic.LoadInt32(&js.requests), int32(2))
+
+	// ==== the configured kids still restrict the jwks keys ====
+	conf = configuration.ParseString(fmt.Sprintf(`
+webconfig.jwt.cpe_token {
+    kids = ["device-k1"]
+    jwks_url = "%v"
+}`, ts.URL))
+	m, err = NewCpeJwksManager(conf, ctx)
+	assert.NilError(t, err)
+	ok, _, _, err = m.VerifyCpeToken(newTestCpeToken(t, key1, "device-k1", mac), mac)
+	assert.NilError(t, err)
+	assert.Assert(t, ok)
+	ok, _, _, _ = m.VerifyCpeToken(newTestCpeToken(t, key2, "device-k2", mac), mac)
+	assert.Assert(t, !ok)
+
+	// ==== the jwks url is required ====
+	_, err = NewCpeJwksManager(configuration.ParseString(`webconfig.jwt.cpe_token.jwks_enabled = true`), ctx)
+	assert.Assert(t, err != nil)
+}
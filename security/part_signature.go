@@ -0,0 +1,179 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package security
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/rdkcentral/webconfig/common"
+	"github.com/rdkcentral/webconfig/util"
+)
+
+// PartSignatureType is the typ of the detached jws of a multipart part
+const PartSignatureType = "webconfig-part+jws"
+
+// PartSignatureHeader is the protected header of a part signature. The name and the version of the
+// part are signed along with its payload, so a part cannot be replayed under another subdoc or version.
+type PartSignatureHeader struct {
+	Algorithm string `json:"alg"`
+	Kid       string `json:"kid"`
+	Type      string `json:"typ"`
+	Name      string `json:"name"`
+	Version   string `json:"version"`
+}
+
+// PartSigner signs the multipart parts by a detached jws, "<header>..<signature>", over the
+// protected header and the payload bytes. The key is looked up on every part, so a key reloaded
+// under the same kid signs from then on.
+type PartSigner struct {
+	kid string
+	key func() (*SigningKey, error)
+}
+
+func NewPartSigner(kid string, key *SigningKey) *PartSigner {
+	return &PartSigner{
+		kid: kid,
+		key: func() (*SigningKey, error) {
+			return key, nil
+		},
+	}
+}
+
+func (s *PartSigner) Kid() string {
+	return s.kid
+}
+
+func (s *PartSigner) SignPart(name string, version string, payload []byte) (string, error) {
+	key, err := s.key()
+	if err != nil {
+		return "", common.NewError(err)
+	}
+	header := PartSignatureHeader{
+		Algorithm: key.Algorithm,
+		Kid:       s.kid,
+		Type:      PartSignatureType,
+		Name:      name,
+		Version:   version,
+	}
+	hbytes, err := json.Marshal(header)
+	if err != nil {
+		return "", common.NewError(err)
+	}
+	encodedHeader := base64.RawURLEncoding.EncodeToString(hbytes)
+	signingString := encodedHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	sig, err := key.SigningMethod().Sign(signingString, key.Key)
+	if err != nil {
+		return "", common.NewError(err)
+	}
+	return encodedHeader + ".." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// PartSigner returns a signer by the private key of the kid. The key is read from the current keys
+// on each part, so the signer follows the reloads of the kid.
+func (m *TokenManager) PartSigner(kid string) (*PartSigner, error) {
+	key := func() (*SigningKey, error) {
+		encodeKeys, _ := m.keys()
+		key, ok := encodeKeys[kid]
+		if !ok {
+			return nil, fmt.Errorf("no private key of kid %v", kid)
+		}
+		return key, nil
+	}
+	if _, err := key(); err != nil {
+		return nil, common.NewError(err)
+	}
+	return &PartSigner{
+		kid: kid,
+		key: key,
+	}, nil
+}
+
+// VerificationKeys returns the public keys by kid
+func (m *TokenManager) VerificationKeys() map[string]*VerificationKey {
+	keys := map[string]*VerificationKey{}
+	_, decodeKeys := m.keys()
+	for kid, key := range decodeKeys {
+		keys[kid] = key
+	}
+	return keys
+}
+
+// VerifyPartSignature verifies the detached signature of a part by the key of its kid, and that
+// it was made for the name and the version of the part. It returns the kid.
+func VerifyPartSignature(mpart common.Multipart, keys map[string]*VerificationKey) (string, error) {
+	segments := strings.Split(mpart.Signature, ".")
+	if len(segments) != 3 || len(segments[1]) > 0 {
+		return "", common.NewError(fmt.Errorf("part %v has no detached signature", mpart.Name))
+	}
+	hbytes, err := base64.RawURLEncoding.DecodeString(segments[0])
+	if err != nil {
+		return "", common.NewError(err)
+	}
+	var header PartSignatureHeader
+	if err := json.Unmarshal(hbytes, &header); err != nil {
+		return "", common.NewError(err)
+	}
+	if header.Type != PartSignatureType {
+		return "", common.NewError(fmt.Errorf("part %v signature typ %q", mpart.Name, header.Type))
+	}
+	key, ok := keys[header.Kid]
+	if !ok {
+		return "", common.NewError(fmt.Errorf("part %v signed by unknown kid %v", mpart.Name, header.Kid))
+	}
+	// the algorithm is pinned by the key, never taken from the header alone
+	if header.Algorithm != key.Algorithm {
+		return "", common.NewError(fmt.Errorf("part %v signed by %v, kid %v expects %v", mpart.Name, header.Algorithm, header.Kid, key.Algorithm))
+	}
+	if header.Name != mpart.Name || header.Version != mpart.Version {
+		return "", common.NewError(fmt.Errorf("part %v version %v signed as %v version %v", mpart.Name, mpart.Version, header.Name, header.Version))
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(segments[2])
+	if err != nil {
+		return "", common.NewError(err)
+	}
+	signingString := segments[0] + "." + base64.RawURLEncoding.EncodeToString(mpart.Bytes)
+	if err := jwt.GetSigningMethod(key.Algorithm).Verify(signingString, sig, key.Key); err != nil {
+		return "", common.NewError(fmt.Errorf("part %v: %v", mpart.Name, err))
+	}
+	return header.Kid, nil
+}
+
+// VerifyMultipartSignatures parses a multipart response and verifies that every part is signed.
+// It returns the names of the verified parts.
+func VerifyMultipartSignatures(header http.Header, body []byte, keys map[string]*VerificationKey) ([]string, error) {
+	mparts, err := util.ParseMultipartAsList(header, body)
+	if err != nil {
+		return nil, common.NewError(err)
+	}
+	names := []string{}
+	for _, mpart := range mparts {
+		if _, err := VerifyPartSignature(mpart, keys); err != nil {
+			return nil, common.NewError(err)
+		}
+		names = append(names, mpart.Name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
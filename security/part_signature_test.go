@@ -0,0 +1,127 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package security
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-akka/configuration"
+	"github.com/rdkcentral/webconfig/common"
+	"github.com/rdkcentral/webconfig/util"
+	"gotest.tools/assert"
+)
+
+func TestPartSignatures(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NilError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NilError(t, err)
+
+	dir := t.TempDir()
+	rsaPublicKeyFile, rsaPrivateKeyFile := writeTestKeyFiles(t, dir, EncodingKeyId, rsaKey)
+	ecPublicKeyFile, ecPrivateKeyFile := writeTestKeyFiles(t, dir, "payload-es256", ecKey)
+	conf := configuration.ParseString(fmt.Sprintf(`
+webconfig.panic_exit_enabled = true
+webconfig.jwt.kid {
+    webconfig_key { public_key_file = "%v", private_key_file = "%v" }
+    payload-es256 { public_key_file = "%v", private_key_file = "%v" }
+}`, rsaPublicKeyFile, rsaPrivateKeyFile, ecPublicKeyFile, ecPrivateKeyFile))
+	m := NewTokenManager(conf)
+	keys := m.VerificationKeys()
+
+	mparts := []common.Multipart{
+		{Name: "lan", Version: "1234", Bytes: []byte("lan payload")},
+		{Name: "wan", Version: "5678", Bytes: []byte("wan payload")},
+	}
+	header := http.Header{}
+	header.Set(common.HeaderContentType, common.MultipartContentType)
+
+	for _, kid := range []string{EncodingKeyId, "payload-es256"} {
+		signer, err := m.PartSigner(kid)
+		assert.NilError(t, err)
+		bbytes, err := common.WriteMultipartBytes(mparts, signer)
+		assert.NilError(t, err)
+
+		names, err := VerifyMultipartSignatures(header, bbytes, keys)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, names, []string{"lan", "wan"})
+
+		parsed, err := util.ParseMultipartAsList(header, bbytes)
+		assert.NilError(t, err)
+		signedKid, err := VerifyPartSignature(parsed[0], keys)
+		assert.NilError(t, err)
+		assert.Equal(t, signedKid, kid)
+
+		// ==== a tampered payload, version or name is rejected ====
+		tampered := parsed[0]
+		tampered.Bytes = []byte("lan payloaD")
+		_, err = VerifyPartSignature(tampered, keys)
+		assert.Assert(t, err != nil)
+
+		tampered = parsed[0]
+		tampered.Version = "1235"
+		_, err = VerifyPartSignature(tampered, keys)
+		assert.Assert(t, err != nil)
+
+		// the signature of lan does not pass for wan
+		tampered = parsed[1]
+		tampered.Signature = parsed[0].Signature
+		_, err = VerifyPartSignature(tampered, keys)
+		assert.Assert(t, err != nil)
+
+		// ==== an unknown kid is rejected ====
+		_, err = VerifyPartSignature(parsed[0], map[string]*VerificationKey{})
+		assert.Assert(t, err != nil)
+	}
+
+	// ==== the parts without signatures are rejected ====
+	bbytes, err := common.WriteMultipartBytes(mparts)
+	assert.NilError(t, err)
+	_, err = VerifyMultipartSignatures(header, bbytes, keys)
+	assert.Assert(t, err != nil)
+
+	_, err = m.PartSigner("no-such-kid")
+	assert.Assert(t, err != nil)
+
+	// ==== a signer signs by the key rotated under its kid ====
+	signer, err := m.PartSigner("payload-es256")
+	assert.NilError(t, err)
+	newKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NilError(t, err)
+	writeTestKeyFiles(t, dir, "payload-es256", newKey)
+	later := time.Now().Add(time.Minute)
+	for _, fname := range []string{ecPublicKeyFile, ecPrivateKeyFile} {
+		err = os.Chtimes(fname, later, later)
+		assert.NilError(t, err)
+	}
+	m.ReloadKeys()
+	bbytes, err = common.WriteMultipartBytes(mparts, signer)
+	assert.NilError(t, err)
+	_, err = VerifyMultipartSignatures(header, bbytes, keys)
+	assert.Assert(t, err != nil)
+	_, err = VerifyMultipartSignatures(header, bbytes, m.VerificationKeys())
+	assert.NilError(t, err)
+}
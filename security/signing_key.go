@@ -0,0 +1,208 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package security
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"fmt"
+	"os"
+
+	"github.com/go-akka/configuration"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/rdkcentral/webconfig/common"
+)
+
+// VerificationKey is the public key of a kid, pinned to one algorithm. A token of the kid signed
+// by any other algorithm is rejected, so a key cannot be used as a different key type.
+type VerificationKey struct {
+	Key       crypto.PublicKey
+	Algorithm string
+}
+
+// SigningKey is the private key of a kid and the algorithm it signs with
+type SigningKey struct {
+	Key       crypto.PrivateKey
+	Algorithm string
+}
+
+func NewVerificationKey(key crypto.PublicKey, algorithm string) (*VerificationKey, error) {
+	if len(algorithm) == 0 {
+		algorithm = defaultAlgorithm(key)
+	}
+	if err := checkKeyAlgorithm(key, algorithm); err != nil {
+		return nil, common.NewError(err)
+	}
+	return &VerificationKey{
+		Key:       key,
+		Algorithm: algorithm,
+	}, nil
+}
+
+func NewSigningKey(key crypto.PrivateKey, algorithm string) (*SigningKey, error) {
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, common.NewError(fmt.Errorf("unsupported private key type %T", key))
+	}
+	if len(algorithm) == 0 {
+		algorithm = defaultAlgorithm(signer.Public())
+	}
+	if err := checkKeyAlgorithm(signer.Public(), algorithm); err != nil {
+		return nil, common.NewError(err)
+	}
+	return &SigningKey{
+		Key:       key,
+		Algorithm: algorithm,
+	}, nil
+}
+
+func (k *VerificationKey) Keyfunc(token *jwt.Token) (interface{}, error) {
+	return k.Key, nil
+}
+
+// ParserOptions pins the parser to the algorithm of the key
+func (k *VerificationKey) ParserOptions() []jwt.ParserOption {
+	return []jwt.ParserOption{jwt.WithValidMethods([]string{k.Algorithm})}
+}
+
+func (k *SigningKey) SigningMethod() jwt.SigningMethod {
+	return jwt.GetSigningMethod(k.Algorithm)
+}
+
+// defaultAlgorithm returns the algorithm of a key when its kid does not configure one
+func defaultAlgorithm(key crypto.PublicKey) string {
+	switch ty := key.(type) {
+	case *rsa.PublicKey:
+		return jwt.SigningMethodRS256.Alg()
+	case *ecdsa.PublicKey:
+		switch ty.Curve.Params().BitSize {
+		case 384:
+			return jwt.SigningMethodES384.Alg()
+		case 521:
+			return jwt.SigningMethodES512.Alg()
+		}
+		return jwt.SigningMethodES256.Alg()
+	case ed25519.PublicKey:
+		return jwt.SigningMethodEdDSA.Alg()
+	}
+	return ""
+}
+
+// checkKeyAlgorithm accepts the RS*, PS*, ES* and EdDSA algorithms for the keys of their types
+func checkKeyAlgorithm(key crypto.PublicKey, algorithm string) error {
+	method := jwt.GetSigningMethod(algorithm)
+	isMatched := false
+	switch mty := method.(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		_, isMatched = key.(*rsa.PublicKey)
+	case *jwt.SigningMethodECDSA:
+		if k, ok := key.(*ecdsa.PublicKey); ok {
+			isMatched = k.Curve.Params().BitSize == mty.CurveBits
+		}
+	case *jwt.SigningMethodEd25519:
+		_, isMatched = key.(ed25519.PublicKey)
+	default:
+		return fmt.Errorf("unsupported algorithm %q", algorithm)
+	}
+	if !isMatched {
+		return fmt.Errorf("algorithm %v does not match key type %T", algorithm, key)
+	}
+	return nil
+}
+
+func loadDecodeKey(keyfile string) (crypto.PublicKey, error) {
+	kbytes, err := os.ReadFile(keyfile)
+	if err != nil {
+		return nil, common.NewError(err)
+	}
+	return parseDecodeKey(kbytes, keyfile)
+}
+
+func parseDecodeKey(kbytes []byte, source string) (crypto.PublicKey, error) {
+	if key, err := jwt.ParseRSAPublicKeyFromPEM(kbytes); err == nil {
+		return key, nil
+	}
+	if key, err := jwt.ParseECPublicKeyFromPEM(kbytes); err == nil {
+		return key, nil
+	}
+	key, err := jwt.ParseEdPublicKeyFromPEM(kbytes)
+	if err != nil {
+		return nil, common.NewError(fmt.Errorf("unsupported public key in %v", source))
+	}
+	return key, nil
+}
+
+func loadEncodeKey(keyfile string) (crypto.PrivateKey, error) {
+	kbytes, err := os.ReadFile(keyfile)
+	if err != nil {
+		return nil, common.NewError(err)
+	}
+	return parseEncodeKey(kbytes, keyfile)
+}
+
+func parseEncodeKey(kbytes []byte, source string) (crypto.PrivateKey, error) {
+	if key, err := jwt.ParseRSAPrivateKeyFromPEM(kbytes); err == nil {
+		return key, nil
+	}
+	if key, err := jwt.ParseECPrivateKeyFromPEM(kbytes); err == nil {
+		return key, nil
+	}
+	key, err := jwt.ParseEdPrivateKeyFromPEM(kbytes)
+	if err != nil {
+		return nil, common.NewError(fmt.Errorf("unsupported private key in %v", source))
+	}
+	return key, nil
+}
+
+// loadConfigDecodeKey loads the public key named by <key>_secret, or else from <key>_file. ok is
+// false when neither is configured.
+func loadConfigDecodeKey(conf *configuration.Config, key string) (crypto.PublicKey, bool, error) {
+	if kbytes, ok, err := common.ReadConfigSecret(conf, key); ok {
+		if err != nil {
+			return nil, true, common.NewError(err)
+		}
+		dk, err := parseDecodeKey(kbytes, key+"_secret")
+		return dk, true, err
+	}
+	keyfile := conf.GetString(key + "_file")
+	if len(keyfile) == 0 {
+		return nil, false, nil
+	}
+	dk, err := loadDecodeKey(keyfile)
+	return dk, true, err
+}
+
+// loadConfigEncodeKey loads the private key named by <key>_secret, or else from <key>_file. ok is
+// false when neither is configured.
+func loadConfigEncodeKey(conf *configuration.Config, key string) (crypto.PrivateKey, bool, error) {
+	if kbytes, ok, err := common.ReadConfigSecret(conf, key); ok {
+		if err != nil {
+			return nil, true, common.NewError(err)
+		}
+		ek, err := parseEncodeKey(kbytes, key+"_secret")
+		return ek, true, err
+	}
+	keyfile := conf.GetString(key + "_file")
+	if len(keyfile) == 0 {
+		return nil, false, nil
+	}
+	ek, err := loadEncodeKey(keyfile)
+	return ek, true, err
+}
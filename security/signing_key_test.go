@@ -0,0 +1,255 @@
+/**
+* Copyright 2021 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+* SPDX-License-Identifier: Apache-2.0
+ */
+package security
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-akka/configuration"
+	"github.com/golang-jwt/jwt/v5"
+	"gotest.tools/assert"
+)
+
+// writeTestKeyFiles writes the pem files of a key pair and returns their paths
+func writeTestKeyFiles(t *testing.T, dir string, kid string, key crypto.Signer) (string, string) {
+	pkbytes, err := x509.MarshalPKCS8PrivateKey(key)
+	assert.NilError(t, err)
+	pubbytes, err := x509.MarshalPKIXPublicKey(key.Public())
+	assert.NilError(t, err)
+
+	privateKeyFile := filepath.Join(dir, kid+".pem")
+	publicKeyFile := filepath.Join(dir, kid+"_pub.pem")
+	err = os.WriteFile(privateKeyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkbytes}), 0600)
+	assert.NilError(t, err)
+	err = os.WriteFile(publicKeyFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubbytes}), 0600)
+	assert.NilError(t, err)
+	return publicKeyFile, privateKeyFile
+}
+
+func TestTokenManagerAlgorithms(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NilError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NilError(t, err)
+	ec384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	assert.NilError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NilError(t, err)
+
+	keys := map[string]crypto.Signer{
+		EncodingKeyId:  rsaKey,
+		"device-ps256": rsaKey,
+		"device-es256": ecKey,
+		"device-es384": ec384Key,
+		"device-eddsa": edKey,
+	}
+	algorithms := map[string]string{
+		"device-ps256": "PS256",
+	}
+	dir := t.TempDir()
+	lines := []string{}
+	for kid, key := range keys {
+		publicKeyFile, privateKeyFile := writeTestKeyFiles(t, dir, kid, key)
+		lines = append(lines, fmt.Sprintf(`%v { public_key_file = "%v", private_key_file = "%v", algorithm = "%v" }`,
+			kid, publicKeyFile, privateKeyFile, algorithms[kid]))
+	}
+	conf := configuration.ParseString(fmt.Sprintf(`
+webconfig.panic_exit_enabled = true
+webconfig.jwt {
+    cpe_token.kids = ["webconfig_key", "device-ps256", "device-es256", "device-es384", "device-eddsa"]
+    kid {
+        %v
+    }
+}`, strings.Join(lines, "\n        ")))
+	m := NewTokenManager(conf)
+	assert.DeepEqual(t, m.SigningKids(), []string{"device-eddsa", "device-es256", "device-es384", "device-ps256", EncodingKeyId})
+
+	// ==== each kid signs and verifies by its own algorithm ====
+	mac := "112233445566"
+	expected := map[string]string{
+		EncodingKeyId:  "RS256",
+		"device-ps256": "PS256",
+		"device-es256": "ES256",
+		"device-es384": "ES384",
+		"device-eddsa": "EdDSA",
+	}
+	for kid, alg := range expected {
+		token, err := m.GenerateWithKid(kid, mac, 86400, "cox", 500)
+		assert.NilError(t, err)
+		parsed, _, err := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{})
+		assert.NilError(t, err)
+		assert.Equal(t, parsed.Method.Alg(), alg)
+
+		ok, partner, trust, err := m.VerifyCpeToken(token, mac)
+		assert.NilError(t, err)
+		assert.Assert(t, ok)
+		assert.Equal(t, partner, "cox")
+		assert.Equal(t, trust, 500)
+	}
+	_, err = m.GenerateWithKid("no-such-kid", mac, 86400)
+	assert.Assert(t, err != nil)
+
+	// ==== a kid does not accept another algorithm, even of the same key ====
+	signAs := func(kid string, method jwt.SigningMethod, key interface{}) string {
+		claims := jwt.MapClaims{"mac": mac, "exp": time.Now().Add(time.Hour).Unix()}
+		token := jwt.NewWithClaims(method, claims)
+		token.Header["kid"] = kid
+		tokenStr, err := token.SignedString(key)
+		assert.NilError(t, err)
+		return tokenStr
+	}
+	ok, _, _, _ := m.VerifyCpeToken(signAs(EncodingKeyId, jwt.SigningMethodPS256, rsaKey), mac)
+	assert.Assert(t, !ok)
+	ok, _, _, _ = m.VerifyCpeToken(signAs("device-ps256", jwt.SigningMethodRS256, rsaKey), mac)
+	assert.Assert(t, !ok)
+
+	// an hmac token keyed by the public key is the classic algorithm confusion
+	pubbytes, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	assert.NilError(t, err)
+	pembytes := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubbytes})
+	ok, _, _, _ = m.VerifyCpeToken(signAs(EncodingKeyId, jwt.SigningMethodHS256, pembytes), mac)
+	assert.Assert(t, !ok)
+
+	ok, _, _, _ = m.VerifyCpeToken(signAs("device-es256", jwt.SigningMethodES384, ec384Key), mac)
+	assert.Assert(t, !ok)
+	ok, _, _, _ = m.VerifyCpeToken(signAs("device-es256", jwt.SigningMethodES256, ecKey), mac)
+	assert.Assert(t, ok)
+}
+
+func TestTokenManagerSecretKeys(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NilError(t, err)
+
+	// the mounted secrets are the same pem files, named by kid
+	dir := t.TempDir()
+	writeTestKeyFiles(t, dir, EncodingKeyId, ecKey)
+	conf := configuration.ParseString(fmt.Sprintf(`
+webconfig.panic_exit_enabled = true
+webconfig.secret_provider {
+    type = "dir"
+    dir.path = "%v"
+}
+webconfig.jwt.cpe_token.kids = ["webconfig_key"]
+webconfig.jwt.kid.webconfig_key {
+    public_key_secret = "webconfig_key_pub.pem"
+    private_key_secret = "webconfig_key.pem"
+}`, dir))
+	m := NewTokenManager(conf)
+
+	mac := "112233445566"
+	token, err := m.GenerateWithKid(EncodingKeyId, mac, 86400, "cox", 500)
+	assert.NilError(t, err)
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{})
+	assert.NilError(t, err)
+	assert.Equal(t, parsed.Method.Alg(), "ES256")
+	ok, partner, _, err := m.VerifyCpeToken(token, mac)
+	assert.NilError(t, err)
+	assert.Assert(t, ok)
+	assert.Equal(t, partner, "cox")
+
+	// ==== a rotated key is picked up by the next reload ====
+	newKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NilError(t, err)
+	publicKeyFile, privateKeyFile := writeTestKeyFiles(t, dir, EncodingKeyId, newKey)
+	later := time.Now().Add(time.Minute)
+	for _, fname := range []string{publicKeyFile, privateKeyFile} {
+		err = os.Chtimes(fname, later, later)
+		assert.NilError(t, err)
+	}
+	ok, _, _, err = m.VerifyCpeToken(token, mac)
+	assert.NilError(t, err)
+	assert.Assert(t, ok)
+
+	m.ReloadKeys()
+	ok, _, _, _ = m.VerifyCpeToken(token, mac)
+	assert.Assert(t, !ok)
+	newToken, err := m.GenerateWithKid(EncodingKeyId, mac, 86400, "cox", 500)
+	assert.NilError(t, err)
+	ok, _, _, err = m.VerifyCpeToken(newToken, mac)
+	assert.NilError(t, err)
+	assert.Assert(t, ok)
+
+	// ==== a key that fails to reload is kept ====
+	err = os.WriteFile(publicKeyFile, []byte("not a pem"), 0600)
+	assert.NilError(t, err)
+	m.ReloadKeys()
+	ok, _, _, err = m.VerifyCpeToken(newToken, mac)
+	assert.NilError(t, err)
+	assert.Assert(t, ok)
+
+	// ==== a key whose secret is removed is dropped ====
+	err = os.Remove(publicKeyFile)
+	assert.NilError(t, err)
+	m.ReloadKeys()
+	ok, _, _, _ = m.VerifyCpeToken(newToken, mac)
+	assert.Assert(t, !ok)
+	_, err = m.GenerateWithKid(EncodingKeyId, mac, 86400, "cox", 500)
+	assert.NilError(t, err)
+	err = os.Remove(privateKeyFile)
+	assert.NilError(t, err)
+	m.ReloadKeys()
+	_, err = m.GenerateWithKid(EncodingKeyId, mac, 86400, "cox", 500)
+	assert.Assert(t, err != nil)
+}
+
+func TestKeyAlgorithms(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NilError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NilError(t, err)
+	edPub, edKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NilError(t, err)
+
+	for _, alg := range []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512"} {
+		_, err = NewVerificationKey(&rsaKey.PublicKey, alg)
+		assert.NilError(t, err)
+	}
+	_, err = NewVerificationKey(&ecKey.PublicKey, "ES256")
+	assert.NilError(t, err)
+	_, err = NewVerificationKey(edPub, "EdDSA")
+	assert.NilError(t, err)
+
+	// mismatched or unsupported
+	_, err = NewVerificationKey(&rsaKey.PublicKey, "ES256")
+	assert.Assert(t, err != nil)
+	_, err = NewVerificationKey(&ecKey.PublicKey, "ES384")
+	assert.Assert(t, err != nil)
+	_, err = NewVerificationKey(&rsaKey.PublicKey, "HS256")
+	assert.Assert(t, err != nil)
+	_, err = NewVerificationKey(&rsaKey.PublicKey, "none")
+	assert.Assert(t, err != nil)
+	_, err = NewSigningKey(edKey, "RS256")
+	assert.Assert(t, err != nil)
+
+	sk, err := NewSigningKey(edKey, "")
+	assert.NilError(t, err)
+	assert.Equal(t, sk.Algorithm, "EdDSA")
+}
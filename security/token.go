@@ -18,12 +18,13 @@
 package security
 
 import (
-	"crypto/rsa"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
-	"os"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-akka/configuration"
@@ -31,10 +32,12 @@ import (
 	"github.com/google/uuid"
 	"github.com/rdkcentral/webconfig/common"
 	"github.com/rdkcentral/webconfig/util"
+	log "github.com/sirupsen/logrus"
 )
 
 const (
-	EncodingKeyId = "webconfig_key"
+	EncodingKeyId            = "webconfig_key"
+	defaultKeysRefreshInSecs = 60
 )
 
 type ThemisClaims struct {
@@ -48,91 +51,177 @@ type ThemisClaims struct {
 	jwt.RegisteredClaims
 }
 
-type VerifyFunc func(map[string]*rsa.PublicKey, []string, []string, ...string) (bool, string, int, error)
+type VerifyFunc func(map[string]*VerificationKey, []string, []string, ...string) (bool, string, int, error)
 
 type TokenManager struct {
-	encodeKey       *rsa.PrivateKey
-	decodeKeys      map[string]*rsa.PublicKey
-	apiKids         []string
-	apiCapabilities []string
-	cpeKids         []string
-	cpeCapabilities []string
-	verifyFn        VerifyFunc
+	encodeKeys          map[string]*SigningKey
+	decodeKeys          map[string]*VerificationKey
+	apiKids             []string
+	apiCapabilities     []string
+	cpeKids             []string
+	cpeCapabilities     []string
+	verifyFn            VerifyFunc
+	conf                *configuration.Config
+	keysRefreshInterval time.Duration
+	keysLock            sync.RWMutex
 }
 
 func NewTokenManager(conf *configuration.Config) *TokenManager {
 	panicExitEnabled := conf.GetBoolean("webconfig.panic_exit_enabled", false)
+	warnOrPanic := func(err error) {
+		if panicExitEnabled {
+			panic(err)
+		} else {
+			fmt.Printf("WARNING %v\n", err)
+		}
+	}
+
+	encodeKeys, decodeKeys := loadKeys(conf, func(kid string, private bool, err error) {
+		warnOrPanic(err)
+	})
+	if _, ok := encodeKeys[EncodingKeyId]; !ok {
+		warnOrPanic(fmt.Errorf("missing private key of kid %v", EncodingKeyId))
+	}
+
+	fn := VerifyToken
 
-	// prepare args for TokenManager
-	privateKeyFile := conf.GetString(fmt.Sprintf("webconfig.jwt.kid.%s.private_key_file", EncodingKeyId))
+	return &TokenManager{
+		encodeKeys:          encodeKeys,
+		decodeKeys:          decodeKeys,
+		apiKids:             conf.GetStringList("webconfig.jwt.api_token.kids"),
+		apiCapabilities:     conf.GetStringList("webconfig.jwt.api_token.capabilities"),
+		cpeKids:             conf.GetStringList("webconfig.jwt.cpe_token.kids"),
+		cpeCapabilities:     conf.GetStringList("webconfig.jwt.cpe_token.capabilities"),
+		verifyFn:            fn,
+		conf:                conf,
+		keysRefreshInterval: time.Duration(conf.GetInt32("webconfig.jwt.keys_refresh_in_secs", defaultKeysRefreshInSecs)) * time.Second,
+	}
+}
 
+// loadKeys reads the keys of the kids, the keys of a kid are pinned to its algorithm. A key that
+// fails to load is passed to onError with its kid and left out.
+func loadKeys(conf *configuration.Config, onError func(string, bool, error)) (map[string]*SigningKey, map[string]*VerificationKey) {
 	kids := conf.GetNode("webconfig.jwt.kid").GetObject().GetKeys()
-	decodeKeys := map[string]*rsa.PublicKey{}
+	decodeKeys := map[string]*VerificationKey{}
+	encodeKeys := map[string]*SigningKey{}
 	for _, kid := range kids {
-		keyfile := conf.GetString(fmt.Sprintf("webconfig.jwt.kid.%s.public_key_file", kid))
-		dk, err := loadDecodeKey(keyfile)
-		if err != nil {
-			if panicExitEnabled {
-				panic(err)
-			} else {
-				fmt.Printf("WARNING %v\n", err)
+		algorithm := conf.GetString(fmt.Sprintf("webconfig.jwt.kid.%s.algorithm", kid))
+
+		// the keys come from <key>_secret through the secret provider, or else from <key>_file
+		dk, ok, err := loadConfigDecodeKey(conf, fmt.Sprintf("webconfig.jwt.kid.%s.public_key", kid))
+		if ok {
+			if err == nil {
+				var vk *VerificationKey
+				if vk, err = NewVerificationKey(dk, algorithm); err == nil {
+					decodeKeys[kid] = vk
+				}
+			}
+			if err != nil {
+				onError(kid, false, err)
 			}
 		}
-		decodeKeys[kid] = dk
-	}
-
-	fn := VerifyToken
 
-	// load the private encoding key
-	encodeKey, err := loadEncodeKey(privateKeyFile)
-	if err != nil {
-		if panicExitEnabled {
-			panic(err)
-		} else {
-			fmt.Printf("WARNING %v\n", err)
+		// load the private encoding keys
+		ek, ok, err := loadConfigEncodeKey(conf, fmt.Sprintf("webconfig.jwt.kid.%s.private_key", kid))
+		if ok {
+			if err == nil {
+				var sk *SigningKey
+				if sk, err = NewSigningKey(ek, algorithm); err == nil {
+					encodeKeys[kid] = sk
+				}
+			}
+			if err != nil {
+				onError(kid, true, err)
+			}
 		}
 	}
+	return encodeKeys, decodeKeys
+}
 
-	return &TokenManager{
-		encodeKey:       encodeKey,
-		decodeKeys:      decodeKeys,
-		apiKids:         conf.GetStringList("webconfig.jwt.api_token.kids"),
-		apiCapabilities: conf.GetStringList("webconfig.jwt.api_token.capabilities"),
-		cpeKids:         conf.GetStringList("webconfig.jwt.cpe_token.kids"),
-		cpeCapabilities: conf.GetStringList("webconfig.jwt.cpe_token.capabilities"),
-		verifyFn:        fn,
-	}
+// keys returns the current keys, they are replaced by ReloadKeys
+func (m *TokenManager) keys() (map[string]*SigningKey, map[string]*VerificationKey) {
+	m.keysLock.RLock()
+	defer m.keysLock.RUnlock()
+	return m.encodeKeys, m.decodeKeys
 }
 
-func loadDecodeKey(keyfile string) (*rsa.PublicKey, error) {
-	kbytes, err := os.ReadFile(keyfile)
-	if err != nil {
-		return nil, common.NewError(err)
+// ReloadKeys reads the keys again from the secrets and the files, so a rotated key is picked up
+// without a restart. A key whose secret or file is gone is dropped, which revokes it. A key that
+// fails to load for another reason, like a secret store not responding, is kept.
+func (m *TokenManager) ReloadKeys() {
+	if m.conf == nil {
+		return
+	}
+	encodeKeys, decodeKeys := m.keys()
+	keptEncodeKids := map[string]bool{}
+	keptDecodeKids := map[string]bool{}
+	newEncodeKeys, newDecodeKeys := loadKeys(m.conf, func(kid string, private bool, err error) {
+		fields := log.Fields{
+			"logger":  "token",
+			"kid":     kid,
+			"private": private,
+		}
+		if common.IsSecretNotFound(err) {
+			log.WithFields(fields).Warn(common.NewError(fmt.Errorf("jwt key removed: %v", err)))
+			return
+		}
+		log.WithFields(fields).Error(common.NewError(fmt.Errorf("failed to reload jwt key, the last loaded one is kept: %v", err)))
+		if private {
+			keptEncodeKids[kid] = true
+		} else {
+			keptDecodeKids[kid] = true
+		}
+	})
+	for kid := range keptEncodeKids {
+		if k, ok := encodeKeys[kid]; ok {
+			newEncodeKeys[kid] = k
+		}
 	}
-	decodeKey, err := jwt.ParseRSAPublicKeyFromPEM(kbytes)
-	if err != nil {
-		return decodeKey, common.NewError(err)
+	for kid := range keptDecodeKids {
+		if k, ok := decodeKeys[kid]; ok {
+			newDecodeKeys[kid] = k
+		}
 	}
-	return decodeKey, nil
+
+	m.keysLock.Lock()
+	m.encodeKeys, m.decodeKeys = newEncodeKeys, newDecodeKeys
+	m.keysLock.Unlock()
 }
 
-func loadEncodeKey(keyfile string) (*rsa.PrivateKey, error) {
-	kbytes, err := os.ReadFile(keyfile)
-	if err != nil {
-		return nil, common.NewError(err)
-	}
-	encodeKey, err := jwt.ParseRSAPrivateKeyFromPEM(kbytes)
-	if err != nil {
-		return encodeKey, common.NewError(err)
+// RunKeysReloader reloads the keys every keys_refresh_in_secs until ctx is done, off the request
+// path since a reload can fetch the secrets from a secret store
+func (m *TokenManager) RunKeysReloader(ctx context.Context) {
+	if m.keysRefreshInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(m.keysRefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.ReloadKeys()
+		}
 	}
-	return encodeKey, nil
 }
 
 // TODO this is not an officially supported function.
 func (m *TokenManager) Generate(mac string, ttl int64, itfs ...interface{}) string {
+	tokenString, _ := m.GenerateWithKid(EncodingKeyId, mac, ttl, itfs...)
+	return tokenString
+}
+
+// GenerateWithKid signs a token by the private key of the kid, with the algorithm of the kid
+func (m *TokenManager) GenerateWithKid(kid string, mac string, ttl int64, itfs ...interface{}) (string, error) {
+	encodeKeys, _ := m.keys()
+	encodeKey, ok := encodeKeys[kid]
+	if !ok {
+		return "", common.NewError(fmt.Errorf("no private key of kid=%v", kid))
+	}
+
 	// %% NOTE mac should be lowercase to be consistent with reference doc
 	// static themis fields copied from examples in the webconfig confluence
-	kid := "webconfig_key"
 	serial := "ABCNDGE"
 	trust := 1000
 	capUuid := "1234567891234"
@@ -168,20 +257,29 @@ func (m *TokenManager) Generate(mac string, ttl int64, itfs ...interface{}) stri
 			Subject:   "client:supplied",
 		},
 	}
-	method := jwt.GetSigningMethod("RS256")
-
-	token := jwt.NewWithClaims(method, claims)
+	token := jwt.NewWithClaims(encodeKey.SigningMethod(), claims)
 	// %% note the default Header is { "alg": "RS256", "typ": "JWT" }
 	if _, ok := token.Header["typ"]; ok {
 		delete(token.Header, "typ")
 	}
 	token.Header["kid"] = kid
 
-	var tokenString string
-	if signedString, err := token.SignedString(m.encodeKey); err == nil {
-		tokenString = signedString
+	tokenString, err := token.SignedString(encodeKey.Key)
+	if err != nil {
+		return "", common.NewError(err)
+	}
+	return tokenString, nil
+}
+
+// SigningKids returns the kids that the token manager can sign with
+func (m *TokenManager) SigningKids() []string {
+	kids := []string{}
+	encodeKeys, _ := m.keys()
+	for kid := range encodeKeys {
+		kids = append(kids, kid)
 	}
-	return tokenString
+	sort.Strings(kids)
+	return kids
 }
 
 func PaddingB64(input string) string {
@@ -225,15 +323,114 @@ func ParseKidFromTokenHeader(tokenString string) (string, error) {
 }
 
 func (m *TokenManager) VerifyApiToken(token string) (bool, error) {
-	ok, _, _, err := m.verifyFn(m.decodeKeys, m.apiKids, m.apiCapabilities, token)
+	return m.VerifyApiTokenCapability(token, "")
+}
+
+// VerifyApiTokenCapability verifies an api token that holds the capability of a route or one of
+// the full access capabilities. No capability is checked if the full access ones are not configured.
+func (m *TokenManager) VerifyApiTokenCapability(token string, capability string) (bool, error) {
+	var requiredCapabilities []string
+	if len(m.apiCapabilities) > 0 {
+		requiredCapabilities = requiredApiCapabilities(capability, m.apiCapabilities)
+	}
+	_, decodeKeys := m.keys()
+	ok, _, _, err := m.verifyFn(decodeKeys, m.apiKids, requiredCapabilities, token)
 	if err != nil {
 		return ok, common.NewError(err)
 	}
-	return ok, err
+	return ok, nil
+}
+
+// ParseApiTokenPartnerIds reads the "partner-id" claim, a string or a list, of an api token
+// that is already verified. An empty list means the token is not scoped to any partner.
+func ParseApiTokenPartnerIds(tokenStr string) ([]string, error) {
+	parser := &jwt.Parser{}
+	claims := jwt.MapClaims{}
+	if _, _, err := parser.ParseUnverified(tokenStr, claims); err != nil {
+		return nil, common.NewError(err)
+	}
+
+	partnerIds := []string{}
+	switch ty := claims["partner-id"].(type) {
+	case string:
+		if len(ty) > 0 {
+			partnerIds = append(partnerIds, ty)
+		}
+	case []interface{}:
+		for _, itf := range ty {
+			if x, ok := itf.(string); ok && len(x) > 0 {
+				partnerIds = append(partnerIds, x)
+			}
+		}
+	}
+	return partnerIds, nil
+}
+
+// ParseApiTokenIdentity reads the subject, the kid and the capabilities of an api token for the
+// audit records. The token is expected to be verified already.
+func ParseApiTokenIdentity(tokenStr string) (string, string, []string, error) {
+	parser := &jwt.Parser{}
+	claims := jwt.MapClaims{}
+	token, _, err := parser.ParseUnverified(tokenStr, claims)
+	if err != nil {
+		return "", "", nil, common.NewError(err)
+	}
+
+	subject, _ := claims["sub"].(string)
+	kid, _ := token.Header["kid"].(string)
+	capabilities := []string{}
+	if itfs, ok := claims["capabilities"].([]interface{}); ok {
+		for _, itf := range itfs {
+			if x, ok := itf.(string); ok {
+				capabilities = append(capabilities, x)
+			}
+		}
+	}
+	return subject, kid, capabilities, nil
+}
+
+// ParseTokenRevocationClaims reads the jti, the mac and the issued time of a token to check it
+// against the revocations. The token is expected to be verified already.
+func ParseTokenRevocationClaims(tokenStr string) (string, string, int64, error) {
+	parser := &jwt.Parser{}
+	claims := jwt.MapClaims{}
+	if _, _, err := parser.ParseUnverified(tokenStr, claims); err != nil {
+		return "", "", 0, common.NewError(err)
+	}
+
+	// the issue time is the iat, or the nbf if the token has no iat, 0 if it has neither
+	jti, _ := claims["jti"].(string)
+	mac, _ := claims["mac"].(string)
+	var iat int64
+	if itf, ok := claims["iat"]; ok {
+		iat = int64(util.ToInt(itf))
+	} else if itf, ok := claims["nbf"]; ok {
+		iat = int64(util.ToInt(itf))
+	}
+	return jti, mac, iat, nil
+}
+
+// VerifiedClaims verifies a token by the key of its kid, of any token type, and returns its claims
+func (m *TokenManager) VerifiedClaims(tokenStr string) (jwt.MapClaims, error) {
+	kid, err := ParseKidFromTokenHeader(tokenStr)
+	if err != nil {
+		return nil, common.NewError(err)
+	}
+	_, decodeKeys := m.keys()
+	decodeKey, ok := decodeKeys[kid]
+	if !ok {
+		return nil, common.NewError(fmt.Errorf("key object missing, kid=%v", kid))
+	}
+	claims := jwt.MapClaims{}
+	if _, err := jwt.ParseWithClaims(tokenStr, claims, decodeKey.Keyfunc, decodeKey.ParserOptions()...); err != nil {
+		return nil, common.NewError(err)
+	}
+	return claims, nil
 }
 
 func (m *TokenManager) VerifyCpeToken(token string, mac string) (bool, string, int, error) {
-	ok, partner, trust, err := m.verifyFn(m.decodeKeys, m.cpeKids, m.cpeCapabilities, token, mac)
+	_, decodeKeys := m.keys()
+	ok, partner, trust, err := m.verifyFn(decodeKeys, m.cpeKids, m.cpeCapabilities, token, mac)
 	if err != nil {
 		return ok, "", trust, common.NewError(err)
 	}
@@ -263,7 +460,8 @@ func (m *TokenManager) ParseCpeToken(tokenStr string) (map[string]string, error)
 	if !util.Contains(m.cpeKids, kid) {
 		return nil, common.NewError(fmt.Errorf("token kid=%v, not in validKids=%v", kid, m.cpeKids))
 	}
-	decodeKey, ok := m.decodeKeys[kid]
+	_, decodeKeys := m.keys()
+	decodeKey, ok := decodeKeys[kid]
 	if !ok {
 		return nil, common.NewError(fmt.Errorf("key object missing, kid=%v", kid))
 	}
@@ -271,7 +469,7 @@ func (m *TokenManager) ParseCpeToken(tokenStr string) (map[string]string, error)
 	// capabilities check is skipped for now
 
 	claims := jwt.MapClaims{}
-	token, err = jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) { return decodeKey, nil })
+	token, err = jwt.ParseWithClaims(tokenStr, claims, decodeKey.Keyfunc, decodeKey.ParserOptions()...)
 	if err != nil {
 		return nil, common.NewError(err)
 	}
@@ -294,76 +492,80 @@ func (m *TokenManager) ParseCpeToken(tokenStr string) (map[string]string, error)
 	return data, nil
 }
 
-func VerifyToken(decodeKeys map[string]*rsa.PublicKey, validKids []string, requiredCapabilities []string, vargs ...string) (bool, string, int, error) {
+func VerifyToken(decodeKeys map[string]*VerificationKey, validKids []string, requiredCapabilities []string, vargs ...string) (bool, string, int, error) {
 	tokenString := vargs[0]
-	var kid string
 	var trust int
 
+	isValidKid := func(kid string) bool {
+		return util.Contains(validKids, kid)
+	}
+	kid, err := parseTokenKid(tokenString, isValidKid, requiredCapabilities)
+	if err != nil {
+		return false, "", trust, common.NewError(err)
+	}
+
+	decodeKey, ok := decodeKeys[kid]
+	if !ok {
+		return false, "", trust, common.NewError(fmt.Errorf("key object missing, kid=%v", kid))
+	}
+
+	return verifyTokenClaims(tokenString, decodeKey.Keyfunc, decodeKey.ParserOptions(), vargs[1:]...)
+}
+
+// parseTokenKid reads the kid of a token before it is verified, and checks the kid and the
+// capabilities. The capabilities are checked if requiredCapabilities is nonempty.
+func parseTokenKid(tokenString string, isValidKid func(string) bool, requiredCapabilities []string) (string, error) {
 	parser := &jwt.Parser{}
 
 	// this is the claims before the token is verified by the public key
 	uclaims := jwt.MapClaims{}
-	if token, _, err := parser.ParseUnverified(tokenString, uclaims); err == nil {
-		// check kid
-		rawkid, ok := token.Header["kid"]
-		if !ok {
-			return false, "", trust, common.NewError(fmt.Errorf("missing kid in token"))
-		}
-		kid, ok = rawkid.(string)
-		if !ok {
-			return false, "", trust, common.NewError(fmt.Errorf("error in reading kid from header"))
-		}
+	token, _, err := parser.ParseUnverified(tokenString, uclaims)
+	if err != nil {
+		return "", common.NewError(err)
+	}
 
-		ok = false
-		for _, k := range validKids {
-			if kid == k {
-				ok = true
-				break
-			}
-		}
-		if !ok {
-			return false, "", trust, common.NewError(fmt.Errorf("token kid=%v, not in validKids=%v", kid, validKids))
-		}
+	// check kid
+	rawkid, ok := token.Header["kid"]
+	if !ok {
+		return "", common.NewError(fmt.Errorf("missing kid in token"))
+	}
+	kid, ok := rawkid.(string)
+	if !ok {
+		return "", common.NewError(fmt.Errorf("error in reading kid from header"))
+	}
+	if !isValidKid(kid) {
+		return "", common.NewError(fmt.Errorf("token kid=%v, not valid", kid))
+	}
 
-		// check capabilities, if requiredCapabilities is nonempty
-		if len(requiredCapabilities) > 0 {
-			isCapable := false
-			if capitfs, ok := uclaims["capabilities"]; ok {
-				capvalues, ok1 := capitfs.([]interface{})
-				if ok1 {
-					for _, capvalue := range capvalues {
-						for _, rc := range requiredCapabilities {
-							if rc == capvalue {
-								isCapable = true
-								break
-							}
-						}
-						if isCapable {
-							break
-						}
-					}
+	// check capabilities, if requiredCapabilities is nonempty
+	if len(requiredCapabilities) > 0 {
+		isCapable := false
+		if capvalues, ok := uclaims["capabilities"].([]interface{}); ok {
+			for _, capvalue := range capvalues {
+				if x, ok := capvalue.(string); ok && util.Contains(requiredCapabilities, x) {
+					isCapable = true
+					break
 				}
 			}
-			if !isCapable {
-				return false, "", trust, common.NewError(fmt.Errorf("token without proper capabilities"))
-			}
 		}
-	} else {
-		return false, "", trust, common.NewError(err)
-	}
-
-	decodeKey, ok := decodeKeys[kid]
-	if !ok {
-		return false, "", trust, common.NewError(fmt.Errorf("key object missing, kid=%v", kid))
+		if !isCapable {
+			return "", common.NewError(fmt.Errorf("token without proper capabilities"))
+		}
 	}
+	return kid, nil
+}
 
+// verifyTokenClaims verifies a token by the key from keyFunc, and returns its partner and trust.
+// The mac, if given, must match the mac claim.
+func verifyTokenClaims(tokenString string, keyFunc jwt.Keyfunc, opts []jwt.ParserOption, vargs ...string) (bool, string, int, error) {
+	var trust int
 	claims := jwt.MapClaims{}
-	if _, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) { return decodeKey, nil }); err != nil {
+	if _, err := jwt.ParseWithClaims(tokenString, claims, keyFunc, opts...); err != nil {
 		return false, "", trust, common.NewError(err)
 	}
 
-	if len(vargs) > 1 {
-		mac := vargs[1]
+	if len(vargs) > 0 {
+		mac := vargs[0]
 		// mac must match
 		isMatched := false
 		if macitf, ok := claims["mac"]; ok {
@@ -380,10 +582,10 @@ func VerifyToken(decodeKeys map[string]*rsa.PublicKey, validKids []string, requi
 		}
 	}
 
-	// parse partner
+	// parse partner, api tokens can carry a list of partners
 	partner := "comcast"
-	if itf, ok := claims["partner-id"]; ok {
-		partner = itf.(string)
+	if x, ok := claims["partner-id"].(string); ok {
+		partner = x
 	}
 
 	if itf, ok := claims["trust"]; ok {
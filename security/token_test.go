@@ -23,6 +23,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/rdkcentral/webconfig/common"
 	"github.com/rdkcentral/webconfig/util"
 	"gotest.tools/assert"
@@ -86,3 +87,32 @@ func TestTokenValidation(t *testing.T) {
 	assert.Equal(t, parsedPartner, partner1)
 	assert.Equal(t, trust, 500)
 }
+
+func TestTokenRevocationClaims(t *testing.T) {
+	newToken := func(claims jwt.MapClaims) string {
+		tokenStr, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("secret"))
+		assert.NilError(t, err)
+		return tokenStr
+	}
+	cpeMac := util.GenerateRandomCpeMac()
+	revocation := &common.TokenRevocation{CpeMac: cpeMac, IssuedBefore: 2000}
+
+	// the iat is preferred over the nbf
+	_, mac, iat, err := ParseTokenRevocationClaims(newToken(jwt.MapClaims{"mac": cpeMac, "iat": 3000, "nbf": 1000}))
+	assert.NilError(t, err)
+	assert.Equal(t, mac, cpeMac)
+	assert.Equal(t, iat, int64(3000))
+	assert.Assert(t, !revocation.Revokes("", iat))
+
+	// a token without iat is judged by its nbf
+	_, _, iat, err = ParseTokenRevocationClaims(newToken(jwt.MapClaims{"mac": cpeMac, "nbf": 3000}))
+	assert.NilError(t, err)
+	assert.Equal(t, iat, int64(3000))
+	assert.Assert(t, !revocation.Revokes("", iat))
+
+	// a token with neither is revoked
+	_, _, iat, err = ParseTokenRevocationClaims(newToken(jwt.MapClaims{"mac": cpeMac}))
+	assert.NilError(t, err)
+	assert.Equal(t, iat, int64(0))
+	assert.Assert(t, revocation.Revokes("", iat))
+}
@@ -78,9 +78,10 @@ func ParseMultipartAsList(header http.Header, bbytes []byte) ([]common.Multipart
 			}
 
 			mpart := common.Multipart{
-				Bytes:   bbytes,
-				Version: p.Header.Get("Etag"),
-				Name:    subdocId,
+				Bytes:     bbytes,
+				Version:   p.Header.Get("Etag"),
+				Name:      subdocId,
+				Signature: p.Header.Get(common.HeaderSubdocumentSignature),
 			}
 			mparts = append(mparts, mpart)
 		}